@@ -264,7 +264,9 @@ func (a *goBlog) apHandleInbox(w http.ResponseWriter, r *http.Request) {
 			// Check if comment exists
 			exists, commentId, err := a.db.commentIdByOriginal(activity.Object.GetLink().String())
 			if err == nil && exists {
-				_ = a.db.deleteComment(commentId)
+				if comments, err := a.db.getComments(&commentsRequestConfig{id: commentId}); err == nil && len(comments) > 0 {
+					_ = a.deleteComment(blog, comments[0])
+				}
 				_ = a.db.deleteWebmentionUUrl(activity.Object.GetLink().String())
 			}
 		}
@@ -304,7 +306,11 @@ func (a *goBlog) apOnCreateUpdate(blog *configBlog, requestActor *ap.Actor, acti
 			}
 			content := object.Content.First().Value.String()
 			if visible {
-				_, _, _ = a.createComment(blog, replyTarget, content, name, website, original)
+				var status commentStatus
+				if a.isSpam(commentSpamText(name, website, content), "") {
+					status = commentStatusSpam
+				}
+				_, _, _, _ = a.createComment(blog, replyTarget, content, name, website, original, 0, status)
 				return
 			} else {
 				buf := bufferpool.Get()
@@ -470,6 +476,47 @@ func (a *goBlog) apDelete(p *post) {
 	a.apSendToAllFollowers(p.Blog, d, append(p.Parameters[activityPubMentionsParameter], p.firstParameter(activityPubReplyActorParameter))...)
 }
 
+// Sends a reply comment to the author of the ActivityPub comment it replies to
+func (a *goBlog) apReplyToComment(bc *configBlog, replyPath string, parent *comment) {
+	_, id, ok := a.localCommentID(a.getFullAddress(replyPath))
+	if !ok {
+		return
+	}
+	replies, err := a.db.getComments(&commentsRequestConfig{id: id})
+	if err != nil || len(replies) < 1 {
+		return
+	}
+	// Get the author of the original note
+	item, err := a.apHttpClients[bc.name].LoadIRI(ap.IRI(parent.Original))
+	if err != nil || item == nil || !ap.IsObject(item) {
+		log.Println("Failed to load ActivityPub object of comment:", parent.Original)
+		return
+	}
+	obj, err := ap.ToObject(item)
+	if err != nil || obj == nil || obj.AttributedTo == nil || obj.AttributedTo.GetLink() == "" {
+		return
+	}
+	actor := obj.AttributedTo.GetLink()
+	// Create note
+	note := ap.ObjectNew(ap.NoteType)
+	note.ID = ap.IRI(a.getFullAddress(replyPath))
+	note.URL = note.ID
+	note.AttributedTo = a.apAPIri(bc)
+	note.InReplyTo = ap.IRI(parent.Original)
+	note.To.Append(ap.PublicNS, a.apGetFollowersCollectionId(bc.name, bc))
+	note.CC.Append(actor)
+	apMention := ap.MentionNew(actor)
+	apMention.Href = actor
+	note.Tag.Append(apMention)
+	note.MediaType = ap.MimeType(contenttype.HTML)
+	note.Content.Add(ap.DefaultLangRef("<p>" + replies[0].Comment + "</p>")) // Already escaped
+	note.Published = time.Now()
+	c := ap.CreateNew(a.apNewID(bc), note)
+	c.Actor = a.apAPIri(bc)
+	c.Published = time.Now()
+	a.apSendToAllFollowers(bc.name, c, actor.String())
+}
+
 func (a *goBlog) apUndelete(p *post) {
 	// The optimal way to do this would be to send a "Undo Delete" activity,
 	// but that doesn't work with Mastodon yet.
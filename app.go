@@ -4,6 +4,8 @@ import (
 	"crypto/rsa"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	shutdowner "git.jlel.se/jlelse/go-shutdowner"
 	ts "git.jlel.se/jlelse/template-strings"
@@ -43,6 +45,13 @@ type goBlog struct {
 	blogStatsCacheGroup singleflight.Group
 	// Cache
 	cache *cache
+	// Render version (see renderVersion)
+	renderVersionInit sync.Once
+	renderVersionSeed string
+	settingsVersion   atomic.Int64
+	// Comment sign in
+	commentSignInEmailsInit    sync.Once
+	commentSignInEmailsLimiter *rateLimiter
 	// Config
 	cfg *config
 	// Database
@@ -57,8 +66,9 @@ type goBlog struct {
 	pDeleteHooks   []postHookFunc
 	pUndeleteHooks []postHookFunc
 	hourlyHooks    []hourlyHookFunc
-	// HTTP Client
-	httpClient *http.Client
+	// HTTP Clients
+	httpClient       *http.Client
+	publicHttpClient *http.Client // For URLs from untrusted sources
 	// HTTP Routers
 	d http.Handler
 	// IndexNow
@@ -71,10 +81,11 @@ type goBlog struct {
 	// Markdown
 	md, absoluteMd, titleMd goldmark.Markdown
 	// Media
-	compressorsInit  sync.Once
-	compressors      []mediaCompression
-	mediaStorageInit sync.Once
-	mediaStorage     mediaStorage
+	compressorsInit     sync.Once
+	compressors         []mediaCompression
+	mediaStorageInit    sync.Once
+	mediaStorage        mediaStorage
+	mediaStorageBackend string
 	// Microformats
 	mfInit  sync.Once
 	mfCache *ristretto.Cache
@@ -89,12 +100,21 @@ type goBlog struct {
 	reactionsInit  sync.Once
 	reactionsCache *ristretto.Cache
 	reactionsSfg   singleflight.Group
+	// Image variants
+	imageVariantsCacheInit sync.Once
+	imageVariantsCache     *ristretto.Cache
+	// Rate limiting
+	rateLimitInit sync.Once
+	rateLimiters  map[string]*rateLimiter
 	// Regex Redirects
 	regexRedirects []*regexRedirect
 	// Sessions
-	loginSessions, captchaSessions *dbSessionStore
+	loginSessions, captchaSessions, commenterSessions *dbSessionStore
 	// Shutdown
 	shutdown shutdowner.Shutdowner
+	// Spam filter
+	spamClientsMutex sync.Mutex
+	spamClients      map[string]time.Time
 	// Template strings
 	ts *ts.TemplateStrings
 	// Tor
@@ -31,14 +31,22 @@ func (a *goBlog) serveBlogroll(w http.ResponseWriter, r *http.Request) {
 	}
 	c := bc.Blogroll
 	can := bc.getRelativePath(defaultIfEmpty(c.Path, defaultBlogrollPath))
+	brd := &blogrollRenderData{
+		title:       c.Title,
+		description: c.Description,
+		outlines:    outlines.([]*opml.Outline),
+		download:    can + ".opml",
+	}
+	if c.Latest {
+		brd.latest = a.getBlogrollLatestEntries(brd.outlines)
+		brd.latestPath = can + blogrollLatestPath
+	}
+	if !c.remote() {
+		brd.icons = a.getBlogrollIcons(blog)
+	}
 	a.render(w, r, a.renderBlogroll, &renderData{
 		Canonical: a.getFullAddress(can),
-		Data: &blogrollRenderData{
-			title:       c.Title,
-			description: c.Description,
-			outlines:    outlines.([]*opml.Outline),
-			download:    can + ".opml",
-		},
+		Data:      brd,
 	})
 }
 
@@ -67,6 +75,14 @@ func (a *goBlog) serveBlogrollExport(w http.ResponseWriter, r *http.Request) {
 func (a *goBlog) getBlogrollOutlines(blog string) ([]*opml.Outline, error) {
 	// Get config
 	config := a.cfg.Blogs[blog].Blogroll
+	// Use the blogroll from the database if no remote OPML is configured
+	if !config.remote() {
+		items, err := a.db.getBlogrollItems(blog)
+		if err != nil {
+			return nil, err
+		}
+		return filterAndSortOutlines(blogrollItemsToOutlines(items), config.Categories), nil
+	}
 	// Check cache
 	if cache := a.db.loadOutlineCache(blog); cache != nil {
 		return cache, nil
@@ -86,26 +102,33 @@ func (a *goBlog) getBlogrollOutlines(blog string) ([]*opml.Outline, error) {
 		return nil, err
 	}
 	// Filter and sort
-	outlines := o.Outlines
-	if len(config.Categories) > 0 {
-		filtered := []*opml.Outline{}
-		for _, category := range config.Categories {
-			if outline, ok := lo.Find(outlines, func(outline *opml.Outline) bool {
-				return outline.Title == category || outline.Text == category
-			}); ok && outline != nil {
-				outline.Outlines = sortOutlines(outline.Outlines)
-				filtered = append(filtered, outline)
-			}
-		}
-		outlines = filtered
-	} else {
-		outlines = sortOutlines(outlines)
-	}
+	outlines := filterAndSortOutlines(o.Outlines, config.Categories)
 	// Cache
 	a.db.cacheOutlines(blog, outlines)
 	return outlines, nil
 }
 
+// Checks if the blogroll uses a remote OPML file instead of the database
+func (c *configBlogroll) remote() bool {
+	return c.Opml != ""
+}
+
+func filterAndSortOutlines(outlines []*opml.Outline, categories []string) []*opml.Outline {
+	if len(categories) == 0 {
+		return sortOutlines(outlines)
+	}
+	filtered := []*opml.Outline{}
+	for _, category := range categories {
+		if outline, ok := lo.Find(outlines, func(outline *opml.Outline) bool {
+			return outline.Title == category || outline.Text == category
+		}); ok && outline != nil {
+			outline.Outlines = sortOutlines(outline.Outlines)
+			filtered = append(filtered, outline)
+		}
+	}
+	return filtered
+}
+
 func (db *database) cacheOutlines(blog string, outlines []*opml.Outline) {
 	opmlBuffer := bufferpool.Get()
 	_ = opml.Render(opmlBuffer, &opml.OPML{
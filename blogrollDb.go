@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/url"
+
+	"github.com/kaorimatz/go-opml"
+)
+
+type blogrollItem struct {
+	ID       int
+	Category string
+	Title    string
+	URL      string
+	Feed     string
+	Icon     string
+}
+
+func (db *database) getBlogrollItems(blog string) ([]*blogrollItem, error) {
+	rows, err := db.Query("select id, category, title, url, feed, icon from blogroll where blog = @blog order by category, lower(title)", sql.Named("blog", blog))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*blogrollItem{}
+	for rows.Next() {
+		i := &blogrollItem{}
+		if err = rows.Scan(&i.ID, &i.Category, &i.Title, &i.URL, &i.Feed, &i.Icon); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func (db *database) createBlogrollItem(blog string, i *blogrollItem) error {
+	_, err := db.Exec(
+		"insert into blogroll (blog, category, title, url, feed, icon) values (@blog, @category, @title, @url, @feed, @icon)",
+		sql.Named("blog", blog), sql.Named("category", i.Category), sql.Named("title", i.Title),
+		sql.Named("url", i.URL), sql.Named("feed", i.Feed), sql.Named("icon", i.Icon),
+	)
+	return err
+}
+
+func (db *database) updateBlogrollItem(blog string, i *blogrollItem) error {
+	_, err := db.Exec(
+		"update blogroll set category = @category, title = @title, url = @url, feed = @feed, icon = @icon where blog = @blog and id = @id",
+		sql.Named("blog", blog), sql.Named("id", i.ID), sql.Named("category", i.Category), sql.Named("title", i.Title),
+		sql.Named("url", i.URL), sql.Named("feed", i.Feed), sql.Named("icon", i.Icon),
+	)
+	return err
+}
+
+func (db *database) deleteBlogrollItem(blog string, id int) error {
+	_, err := db.Exec("delete from blogroll where blog = @blog and id = @id", sql.Named("blog", blog), sql.Named("id", id))
+	return err
+}
+
+// Returns the icons of the blogroll items, mapped by the key of the outline
+func (a *goBlog) getBlogrollIcons(blog string) map[string]string {
+	items, err := a.db.getBlogrollItems(blog)
+	if err != nil {
+		log.Println("Failed to get blogroll icons:", err.Error())
+		return nil
+	}
+	icons := map[string]string{}
+	for _, i := range items {
+		if i.Icon != "" {
+			icons[defaultIfEmpty(i.URL, i.Feed)] = i.Icon
+		}
+	}
+	return icons
+}
+
+func blogrollOutlineKey(o *opml.Outline) string {
+	return defaultIfEmpty(htmlURLString(o.HTMLURL), htmlURLString(o.XMLURL))
+}
+
+// Converts the blogroll items to outlines, one outline per category
+func blogrollItemsToOutlines(items []*blogrollItem) []*opml.Outline {
+	outlines := []*opml.Outline{}
+	categories := map[string]*opml.Outline{}
+	for _, i := range items {
+		category, ok := categories[i.Category]
+		if !ok {
+			category = &opml.Outline{Text: i.Category, Title: i.Category}
+			categories[i.Category] = category
+			outlines = append(outlines, category)
+		}
+		outline := &opml.Outline{Text: i.Title, Title: i.Title}
+		if i.Feed != "" {
+			outline.Type = "rss"
+			outline.XMLURL, _ = url.Parse(i.Feed)
+		}
+		if i.URL != "" {
+			outline.HTMLURL, _ = url.Parse(i.URL)
+		}
+		category.Outlines = append(category.Outlines, outline)
+	}
+	return outlines
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jlelse/feeds"
+	"github.com/kaorimatz/go-opml"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bufferpool"
+	"go.goblog.app/app/pkgs/builderpool"
+	"go.goblog.app/app/pkgs/htmlbuilder"
+)
+
+const (
+	blogrollLatestPath      = "/latest"
+	blogrollQueueName       = "blogroll"
+	blogrollEntriesPerFeed  = 10
+	blogrollLatestLimit     = 50
+	blogrollEntryTitleLimit = 100
+)
+
+type blogrollEntry struct {
+	Feed, URL, Title string
+	Published        int64
+}
+
+func (bc *configBlog) blogrollLatestEnabled() bool {
+	return bc.Blogroll != nil && bc.Blogroll.Enabled && bc.Blogroll.Latest
+}
+
+func (a *goBlog) initBlogrollLatest() {
+	if !lo.SomeBy(lo.Values(a.cfg.Blogs), func(bc *configBlog) bool { return bc.blogrollLatestEnabled() }) {
+		return
+	}
+	a.listenOnQueue(blogrollQueueName, 30*time.Second, func(qi *queueItem, dequeue func(), _ func(time.Duration)) {
+		feedURL := string(qi.content)
+		if err := a.fetchBlogrollFeed(feedURL); err != nil {
+			// Feeds are fetched again every hour, so don't retry
+			log.Println("Failed to fetch blogroll feed:", feedURL, err.Error())
+		}
+		dequeue()
+	})
+	a.hourlyHooks = append(a.hourlyHooks, a.enqueueBlogrollFeeds)
+	// Don't wait for the next hour to fetch the feeds
+	go a.enqueueBlogrollFeeds()
+}
+
+// Enqueues the feeds of all blogrolls to fetch the latest entries
+func (a *goBlog) enqueueBlogrollFeeds() {
+	feedURLs := []string{}
+	for blog, bc := range a.cfg.Blogs {
+		if !bc.blogrollLatestEnabled() {
+			continue
+		}
+		outlines, err, _ := a.blogrollCacheGroup.Do(blog, func() (any, error) {
+			return a.getBlogrollOutlines(blog)
+		})
+		if err != nil {
+			log.Println("Failed to get blogroll outlines:", err.Error())
+			continue
+		}
+		feedURLs = append(feedURLs, lo.Keys(blogrollFeedOutlines(outlines.([]*opml.Outline)))...)
+	}
+	for _, feedURL := range lo.Uniq(feedURLs) {
+		if err := a.enqueue(blogrollQueueName, []byte(feedURL), time.Now()); err != nil {
+			log.Println("Failed to enqueue blogroll feed:", err.Error())
+		}
+	}
+}
+
+// Fetches the feed and saves the newest entries
+func (a *goBlog) fetchBlogrollFeed(feedURL string) error {
+	feed, err := a.fetchFeed(feedURL)
+	if err != nil {
+		return err
+	}
+	// Relative entry links are relative to the feed link, which can be relative to the feed URL itself
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return err
+	}
+	if feedLink, err := url.Parse(feed.Link); err == nil && feed.Link != "" {
+		base = base.ResolveReference(feedLink)
+	}
+	now := time.Now().Unix()
+	for _, item := range feed.Items {
+		if item == nil || item.Link == "" {
+			continue
+		}
+		entryURL, ok := blogrollEntryURL(base, item.Link)
+		if !ok {
+			continue
+		}
+		entry := &blogrollEntry{
+			Feed:      feedURL,
+			URL:       entryURL,
+			Title:     item.Title,
+			Published: now,
+		}
+		if entry.Title == "" {
+			entry.Title = truncateStringWithEllipsis(htmlText(defaultIfEmpty(item.Description, item.Content)), blogrollEntryTitleLimit)
+		}
+		dated := true
+		if item.PublishedParsed != nil {
+			entry.Published = item.PublishedParsed.Unix()
+		} else if item.UpdatedParsed != nil {
+			entry.Published = item.UpdatedParsed.Unix()
+		} else {
+			dated = false
+		}
+		if err = a.db.saveBlogrollEntry(defaultIfEmpty(item.GUID, item.Link), entry, dated); err != nil {
+			return err
+		}
+	}
+	return a.db.cleanupBlogrollEntries(feedURL, blogrollEntriesPerFeed)
+}
+
+// Resolves the link against the base and only returns absolute http(s) URLs, so entries can't link to other schemes
+func blogrollEntryURL(base *url.URL, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	u = base.ResolveReference(u)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func (db *database) saveBlogrollEntry(guid string, e *blogrollEntry, dated bool) error {
+	// Entries without a date keep the time they were first seen
+	_, err := db.Exec(`
+	insert into blogroll_entries (feed, guid, url, title, published) values (@feed, @guid, @url, @title, @published)
+	on conflict (feed, guid) do update set url = excluded.url, title = excluded.title,
+	published = case when @dated then excluded.published else published end`,
+		sql.Named("feed", e.Feed), sql.Named("guid", guid), sql.Named("url", e.URL), sql.Named("title", e.Title),
+		sql.Named("published", e.Published), sql.Named("dated", dated),
+	)
+	return err
+}
+
+// Only keeps the newest entries of the feed
+func (db *database) cleanupBlogrollEntries(feedURL string, keep int) error {
+	_, err := db.Exec(`
+	delete from blogroll_entries where feed = @feed and guid not in (
+		select guid from blogroll_entries where feed = @feed order by published desc limit @keep
+	)`, sql.Named("feed", feedURL), sql.Named("keep", keep))
+	return err
+}
+
+// Returns the newest entries of the feeds. If latestPerFeed is true, only the newest entry of each feed is returned.
+func (db *database) getBlogrollEntries(feedURLs []string, latestPerFeed bool, limit int) ([]*blogrollEntry, error) {
+	if len(feedURLs) == 0 {
+		return nil, nil
+	}
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	args := []any{}
+	if latestPerFeed {
+		// SQLite returns the other columns of the row with the maximum value
+		queryBuilder.WriteString("select feed, url, title, max(published) from blogroll_entries where feed in (")
+	} else {
+		queryBuilder.WriteString("select feed, url, title, published from blogroll_entries where feed in (")
+	}
+	for i, feedURL := range feedURLs {
+		if i > 0 {
+			queryBuilder.WriteString(", ")
+		}
+		named := fmt.Sprintf("feed%d", i)
+		queryBuilder.WriteString("@" + named)
+		args = append(args, sql.Named(named, feedURL))
+	}
+	queryBuilder.WriteString(")")
+	if latestPerFeed {
+		queryBuilder.WriteString(" group by feed")
+	}
+	queryBuilder.WriteString(" order by 4 desc limit @limit")
+	args = append(args, sql.Named("limit", limit))
+	rows, err := db.Query(queryBuilder.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*blogrollEntry{}
+	for rows.Next() {
+		e := &blogrollEntry{}
+		if err = rows.Scan(&e.Feed, &e.URL, &e.Title, &e.Published); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Returns the outlines with a feed, mapped by the feed URL
+func blogrollFeedOutlines(outlines []*opml.Outline) map[string]*opml.Outline {
+	m := map[string]*opml.Outline{}
+	for _, category := range outlines {
+		for _, o := range category.Outlines {
+			if o.XMLURL != nil && o.XMLURL.IsAbs() {
+				m[o.XMLURL.String()] = o
+			}
+		}
+	}
+	return m
+}
+
+func outlineTitle(o *opml.Outline) string {
+	return defaultIfEmpty(o.Title, o.Text)
+}
+
+func htmlURLString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+type blogrollLatestRenderData struct {
+	title      string
+	category   string
+	categories []string
+	entries    []*blogrollEntry
+	outlines   map[string]*opml.Outline
+	path       string
+}
+
+func (a *goBlog) serveBlogrollLatest(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	result, err, _ := a.blogrollCacheGroup.Do(blog, func() (any, error) {
+		return a.getBlogrollOutlines(blog)
+	})
+	if err != nil {
+		log.Printf("Failed to get outlines: %v", err)
+		a.serveError(w, r, "", http.StatusInternalServerError)
+		return
+	}
+	outlines := result.([]*opml.Outline)
+	categories := lo.Map(outlines, func(o *opml.Outline, _ int) string { return outlineTitle(o) })
+	// Filter by category
+	category := r.URL.Query().Get("category")
+	if category != "" {
+		outlines = lo.Filter(outlines, func(o *opml.Outline, _ int) bool { return outlineTitle(o) == category })
+		if len(outlines) == 0 {
+			a.serve404(w, r)
+			return
+		}
+	}
+	feedOutlines := blogrollFeedOutlines(outlines)
+	entries, err := a.db.getBlogrollEntries(lo.Keys(feedOutlines), false, blogrollLatestLimit)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	path := bc.getRelativePath(defaultIfEmpty(bc.Blogroll.Path, defaultBlogrollPath) + blogrollLatestPath)
+	title := a.ts.GetTemplateStringVariant(bc.Lang, "blogrolllatest")
+	if category != "" {
+		title = fmt.Sprintf("%s (%s)", title, category)
+	}
+	if ft := feedType(chi.URLParam(r, "feed")); ft != noFeed {
+		a.serveBlogrollLatestFeed(w, r, ft, title, path, entries, feedOutlines)
+		return
+	}
+	a.render(w, r, a.renderBlogrollLatest, &renderData{
+		Canonical: a.getFullAddress(path) + lo.Ternary(category != "", "?category="+url.QueryEscape(category), ""),
+		Data: &blogrollLatestRenderData{
+			title:      title,
+			category:   category,
+			categories: categories,
+			entries:    entries,
+			outlines:   feedOutlines,
+			path:       path,
+		},
+	})
+}
+
+func (a *goBlog) serveBlogrollLatestFeed(w http.ResponseWriter, r *http.Request, ft feedType, title, path string, entries []*blogrollEntry, outlines map[string]*opml.Outline) {
+	_, bc := a.getBlog(r)
+	feed := &feeds.Feed{
+		Title:   fmt.Sprintf("%s (%s)", title, a.renderMdTitle(defaultIfEmpty(bc.Blogroll.Title, bc.Title))),
+		Link:    &feeds.Link{Href: a.getFullAddress(path)},
+		Created: time.Now(),
+	}
+	if len(entries) > 0 {
+		feed.Created = time.Unix(entries[0].Published, 0)
+	}
+	for _, e := range entries {
+		o := outlines[e.Feed]
+		buf := bufferpool.Get()
+		blogrollEntryFeedHtml(buf, e, o)
+		feed.Add(&feeds.Item{
+			Title:   e.Title,
+			Link:    &feeds.Link{Href: e.URL},
+			Author:  &feeds.Author{Name: outlineTitle(o)},
+			Id:      e.URL,
+			Content: buf.String(),
+			Created: time.Unix(e.Published, 0),
+		})
+		bufferpool.Put(buf)
+	}
+	a.writeFeed(w, r, ft, feed, &feedExtensions{self: a.getFullAddress(r.URL.RequestURI())})
+}
+
+func blogrollEntryFeedHtml(w io.Writer, e *blogrollEntry, o *opml.Outline) {
+	hb := htmlbuilder.NewHtmlBuilder(w)
+	hb.WriteElementOpen("p")
+	hb.WriteElementOpen("a", "href", e.URL)
+	hb.WriteEscaped(e.Title)
+	hb.WriteElementClose("a")
+	hb.WriteElementClose("p")
+	hb.WriteElementOpen("p")
+	hb.WriteUnescaped("→ ")
+	hb.WriteElementOpen("a", "href", defaultIfEmpty(htmlURLString(o.HTMLURL), e.Feed))
+	hb.WriteEscaped(outlineTitle(o))
+	hb.WriteElementClose("a")
+	hb.WriteElementClose("p")
+}
+
+func (a *goBlog) renderBlogrollLatest(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	bd, ok := rd.Data.(*blogrollLatestRenderData)
+	if !ok {
+		return
+	}
+	query := ""
+	if bd.category != "" {
+		query = "?category=" + url.QueryEscape(bd.category)
+	}
+	a.renderBase(
+		hb, rd,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			a.renderTitleTag(hb, rd.Blog, bd.title)
+			hb.WriteElementOpen("link", "rel", "alternate", "type", "application/rss+xml", "title", bd.title, "href", a.getFullAddress(bd.path+".rss")+query)
+		},
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementOpen("main")
+			// Title
+			hb.WriteElementOpen("h1")
+			hb.WriteEscaped(bd.title)
+			hb.WriteElementClose("h1")
+			// Categories
+			if len(bd.categories) > 1 {
+				hb.WriteElementOpen("p")
+				for i, category := range append([]string{""}, bd.categories...) {
+					if i > 0 {
+						hb.WriteUnescaped(" · ")
+					}
+					name, href := category, bd.path+"?category="+url.QueryEscape(category)
+					if category == "" {
+						name, href = a.ts.GetTemplateStringVariant(rd.Blog.Lang, "all"), bd.path
+					}
+					if category == bd.category {
+						hb.WriteElementOpen("strong")
+						hb.WriteEscaped(name)
+						hb.WriteElementClose("strong")
+						continue
+					}
+					hb.WriteElementOpen("a", "href", href)
+					hb.WriteEscaped(name)
+					hb.WriteElementClose("a")
+				}
+				hb.WriteElementClose("p")
+			}
+			// Feed button
+			hb.WriteElementOpen("p")
+			hb.WriteElementOpen("a", "href", bd.path+".rss"+query, "class", "button")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "feed"))
+			hb.WriteElementClose("a")
+			hb.WriteElementClose("p")
+			// Entries
+			if len(bd.entries) == 0 {
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "noposts"))
+				hb.WriteElementClose("p")
+			} else {
+				hb.WriteElementOpen("ul")
+				for _, e := range bd.entries {
+					o := bd.outlines[e.Feed]
+					hb.WriteElementOpen("li")
+					hb.WriteElementOpen("a", "href", e.URL, "target", "_blank")
+					hb.WriteEscaped(defaultIfEmpty(e.Title, e.URL))
+					hb.WriteElementClose("a")
+					hb.WriteElementOpen("br")
+					hb.WriteElementOpen("small")
+					hb.WriteElementOpen("a", "href", defaultIfEmpty(htmlURLString(o.HTMLURL), e.Feed), "target", "_blank")
+					hb.WriteEscaped(outlineTitle(o))
+					hb.WriteElementClose("a")
+					hb.WriteEscaped(", " + time.Unix(e.Published, 0).Local().Format(isoDateFormat))
+					hb.WriteElementClose("small")
+					hb.WriteElementClose("li")
+				}
+				hb.WriteElementClose("ul")
+			}
+			hb.WriteElementClose("main")
+		},
+	)
+}
+
+// Returns the newest entry of each feed in the blogroll
+func (a *goBlog) getBlogrollLatestEntries(outlines []*opml.Outline) map[string]*blogrollEntry {
+	entries, err := a.db.getBlogrollEntries(lo.Keys(blogrollFeedOutlines(outlines)), true, -1)
+	if err != nil {
+		log.Println("Failed to get latest blogroll entries:", err.Error())
+		return nil
+	}
+	return lo.KeyBy(entries, func(e *blogrollEntry) string { return e.Feed })
+}
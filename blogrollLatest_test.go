@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_blogrollLatest(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.Cache.Enable = false
+
+	_ = app.initConfig(false)
+	app.cfg.Blogs[app.cfg.DefaultBlog].Blogroll = &configBlogroll{
+		Enabled:    true,
+		Opml:       "https://example.com/blogroll.opml",
+		Categories: []string{"Friends", "Tech"},
+		Latest:     true,
+	}
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "https://example.com/blogroll.opml":
+			_, _ = w.Write([]byte(`<opml version="2.0"><body>
+<outline text="Friends">
+<outline text="Alice" xmlUrl="https://alice.example/feed.xml" htmlUrl="https://alice.example/"/>
+<outline text="Bob" xmlUrl="https://bob.example/feed.xml" htmlUrl="https://bob.example/"/>
+</outline>
+<outline text="Tech">
+<outline text="Carol" xmlUrl="https://carol.example/feed.xml" htmlUrl="https://carol.example/"/>
+</outline>
+<outline text="Other">
+<outline text="Dave" xmlUrl="https://dave.example/feed.xml" htmlUrl="https://dave.example/"/>
+</outline>
+</body></opml>`))
+		case "https://alice.example/feed.xml":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Alice</title>
+<item><link>https://alice.example/old</link><title>Old post by Alice</title><pubDate>Mon, 02 Jan 2023 10:00:00 GMT</pubDate></item>
+<item><link>https://alice.example/new</link><title>New post by Alice</title><pubDate>Thu, 05 Jan 2023 10:00:00 GMT</pubDate></item>
+</channel></rss>`))
+		case "https://bob.example/feed.xml":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Bob</title>
+<item><link>https://bob.example/note</link><description>&lt;p&gt;A note without title&lt;/p&gt;</description><pubDate>Wed, 04 Jan 2023 10:00:00 GMT</pubDate></item>
+</channel></rss>`))
+		case "https://carol.example/feed.xml":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Carol</title><link>/blog/</link>
+<item><link>https://carol.example/post</link><title>Carol writes</title><pubDate>Tue, 03 Jan 2023 10:00:00 GMT</pubDate></item>
+<item><link>relative</link><title>Carol links relative</title><pubDate>Tue, 03 Jan 2023 09:00:00 GMT</pubDate></item>
+<item><link>javascript:alert(1)</link><title>Carol links script</title><pubDate>Tue, 03 Jan 2023 08:00:00 GMT</pubDate></item>
+</channel></rss>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	// Enqueue the feeds of the (filtered) blogroll
+	app.enqueueBlogrollFeeds()
+	feedURLs := []string{}
+	for {
+		qi, err := app.peekQueue(context.Background(), blogrollQueueName)
+		require.NoError(t, err)
+		if qi == nil {
+			break
+		}
+		feedURLs = append(feedURLs, string(qi.content))
+		require.NoError(t, app.dequeue(qi))
+	}
+	assert.ElementsMatch(t, []string{"https://alice.example/feed.xml", "https://bob.example/feed.xml", "https://carol.example/feed.xml"}, feedURLs)
+
+	// Fetch the feeds
+	for _, feedURL := range feedURLs {
+		require.NoError(t, app.fetchBlogrollFeed(feedURL))
+	}
+	// Fetching again doesn't duplicate entries
+	require.NoError(t, app.fetchBlogrollFeed("https://alice.example/feed.xml"))
+
+	// Blogroll shows the latest post of each entry
+	var page string
+	err := requests.URL("http://localhost:8080/blogroll").Client(handlerClient).ToString(&page).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, page, `href=https://alice.example/new target=_blank>New post by Alice</a>`)
+	assert.NotContains(t, page, "Old post by Alice")
+	assert.Contains(t, page, `href=/blogroll/latest`)
+
+	// River of all entries
+	err = requests.URL("http://localhost:8080/blogroll/latest").Client(handlerClient).ToString(&page).Fetch(context.Background())
+	require.NoError(t, err)
+	alice, bob, carol, old := strings.Index(page, "New post by Alice"), strings.Index(page, "A note without title"), strings.Index(page, "Carol writes"), strings.Index(page, "Old post by Alice")
+	assert.True(t, alice >= 0 && alice < bob && bob < carol && carol < old)
+	assert.Contains(t, page, `href="/blogroll/latest?category=Tech"`)
+	// Relative links are resolved against the feed link, other schemes are dropped
+	assert.Contains(t, page, `href=https://carol.example/blog/relative`)
+	assert.NotContains(t, page, "Carol links script")
+	assert.NotContains(t, page, "javascript:")
+
+	// Category filter
+	err = requests.URL("http://localhost:8080/blogroll/latest?category=Tech").Client(handlerClient).ToString(&page).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, page, "Carol writes")
+	assert.NotContains(t, page, "New post by Alice")
+
+	err = requests.URL("http://localhost:8080/blogroll/latest?category=Other").Client(handlerClient).Fetch(context.Background())
+	assert.True(t, requests.HasStatusErr(err, http.StatusNotFound))
+
+	// Feed
+	var feed *gofeed.Feed
+	err = requests.URL("http://localhost:8080/blogroll/latest.atom?category=Friends").Client(handlerClient).
+		Handle(func(r *http.Response) (err error) {
+			defer r.Body.Close()
+			feed, err = gofeed.NewParser().Parse(r.Body)
+			return
+		}).
+		Fetch(context.Background())
+	require.NoError(t, err)
+	if assert.Len(t, feed.Items, 3) {
+		assert.Equal(t, "New post by Alice", feed.Items[0].Title)
+		assert.Equal(t, "https://alice.example/new", feed.Items[0].Link)
+		assert.Equal(t, "Alice", feed.Items[0].Author.Name)
+		assert.Equal(t, "A note without title", feed.Items[1].Title)
+	}
+}
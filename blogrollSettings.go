@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/carlmjohnson/requests"
+	"github.com/kaorimatz/go-opml"
+	"github.com/mmcdole/gofeed"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bodylimit"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+const blogrollDefaultCategory = "Blogroll"
+
+func (bc *configBlog) blogrollInDatabase() bool {
+	return bc.Blogroll != nil && bc.Blogroll.Enabled && !bc.Blogroll.remote()
+}
+
+// Reads the blogroll item from the form, discovering missing values from the website
+func (a *goBlog) blogrollItemFromForm(r *http.Request, discover bool) (*blogrollItem, error) {
+	item := &blogrollItem{
+		Category: strings.TrimSpace(r.FormValue("category")),
+		Title:    strings.TrimSpace(r.FormValue("title")),
+		URL:      strings.TrimSpace(r.FormValue("url")),
+		Feed:     strings.TrimSpace(r.FormValue("feed")),
+		Icon:     strings.TrimSpace(r.FormValue("icon")),
+	}
+	if item.Category == "" {
+		return nil, errors.New("missing category")
+	}
+	if item.URL == "" && item.Feed == "" {
+		return nil, errors.New("missing URL")
+	}
+	for _, u := range []string{item.URL, item.Feed, item.Icon} {
+		if u != "" && !isAbsoluteURL(u) {
+			return nil, errors.New("invalid URL")
+		}
+	}
+	if discover && (item.Title == "" || item.Feed == "" || item.Icon == "") {
+		if discovered, err := a.discoverBlogrollItem(r.Context(), defaultIfEmpty(item.URL, item.Feed)); err != nil {
+			log.Println("Failed to discover blogroll item:", err.Error())
+		} else {
+			if item.Feed == "" && discovered.Feed == item.URL {
+				// The entered website is a feed
+				item.URL = ""
+			}
+			item.Title = defaultIfEmpty(item.Title, discovered.Title)
+			item.URL = defaultIfEmpty(item.URL, discovered.URL)
+			item.Feed = defaultIfEmpty(item.Feed, discovered.Feed)
+			item.Icon = defaultIfEmpty(item.Icon, discovered.Icon)
+		}
+	}
+	if item.Title == "" {
+		item.Title = lo.Must(url.Parse(defaultIfEmpty(item.URL, item.Feed))).Hostname()
+	}
+	return item, nil
+}
+
+const settingsCreateBlogrollItemPath = "/createblogrollitem"
+
+func (a *goBlog) settingsCreateBlogrollItem(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	item, err := a.blogrollItemFromForm(r, true)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = a.db.createBlogrollItem(blog, item); err != nil {
+		a.serveError(w, r, "Failed to save blogroll item in database", http.StatusInternalServerError)
+		return
+	}
+	a.blogrollChanged(bc, item.Feed)
+	http.Redirect(w, r, bc.getRelativePath(settingsPath), http.StatusFound)
+}
+
+const settingsUpdateBlogrollItemPath = "/updateblogrollitem"
+
+func (a *goBlog) settingsUpdateBlogrollItem(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	item, err := a.blogrollItemFromForm(r, false)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if item.ID, err = strconv.Atoi(r.FormValue("id")); err != nil {
+		a.serveError(w, r, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if err = a.db.updateBlogrollItem(blog, item); err != nil {
+		a.serveError(w, r, "Failed to update blogroll item in database", http.StatusInternalServerError)
+		return
+	}
+	a.blogrollChanged(bc, item.Feed)
+	http.Redirect(w, r, bc.getRelativePath(settingsPath), http.StatusFound)
+}
+
+const settingsDeleteBlogrollItemPath = "/deleteblogrollitem"
+
+func (a *goBlog) settingsDeleteBlogrollItem(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		a.serveError(w, r, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if err = a.db.deleteBlogrollItem(blog, id); err != nil {
+		a.serveError(w, r, "Failed to delete blogroll item from database", http.StatusInternalServerError)
+		return
+	}
+	a.blogrollChanged(bc)
+	http.Redirect(w, r, bc.getRelativePath(settingsPath), http.StatusFound)
+}
+
+const settingsImportBlogrollPath = "/importblogroll"
+
+func (a *goBlog) settingsImportBlogroll(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	// Check if request is multipart
+	if ct := r.Header.Get(contentType); !strings.Contains(ct, contenttype.MultipartForm) {
+		a.serveError(w, r, "wrong content-type", http.StatusBadRequest)
+		return
+	}
+	// Get file
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		a.serveError(w, r, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	o, err := opml.Parse(file)
+	_ = file.Close()
+	if err != nil {
+		a.serveError(w, r, "Failed to parse OPML", http.StatusBadRequest)
+		return
+	}
+	feeds, err := a.importBlogrollOutlines(blog, o.Outlines)
+	if err != nil {
+		a.serveError(w, r, "Failed to import blogroll: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.blogrollChanged(bc, feeds...)
+	http.Redirect(w, r, bc.getRelativePath(settingsPath), http.StatusFound)
+}
+
+// Saves the outlines as blogroll items, top-level outlines with children are used as categories.
+// Items that already exist (same feed or website) are skipped. Returns the feeds of the imported items.
+func (a *goBlog) importBlogrollOutlines(blog string, outlines []*opml.Outline) ([]string, error) {
+	existing, err := a.db.getBlogrollItems(blog)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, i := range existing {
+		known[i.Feed], known[i.URL] = true, true
+	}
+	delete(known, "")
+	imported := []string{}
+	var importOutline func(category string, o *opml.Outline) error
+	importOutline = func(category string, o *opml.Outline) error {
+		if len(o.Outlines) > 0 {
+			for _, child := range o.Outlines {
+				if err := importOutline(defaultIfEmpty(outlineTitle(o), category), child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		item := &blogrollItem{Category: category, Title: outlineTitle(o)}
+		if o.XMLURL != nil && o.XMLURL.IsAbs() {
+			item.Feed = o.XMLURL.String()
+		}
+		if o.HTMLURL != nil && o.HTMLURL.IsAbs() {
+			item.URL = o.HTMLURL.String()
+		}
+		if (item.Feed == "" && item.URL == "") || known[item.Feed] || known[item.URL] {
+			return nil
+		}
+		if item.Title == "" {
+			item.Title = lo.Must(url.Parse(defaultIfEmpty(item.URL, item.Feed))).Hostname()
+		}
+		if err := a.db.createBlogrollItem(blog, item); err != nil {
+			return err
+		}
+		known[item.Feed], known[item.URL] = true, true
+		delete(known, "")
+		imported = append(imported, item.Feed)
+		return nil
+	}
+	for _, o := range outlines {
+		if err := importOutline(blogrollDefaultCategory, o); err != nil {
+			return imported, err
+		}
+	}
+	return lo.Compact(imported), nil
+}
+
+// Purges the cache and fetches the latest posts of new or changed feeds
+func (a *goBlog) blogrollChanged(bc *configBlog, feeds ...string) {
+	a.cache.purge()
+	if !bc.blogrollLatestEnabled() {
+		return
+	}
+	for _, feed := range lo.Compact(feeds) {
+		if err := a.enqueue(blogrollQueueName, []byte(feed), time.Now()); err != nil {
+			log.Println("Failed to enqueue blogroll feed:", err.Error())
+		}
+	}
+}
+
+var blogrollFeedTypes = []string{contenttype.RSS, contenttype.ATOM, contenttype.JSONFeed}
+
+// Discovers the title, feed and icon of a website (or a feed)
+func (a *goBlog) discoverBlogrollItem(ctx context.Context, pageURL string) (*blogrollItem, error) {
+	item := &blogrollItem{URL: pageURL}
+	var body []byte
+	baseURL := pageURL
+	err := requests.URL(pageURL).Client(a.httpClient).
+		Handle(func(r *http.Response) (err error) {
+			defer r.Body.Close()
+			baseURL = r.Request.URL.String()
+			body, err = io.ReadAll(io.LimitReader(r.Body, 5*bodylimit.MB))
+			return
+		}).
+		Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Check if the URL is a feed
+	if feed, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err == nil {
+		item.Feed, item.URL, item.Title = pageURL, feed.Link, feed.Title
+		if feed.Image != nil {
+			item.Icon = feed.Image.URL
+		}
+		return item, nil
+	}
+	// Parse the HTML
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	item.Title = strings.TrimSpace(doc.Find("head title").First().Text())
+	if siteName, ok := doc.Find(`meta[property="og:site_name"][content]`).Attr("content"); ok && strings.TrimSpace(siteName) != "" {
+		item.Title = strings.TrimSpace(siteName)
+	}
+	feedHref, iconHref := "", "/favicon.ico"
+	doc.Find("link[rel~=alternate][href][type]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if lo.Contains(blogrollFeedTypes, strings.ToLower(s.AttrOr("type", ""))) {
+			feedHref = s.AttrOr("href", "")
+			return false
+		}
+		return true
+	})
+	if href, ok := doc.Find("link[rel~=icon][href]").First().Attr("href"); ok && href != "" {
+		iconHref = href
+	}
+	resolved, err := resolveURLReferences(baseURL, feedHref, iconHref)
+	if err != nil || len(resolved) != 2 {
+		return item, err
+	}
+	if feedHref != "" {
+		item.Feed = resolved[0]
+	}
+	item.Icon = resolved[1]
+	return item, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_blogrollSettings(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.Cache.Enable = false
+	app.cfg.DefaultBlog = "en"
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Blogroll: &configBlogroll{
+				Enabled: true,
+			},
+		},
+	}
+
+	_ = app.initConfig(false)
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	require.True(t, app.cfg.Blogs["en"].blogrollInDatabase())
+
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "https://alice.example/":
+			_, _ = w.Write([]byte(`<html><head><title>Alice's Blog</title>
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="shortcut icon" href="/icon.png">
+</head><body></body></html>`))
+		case "https://bob.example/feed.xml":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Bob</title><link>https://bob.example/</link></channel></rss>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	postForm := func(handler http.HandlerFunc, values url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(values.Encode()))
+		req.Header.Set(contentType, "application/x-www-form-urlencoded")
+		handler(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+		return rec
+	}
+
+	// Create with discovery from the website
+	rec := postForm(app.settingsCreateBlogrollItem, url.Values{"category": {"Friends"}, "url": {"https://alice.example/"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	// Create with discovery from the feed
+	rec = postForm(app.settingsCreateBlogrollItem, url.Values{"category": {"Friends"}, "url": {"https://bob.example/feed.xml"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	// Missing category and invalid URL
+	rec = postForm(app.settingsCreateBlogrollItem, url.Values{"url": {"https://carol.example/"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = postForm(app.settingsCreateBlogrollItem, url.Values{"category": {"Friends"}, "url": {"carol.example"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	items, err := app.db.getBlogrollItems("en")
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "Alice's Blog", items[0].Title)
+	assert.Equal(t, "https://alice.example/", items[0].URL)
+	assert.Equal(t, "https://alice.example/feed.xml", items[0].Feed)
+	assert.Equal(t, "https://alice.example/icon.png", items[0].Icon)
+	assert.Equal(t, "Bob", items[1].Title)
+	assert.Equal(t, "https://bob.example/", items[1].URL)
+	assert.Equal(t, "https://bob.example/feed.xml", items[1].Feed)
+
+	// Update
+	rec = postForm(app.settingsUpdateBlogrollItem, url.Values{
+		"id": {"2"}, "category": {"Tech"}, "title": {"Bob's Blog"},
+		"url": {"https://bob.example/"}, "feed": {"https://bob.example/feed.xml"},
+	})
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	// Import OPML
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "blogroll.opml")
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte(`<opml version="2.0"><body>
+<outline text="Tech">
+<outline text="Bob" xmlUrl="https://bob.example/feed.xml" htmlUrl="https://bob.example/"/>
+<outline text="Carol" xmlUrl="https://carol.example/feed.xml" htmlUrl="https://carol.example/"/>
+</outline>
+<outline text="Dave" htmlUrl="https://dave.example/"/>
+</body></opml>`))
+	require.NoError(t, mw.Close())
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/settings", body)
+	req.Header.Set(contentType, mw.FormDataContentType())
+	app.settingsImportBlogroll(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	// Outlines grouped by category
+	outlines, err := app.getBlogrollOutlines("en")
+	require.NoError(t, err)
+	if assert.Len(t, outlines, 3) {
+		assert.Equal(t, "Blogroll", outlines[0].Text)
+		assert.Equal(t, "Friends", outlines[1].Text)
+		assert.Equal(t, "Tech", outlines[2].Text)
+		if assert.Len(t, outlines[2].Outlines, 2) {
+			assert.Equal(t, "Bob's Blog", outlines[2].Outlines[0].Title)
+			assert.Equal(t, "Carol", outlines[2].Outlines[1].Title)
+		}
+		if assert.Len(t, outlines[0].Outlines, 1) {
+			assert.Equal(t, "https://dave.example/", outlines[0].Outlines[0].HTMLURL.String())
+			assert.Nil(t, outlines[0].Outlines[0].XMLURL)
+		}
+	}
+	assert.Equal(t, "https://alice.example/icon.png", app.getBlogrollIcons("en")["https://alice.example/"])
+
+	// Delete
+	rec = postForm(app.settingsDeleteBlogrollItem, url.Values{"id": {"1"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	items, err = app.db.getBlogrollItems("en")
+	require.NoError(t, err)
+	assert.Len(t, items, 3)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
@@ -79,7 +80,7 @@ func (a *goBlog) cacheMiddleware(next http.Handler) http.Handler {
 		// copy and set headers
 		a.setCacheHeaders(w, ci)
 		// check conditional request
-		if ifNoneMatchHeader := r.Header.Get("If-None-Match"); ifNoneMatchHeader != "" && ifNoneMatchHeader == ci.eTag {
+		if notModified(r, ci.eTag, ci.lastModified) {
 			// send 304
 			w.WriteHeader(http.StatusNotModified)
 			return
@@ -101,6 +102,28 @@ func cacheable(r *http.Request) bool {
 	return true
 }
 
+// Checks the conditional request headers, If-None-Match takes precedence over If-Modified-Since
+func notModified(r *http.Request, eTag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if eTag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(eTag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ifModifiedSince); err == nil {
+			return !lastModified.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
 func cacheKey(r *http.Request) (key string) {
 	buf := bufferpool.Get()
 	// Special cases
@@ -145,15 +168,19 @@ func (a *goBlog) setCacheHeaders(w http.ResponseWriter, cache *cacheItem) {
 	}
 	// Set cache headers
 	w.Header().Set("ETag", cache.eTag)
+	if !cache.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", cache.lastModified.UTC().Format(http.TimeFormat))
+	}
 	w.Header().Set(cacheControl, "public,no-cache")
 }
 
 type cacheItem struct {
-	expiration int
-	eTag       string
-	code       int
-	header     http.Header
-	body       []byte
+	expiration   int
+	eTag         string
+	lastModified time.Time
+	code         int
+	header       http.Header
+	body         []byte
 }
 
 // Calculate byte size of cache item using size of header, body and etag
@@ -27,6 +27,7 @@ func (c *cacheRecorder) finish() *cacheItem {
 	if c.item.eTag == "" {
 		c.item.eTag = fmt.Sprintf("%x", sha256.Sum256(c.item.body))
 	}
+	c.item.lastModified, _ = http.ParseTime(c.item.header.Get("Last-Modified"))
 	return &c.item
 }
 
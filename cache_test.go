@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/dgraph-io/ristretto"
 	"github.com/stretchr/testify/assert"
@@ -67,3 +68,21 @@ func Benchmark_cache_getCache(b *testing.B) {
 		c.getCache(strconv.Itoa(i), handler, req)
 	}
 }
+
+func Test_notModified(t *testing.T) {
+	lastModified := time.Date(2020, 1, 1, 12, 0, 0, 500, time.UTC)
+	check := func(header, value string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(header, value)
+		return notModified(req, `W/"abc"`, lastModified)
+	}
+	assert.True(t, check("If-None-Match", `W/"abc"`))
+	assert.True(t, check("If-None-Match", `"def", "abc"`))
+	assert.True(t, check("If-None-Match", "*"))
+	assert.False(t, check("If-None-Match", `"def"`))
+	assert.True(t, check("If-Modified-Since", "Wed, 01 Jan 2020 12:00:00 GMT"))
+	assert.True(t, check("If-Modified-Since", "Thu, 02 Jan 2020 12:00:00 GMT"))
+	assert.False(t, check("If-Modified-Since", "Wed, 01 Jan 2020 11:59:59 GMT"))
+	assert.False(t, check("If-Modified-Since", "invalid"))
+	assert.False(t, notModified(httptest.NewRequest(http.MethodGet, "/", nil), `W/"abc"`, lastModified))
+}
@@ -2,20 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"math/bits"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/dchest/captcha"
+	"github.com/gorilla/sessions"
 	"go.goblog.app/app/pkgs/bodylimit"
 	"go.goblog.app/app/pkgs/bufferpool"
 	"go.goblog.app/app/pkgs/contenttype"
 )
 
-const captchaSolvedKey contextKey = "captchaSolved"
+const (
+	captchaSolvedKey contextKey = "captchaSolved"
+
+	captchaModeImage    = "image"
+	captchaModePoW      = "pow"
+	captchaModeHoneypot = "honeypot"
+
+	defaultCaptchaPoWDifficulty = 16 // Leading zero bits of the hash
+	defaultCaptchaMinSeconds    = 3
+	captchaHoneypotField        = "website"
+)
 
 var captchaStore = captcha.NewMemoryStore(100, 10*time.Minute)
 
@@ -23,6 +36,35 @@ func init() {
 	captcha.SetCustomStore(captchaStore)
 }
 
+// Returns the challenge mode of the blog, the image captcha is the default
+func (blog *configBlog) captchaMode() string {
+	if blog != nil && blog.Captcha != nil {
+		switch blog.Captcha.Mode {
+		case captchaModePoW, captchaModeHoneypot:
+			return blog.Captcha.Mode
+		}
+	}
+	return captchaModeImage
+}
+
+func (blog *configBlog) captchaPoWDifficulty() int {
+	if blog == nil || blog.Captcha == nil || blog.Captcha.Difficulty <= 0 {
+		return defaultCaptchaPoWDifficulty
+	}
+	if blog.Captcha.Difficulty > 32 {
+		// More would take too long to solve in the browser
+		return 32
+	}
+	return blog.Captcha.Difficulty
+}
+
+func (blog *configBlog) captchaMinSeconds() int {
+	if blog == nil || blog.Captcha == nil || blog.Captcha.MinSeconds <= 0 {
+		return defaultCaptchaMinSeconds
+	}
+	return blog.Captcha.MinSeconds
+}
+
 func (a *goBlog) captchaMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if captcha already solved
@@ -41,18 +83,32 @@ func (a *goBlog) captchaMiddleware(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), captchaSolvedKey, true)))
 			return
 		}
-		// Get captcha ID
-		captchaId := ""
-		if sesCaptchaId, ok := ses.Values["captchaid"]; ok {
-			// Already has a captcha ID
-			ci := sesCaptchaId.(string)
-			if captcha.Reload(ci) {
-				captchaId = ci
-			}
+		// Prepare challenge
+		_, bc := a.getBlog(r)
+		crd := &captchaRenderData{
+			captchaMode:   bc.captchaMode(),
+			captchaMethod: r.Method,
 		}
-		if captchaId == "" {
-			captchaId = captcha.New()
-			ses.Values["captchaid"] = captchaId
+		ses.Values["captchamode"] = crd.captchaMode
+		switch crd.captchaMode {
+		case captchaModePoW:
+			crd.captchaChallenge = randomString(32)
+			crd.captchaDifficulty = bc.captchaPoWDifficulty()
+			ses.Values["powchallenge"] = crd.captchaChallenge
+			ses.Values["powdifficulty"] = crd.captchaDifficulty
+		case captchaModeHoneypot:
+			ses.Values["captchatime"] = time.Now().Unix()
+			ses.Values["captchaminseconds"] = bc.captchaMinSeconds()
+		default:
+			// Get captcha ID
+			if sesCaptchaId, ok := ses.Values["captchaid"].(string); ok && captcha.Reload(sesCaptchaId) {
+				// Already has a captcha ID
+				crd.captchaId = sesCaptchaId
+			}
+			if crd.captchaId == "" {
+				crd.captchaId = captcha.New()
+				ses.Values["captchaid"] = crd.captchaId
+			}
 		}
 		// Encode original request
 		headerBuffer, bodyBuffer := bufferpool.Get(), bufferpool.Get()
@@ -79,13 +135,9 @@ func (a *goBlog) captchaMiddleware(next http.Handler) http.Handler {
 		// Render captcha
 		_ = ses.Save(r, w)
 		w.Header().Set(cacheControl, "no-store,max-age=0")
+		crd.captchaHeaders, crd.captchaBody = headerBuffer.String(), bodyBuffer.String()
 		a.renderWithStatusCode(w, r, http.StatusUnauthorized, a.renderCaptcha, &renderData{
-			Data: &captchaRenderData{
-				captchaMethod:  r.Method,
-				captchaHeaders: headerBuffer.String(),
-				captchaBody:    bodyBuffer.String(),
-				captchaId:      captchaId,
-			},
+			Data: crd,
 		})
 	})
 }
@@ -119,12 +171,8 @@ func (a *goBlog) checkCaptcha(w http.ResponseWriter, r *http.Request) bool {
 		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
 		return true
 	}
-	// Check if session contains a captchaId and if captcha is solved
-	if sesCaptchaId, ok := ses.Values["captchaid"]; ok && captcha.VerifyString(sesCaptchaId.(string), r.FormValue("digits")) {
-		if err != nil {
-			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
-			return true
-		}
+	// Check if the challenge of the session is solved
+	if verifyCaptcha(r, ses) {
 		ses.Values["captcha"] = true
 		err = a.captchaSessions.Save(r, w, ses)
 		if err != nil {
@@ -141,3 +189,38 @@ func (a *goBlog) checkCaptcha(w http.ResponseWriter, r *http.Request) bool {
 	a.d.ServeHTTP(w, origReq)
 	return true
 }
+
+// Verifies the solution of the challenge stored in the session
+func verifyCaptcha(r *http.Request, ses *sessions.Session) bool {
+	switch ses.Values["captchamode"] {
+	case captchaModePoW:
+		challenge, _ := ses.Values["powchallenge"].(string)
+		difficulty, _ := ses.Values["powdifficulty"].(int)
+		return challenge != "" && difficulty > 0 && verifyCaptchaPoW(challenge, r.FormValue("pownonce"), difficulty)
+	case captchaModeHoneypot:
+		started, _ := ses.Values["captchatime"].(int64)
+		minSeconds, _ := ses.Values["captchaminseconds"].(int)
+		// Bots fill out every field and submit immediately
+		return started != 0 && r.FormValue(captchaHoneypotField) == "" &&
+			time.Since(time.Unix(started, 0)) >= time.Duration(minSeconds)*time.Second
+	default:
+		captchaId, _ := ses.Values["captchaid"].(string)
+		return captchaId != "" && captcha.VerifyString(captchaId, r.FormValue("digits"))
+	}
+}
+
+// Checks if the SHA-256 hash of challenge and nonce starts with the required number of zero bits
+func verifyCaptchaPoW(challenge, nonce string, difficulty int) bool {
+	if nonce == "" || len(nonce) > 20 {
+		return false
+	}
+	hash := sha256.Sum256([]byte(challenge + nonce))
+	zeroBits := 0
+	for _, b := range hash {
+		zeroBits += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeroBits >= difficulty
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/justinas/alice"
@@ -198,4 +199,119 @@ func Test_captchaMiddleware(t *testing.T) {
 		assert.Contains(t, resString, "ABC Test")
 	})
 
+	t.Run("Audio fallback", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		app.d.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/abc", nil))
+		doc, err := goquery.NewDocumentFromReader(rec.Result().Body)
+		require.NoError(t, err)
+		captchaId := strings.TrimSuffix(strings.TrimPrefix(doc.Find("img.captchaimg").AttrOr("src", ""), "/captcha/"), ".png")
+		assert.Equal(t, "/captcha/"+captchaId+".wav?lang=en", doc.Find("audio").AttrOr("src", ""))
+	})
+
+	// Requests a new challenge, the cookie is set after the first request
+	var captchaCookie *http.Cookie
+	newChallenge := func() *goquery.Document {
+		req := httptest.NewRequest(http.MethodPost, "/abc", strings.NewReader("test"))
+		if captchaCookie != nil {
+			req.AddCookie(captchaCookie)
+		}
+		rec := httptest.NewRecorder()
+		app.d.ServeHTTP(rec, req)
+		res := rec.Result()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		if cookies := res.Cookies(); len(cookies) > 0 {
+			captchaCookie = cookies[0]
+		}
+		doc, err := goquery.NewDocumentFromReader(res.Body)
+		_ = res.Body.Close()
+		require.NoError(t, err)
+		return doc
+	}
+	// Submits the challenge form with additional values
+	submitChallenge := func(doc *goquery.Document, values url.Values) (int, string) {
+		doc.Find("form input[type=hidden]").Each(func(_ int, s *goquery.Selection) {
+			if values.Get(s.AttrOr("name", "")) == "" {
+				values.Set(s.AttrOr("name", ""), s.AttrOr("value", ""))
+			}
+		})
+		req := httptest.NewRequest(http.MethodPost, "/abc", strings.NewReader(values.Encode()))
+		req.Header.Set(contentType, contenttype.WWWForm)
+		req.AddCookie(captchaCookie)
+		rec := httptest.NewRecorder()
+		app.d.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("Proof of work", func(t *testing.T) {
+		bc := app.cfg.Blogs[app.cfg.DefaultBlog]
+		bc.Captcha = &configCaptcha{Mode: captchaModePoW, Difficulty: 8}
+		defer func() { bc.Captcha = nil }()
+		captchaCookie = nil
+
+		doc := newChallenge()
+		form := doc.Find("form#captchapow")
+		challenge := form.AttrOr("data-challenge", "")
+		assert.NotEmpty(t, challenge)
+		assert.Equal(t, "8", form.AttrOr("data-difficulty", ""))
+		assert.Equal(t, 0, doc.Find("img.captchaimg").Length())
+
+		// Wrong nonce
+		nonce := 0
+		for verifyCaptchaPoW(challenge, strconv.Itoa(nonce), 8) {
+			nonce++
+		}
+		code, _ := submitChallenge(doc, url.Values{"pownonce": {strconv.Itoa(nonce)}})
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// Each challenge is new
+		doc = newChallenge()
+		nextChallenge := doc.Find("form#captchapow").AttrOr("data-challenge", "")
+		assert.NotEqual(t, challenge, nextChallenge)
+
+		// Solved
+		nonce = 0
+		for !verifyCaptchaPoW(nextChallenge, strconv.Itoa(nonce), 8) {
+			nonce++
+		}
+		code, body := submitChallenge(doc, url.Values{"pownonce": {strconv.Itoa(nonce)}})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "ABC Test")
+	})
+
+	t.Run("Honeypot", func(t *testing.T) {
+		bc := app.cfg.Blogs[app.cfg.DefaultBlog]
+		bc.Captcha = &configCaptcha{Mode: captchaModeHoneypot}
+		defer func() { bc.Captcha = nil }()
+		captchaCookie = nil
+
+		// Makes the challenge older than the minimum time
+		backdate := func() {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(captchaCookie)
+			ses, err := app.captchaSessions.Get(req, "c")
+			require.NoError(t, err)
+			ses.Values["captchatime"] = time.Now().Add(-time.Minute).Unix()
+			require.NoError(t, app.captchaSessions.Save(req, httptest.NewRecorder(), ses))
+		}
+
+		doc := newChallenge()
+		assert.Equal(t, 1, doc.Find("input[name="+captchaHoneypotField+"]").Length())
+
+		// Too fast
+		code, _ := submitChallenge(doc, url.Values{})
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// Honeypot filled
+		doc = newChallenge()
+		backdate()
+		code, _ = submitChallenge(doc, url.Values{captchaHoneypotField: {"https://spam.example/"}})
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// Human
+		doc = newChallenge()
+		backdate()
+		code, body := submitChallenge(doc, url.Values{})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "ABC Test")
+	})
 }
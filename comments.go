@@ -4,11 +4,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.goblog.app/app/pkgs/builderpool"
@@ -23,8 +26,30 @@ type comment struct {
 	Website  string
 	Comment  string
 	Original string
+	Status   commentStatus
+	Parent   int
+	Token    string // Hashed edit token of the commenter
+	Created  int64
+	Edited   int64
+	Verified bool   // Commenter signed in with the website
+	Photo    string // Photo of verified commenters
 }
 
+type commentStatus string
+
+const (
+	commentStatusPending  commentStatus = "pending"
+	commentStatusApproved commentStatus = "approved"
+	commentStatusSpam     commentStatus = "spam"
+)
+
+const (
+	commentsModerationNone     = "none"     // Approve all comments
+	commentsModerationKnown    = "known"    // Approve comments of signed in commenters with approved comments
+	commentsModerationVerified = "verified" // Approve comments of signed in commenters
+	commentsModerationAll      = "all"      // Moderate all comments
+)
+
 func (a *goBlog) serveComment(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -41,6 +66,10 @@ func (a *goBlog) serveComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	comment := comments[0]
+	if comment.Status != commentStatusApproved && !a.isLoggedIn(r) {
+		a.serve404(w, r)
+		return
+	}
 	_, bc := a.getBlog(r)
 	canonical := a.getFullAddress(bc.getRelativePath(path.Join(commentPath, strconv.Itoa(id))))
 	a.render(w, r, a.renderComment, &renderData{
@@ -54,70 +83,214 @@ func (a *goBlog) createCommentFromRequest(w http.ResponseWriter, r *http.Request
 	comment := r.FormValue("comment")
 	name := r.FormValue("name")
 	website := r.FormValue("website")
+	parent := stringToInt(r.FormValue("parent"))
 	_, bc := a.getBlog(r)
+	// Check email for reply notifications, it's never displayed
+	email := ""
+	if bc.commentsEmailEnabled() && r.FormValue("notify") != "" && strings.TrimSpace(r.FormValue("email")) != "" {
+		address, err := mail.ParseAddress(strings.TrimSpace(r.FormValue("email")))
+		if err != nil {
+			a.serveError(w, r, "invalid email address", http.StatusBadRequest)
+			return
+		}
+		email = address.Address
+	}
+	// Use the identity of signed in commenters
+	commenter := a.getCommenter(r)
+	if commenter != nil {
+		name, website = commenter.Name, commenter.Me
+	}
+	// Check moderation policy and spam
+	status, err := a.newCommentStatus(bc, website, commenter != nil)
+	if err != nil {
+		a.serveError(w, r, "failed to check the database", http.StatusInternalServerError)
+		return
+	}
+	if a.isSpam(commentSpamText(name, website, comment), a.clientAddress(r)) {
+		status = commentStatusSpam
+	}
 	// Create comment
-	result, errStatus, err := a.createComment(bc, target, comment, name, website, "")
+	result, status, errStatus, err := a.createComment(bc, target, comment, name, website, "", parent, status)
 	if err != nil {
 		a.serveError(w, r, err.Error(), errStatus)
 		return
 	}
+	_, id, ok := a.localCommentID(a.getFullAddress(result))
+	if ok && commenter != nil {
+		if err := a.db.setCommentVerified(id, commenter.Photo); err != nil {
+			log.Println("Failed to mark comment as verified:", err.Error())
+		}
+	}
+	if ok && status != commentStatusSpam {
+		// Let the commenter edit or delete the comment
+		if _, err := a.createCommentToken(w, bc, id); err != nil {
+			log.Println("Failed to create comment token:", err.Error())
+		}
+		if email != "" {
+			a.subscribeToCommentReplies(bc, id, email, status)
+		}
+	}
+	if status != commentStatusApproved {
+		// Comment isn't public yet
+		a.render(w, r, a.renderCommentPending, &renderData{
+			Data: a.getFullAddress(r.FormValue("target")),
+		})
+		return
+	}
 	// Redirect to comment
 	http.Redirect(w, r, result, http.StatusFound)
 }
 
-func (a *goBlog) createComment(bc *configBlog, target, comment, name, website, original string) (string, int, error) {
-	updateId := -1
+// Creates a comment (or updates the comment with the same original), parent is the ID of the comment this is a reply to.
+// If status is empty, the status is based on the moderation policy of the blog.
+func (a *goBlog) createComment(bc *configBlog, target, comment, name, website, original string, parent int, status commentStatus) (string, commentStatus, int, error) {
 	// Check target
-	target, status, err := a.checkCommentTarget(target)
+	target, errStatus, err := a.checkCommentTarget(target)
 	if err != nil {
-		return "", status, err
+		return "", "", errStatus, err
+	}
+	// Check if target is a comment
+	if _, id, ok := a.localCommentID(a.getFullAddress(target)); ok && parent == 0 {
+		parent = id
+	}
+	if parent != 0 {
+		parents, err := a.db.getComments(&commentsRequestConfig{id: parent, status: commentStatusApproved})
+		if err != nil {
+			return "", "", http.StatusInternalServerError, errors.New("failed to check the database")
+		}
+		if len(parents) < 1 {
+			return "", "", http.StatusBadRequest, errors.New("comment to reply to not found")
+		}
+		// Replies have the same target as the comment they reply to
+		target = parents[0].Target
 	}
 	// Check and clean comment
 	comment = cleanHTMLText(comment)
 	if comment == "" {
-		return "", http.StatusBadRequest, errors.New("comment is empty")
+		return "", "", http.StatusBadRequest, errors.New("comment is empty")
 	}
 	name = defaultIfEmpty(cleanHTMLText(name), "Anonymous")
 	website = cleanHTMLText(website)
 	original = cleanHTMLText(original)
 	if original != "" {
 		// Check if comment already exists
-		exists, id, err := a.db.commentIdByOriginal(original)
+		existing, err := a.db.getComments(&commentsRequestConfig{original: original})
 		if err != nil {
-			return "", http.StatusInternalServerError, errors.New("failed to check the database")
+			return "", "", http.StatusInternalServerError, errors.New("failed to check the database")
 		}
-		if exists {
-			updateId = id
+		if len(existing) > 0 {
+			// Update
+			c := existing[0]
+			if err := a.db.updateComment(c.ID, comment, name, website); err != nil {
+				return "", "", http.StatusInternalServerError, errors.New("failed to update comment in database")
+			}
+			commentAddress := bc.getRelativePath(fmt.Sprintf("%s/%d", commentPath, c.ID))
+			if c.Status == commentStatusApproved {
+				// Send webmention
+				_ = a.createWebmention(a.getFullAddress(commentAddress), a.commentWebmentionTarget(bc, c.Target, c.Parent))
+			}
+			// Return comment path
+			return commentAddress, c.Status, 0, nil
 		}
 	}
 	// Insert
-	if updateId == -1 {
-		result, err := a.db.Exec(
-			"insert into comments (target, comment, name, website, original) values (@target, @comment, @name, @website, @original)",
-			sql.Named("target", target), sql.Named("comment", comment), sql.Named("name", name), sql.Named("website", website), sql.Named("original", original),
-		)
+	if status == "" {
+		status, err = a.newCommentStatus(bc, website, false)
 		if err != nil {
-			return "", http.StatusInternalServerError, errors.New("failed to save comment to database")
-		}
-		if commentID, err := result.LastInsertId(); err != nil {
-			return "", http.StatusInternalServerError, errors.New("failed to save comment to database")
-		} else {
-			commentAddress := bc.getRelativePath(fmt.Sprintf("%s/%d", commentPath, commentID))
-			// Send webmention
-			_ = a.createWebmention(a.getFullAddress(commentAddress), a.getFullAddress(target))
-			// Return comment path
-			return commentAddress, 0, nil
-		}
-	} else {
-		if err := a.db.updateComment(updateId, comment, name, website); err != nil {
-			return "", http.StatusInternalServerError, errors.New("failed to update comment in database")
+			return "", "", http.StatusInternalServerError, errors.New("failed to check the database")
 		}
-		commentAddress := bc.getRelativePath(fmt.Sprintf("%s/%d", commentPath, updateId))
+	}
+	result, err := a.db.Exec(
+		"insert into comments (target, comment, name, website, original, status, parent, created) values (@target, @comment, @name, @website, @original, @status, @parent, @created)",
+		sql.Named("target", target), sql.Named("comment", comment), sql.Named("name", name), sql.Named("website", website),
+		sql.Named("original", original), sql.Named("status", status), sql.Named("parent", parent), sql.Named("created", time.Now().Unix()),
+	)
+	if err != nil {
+		return "", "", http.StatusInternalServerError, errors.New("failed to save comment to database")
+	}
+	commentID, err := result.LastInsertId()
+	if err != nil {
+		return "", "", http.StatusInternalServerError, errors.New("failed to save comment to database")
+	}
+	commentAddress := bc.getRelativePath(fmt.Sprintf("%s/%d", commentPath, commentID))
+	if status == commentStatusApproved {
 		// Send webmention
-		_ = a.createWebmention(a.getFullAddress(commentAddress), a.getFullAddress(target))
-		// Return comment path
-		return commentAddress, 0, nil
+		_ = a.createWebmention(a.getFullAddress(commentAddress), a.commentWebmentionTarget(bc, target, parent))
+		// Notify the author of the comment replied to
+		a.notifyCommentReply(bc, parent, int(commentID), name, comment)
+	} else if status == commentStatusPending {
+		a.notifyCommentModeration(bc, int(commentID), target, name, comment)
 	}
+	// Return comment path
+	return commentAddress, status, 0, nil
+}
+
+// Notifies about a comment awaiting moderation
+func (a *goBlog) notifyCommentModeration(bc *configBlog, id int, target, name, comment string) {
+	a.sendNotification(fmt.Sprintf(
+		"New comment by %s on %s awaiting moderation:\n\n%s\n\nModerate: %s",
+		name, a.getFullAddress(target), comment,
+		a.getFullAddress(bc.getRelativePath(fmt.Sprintf("%s?id=%d", commentPath, id))),
+	))
+}
+
+// Returns the status of a new comment based on the moderation policy of the blog,
+// verified is true if the commenter signed in with the website.
+// Names and websites entered in the form can be spoofed, so only verified commenters are approved.
+func (a *goBlog) newCommentStatus(bc *configBlog, website string, verified bool) (commentStatus, error) {
+	switch bc.commentsModeration() {
+	case commentsModerationAll:
+		return commentStatusPending, nil
+	case commentsModerationVerified:
+		if verified {
+			return commentStatusApproved, nil
+		}
+		return commentStatusPending, nil
+	case commentsModerationKnown:
+		if !verified || website == "" {
+			return commentStatusPending, nil
+		}
+		known, err := a.db.countComments(&commentsRequestConfig{status: commentStatusApproved, website: website, verified: true})
+		if err != nil {
+			return "", err
+		}
+		if known > 0 {
+			return commentStatusApproved, nil
+		}
+		return commentStatusPending, nil
+	default:
+		return commentStatusApproved, nil
+	}
+}
+
+// Returns the text of a comment that is used for the spam filter
+func commentSpamText(name, website, comment string) string {
+	return name + " " + website + " " + comment
+}
+
+// Returns the URL the webmention of a comment is sent to, the parent comment for replies or the post
+func (a *goBlog) commentWebmentionTarget(bc *configBlog, target string, parent int) string {
+	if parent != 0 {
+		return a.getFullAddress(bc.getRelativePath(fmt.Sprintf("%s/%d", commentPath, parent)))
+	}
+	return a.getFullAddress(target)
+}
+
+// Returns the blog and the ID of a comment URL of this installation
+func (a *goBlog) localCommentID(u string) (*configBlog, int, bool) {
+	for _, bc := range a.cfg.Blogs {
+		if !bc.commentsEnabled() {
+			continue
+		}
+		prefix := a.getFullAddress(bc.getRelativePath(commentPath)) + "/"
+		if !strings.HasPrefix(u, prefix) {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimPrefix(u, prefix)); err == nil && id > 0 {
+			return bc, id, true
+		}
+	}
+	return nil, 0, false
 }
 
 func (a *goBlog) checkCommentTarget(target string) (string, int, error) {
@@ -135,16 +308,35 @@ func (a *goBlog) checkCommentTarget(target string) (string, int, error) {
 
 type commentsRequestConfig struct {
 	id, offset, limit int
+	status            commentStatus
+	website           string
+	verified          bool
+	original          string
 }
 
 func buildCommentsQuery(config *commentsRequestConfig) (query string, args []any) {
 	queryBuilder := builderpool.Get()
 	defer builderpool.Put(queryBuilder)
-	queryBuilder.WriteString("select id, target, name, website, comment, original from comments")
+	queryBuilder.WriteString("select id, target, name, website, comment, original, status, parent, token, created, edited, verified, photo from comments where 1")
 	if config.id != 0 {
-		queryBuilder.WriteString(" where id = @id")
+		queryBuilder.WriteString(" and id = @id")
 		args = append(args, sql.Named("id", config.id))
 	}
+	if config.status != "" {
+		queryBuilder.WriteString(" and status = @status")
+		args = append(args, sql.Named("status", config.status))
+	}
+	if config.original != "" {
+		queryBuilder.WriteString(" and original = @original")
+		args = append(args, sql.Named("original", config.original))
+	}
+	if config.website != "" {
+		queryBuilder.WriteString(" and website = @website")
+		args = append(args, sql.Named("website", config.website))
+	}
+	if config.verified {
+		queryBuilder.WriteString(" and verified = 1")
+	}
 	queryBuilder.WriteString(" order by id desc")
 	if config.limit != 0 || config.offset != 0 {
 		queryBuilder.WriteString(" limit @limit offset @offset")
@@ -162,7 +354,7 @@ func (db *database) getComments(config *commentsRequestConfig) ([]*comment, erro
 	}
 	for rows.Next() {
 		c := &comment{}
-		err = rows.Scan(&c.ID, &c.Target, &c.Name, &c.Website, &c.Comment, &c.Original)
+		err = rows.Scan(&c.ID, &c.Target, &c.Name, &c.Website, &c.Comment, &c.Original, &c.Status, &c.Parent, &c.Token, &c.Created, &c.Edited, &c.Verified, &c.Photo)
 		if err != nil {
 			return nil, err
 		}
@@ -184,14 +376,43 @@ func (db *database) countComments(config *commentsRequestConfig) (count int, err
 
 func (db *database) updateComment(id int, comment, name, website string) error {
 	_, err := db.Exec(
-		"update comments set comment = @comment, name = @name, website = @website where id = @id",
-		sql.Named("comment", comment), sql.Named("name", name), sql.Named("website", website), sql.Named("id", id),
+		"update comments set comment = @comment, name = @name, website = @website, edited = @edited where id = @id",
+		sql.Named("comment", comment), sql.Named("name", name), sql.Named("website", website), sql.Named("edited", time.Now().Unix()), sql.Named("id", id),
 	)
 	return err
 }
 
-func (db *database) deleteComment(id int) error {
-	_, err := db.Exec("delete from comments where id = @id", sql.Named("id", id))
+func (db *database) setCommentVerified(id int, photo string) error {
+	_, err := db.Exec("update comments set verified = 1, photo = @photo where id = @id", sql.Named("photo", photo), sql.Named("id", id))
+	return err
+}
+
+func (db *database) setCommentStatus(id int, status commentStatus) error {
+	_, err := db.Exec("update comments set status = @status where id = @id", sql.Named("status", status), sql.Named("id", id))
+	return err
+}
+
+// Deletes the comment, removes it from the post and purges the cache.
+// Replies to the comment move up to its parent, so they stay in the thread.
+func (a *goBlog) deleteComment(bc *configBlog, c *comment) error {
+	commentsPrefix := a.getFullAddress(bc.getRelativePath(commentPath)) + "/"
+	if err := a.db.deleteComment(c.ID, commentsPrefix, a.commentWebmentionTarget(bc, c.Target, c.Parent)); err != nil {
+		return err
+	}
+	a.cache.purge()
+	return nil
+}
+
+// Deletes the comment and its webmention and moves the replies and their webmentions to the parent target
+func (db *database) deleteComment(id int, commentsPrefix, parentTarget string) error {
+	source := commentsPrefix + strconv.Itoa(id)
+	_, err := db.Exec(`begin;
+	update webmentions set target = lowerunescaped(?) where target = lowerunescaped(?) and source in (select ? || id from comments where parent = ?);
+	update comments set parent = (select parent from comments where id = ?) where parent = ?;
+	delete from webmentions where source = ?;
+	delete from comments where id = ?;
+	delete from comment_subscriptions where comment = ?;
+	commit;`, dbNoCache, parentTarget, source, commentsPrefix, id, id, id, source, id, id)
 	return err
 }
 
@@ -213,6 +434,18 @@ func (blog *configBlog) commentsEnabled() bool {
 	return blog.Comments != nil && blog.Comments.Enabled
 }
 
+func (blog *configBlog) commentsModeration() string {
+	if blog.Comments == nil {
+		return commentsModerationNone
+	}
+	switch blog.Comments.Moderation {
+	case commentsModerationKnown, commentsModerationVerified, commentsModerationAll:
+		return blog.Comments.Moderation
+	default:
+		return commentsModerationNone
+	}
+}
+
 const commentsPostParam = "comments"
 
 func (a *goBlog) commentsEnabledForPost(post *post) bool {
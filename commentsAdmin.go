@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"reflect"
 	"strconv"
 	"sync"
@@ -37,8 +39,16 @@ func (p *commentsPaginationAdapter) Slice(offset, length int, data any) error {
 
 func (a *goBlog) commentsAdmin(w http.ResponseWriter, r *http.Request) {
 	commentsPath := r.Context().Value(pathKey).(string)
+	// Filter
+	config := &commentsRequestConfig{
+		id: stringToInt(r.URL.Query().Get("id")),
+	}
+	switch status := commentStatus(r.URL.Query().Get("status")); status {
+	case commentStatusPending, commentStatusApproved, commentStatusSpam:
+		config.status = status
+	}
 	// Adapter
-	p := paginator.New(&commentsPaginationAdapter{config: &commentsRequestConfig{}, db: a.db}, 5)
+	p := paginator.New(&commentsPaginationAdapter{config: config, db: a.db}, 5)
 	p.SetPage(stringToInt(chi.URLParam(r, "page")))
 	var comments []*comment
 	err := p.Results(&comments)
@@ -68,14 +78,20 @@ func (a *goBlog) commentsAdmin(w http.ResponseWriter, r *http.Request) {
 		nextPage, _ = p.Page()
 	}
 	nextPath = fmt.Sprintf("%s/page/%d", commentsPath, nextPage)
+	// Query
+	query := ""
+	if config.status != "" {
+		query = "?" + url.Values{"status": {string(config.status)}}.Encode()
+	}
 	// Render
 	a.render(w, r, a.renderCommentsAdmin, &renderData{
 		Data: &commentsRenderData{
 			comments: comments,
+			status:   config.status,
 			hasPrev:  hasPrev,
 			hasNext:  hasNext,
-			prev:     prevPath,
-			next:     nextPath,
+			prev:     prevPath + query,
+			next:     nextPath + query,
 		},
 	})
 }
@@ -88,11 +104,123 @@ func (a *goBlog) commentsAdminDelete(w http.ResponseWriter, r *http.Request) {
 		a.serveError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	err = a.db.deleteComment(id)
+	comments, err := a.db.getComments(&commentsRequestConfig{id: id})
 	if err != nil {
 		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	a.cache.purge()
+	if len(comments) < 1 {
+		a.serve404(w, r)
+		return
+	}
+	_, bc := a.getBlog(r)
+	if err = a.deleteComment(bc, comments[0]); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	http.Redirect(w, r, ".", http.StatusFound)
 }
+
+const commentApproveSubPath = "/approve"
+
+func (a *goBlog) commentsAdminApprove(w http.ResponseWriter, r *http.Request) {
+	a.commentsAdminSetStatus(w, r, commentStatusApproved)
+}
+
+const commentSpamSubPath = "/spam"
+
+func (a *goBlog) commentsAdminSpam(w http.ResponseWriter, r *http.Request) {
+	a.commentsAdminSetStatus(w, r, commentStatusSpam)
+}
+
+func (a *goBlog) commentsAdminSetStatus(w http.ResponseWriter, r *http.Request, status commentStatus) {
+	id, err := strconv.Atoi(r.FormValue("commentid"))
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	comments, err := a.db.getComments(&commentsRequestConfig{id: id})
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(comments) < 1 {
+		a.serve404(w, r)
+		return
+	}
+	if err = a.db.setCommentStatus(id, status); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Learn from the decision
+	c := comments[0]
+	a.spamLearn(fmt.Sprintf("comment:%d", id), commentSpamText(c.Name, c.Website, c.Comment), status == commentStatusSpam)
+	_, bc := a.getBlog(r)
+	source := a.getFullAddress(bc.getRelativePath(path.Join(commentPath, strconv.Itoa(id))))
+	target := a.commentWebmentionTarget(bc, c.Target, c.Parent)
+	if status == commentStatusApproved {
+		// Publish the comment on the post
+		_ = a.createWebmention(source, target)
+		// Handle reply notifications
+		if c.Status != commentStatusApproved {
+			a.sendCommentSubscriptionConfirmation(bc, id)
+			a.notifyCommentReply(bc, c.Parent, id, c.Name, c.Comment)
+		}
+	} else {
+		// Remove the comment from the post
+		_ = a.db.deleteWebmention(&mention{Source: source, Target: target})
+	}
+	a.cache.purge()
+	redirect := r.FormValue("redir")
+	if !isLocalRedirect(redirect) {
+		redirect = "."
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+const commentReplySubPath = "/reply"
+
+func (a *goBlog) commentsAdminReply(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("commentid"))
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parents, err := a.db.getComments(&commentsRequestConfig{id: id})
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(parents) < 1 {
+		a.serve404(w, r)
+		return
+	}
+	parent := parents[0]
+	_, bc := a.getBlog(r)
+	// Create the reply as the blog author
+	name, website := "", a.getFullAddress(bc.getRelativePath(""))
+	if user := a.cfg.User; user != nil {
+		name, website = user.Name, defaultIfEmpty(user.Link, website)
+	}
+	addr, _, errStatus, err := a.createComment(bc, a.getFullAddress(parent.Target), r.FormValue("comment"), name, website, "", parent.ID, commentStatusApproved)
+	if err != nil {
+		a.serveError(w, r, err.Error(), errStatus)
+		return
+	}
+	if parent.Original != "" && a.apEnabled() {
+		// Federate the reply to the ActivityPub comment
+		go a.apReplyToComment(bc, addr, parent)
+	}
+	a.cache.purge()
+	http.Redirect(w, r, addr, http.StatusFound)
+}
+
+// Checks if the source of a webmention is an approved comment of a moderated blog
+func (a *goBlog) isModeratedLocalComment(source string) bool {
+	bc, id, ok := a.localCommentID(source)
+	if !ok || bc.commentsModeration() == commentsModerationNone {
+		return false
+	}
+	count, err := a.db.countComments(&commentsRequestConfig{id: id, status: commentStatusApproved})
+	return err == nil && count > 0
+}
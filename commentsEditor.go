@@ -29,14 +29,12 @@ func (a *goBlog) serveCommentsEditor(w http.ResponseWriter, r *http.Request) {
 		name := r.FormValue("name")
 		website := r.FormValue("website")
 		commentText := r.FormValue("comment")
-		if err := a.db.updateComment(id, commentText, name, website); err != nil {
+		// Edits by the admin keep the status
+		commentAddress, err := a.editComment(bc, comment, commentText, name, website, comment.Status)
+		if err != nil {
 			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		a.cache.purge()
-		// Resend webmention
-		commentAddress := bc.getRelativePath(path.Join(commentPath, strconv.Itoa(id)))
-		_ = a.createWebmention(a.getFullAddress(commentAddress), a.getFullAddress(comment.Target))
 		// Redirect to comment
 		http.Redirect(w, r, commentAddress, http.StatusFound)
 		return
@@ -46,3 +44,30 @@ func (a *goBlog) serveCommentsEditor(w http.ResponseWriter, r *http.Request) {
 		BlogString: blog,
 	})
 }
+
+// Updates the comment, marks it as edited and sets the new status, returns the comment path.
+// Approved comments resend the webmention, all others are removed from the post.
+func (a *goBlog) editComment(bc *configBlog, c *comment, commentText, name, website string, status commentStatus) (string, error) {
+	if err := a.db.updateComment(c.ID, commentText, name, website); err != nil {
+		return "", err
+	}
+	if status != c.Status {
+		if err := a.db.setCommentStatus(c.ID, status); err != nil {
+			return "", err
+		}
+	}
+	a.cache.purge()
+	commentAddress := bc.getRelativePath(path.Join(commentPath, strconv.Itoa(c.ID)))
+	source, target := a.getFullAddress(commentAddress), a.commentWebmentionTarget(bc, c.Target, c.Parent)
+	switch status {
+	case commentStatusApproved:
+		// Resend webmention
+		_ = a.createWebmention(source, target)
+	case commentStatusPending:
+		_ = a.db.deleteWebmention(&mention{Source: source, Target: target})
+		a.notifyCommentModeration(bc, c.ID, c.Target, name, commentText)
+	default:
+		_ = a.db.deleteWebmention(&mention{Source: source, Target: target})
+	}
+	return commentAddress, nil
+}
@@ -28,7 +28,7 @@ func Test_commentsEditor(t *testing.T) {
 
 	bc := app.cfg.Blogs[app.cfg.DefaultBlog]
 
-	addr, _, err := app.createComment(bc, "https://example.com/abc", "Test", "Name", "https://example.org", "")
+	addr, _, _, err := app.createComment(bc, "https://example.com/abc", "Test", "Name", "https://example.org", "", 0, "")
 	require.NoError(t, err)
 
 	splittedAddr := strings.Split(addr, "/")
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	commentManageSubPath     = "/manage"
+	commentTokenCookie       = "comment_token"
+	defaultCommentEditWindow = 15 // Minutes
+)
+
+// Returns how long commenters can edit or delete their comments, 0 if disabled
+func (blog *configBlog) commentsEditWindow() time.Duration {
+	if !blog.commentsEnabled() || blog.Comments.EditWindow < 0 {
+		return 0
+	}
+	if blog.Comments.EditWindow == 0 {
+		return defaultCommentEditWindow * time.Minute
+	}
+	return time.Duration(blog.Comments.EditWindow) * time.Minute
+}
+
+func hashCommentToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+func (db *database) setCommentToken(id int, token string) error {
+	_, err := db.Exec("update comments set token = @token where id = @id", sql.Named("token", hashCommentToken(token)), sql.Named("id", id))
+	return err
+}
+
+// Creates the secret edit token of a new comment and places it in a cookie only sent to the comment's pages
+func (a *goBlog) createCommentToken(w http.ResponseWriter, bc *configBlog, id int) (string, error) {
+	window := bc.commentsEditWindow()
+	if window == 0 {
+		return "", nil
+	}
+	token := randomString(32)
+	if err := a.db.setCommentToken(id, token); err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     commentTokenCookie,
+		Value:    token,
+		Path:     bc.getRelativePath(path.Join(commentPath, strconv.Itoa(id))),
+		MaxAge:   int(window.Seconds()),
+		Secure:   a.useSecureCookies(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// Returns the edit token of the request (cookie or posted form value, never from the URL, so it doesn't leak with the referrer)
+// if it belongs to the comment and the edit window is still open
+func (a *goBlog) commenterToken(r *http.Request, bc *configBlog, c *comment) string {
+	if r == nil || c == nil || c.Token == "" {
+		return ""
+	}
+	if time.Since(time.Unix(c.Created, 0)) > bc.commentsEditWindow() {
+		return ""
+	}
+	token := r.PostFormValue("token")
+	if token == "" {
+		if cookie, err := r.Cookie(commentTokenCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(hashCommentToken(token)), []byte(c.Token)) != 1 {
+		return ""
+	}
+	return token
+}
+
+// Skips the cache for commenters with an edit token, so they get the link to edit or delete their comment
+func (a *goBlog) commentCacheMiddleware(next http.Handler) http.Handler {
+	cached := a.cacheMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(commentTokenCookie); err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cached.ServeHTTP(w, r)
+	})
+}
+
+type commentManageRenderData struct {
+	comment *comment
+	token   string
+	until   time.Time
+}
+
+// Lets the commenter edit or delete the comment with the secret edit token
+func (a *goBlog) serveCommentManage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		a.serveError(w, r, "id missing or wrong format", http.StatusBadRequest)
+		return
+	}
+	comments, err := a.db.getComments(&commentsRequestConfig{id: id})
+	if err != nil {
+		a.serveError(w, r, "failed to query comments from database", http.StatusInternalServerError)
+		return
+	}
+	if len(comments) < 1 {
+		a.serve404(w, r)
+		return
+	}
+	c := comments[0]
+	_, bc := a.getBlog(r)
+	token := a.commenterToken(r, bc, c)
+	if token == "" {
+		a.serveError(w, r, "invalid or expired token", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "delete":
+			if err = a.deleteComment(bc, c); err != nil {
+				a.serveError(w, r, "failed to delete comment", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, c.Target, http.StatusFound)
+		default:
+			commentText := cleanHTMLText(r.FormValue("comment"))
+			if commentText == "" {
+				a.serveError(w, r, "comment is empty", http.StatusBadRequest)
+				return
+			}
+			name, website := defaultIfEmpty(cleanHTMLText(r.FormValue("name")), "Anonymous"), cleanHTMLText(r.FormValue("website"))
+			if c.Verified {
+				// Keep the verified identity
+				name, website = c.Name, c.Website
+			}
+			// The edited comment has to pass the spam filter and the moderation policy again,
+			// edits never approve a comment that isn't approved yet
+			status := c.Status
+			if status == commentStatusApproved {
+				if status, err = a.newCommentStatus(bc, website, c.Verified); err != nil {
+					a.serveError(w, r, "failed to check the database", http.StatusInternalServerError)
+					return
+				}
+			}
+			if a.isSpam(commentSpamText(name, website, commentText), a.clientAddress(r)) {
+				status = commentStatusSpam
+			}
+			commentAddress, err := a.editComment(bc, c, commentText, name, website, status)
+			if err != nil {
+				a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if status != commentStatusApproved {
+				// Comment isn't public anymore
+				a.render(w, r, a.renderCommentPending, &renderData{
+					Data: a.getFullAddress(c.Target),
+				})
+				return
+			}
+			http.Redirect(w, r, commentAddress, http.StatusFound)
+		}
+		return
+	}
+	a.render(w, r, a.renderCommentManage, &renderData{
+		Data: &commentManageRenderData{
+			comment: c,
+			token:   token,
+			until:   time.Unix(c.Created, 0).Add(bc.commentsEditWindow()),
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+func Test_commentsSelfService(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Comments: &configComments{
+				Enabled: true,
+			},
+		},
+	}
+	app.cfg.DefaultBlog = "en"
+
+	err := app.initConfig(false)
+	require.NoError(t, err)
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	mux := chi.NewMux()
+	mux.Use(middleware.WithValue(blogKey, "en"))
+	mux.Post(commentPath, app.createCommentFromRequest)
+	mux.Get(commentPath+"/{id}", app.serveComment)
+	mux.Get(commentPath+"/{id}"+commentManageSubPath, app.serveCommentManage)
+	mux.Post(commentPath+"/{id}"+commentManageSubPath, app.serveCommentManage)
+
+	do := func(method, target string, values url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		var req *http.Request
+		if values != nil {
+			req = httptest.NewRequest(method, target, strings.NewReader(values.Encode()))
+			req.Header.Add(contentType, contenttype.WWWForm)
+		} else {
+			req = httptest.NewRequest(method, target, nil)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Create comment
+	rec := do(http.MethodPost, commentPath, url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Tpyo"}, "name": {"Alice"}}, nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, commentTokenCookie, cookie.Name)
+	assert.Equal(t, "/comment/1", cookie.Path)
+	assert.Equal(t, 15*60, cookie.MaxAge)
+	assert.True(t, cookie.HttpOnly)
+
+	// Only the hash is stored
+	comments, err := app.db.getComments(&commentsRequestConfig{id: 1})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.NotEqual(t, cookie.Value, comments[0].Token)
+	assert.Equal(t, hashCommentToken(cookie.Value), comments[0].Token)
+	assert.NotZero(t, comments[0].Created)
+	assert.Zero(t, comments[0].Edited)
+
+	// Comment page links the manage page
+	rec = do(http.MethodGet, "/comment/1", nil, cookie)
+	assert.Contains(t, rec.Body.String(), "/comment/1/manage")
+	rec = do(http.MethodGet, "/comment/1", nil, nil)
+	assert.NotContains(t, rec.Body.String(), "/comment/1/manage")
+
+	// Manage page with cookie, not without, with a wrong token or with the token in the URL
+	rec = do(http.MethodGet, "/comment/1/manage", nil, cookie)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "?token=")
+	rec = do(http.MethodGet, "/comment/1/manage?token="+cookie.Value, nil, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = do(http.MethodGet, "/comment/1/manage", nil, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = do(http.MethodGet, "/comment/1/manage?token=wrong", nil, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Edit
+	rec = do(http.MethodPost, "/comment/1/manage", url.Values{"token": {cookie.Value}, "action": {"edit"}, "name": {"Alice"}, "comment": {"Typo"}}, nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/comment/1", rec.Header().Get("Location"))
+	comments, err = app.db.getComments(&commentsRequestConfig{id: 1})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Typo", comments[0].Comment)
+	assert.NotZero(t, comments[0].Edited)
+
+	// Edit can't remove the comment text
+	rec = do(http.MethodPost, "/comment/1/manage", url.Values{"token": {cookie.Value}, "action": {"edit"}}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Closed edit window
+	_, err = app.db.Exec("update comments set created = created - 3600 where id = 1")
+	require.NoError(t, err)
+	rec = do(http.MethodGet, "/comment/1/manage", nil, cookie)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	_, err = app.db.Exec("update comments set created = created + 3600 where id = 1")
+	require.NoError(t, err)
+
+	// Token of another comment
+	rec = do(http.MethodPost, commentPath, url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Other"}}, nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+	otherCookie := rec.Result().Cookies()[0]
+	rec = do(http.MethodPost, "/comment/1/manage", url.Values{"token": {otherCookie.Value}, "action": {"delete"}}, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Edits are moderated again
+	app.cfg.Blogs["en"].Comments.Moderation = commentsModerationAll
+	rec = do(http.MethodPost, "/comment/2/manage", url.Values{"token": {otherCookie.Value}, "action": {"edit"}, "comment": {"Edited"}}, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	comments, err = app.db.getComments(&commentsRequestConfig{id: 2})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, commentStatusPending, comments[0].Status)
+	app.cfg.Blogs["en"].Comments.Moderation = commentsModerationNone
+
+	// Edits don't approve comments
+	rec = do(http.MethodPost, "/comment/2/manage", url.Values{"token": {otherCookie.Value}, "action": {"edit"}, "comment": {"Edited again"}}, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	comments, err = app.db.getComments(&commentsRequestConfig{id: 2})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, commentStatusPending, comments[0].Status)
+
+	// Delete
+	rec = do(http.MethodPost, "/comment/1/manage", url.Values{"token": {cookie.Value}, "action": {"delete"}}, nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/test", rec.Header().Get("Location"))
+	count, err := app.db.countComments(&commentsRequestConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Disabled
+	app.cfg.Blogs["en"].Comments.EditWindow = -1
+	rec = do(http.MethodPost, commentPath, url.Values{"target": {"http://localhost:8080/test"}, "comment": {"No token"}}, nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Len(t, rec.Result().Cookies(), 0)
+	rec = do(http.MethodGet, "/comment/2/manage", nil, otherCookie)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
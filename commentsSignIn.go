@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/gorilla/sessions"
+	"github.com/hacdias/indieauth/v3"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bodylimit"
+	"go.goblog.app/app/pkgs/bufferpool"
+	"go.goblog.app/app/pkgs/contenttype"
+	"willnorris.com/go/microformats"
+)
+
+const (
+	commentSignInSubPath         = "/signin"
+	commentSignInCallbackSubPath = "/signin/callback"
+	commentSignInEmailSubPath    = "/signin/email"
+	commentSignOutSubPath        = "/signout"
+
+	commenterSessionName  = "cm"
+	commentSignInEmailTTL = 15 * time.Minute
+	// Sign in emails per address and hour
+	commentSignInEmailsPerHour = 3
+)
+
+// Verified identity of a commenter who signed in with the website
+type commenter struct {
+	Me, Name, Photo string
+}
+
+func (blog *configBlog) commentsSignInEnabled() bool {
+	return blog.commentsEnabled() && blog.Comments.SignIn
+}
+
+// Returns the signed in commenter or nil
+func (a *goBlog) getCommenter(r *http.Request) *commenter {
+	_, bc := a.getBlog(r)
+	if !bc.commentsSignInEnabled() {
+		return nil
+	}
+	ses, err := a.commenterSessions.Get(r, commenterSessionName)
+	if err != nil || ses.IsNew {
+		return nil
+	}
+	me, _ := ses.Values["me"].(string)
+	if me == "" {
+		return nil
+	}
+	name, _ := ses.Values["name"].(string)
+	photo, _ := ses.Values["photo"].(string)
+	return &commenter{Me: me, Name: defaultIfEmpty(name, commenterHost(me)), Photo: photo}
+}
+
+func commenterHost(me string) string {
+	if u, err := url.Parse(me); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return me
+}
+
+func (a *goBlog) commenterIndieAuthClient(bc *configBlog) *indieauth.Client {
+	return indieauth.NewClient(
+		a.getFullAddress(bc.getRelativePath("/")),
+		a.getFullAddress(bc.getRelativePath(commentPath+commentSignInCallbackSubPath)),
+		a.httpClient,
+	)
+}
+
+// Only allows redirects to this installation
+func (a *goBlog) commentSignInRedirect(bc *configBlog, redirect string) string {
+	local := redirect
+	if strings.HasPrefix(redirect, a.cfg.Server.PublicAddress+"/") {
+		local = strings.TrimPrefix(redirect, a.cfg.Server.PublicAddress)
+	}
+	if strings.HasPrefix(local, "/") && isLocalRedirect(local) {
+		return redirect
+	}
+	return bc.getRelativePath("/")
+}
+
+type commentSignInRenderData struct {
+	commenter *commenter
+	redirect  string
+	emailSent bool
+	// Address to confirm before sending the sign in email
+	me, email string
+}
+
+func (a *goBlog) serveCommentSignIn(w http.ResponseWriter, r *http.Request) {
+	_, bc := a.getBlog(r)
+	a.render(w, r, a.renderCommentSignIn, &renderData{
+		Data: &commentSignInRenderData{
+			commenter: a.getCommenter(r),
+			redirect:  a.commentSignInRedirect(bc, r.FormValue("redirect")),
+		},
+	})
+}
+
+// Starts the sign in with IndieAuth, falls back to RelMeAuth with a rel=me email address
+func (a *goBlog) startCommentSignIn(w http.ResponseWriter, r *http.Request) {
+	_, bc := a.getBlog(r)
+	me := indieauth.CanonicalizeURL(strings.TrimSpace(r.FormValue("me")))
+	if err := indieauth.IsValidProfileURL(me); err != nil {
+		a.serveError(w, r, "invalid website: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ses, err := a.commenterSessions.Get(r, commenterSessionName)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redirect := a.commentSignInRedirect(bc, r.FormValue("redirect"))
+	ses.Values["redirect"] = redirect
+	// IndieAuth
+	authInfo, authURL, err := a.commenterIndieAuthClient(bc).Authenticate(me, "profile")
+	if err == nil {
+		authInfoJSON, _ := json.Marshal(authInfo)
+		ses.Values["authinfo"] = string(authInfoJSON)
+		if err = a.commenterSessions.Save(r, w, ses); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, authURL, http.StatusFound)
+		return
+	}
+	// RelMeAuth with email
+	profile, err := a.fetchCommenterProfile(r, me)
+	if err != nil || len(profile.emails) == 0 || !bc.Contact.smtpConfigured() {
+		a.serveError(w, r, "no IndieAuth server or rel=me email address in the h-card found on the website", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("confirm") == "" {
+		// Show the address before sending
+		a.render(w, r, a.renderCommentSignIn, &renderData{
+			Data: &commentSignInRenderData{
+				redirect: redirect,
+				me:       me,
+				email:    profile.emails[0],
+			},
+		})
+		return
+	}
+	// Only send to the shown address
+	email, ok := lo.Find(profile.emails, func(e string) bool { return strings.EqualFold(e, r.FormValue("email")) })
+	if !ok {
+		a.serveError(w, r, "the email address is no longer linked on the website", http.StatusBadRequest)
+		return
+	}
+	if !a.commentSignInEmailAllowed(email) {
+		a.serveError(w, r, "too many sign in emails sent to this address, please try again later", http.StatusTooManyRequests)
+		return
+	}
+	token := randomString(32)
+	ses.Values["emailtoken"] = hashCommentToken(token)
+	ses.Values["emailexpires"] = time.Now().Add(commentSignInEmailTTL).Unix()
+	ses.Values["pendingme"], ses.Values["pendingname"], ses.Values["pendingphoto"] = me, profile.Name, profile.Photo
+	if err = a.commenterSessions.Save(r, w, ses); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := bufferpool.Get()
+	defer bufferpool.Put(body)
+	_, _ = fmt.Fprintf(
+		body, "%s\n\n%s\n",
+		a.ts.GetTemplateStringVariant(bc.Lang, "commentsigninemailtext"),
+		a.getFullAddress(bc.getRelativePath(commentPath+commentSignInEmailSubPath))+"?token="+token,
+	)
+	subject, text := a.ts.GetTemplateStringVariant(bc.Lang, "commentsigninwithdomain"), body.String()
+	go func() {
+		if err := a.sendEmail(bc.Contact, email, subject, text, "", ""); err != nil {
+			log.Println("Failed to send sign in email:", err.Error())
+		}
+	}()
+	a.render(w, r, a.renderCommentSignIn, &renderData{
+		Data: &commentSignInRenderData{
+			redirect:  redirect,
+			emailSent: true,
+			email:     email,
+		},
+	})
+}
+
+// Limits the sign in emails per address, so the fallback can't be used to flood a mailbox
+func (a *goBlog) commentSignInEmailAllowed(email string) bool {
+	a.commentSignInEmailsInit.Do(func() {
+		a.commentSignInEmailsLimiter = &rateLimiter{
+			rate:    float64(commentSignInEmailsPerHour) / time.Hour.Seconds(),
+			burst:   commentSignInEmailsPerHour,
+			buckets: map[string]*rateLimitBucket{},
+		}
+	})
+	allowed, _ := a.commentSignInEmailsLimiter.take(strings.ToLower(email), time.Now())
+	return allowed
+}
+
+// Finishes the IndieAuth sign in
+func (a *goBlog) commentSignInCallback(w http.ResponseWriter, r *http.Request) {
+	_, bc := a.getBlog(r)
+	ses, err := a.commenterSessions.Get(r, commenterSessionName)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	authInfoJSON, _ := ses.Values["authinfo"].(string)
+	authInfo := &indieauth.AuthInfo{}
+	if authInfoJSON == "" || json.Unmarshal([]byte(authInfoJSON), authInfo) != nil {
+		a.serveError(w, r, "no sign in started", http.StatusBadRequest)
+		return
+	}
+	delete(ses.Values, "authinfo")
+	client := a.commenterIndieAuthClient(bc)
+	code, err := client.ValidateCallback(authInfo, r)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	profile, err := client.FetchProfile(authInfo, code)
+	if err != nil {
+		a.serveError(w, r, "failed to verify sign in: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = a.verifyCommenterProfileURL(client, authInfo, profile.Me); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, photo := profile.Profile.Name, profile.Profile.Photo
+	if name == "" || photo == "" {
+		// Use the h-card of the website
+		if hcard, err := a.fetchCommenterProfile(r, profile.Me); err == nil {
+			name, photo = defaultIfEmpty(name, hcard.Name), defaultIfEmpty(photo, hcard.Photo)
+		}
+	}
+	a.finishCommentSignIn(w, r, bc, ses, profile.Me, name, photo)
+}
+
+// The returned profile URL must be the requested one or use the same authorization endpoint
+func (*goBlog) verifyCommenterProfileURL(client *indieauth.Client, authInfo *indieauth.AuthInfo, me string) error {
+	if me == authInfo.Me {
+		return nil
+	}
+	meURL, err := url.Parse(me)
+	if err != nil || indieauth.IsValidProfileURL(me) != nil {
+		return errors.New("invalid profile URL")
+	}
+	requestedURL, _ := url.Parse(authInfo.Me)
+	if meURL.Host == requestedURL.Host {
+		return nil
+	}
+	metadata, err := client.DiscoverMetadata(me)
+	if err != nil || metadata.AuthorizationEndpoint != authInfo.AuthorizationEndpoint {
+		return errors.New("profile URL doesn't match the authorization endpoint")
+	}
+	return nil
+}
+
+// Finishes the sign in with the link sent to the rel=me email address
+func (a *goBlog) commentSignInEmail(w http.ResponseWriter, r *http.Request) {
+	_, bc := a.getBlog(r)
+	ses, err := a.commenterSessions.Get(r, commenterSessionName)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hashedToken, _ := ses.Values["emailtoken"].(string)
+	expires, _ := ses.Values["emailexpires"].(int64)
+	if hashedToken == "" || time.Now().Unix() > expires ||
+		subtle.ConstantTimeCompare([]byte(hashCommentToken(r.FormValue("token"))), []byte(hashedToken)) != 1 {
+		a.serveError(w, r, "invalid or expired sign in link, it has to be opened in the same browser", http.StatusBadRequest)
+		return
+	}
+	me, _ := ses.Values["pendingme"].(string)
+	name, _ := ses.Values["pendingname"].(string)
+	photo, _ := ses.Values["pendingphoto"].(string)
+	for _, key := range []string{"emailtoken", "emailexpires", "pendingme", "pendingname", "pendingphoto"} {
+		delete(ses.Values, key)
+	}
+	a.finishCommentSignIn(w, r, bc, ses, me, name, photo)
+}
+
+func (a *goBlog) finishCommentSignIn(w http.ResponseWriter, r *http.Request, bc *configBlog, ses *sessions.Session, me, name, photo string) {
+	ses.Values["me"], ses.Values["name"] = me, cleanHTMLText(name)
+	ses.Values["photo"] = ""
+	if isAbsoluteURL(photo) {
+		ses.Values["photo"] = photo
+	}
+	redirect, _ := ses.Values["redirect"].(string)
+	delete(ses.Values, "redirect")
+	if err := a.commenterSessions.Save(r, w, ses); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, a.commentSignInRedirect(bc, redirect), http.StatusFound)
+}
+
+func (a *goBlog) commentSignOut(w http.ResponseWriter, r *http.Request) {
+	_, bc := a.getBlog(r)
+	if ses, err := a.commenterSessions.Get(r, commenterSessionName); err == nil && !ses.IsNew {
+		_ = a.commenterSessions.Delete(r, w, ses)
+	}
+	http.Redirect(w, r, a.commentSignInRedirect(bc, r.FormValue("redirect")), http.StatusFound)
+}
+
+type commenterProfile struct {
+	Name, Photo string
+	emails      []string
+}
+
+// Fetches the representative h-card and the rel=me email addresses of the website that are also in its own h-card
+func (a *goBlog) fetchCommenterProfile(r *http.Request, me string) (*commenterProfile, error) {
+	meURL, err := url.Parse(me)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	err = requests.URL(me).Client(a.httpClient).Accept(contenttype.HTMLUTF8).
+		Handle(func(res *http.Response) (err error) {
+			defer res.Body.Close()
+			meURL = res.Request.URL
+			body, err = io.ReadAll(io.LimitReader(res.Body, 5*bodylimit.MB))
+			return
+		}).
+		Fetch(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	data := microformats.Parse(bytes.NewReader(body), meURL)
+	profile := &commenterProfile{}
+	// Prefer the h-card of the website itself, otherwise use the first one
+	isOwn := func(item *microformats.Microformat) bool {
+		for _, u := range append(mfStrings(item, "url"), mfStrings(item, "uid")...) {
+			if u == me || u == meURL.String() {
+				return true
+			}
+		}
+		return false
+	}
+	var hcard *microformats.Microformat
+	own := false
+	for _, item := range data.Items {
+		if !mfHasType(item, "h-card") || own {
+			continue
+		}
+		if own = isOwn(item); hcard == nil || own {
+			hcard = item
+		}
+	}
+	if hcard == nil {
+		return profile, nil
+	}
+	if names := mfStrings(hcard, "name"); len(names) > 0 {
+		profile.Name = strings.TrimSpace(names[0])
+	}
+	if photos := mfStrings(hcard, "photo"); len(photos) > 0 {
+		profile.Photo = photos[0]
+	}
+	if !own {
+		return profile, nil
+	}
+	// Only email addresses that are linked with rel=me and also in the own h-card
+	hcardEmails := lo.Map(mfStrings(hcard, "email"), func(e string, _ int) string {
+		return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), "mailto:"))
+	})
+	for _, rel := range data.Rels["me"] {
+		if email, ok := strings.CutPrefix(rel, "mailto:"); ok && email != "" && lo.Contains(hcardEmails, strings.ToLower(email)) {
+			profile.emails = append(profile.emails, email)
+		}
+	}
+	return profile, nil
+}
+
+// Returns the string values of a microformats property, image values with alt text are supported
+func mfStrings(mf *microformats.Microformat, property string) (values []string) {
+	for _, v := range mf.Properties[property] {
+		switch value := v.(type) {
+		case string:
+			values = append(values, value)
+		case map[string]string:
+			if value["value"] != "" {
+				values = append(values, value["value"])
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	netmail "net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.goblog.app/app/pkgs/contenttype"
+	"go.goblog.app/app/pkgs/mocksmtp"
+)
+
+func Test_commentsSignIn(t *testing.T) {
+	port, rd, cancel, err := mocksmtp.StartMockSMTPServer()
+	require.NoError(t, err)
+	defer cancel()
+
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Comments: &configComments{
+				Enabled:    true,
+				SignIn:     true,
+				Moderation: commentsModerationVerified,
+			},
+			Contact: &configContact{
+				SMTPPort:  port,
+				SMTPHost:  "127.0.0.1",
+				EmailFrom: "from@example.org",
+			},
+		},
+	}
+	app.cfg.DefaultBlog = "en"
+
+	err = app.initConfig(false)
+	require.NoError(t, err)
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "https://alice.example/":
+			w.Header().Set("Link", `<https://auth.example/metadata>; rel="indieauth-metadata"`)
+			_, _ = w.Write([]byte(`<html><body><div class="h-card"><a class="u-url p-name" href="/">Alice</a></div></body></html>`))
+		case "https://auth.example/metadata":
+			_, _ = w.Write([]byte(`{"issuer":"https://auth.example/","authorization_endpoint":"https://auth.example/auth","token_endpoint":"https://auth.example/token"}`))
+		case "https://auth.example/auth":
+			_ = r.ParseForm()
+			if r.Method != http.MethodPost || r.Form.Get("code") != "secretcode" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"me":"https://alice.example/","profile":{"name":"Alice Example","photo":"https://alice.example/photo.jpg"}}`))
+		case "https://bob.example/":
+			_, _ = w.Write([]byte(`<html><body>
+<div class="h-card"><a class="u-url p-name" href="https://bob.example/">Bob</a><img class="u-photo" src="/bob.jpg" alt="Bob"><a class="u-email" href="mailto:Bob@example.net">Email</a></div>
+<a rel="me" href="mailto:bob@example.net">Email</a>
+<a rel="me" href="mailto:other@example.net">Other</a>
+</body></html>`))
+		case "https://dave.example/":
+			_, _ = w.Write([]byte(`<html><body>
+<div class="h-card"><a class="u-url p-name" href="https://dave.example/">Dave</a></div>
+<div class="h-card"><a class="u-url p-name" href="https://mallory.example/">Mallory</a><a class="u-email" href="mailto:victim@example.net">Email</a></div>
+<a rel="me" href="mailto:victim@example.net">Email</a>
+</body></html>`))
+		case "https://carol.example/":
+			_, _ = w.Write([]byte(`<html><body>Nothing here</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	mux := chi.NewMux()
+	mux.Use(middleware.WithValue(blogKey, "en"))
+	mux.Post(commentPath, app.createCommentFromRequest)
+	mux.Get(commentPath+commentSignInSubPath, app.serveCommentSignIn)
+	mux.Post(commentPath+commentSignInSubPath, app.startCommentSignIn)
+	mux.Get(commentPath+commentSignInCallbackSubPath, app.commentSignInCallback)
+	mux.Get(commentPath+commentSignInEmailSubPath, app.commentSignInEmail)
+	mux.Post(commentPath+commentSignOutSubPath, app.commentSignOut)
+
+	var cookie *http.Cookie
+	do := func(method, target string, values url.Values) *httptest.ResponseRecorder {
+		var req *http.Request
+		if values != nil {
+			req = httptest.NewRequest(method, target, strings.NewReader(values.Encode()))
+			req.Header.Add(contentType, contenttype.WWWForm)
+		} else {
+			req = httptest.NewRequest(method, target, nil)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == commenterSessionName {
+				cookie = c
+				if c.MaxAge < 0 {
+					cookie = nil
+				}
+			}
+		}
+		return rec
+	}
+
+	t.Run("IndieAuth", func(t *testing.T) {
+		cookie = nil
+		rec := do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"alice.example"}, "redirect": {"/test"}})
+		require.Equal(t, http.StatusFound, rec.Code)
+		authURL, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "auth.example", authURL.Host)
+		assert.Equal(t, "http://localhost:8080", authURL.Query().Get("client_id"))
+		assert.Equal(t, "http://localhost:8080/comment/signin/callback", authURL.Query().Get("redirect_uri"))
+		require.NotNil(t, cookie)
+
+		// Wrong state
+		rec = do(http.MethodGet, commentPath+commentSignInCallbackSubPath+"?code=secretcode&iss=https://auth.example/&state=wrong", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		// Restart and finish
+		rec = do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"alice.example"}, "redirect": {"/test"}})
+		require.Equal(t, http.StatusFound, rec.Code)
+		authURL, _ = url.Parse(rec.Header().Get("Location"))
+		rec = do(http.MethodGet, commentPath+commentSignInCallbackSubPath+"?"+url.Values{
+			"code": {"secretcode"}, "iss": {"https://auth.example/"}, "state": {authURL.Query().Get("state")},
+		}.Encode(), nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+		assert.Equal(t, "/test", rec.Header().Get("Location"))
+
+		// Sign in page shows the commenter
+		rec = do(http.MethodGet, commentPath+commentSignInSubPath, nil)
+		assert.Contains(t, rec.Body.String(), "Alice Example")
+
+		// Comment is verified and approved
+		rec = do(http.MethodPost, commentPath, url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Hi"}, "name": {"Mallory"}})
+		require.Equal(t, http.StatusFound, rec.Code)
+		comments, err := app.db.getComments(&commentsRequestConfig{id: 1})
+		require.NoError(t, err)
+		require.Len(t, comments, 1)
+		assert.Equal(t, "Alice Example", comments[0].Name)
+		assert.Equal(t, "https://alice.example/", comments[0].Website)
+		assert.Equal(t, "https://alice.example/photo.jpg", comments[0].Photo)
+		assert.True(t, comments[0].Verified)
+		assert.Equal(t, commentStatusApproved, comments[0].Status)
+
+		// Sign out, anonymous comments are still possible but moderated
+		rec = do(http.MethodPost, commentPath+commentSignOutSubPath, url.Values{"redirect": {"/test"}})
+		require.Equal(t, http.StatusFound, rec.Code)
+		assert.Nil(t, cookie)
+		rec = do(http.MethodPost, commentPath, url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Hi"}, "name": {"Alice Example"}, "website": {"https://alice.example/"}})
+		require.Equal(t, http.StatusOK, rec.Code)
+		comments, err = app.db.getComments(&commentsRequestConfig{id: 2})
+		require.NoError(t, err)
+		require.Len(t, comments, 1)
+		assert.False(t, comments[0].Verified)
+		assert.Equal(t, commentStatusPending, comments[0].Status)
+	})
+
+	t.Run("RelMeAuth", func(t *testing.T) {
+		cookie = nil
+		rec := do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"https://bob.example/"}, "redirect": {"https://evil.example/"}})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// The address is shown before sending
+		assert.Contains(t, rec.Body.String(), "bob@example.net")
+		assert.NotContains(t, rec.Body.String(), "other@example.net")
+		assert.Contains(t, rec.Body.String(), "name=confirm")
+		time.Sleep(100 * time.Millisecond)
+		assert.Len(t, rd.Datas, 0)
+
+		// Only addresses from the h-card are accepted
+		rec = do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"https://bob.example/"}, "email": {"other@example.net"}, "confirm": {"1"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{
+			"me": {"https://bob.example/"}, "email": {"bob@example.net"}, "confirm": {"1"}, "redirect": {"https://evil.example/"},
+		})
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "bob@example.net")
+
+		// Get link from email
+		for i := 0; i < 20 && len(rd.Datas) < 1; i++ {
+			time.Sleep(50 * time.Millisecond)
+		}
+		require.Len(t, rd.Datas, 1)
+		assert.Equal(t, []string{"bob@example.net"}, rd.Rcpts)
+		msg, err := netmail.ReadMessage(bytes.NewReader(rd.Datas[0]))
+		require.NoError(t, err)
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		require.NoError(t, err)
+		link := regexp.MustCompile(`http://localhost:8080(/comment/signin/email\?token=[a-z]+)`).FindStringSubmatch(string(body))
+		require.Len(t, link, 2)
+
+		// Wrong token
+		rec = do(http.MethodGet, commentPath+commentSignInEmailSubPath+"?token=wrong", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		// Sign in, redirects only to this blog
+		rec = do(http.MethodGet, link[1], nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+		assert.Equal(t, "/", rec.Header().Get("Location"))
+
+		// The link can only be used once
+		rec = do(http.MethodGet, link[1], nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		commenter := app.getCommenter(req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+		require.NotNil(t, commenter)
+		assert.Equal(t, "https://bob.example/", commenter.Me)
+		assert.Equal(t, "Bob", commenter.Name)
+		assert.Equal(t, "https://bob.example/bob.jpg", commenter.Photo)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		cookie = nil
+		rec := do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"https://carol.example/"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		// The email address is only in the h-card of another website
+		rec = do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"https://dave.example/"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		rec = do(http.MethodPost, commentPath+commentSignInSubPath, url.Values{"me": {"https://127.0.0.1/"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("EmailLimit", func(t *testing.T) {
+		cookie = nil
+		confirm := url.Values{"me": {"https://bob.example/"}, "email": {"bob@example.net"}, "confirm": {"1"}}
+		// One email was already sent in the RelMeAuth test
+		for i := 1; i < commentSignInEmailsPerHour; i++ {
+			rec := do(http.MethodPost, commentPath+commentSignInSubPath, confirm)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		rec := do(http.MethodPost, commentPath+commentSignInSubPath, confirm)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		// The address is compared case-insensitively
+		confirm.Set("email", "BOB@example.net")
+		rec = do(http.MethodPost, commentPath+commentSignInSubPath, confirm)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		bc := app.cfg.Blogs["en"]
+		assert.Equal(t, "/test", app.commentSignInRedirect(bc, "/test"))
+		assert.Equal(t, "http://localhost:8080/test#interactions", app.commentSignInRedirect(bc, "http://localhost:8080/test#interactions"))
+		for _, redirect := range []string{
+			"", "test", "//evil.example", "/\\evil.example", "\\\\evil.example", "https://evil.example/",
+			"http://localhost:8080.evil.example/", "http://localhost:8080//evil.example", "javascript:alert(1)",
+		} {
+			assert.Equal(t, "/", app.commentSignInRedirect(bc, redirect), redirect)
+		}
+	})
+}
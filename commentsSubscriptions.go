@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"go.goblog.app/app/pkgs/bufferpool"
+)
+
+const (
+	commentSubscriptionConfirmSubPath     = "/subscription/confirm"
+	commentSubscriptionUnsubscribeSubPath = "/subscription/unsubscribe"
+)
+
+type commentSubscription struct {
+	Comment   int
+	Email     string
+	Token     string
+	Confirmed bool
+}
+
+// Commenters can subscribe to replies if enabled and the SMTP settings of the contact config are set
+func (blog *configBlog) commentsEmailEnabled() bool {
+	return blog.commentsEnabled() && blog.Comments.EmailNotifications && blog.Contact.smtpConfigured()
+}
+
+func (db *database) createCommentSubscription(comment int, email string) error {
+	_, err := db.Exec(
+		"insert or replace into comment_subscriptions (comment, email, token, confirmed) values (@comment, @email, @token, 0)",
+		sql.Named("comment", comment), sql.Named("email", email), sql.Named("token", randomString(32)),
+	)
+	return err
+}
+
+func (db *database) getCommentSubscription(comment int) (*commentSubscription, error) {
+	row, err := db.QueryRow(
+		"select comment, email, token, confirmed from comment_subscriptions where comment = @comment",
+		sql.Named("comment", comment),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s := &commentSubscription{}
+	if err = row.Scan(&s.Comment, &s.Email, &s.Token, &s.Confirmed); errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (db *database) confirmCommentSubscription(token string) (bool, error) {
+	result, err := db.Exec("update comment_subscriptions set confirmed = 1 where token = @token", sql.Named("token", token))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (db *database) commentSubscriptionExists(token string) (bool, error) {
+	row, err := db.QueryRow("select exists(select 1 from comment_subscriptions where token = @token)", sql.Named("token", token))
+	if err != nil {
+		return false, err
+	}
+	var exists bool
+	err = row.Scan(&exists)
+	return exists, err
+}
+
+func (db *database) deleteCommentSubscription(token string) (bool, error) {
+	result, err := db.Exec("delete from comment_subscriptions where token = @token", sql.Named("token", token))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Saves the subscription of a new comment, the confirmation is sent once the comment is public
+func (a *goBlog) subscribeToCommentReplies(bc *configBlog, commentID int, email string, status commentStatus) {
+	if err := a.db.createCommentSubscription(commentID, email); err != nil {
+		log.Println("Failed to save comment subscription:", err.Error())
+		return
+	}
+	if status == commentStatusApproved {
+		a.sendCommentSubscriptionConfirmation(bc, commentID)
+	}
+}
+
+func (a *goBlog) commentSubscriptionURL(bc *configBlog, subPath, token string) string {
+	return a.getFullAddress(bc.getRelativePath(commentPath+subPath)) + "?token=" + url.QueryEscape(token)
+}
+
+// Asks the commenter to confirm the subscription (double opt-in)
+func (a *goBlog) sendCommentSubscriptionConfirmation(bc *configBlog, commentID int) {
+	if !bc.commentsEmailEnabled() {
+		return
+	}
+	s, err := a.db.getCommentSubscription(commentID)
+	if err != nil || s == nil || s.Confirmed {
+		return
+	}
+	body := bufferpool.Get()
+	defer bufferpool.Put(body)
+	_, _ = fmt.Fprintf(
+		body, "%s\n\n%s\n\n%s\n",
+		a.ts.GetTemplateStringVariant(bc.Lang, "commentconfirmtext"),
+		a.commentSubscriptionURL(bc, commentSubscriptionConfirmSubPath, s.Token),
+		a.getFullAddress(bc.getRelativePath(path.Join(commentPath, strconv.Itoa(commentID)))),
+	)
+	a.sendCommentSubscriptionEmail(bc, s, "commentconfirmsubject", body.String(), "")
+}
+
+// Notifies the confirmed subscriber of the parent comment about an approved reply
+func (a *goBlog) notifyCommentReply(bc *configBlog, parent, replyID int, name, text string) {
+	if parent == 0 || !bc.commentsEmailEnabled() {
+		return
+	}
+	s, err := a.db.getCommentSubscription(parent)
+	if err != nil || s == nil || !s.Confirmed {
+		return
+	}
+	unsubscribe := a.commentSubscriptionURL(bc, commentSubscriptionUnsubscribeSubPath, s.Token)
+	body := bufferpool.Get()
+	defer bufferpool.Put(body)
+	_, _ = fmt.Fprintf(
+		body, "%s\n\n%s:\n%s\n\n%s\n\n%s: %s\n",
+		a.ts.GetTemplateStringVariant(bc.Lang, "commentreplytext"),
+		name, text,
+		a.getFullAddress(bc.getRelativePath(path.Join(commentPath, strconv.Itoa(replyID)))),
+		a.ts.GetTemplateStringVariant(bc.Lang, "unsubscribe"), unsubscribe,
+	)
+	a.sendCommentSubscriptionEmail(bc, s, "commentreplysubject", body.String(), unsubscribe)
+}
+
+func (a *goBlog) sendCommentSubscriptionEmail(bc *configBlog, s *commentSubscription, subjectKey, body, unsubscribe string) {
+	subject := a.ts.GetTemplateStringVariant(bc.Lang, subjectKey)
+	go func() {
+		if err := a.sendEmail(bc.Contact, s.Email, subject, body, "", unsubscribe); err != nil {
+			log.Println("Failed to send comment subscription email:", err.Error())
+		}
+	}()
+}
+
+// The link (GET) only shows a form, so link previews and scanners don't confirm the subscription (POST)
+func (a *goBlog) serveCommentSubscriptionConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		a.commentSubscriptionAction(w, r, a.db.confirmCommentSubscription, "subscriptionconfirmed")
+		return
+	}
+	token := r.FormValue("token")
+	if token == "" {
+		a.serveError(w, r, "token missing", http.StatusBadRequest)
+		return
+	}
+	exists, err := a.db.commentSubscriptionExists(token)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		a.serve404(w, r)
+		return
+	}
+	a.render(w, r, a.renderCommentSubscriptionConfirm, &renderData{
+		Data: token,
+	})
+}
+
+// Works with links (GET) and one-click unsubscribe of email clients (POST)
+func (a *goBlog) serveCommentSubscriptionUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	a.commentSubscriptionAction(w, r, a.db.deleteCommentSubscription, "unsubscribed")
+}
+
+func (a *goBlog) commentSubscriptionAction(w http.ResponseWriter, r *http.Request, action func(string) (bool, error), message string) {
+	token := r.FormValue("token")
+	if token == "" {
+		a.serveError(w, r, "token missing", http.StatusBadRequest)
+		return
+	}
+	ok, err := action(token)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.serve404(w, r)
+		return
+	}
+	a.render(w, r, a.renderCommentSubscription, &renderData{
+		Data: message,
+	})
+}
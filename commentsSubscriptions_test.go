@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.goblog.app/app/pkgs/contenttype"
+	"go.goblog.app/app/pkgs/mocksmtp"
+)
+
+func Test_commentsSubscriptions(t *testing.T) {
+	// Start the SMTP server
+	port, rd, cancel, err := mocksmtp.StartMockSMTPServer()
+	require.NoError(t, err)
+	defer cancel()
+
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Comments: &configComments{
+				Enabled:            true,
+				EmailNotifications: true,
+			},
+			Contact: &configContact{
+				SMTPPort:  port,
+				SMTPHost:  "127.0.0.1",
+				EmailFrom: "from@example.org",
+			},
+		},
+	}
+	app.cfg.DefaultBlog = "en"
+
+	err = app.initConfig(false)
+	require.NoError(t, err)
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	bc := app.cfg.Blogs["en"]
+	require.True(t, bc.commentsEmailEnabled())
+
+	postComment := func(values url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, commentPath, strings.NewReader(values.Encode()))
+		req.Header.Add(contentType, contenttype.WWWForm)
+		rec := httptest.NewRecorder()
+		app.createCommentFromRequest(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+		return rec
+	}
+	subscriptionRequest := func(method, subPath, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, commentPath+subPath+"?token="+token, nil)
+		rec := httptest.NewRecorder()
+		handler := app.serveCommentSubscriptionConfirm
+		if subPath == commentSubscriptionUnsubscribeSubPath {
+			handler = app.serveCommentSubscriptionUnsubscribe
+		}
+		handler(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+		return rec
+	}
+	readMail := func(i int) (*netmail.Message, string) {
+		msg, err := netmail.ReadMessage(bytes.NewReader(rd.Datas[i]))
+		require.NoError(t, err)
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		require.NoError(t, err)
+		return msg, string(body)
+	}
+	waitForMails := func(n int) {
+		for i := 0; i < 20 && len(rd.Datas) < n; i++ {
+			time.Sleep(50 * time.Millisecond)
+		}
+		require.Len(t, rd.Datas, n)
+	}
+
+	// Invalid email
+	rec := postComment(url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Hi"}, "email": {"invalid"}, "notify": {"true"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Email without opt-in is ignored
+	rec = postComment(url.Values{"target": {"http://localhost:8080/test"}, "comment": {"First"}, "email": {"first@example.net"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	s, err := app.db.getCommentSubscription(1)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	// Subscribe
+	rec = postComment(url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Second"}, "email": {"Alice <alice@example.net>"}, "notify": {"true"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	s, err = app.db.getCommentSubscription(2)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	assert.Equal(t, "alice@example.net", s.Email)
+	assert.False(t, s.Confirmed)
+
+	// Confirmation email
+	waitForMails(1)
+	assert.Equal(t, []string{"alice@example.net"}, rd.Rcpts)
+	_, body := readMail(0)
+	assert.Contains(t, body, "http://localhost:8080/comment/subscription/confirm?token="+s.Token)
+
+	// The email is never displayed
+	commentRec := httptest.NewRecorder()
+	commentReq := httptest.NewRequest(http.MethodGet, "/comment/2", nil)
+	app.render(commentRec, commentReq.WithContext(context.WithValue(commentReq.Context(), blogKey, "en")), app.renderComment, &renderData{Data: &comment{ID: 2, Target: "/test", Comment: "Second"}})
+	assert.NotContains(t, commentRec.Body.String(), "alice@example.net")
+
+	// No reply notification before confirmation
+	_, _, _, err = app.createComment(bc, "http://localhost:8080/test", "Early reply", "Bob", "", "", 2, "")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, rd.Datas, 1)
+
+	// Confirm
+	rec = subscriptionRequest(http.MethodGet, commentSubscriptionConfirmSubPath, "wrong")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = subscriptionRequest(http.MethodGet, commentSubscriptionConfirmSubPath, s.Token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "method=post")
+	s, err = app.db.getCommentSubscription(2)
+	require.NoError(t, err)
+	assert.False(t, s.Confirmed)
+	rec = subscriptionRequest(http.MethodPost, commentSubscriptionConfirmSubPath, s.Token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	s, err = app.db.getCommentSubscription(2)
+	require.NoError(t, err)
+	assert.True(t, s.Confirmed)
+
+	// Reply notification
+	_, _, _, err = app.createComment(bc, "http://localhost:8080/test", "Great comment!", "Bob", "", "", 2, "")
+	require.NoError(t, err)
+	waitForMails(2)
+	msg, body := readMail(1)
+	assert.Contains(t, body, "Great comment!")
+	assert.Contains(t, body, "http://localhost:8080/comment/4")
+	assert.Equal(t, "<http://localhost:8080/comment/subscription/unsubscribe?token="+s.Token+">", strings.TrimSpace(msg.Header.Get("List-Unsubscribe")))
+	assert.Equal(t, "List-Unsubscribe=One-Click", msg.Header.Get("List-Unsubscribe-Post"))
+
+	// One-click unsubscribe
+	rec = subscriptionRequest(http.MethodPost, commentSubscriptionUnsubscribeSubPath, s.Token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	s, err = app.db.getCommentSubscription(2)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	// No more notifications
+	_, _, _, err = app.createComment(bc, "http://localhost:8080/test", "Another reply", "Bob", "", "", 2, "")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, rd.Datas, 2)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -98,7 +100,7 @@ func Test_comments(t *testing.T) {
 
 		// Delete comment
 
-		err = app.db.deleteComment(1)
+		err = app.deleteComment(app.cfg.Blogs["en"], &comment{ID: 1, Target: "/test"})
 		require.NoError(t, err)
 		cc, err = app.db.countComments(&commentsRequestConfig{})
 		require.NoError(t, err)
@@ -139,7 +141,7 @@ func Test_comments(t *testing.T) {
 
 		// Delete comment
 
-		err = app.db.deleteComment(2)
+		err = app.deleteComment(app.cfg.Blogs["en"], &comment{ID: 2, Target: "/test"})
 		require.NoError(t, err)
 
 	})
@@ -215,7 +217,7 @@ func Test_commentsUpdateByOriginal(t *testing.T) {
 
 	bc := app.cfg.Blogs[app.cfg.DefaultBlog]
 
-	addr, _, err := app.createComment(bc, "https://example.com/abc", "Test", "Name", "https://example.org", "https://example.org/1")
+	addr, _, _, err := app.createComment(bc, "https://example.com/abc", "Test", "Name", "https://example.org", "https://example.org/1", 0, "")
 	require.NoError(t, err)
 
 	splittedAddr := strings.Split(addr, "/")
@@ -233,7 +235,7 @@ func Test_commentsUpdateByOriginal(t *testing.T) {
 	assert.Equal(t, "https://example.org", comment.Website)
 	assert.Equal(t, "https://example.org/1", comment.Original)
 
-	_, _, err = app.createComment(bc, "https://example.com/abc", "Edited comment", "Edited name", "", "https://example.org/1")
+	_, _, _, err = app.createComment(bc, "https://example.com/abc", "Edited comment", "Edited name", "", "https://example.org/1", 0, "")
 	require.NoError(t, err)
 
 	comments, err = app.db.getComments(&commentsRequestConfig{id: id})
@@ -248,3 +250,290 @@ func Test_commentsUpdateByOriginal(t *testing.T) {
 	assert.Equal(t, "", comment.Website)
 
 }
+
+func Test_commentsModeration(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Comments: &configComments{
+				Enabled:    true,
+				Moderation: commentsModerationKnown,
+			},
+		},
+	}
+	app.cfg.DefaultBlog = "en"
+
+	err := app.initConfig(false)
+	require.NoError(t, err)
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	bc := app.cfg.Blogs["en"]
+
+	countQueue := func() (count int) {
+		for {
+			qi, err := app.peekQueue(context.Background(), "wm")
+			require.NoError(t, err)
+			if qi == nil {
+				return
+			}
+			require.NoError(t, app.dequeue(qi))
+			count++
+		}
+	}
+
+	mux := chi.NewMux()
+	mux.Use(middleware.WithValue(blogKey, "en"))
+	mux.Get("/comment/{id}", app.serveComment)
+	mux.Post("/comment"+commentApproveSubPath, app.commentsAdminApprove)
+	mux.Post("/comment"+commentSpamSubPath, app.commentsAdminSpam)
+	mux.Post("/comment"+commentDeleteSubPath, app.commentsAdminDelete)
+
+	// Unknown commenter has to wait for moderation
+	data := url.Values{}
+	data.Add("target", "http://localhost:8080/test")
+	data.Add("comment", "First comment")
+	data.Add("name", "Alice")
+	data.Add("website", "https://alice.example")
+
+	req := httptest.NewRequest(http.MethodPost, commentPath, strings.NewReader(data.Encode()))
+	req.Header.Add(contentType, contenttype.WWWForm)
+	rec := httptest.NewRecorder()
+	app.createCommentFromRequest(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	comments, err := app.db.getComments(&commentsRequestConfig{})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, commentStatusPending, comments[0].Status)
+	assert.Equal(t, 0, countQueue())
+
+	notifications, err := app.db.getNotifications(&notificationsRequestConfig{})
+	require.NoError(t, err)
+	if assert.Len(t, notifications, 1) {
+		assert.Contains(t, notifications[0].Text, "http://localhost:8080/comment?id=1")
+	}
+
+	// Pending comment is only visible when logged in
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/comment/1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/comment/1", nil)
+	setLoggedIn(req, true)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, app.isModeratedLocalComment("http://localhost:8080/comment/1"))
+
+	// Approve, redirects only stay on the site
+	req = httptest.NewRequest(http.MethodPost, "/comment"+commentApproveSubPath, strings.NewReader("commentid=1&redir=https%3A%2F%2Fevil.example"))
+	req.Header.Add(contentType, contenttype.WWWForm)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/comment", rec.Header().Get("Location"))
+
+	comments, err = app.db.getComments(&commentsRequestConfig{id: 1})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, commentStatusApproved, comments[0].Status)
+	assert.Equal(t, 1, countQueue())
+	assert.True(t, app.isModeratedLocalComment("http://localhost:8080/comment/1"))
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/comment/1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Name and website of a known commenter can be spoofed without signing in
+	addr, status, _, err := app.createComment(bc, "http://localhost:8080/test", "Second comment", "Alice", "https://alice.example", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, "/comment/2", addr)
+	assert.Equal(t, commentStatusPending, status)
+	assert.Equal(t, 0, countQueue())
+
+	// Signed in commenter with an approved verified comment is known
+	status, err = app.newCommentStatus(bc, "https://alice.example", true)
+	require.NoError(t, err)
+	assert.Equal(t, commentStatusPending, status)
+	require.NoError(t, app.db.setCommentVerified(1, ""))
+	status, err = app.newCommentStatus(bc, "https://alice.example", true)
+	require.NoError(t, err)
+	assert.Equal(t, commentStatusApproved, status)
+	status, err = app.newCommentStatus(bc, "https://bob.example", true)
+	require.NoError(t, err)
+	assert.Equal(t, commentStatusPending, status)
+
+	// Anonymous commenter isn't known
+	_, status, _, err = app.createComment(bc, "http://localhost:8080/test", "Third comment", "Alice", "", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, commentStatusPending, status)
+
+	// Mark as spam
+	req = httptest.NewRequest(http.MethodPost, "/comment"+commentSpamSubPath, strings.NewReader("commentid=2"))
+	req.Header.Add(contentType, contenttype.WWWForm)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	cc, err := app.db.countComments(&commentsRequestConfig{status: commentStatusSpam})
+	require.NoError(t, err)
+	assert.Equal(t, 1, cc)
+	cc, err = app.db.countComments(&commentsRequestConfig{status: commentStatusPending})
+	require.NoError(t, err)
+	assert.Equal(t, 1, cc)
+
+	// Moderate all
+	bc.Comments.Moderation = commentsModerationAll
+	_, status, _, err = app.createComment(bc, "http://localhost:8080/test", "Fourth comment", "Alice", "https://alice.example", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, commentStatusPending, status)
+
+	// Deleting also removes the comment from the post
+	require.NoError(t, app.db.insertWebmention(&mention{Source: "http://localhost:8080/comment/1", Target: "http://localhost:8080/test"}, webmentionStatusApproved))
+	deleteComment := func(id string) int {
+		req := httptest.NewRequest(http.MethodPost, "/comment"+commentDeleteSubPath, strings.NewReader("commentid="+id))
+		req.Header.Add(contentType, contenttype.WWWForm)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusFound, deleteComment("1"))
+	cc, err = app.db.countComments(&commentsRequestConfig{id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 0, cc)
+	cc, err = app.db.countWebmentions(&webmentionsRequestConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, cc)
+	assert.Equal(t, http.StatusNotFound, deleteComment("1"))
+}
+
+func Test_commentsReplies(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Comments: &configComments{
+				Enabled: true,
+			},
+		},
+	}
+	app.cfg.DefaultBlog = "en"
+	app.cfg.User.Name = "Author"
+
+	err := app.initConfig(false)
+	require.NoError(t, err)
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	bc := app.cfg.Blogs["en"]
+
+	queuedTargets := func() (targets []string) {
+		for {
+			qi, err := app.peekQueue(context.Background(), "wm")
+			require.NoError(t, err)
+			if qi == nil {
+				return
+			}
+			var m mention
+			require.NoError(t, gob.NewDecoder(bytes.NewReader(qi.content)).Decode(&m))
+			targets = append(targets, m.Target)
+			require.NoError(t, app.dequeue(qi))
+		}
+	}
+
+	_, _, _, err = app.createComment(bc, "http://localhost:8080/test", "Comment", "Alice", "", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://localhost:8080/test"}, queuedTargets())
+
+	// Reply using the parent
+	addr, _, _, err := app.createComment(bc, "http://localhost:8080/other", "Reply", "Bob", "", "", 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, "/comment/2", addr)
+	assert.Equal(t, []string{"http://localhost:8080/comment/1"}, queuedTargets())
+
+	// Reply using the comment as target
+	_, _, _, err = app.createComment(bc, "http://localhost:8080/comment/2", "Reply to reply", "Alice", "", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://localhost:8080/comment/2"}, queuedTargets())
+
+	comments, err := app.db.getComments(&commentsRequestConfig{})
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	assert.Equal(t, 2, comments[0].Parent)
+	assert.Equal(t, "/test", comments[0].Target)
+	assert.Equal(t, 1, comments[1].Parent)
+	assert.Equal(t, "/test", comments[1].Target)
+
+	// Parent has to exist
+	_, _, errStatus, err := app.createComment(bc, "http://localhost:8080/test", "Reply", "Bob", "", "", 10, "")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, errStatus)
+
+	// Reply from the admin
+	mux := chi.NewMux()
+	mux.Use(middleware.WithValue(blogKey, "en"))
+	mux.Post("/comment"+commentReplySubPath, app.commentsAdminReply)
+
+	req := httptest.NewRequest(http.MethodPost, "/comment"+commentReplySubPath, strings.NewReader("commentid=1&comment=Thanks"))
+	req.Header.Add(contentType, contenttype.WWWForm)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/comment/4", rec.Header().Get("Location"))
+
+	comments, err = app.db.getComments(&commentsRequestConfig{id: 4})
+	require.NoError(t, err)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "Author", comments[0].Name)
+		assert.Equal(t, "Thanks", comments[0].Comment)
+		assert.Equal(t, 1, comments[0].Parent)
+		assert.Equal(t, commentStatusApproved, comments[0].Status)
+	}
+
+	// Nested mentions
+	for _, m := range []*mention{
+		{Source: "http://localhost:8080/comment/1", Target: "http://localhost:8080/test"},
+		{Source: "http://localhost:8080/comment/2", Target: "http://localhost:8080/comment/1"},
+		{Source: "http://localhost:8080/comment/3", Target: "http://localhost:8080/comment/2"},
+	} {
+		require.NoError(t, app.db.insertWebmention(m, webmentionStatusApproved))
+	}
+	mentions := app.db.getWebmentionsByAddress("http://localhost:8080/test")
+	if assert.Len(t, mentions, 1) && assert.Len(t, mentions[0].Submentions, 1) && assert.Len(t, mentions[0].Submentions[0].Submentions, 1) {
+		assert.Equal(t, "http://localhost:8080/comment/3", mentions[0].Submentions[0].Submentions[0].Source)
+	}
+
+	// Replies of deleted comments move up to the parent
+	getComment := func(id int) *comment {
+		comments, err := app.db.getComments(&commentsRequestConfig{id: id})
+		require.NoError(t, err)
+		require.Len(t, comments, 1)
+		return comments[0]
+	}
+	require.NoError(t, app.deleteComment(bc, getComment(2)))
+	assert.Equal(t, 1, getComment(3).Parent)
+	mentions = app.db.getWebmentionsByAddress("http://localhost:8080/test")
+	if assert.Len(t, mentions, 1) && assert.Len(t, mentions[0].Submentions, 1) {
+		assert.Equal(t, "http://localhost:8080/comment/3", mentions[0].Submentions[0].Source)
+	}
+
+	require.NoError(t, app.deleteComment(bc, getComment(1)))
+	assert.Equal(t, 0, getComment(3).Parent)
+	assert.Equal(t, 0, getComment(4).Parent)
+	mentions = app.db.getWebmentionsByAddress("http://localhost:8080/test")
+	if assert.Len(t, mentions, 1) {
+		assert.Equal(t, "http://localhost:8080/comment/3", mentions[0].Source)
+		assert.Empty(t, mentions[0].Submentions)
+	}
+	cc, err := app.db.countComments(&commentsRequestConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, cc)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -30,10 +31,14 @@ type config struct {
 	Notifications *configNotifications   `mapstructure:"notifications"`
 	PrivateMode   *configPrivateMode     `mapstructure:"privateMode"`
 	IndexNow      *configIndexNow        `mapstructure:"indexNow"`
+	WebSub        *configWebSub          `mapstructure:"webSub"`
+	Microsub      *configMicrosub        `mapstructure:"microsub"`
 	EasterEgg     *configEasterEgg       `mapstructure:"easterEgg"`
 	MapTiles      *configMapTiles        `mapstructure:"mapTiles"`
 	TTS           *configTTS             `mapstructure:"tts"`
 	Reactions     *configReactions       `mapstructure:"reactions"`
+	SpamFilter    *configSpamFilter      `mapstructure:"spamFilter"`
+	RateLimit     *configRateLimit       `mapstructure:"rateLimit"`
 	Pprof         *configPprof           `mapstructure:"pprof"`
 	Debug         bool                   `mapstructure:"debug"`
 	initialized   bool
@@ -96,6 +101,8 @@ type configBlog struct {
 	Map            *configGeoMap             `mapstructure:"map"`
 	Contact        *configContact            `mapstructure:"contact"`
 	Announcement   *configAnnouncement       `mapstructure:"announcement"`
+	Podcast        *configPodcast            `mapstructure:"podcast"`
+	Captcha        *configCaptcha            `mapstructure:"captcha"`
 	name           string
 	// Configs read from database
 	hideOldContentWarning bool
@@ -165,6 +172,14 @@ type configBlogroll struct {
 	Categories  []string `mapstructure:"categories"`
 	Title       string   `mapstructure:"title"`
 	Description string   `mapstructure:"description"`
+	Latest      bool     `mapstructure:"latest"`
+}
+
+type configPodcast struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Category    string `mapstructure:"category"`
+	Subcategory string `mapstructure:"subcategory"`
+	Explicit    bool   `mapstructure:"explicit"`
 }
 
 type configRandomPost struct {
@@ -178,7 +193,11 @@ type configOnThisDay struct {
 }
 
 type configComments struct {
-	Enabled bool `mapstructure:"enabled"`
+	Enabled            bool   `mapstructure:"enabled"`
+	Moderation         string `mapstructure:"moderation"`
+	EmailNotifications bool   `mapstructure:"emailNotifications"`
+	EditWindow         int    `mapstructure:"editWindow"`
+	SignIn             bool   `mapstructure:"signIn"`
 }
 
 type configGeoMap struct {
@@ -201,6 +220,12 @@ type configContact struct {
 	EmailSubject  string `mapstructure:"emailSubject"`
 }
 
+type configCaptcha struct {
+	Mode       string `mapstructure:"mode"`
+	Difficulty int    `mapstructure:"difficulty"`
+	MinSeconds int    `mapstructure:"minSeconds"`
+}
+
 type configAnnouncement struct {
 	Text string `mapstructure:"text"`
 }
@@ -258,12 +283,42 @@ type configMicropubMedia struct {
 	FTPAddress  string `mapstructure:"ftpAddress"`
 	FTPUser     string `mapstructure:"ftpUser"`
 	FTPPassword string `mapstructure:"ftpPassword"`
+	// SFTP
+	SFTPAddress    string `mapstructure:"sftpAddress"`
+	SFTPUser       string `mapstructure:"sftpUser"`
+	SFTPPassword   string `mapstructure:"sftpPassword"`
+	SFTPPrivateKey string `mapstructure:"sftpPrivateKey"`
+	SFTPHostKey    string `mapstructure:"sftpHostKey"`
+	SFTPPath       string `mapstructure:"sftpPath"`
+	// WebDAV
+	WebDAVURL      string `mapstructure:"webdavUrl"`
+	WebDAVUser     string `mapstructure:"webdavUser"`
+	WebDAVPassword string `mapstructure:"webdavPassword"`
+	// S3
+	S3Endpoint   string `mapstructure:"s3Endpoint"`
+	S3Bucket     string `mapstructure:"s3Bucket"`
+	S3Region     string `mapstructure:"s3Region"`
+	S3AccessKey  string `mapstructure:"s3AccessKey"`
+	S3SecretKey  string `mapstructure:"s3SecretKey"`
+	S3PathStyle  bool   `mapstructure:"s3PathStyle"`
+	S3SignedURLs bool   `mapstructure:"s3SignedUrls"`
 	// Tinify
 	TinifyKey string `mapstructure:"tinifyKey"`
 	// Cloudflare
 	CloudflareCompressionEnabled bool `mapstructure:"cloudflareCompressionEnabled"`
 	// Local
 	LocalCompressionEnabled bool `mapstructure:"localCompressionEnabled"`
+	// Garbage collection of unused files
+	MediaGCEnabled    bool `mapstructure:"mediaGcEnabled"`
+	MediaGCGraceDays  int  `mapstructure:"mediaGcGraceDays"`
+	MediaGCDeleteDays int  `mapstructure:"mediaGcDeleteDays"`
+	// Responsive image variants
+	ImageVariantsEnabled bool  `mapstructure:"imageVariantsEnabled"`
+	ImageVariantWidths   []int `mapstructure:"imageVariantWidths"`
+	// HLS packaging of uploaded videos
+	VideoHLSEnabled bool   `mapstructure:"videoHlsEnabled"`
+	VideoHLSHeights []int  `mapstructure:"videoHlsHeights"`
+	FFmpegPath      string `mapstructure:"ffmpegPath"`
 }
 
 type configRegexRedirect struct {
@@ -319,6 +374,16 @@ type configIndexNow struct {
 	Enabled bool `mapstructure:"enabled"`
 }
 
+type configWebSub struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Hub     string `mapstructure:"hub"`
+}
+
+type configMicrosub struct {
+	Enabled       bool `mapstructure:"enabled"`
+	RetentionDays int  `mapstructure:"retentionDays"`
+}
+
 type configEasterEgg struct {
 	Enabled bool `mapstructure:"enabled"`
 }
@@ -328,6 +393,26 @@ type configWebmention struct {
 	DisableReceiving bool `mapstructure:"disableReceiving"`
 }
 
+type configSpamFilter struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	Threshold      float64  `mapstructure:"threshold"`
+	MaxLinks       int      `mapstructure:"maxLinks"`
+	MinInterval    int      `mapstructure:"minInterval"`
+	BlockedDomains []string `mapstructure:"blockedDomains"`
+}
+
+type configRateLimit struct {
+	Enabled        bool                              `mapstructure:"enabled"`
+	TrustedProxies []string                          `mapstructure:"trustedProxies"`
+	Endpoints      map[string]*configRateLimitBudget `mapstructure:"endpoints"`
+	trustedProxies []*net.IPNet
+}
+
+type configRateLimitBudget struct {
+	Requests int `mapstructure:"requests"` // Per minute
+	Burst    int `mapstructure:"burst"`
+}
+
 type configMapTiles struct {
 	Source      string `mapstructure:"source"`
 	Attribution string `mapstructure:"attribution"`
@@ -456,6 +541,20 @@ func (a *goBlog) initConfig(logging bool) error {
 	if ms := a.cfg.Micropub.MediaStorage; ms != nil && ms.MediaURL != "" {
 		ms.MediaURL = strings.TrimSuffix(ms.MediaURL, "/")
 	}
+	// Parse trusted proxies
+	if rl := a.cfg.RateLimit; rl != nil {
+		rl.trustedProxies = nil
+		for _, proxy := range rl.TrustedProxies {
+			if !strings.Contains(proxy, "/") {
+				proxy += lo.If(strings.Contains(proxy, ":"), "/128").Else("/32")
+			}
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				return errors.New("Invalid trusted proxy: " + err.Error())
+			}
+			rl.trustedProxies = append(rl.trustedProxies, network)
+		}
+	}
 	// Check if webmention receiving is disabled
 	if wm := a.cfg.Webmention; wm != nil && wm.DisableReceiving {
 		// Disable comments for all blogs
@@ -536,10 +635,6 @@ func (a *goBlog) initConfig(logging bool) error {
 		if bc.Lang == "" {
 			bc.Lang = "en"
 		}
-		// Blogroll
-		if br := bc.Blogroll; br != nil && br.Enabled && br.Opml == "" {
-			br.Enabled = false
-		}
 		// Load other settings from database
 		configs := []*bool{
 			&bc.hideOldContentWarning, &bc.hideShareButton, &bc.hideTranslateButton,
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	mail "github.com/xhit/go-simple-mail/v2"
 	"go.goblog.app/app/pkgs/bufferpool"
 )
@@ -26,7 +28,7 @@ func (a *goBlog) serveContactForm(w http.ResponseWriter, r *http.Request) {
 
 func (a *goBlog) sendContactSubmission(w http.ResponseWriter, r *http.Request) {
 	// Get blog
-	_, bc := a.getBlog(r)
+	blog, bc := a.getBlog(r)
 	// Get form values and build message
 	message := bufferpool.Get()
 	defer bufferpool.Put(message)
@@ -55,21 +57,45 @@ func (a *goBlog) sendContactSubmission(w http.ResponseWriter, r *http.Request) {
 	}
 	// Add message text to message
 	_, _ = message.WriteString(formMessage)
+	if a.isSpam(message.String(), a.clientAddress(r)) {
+		// Move to spam folder instead of sending
+		if err := a.db.saveContactSpam(blog, message.String(), formEmail); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		a.deliverContactSubmission(bc, message.String(), formEmail)
+	}
+	// Give feedback
+	a.render(w, r, a.renderContactSent, &renderData{})
+}
+
+func (a *goBlog) deliverContactSubmission(bc *configBlog, message, email string) {
 	// Send submission
 	go func() {
-		if err := a.sendContactEmail(bc.Contact, message.String(), formEmail); err != nil {
+		if err := a.sendContactEmail(bc.Contact, message, email); err != nil {
 			log.Println(err.Error())
 		}
 	}()
 	// Send notification
-	go a.sendNotification(message.String())
-	// Give feedback
-	a.render(w, r, a.renderContactSent, &renderData{})
+	go a.sendNotification(message)
+}
+
+func (a *goBlog) sendContactEmail(cc *configContact, body, replyTo string) error {
+	if cc == nil || cc.EmailTo == "" {
+		return fmt.Errorf("email not send as config is missing")
+	}
+	return a.sendEmail(cc, cc.EmailTo, defaultIfEmpty(cc.EmailSubject, "New contact message"), body, replyTo, "")
+}
+
+func (cc *configContact) smtpConfigured() bool {
+	return cc != nil && cc.SMTPHost != "" && cc.EmailFrom != ""
 }
 
-func (*goBlog) sendContactEmail(cc *configContact, body, replyTo string) error {
+// Sends a plain text email using the SMTP settings of the contact config, unsubscribe is an optional one-click unsubscribe URL
+func (a *goBlog) sendEmail(cc *configContact, to, subject, body, replyTo, unsubscribe string) error {
 	// Check required config
-	if cc == nil || cc.SMTPHost == "" || cc.EmailFrom == "" || cc.EmailTo == "" {
+	if !cc.smtpConfigured() || to == "" {
 		return fmt.Errorf("email not send as config is missing")
 	}
 	// Connect to SMTP
@@ -89,18 +115,100 @@ func (*goBlog) sendContactEmail(cc *configContact, body, replyTo string) error {
 	}
 	// Build email
 	msg := mail.NewMSG()
-	msg.AddTo(cc.EmailTo)
+	msg.AddTo(to)
 	msg.SetFrom(cc.EmailFrom)
 	if replyTo != "" {
 		msg.SetReplyTo(replyTo)
 	}
-	msg.SetDate(time.Now().UTC().Format("2006-01-02 15:04:05 MST"))
-	subject := cc.EmailSubject
-	if subject == "" {
-		subject = "New contact message"
+	if unsubscribe != "" {
+		msg.SetListUnsubscribe("<" + unsubscribe + ">")
+		msg.AddHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
 	}
+	msg.SetDate(time.Now().UTC().Format("2006-01-02 15:04:05 MST"))
 	msg.SetSubject(subject)
 	msg.SetBody(mail.TextPlain, body)
 	// Send mail
 	return msg.Send(smtpClient)
 }
+
+type contactSpam struct {
+	ID      int
+	Created int64
+	Message string
+	Email   string
+}
+
+func (db *database) saveContactSpam(blog, message, email string) error {
+	_, err := db.Exec(
+		"insert into contact_spam (blog, created, message, email) values (@blog, @created, @message, @email)",
+		sql.Named("blog", blog), sql.Named("created", time.Now().Unix()), sql.Named("message", message), sql.Named("email", email),
+	)
+	return err
+}
+
+func (db *database) getContactSpam(blog string, id int) ([]*contactSpam, error) {
+	query := "select id, created, message, email from contact_spam where blog = @blog"
+	args := []any{sql.Named("blog", blog)}
+	if id != 0 {
+		query += " and id = @id"
+		args = append(args, sql.Named("id", id))
+	}
+	rows, err := db.Query(query+" order by id desc", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := []*contactSpam{}
+	for rows.Next() {
+		m := &contactSpam{}
+		if err = rows.Scan(&m.ID, &m.Created, &m.Message, &m.Email); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (db *database) deleteContactSpam(blog string, id int) error {
+	_, err := db.Exec("delete from contact_spam where blog = @blog and id = @id", sql.Named("blog", blog), sql.Named("id", id))
+	return err
+}
+
+const contactSpamPath = "/spam"
+
+func (a *goBlog) serveContactSpam(w http.ResponseWriter, r *http.Request) {
+	blog, _ := a.getBlog(r)
+	messages, err := a.db.getContactSpam(blog, 0)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.render(w, r, a.renderContactSpam, &renderData{
+		Data: messages,
+	})
+}
+
+// Delivers the message that isn't spam or deletes the spam message, the filter learns from both actions
+func (a *goBlog) contactSpamAction(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	messages, err := a.db.getContactSpam(blog, stringToInt(r.FormValue("id")))
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(messages) < 1 || r.FormValue("id") == "" {
+		a.serve404(w, r)
+		return
+	}
+	m := messages[0]
+	spam := chi.URLParam(r, "action") == "delete"
+	a.spamLearn(fmt.Sprintf("contact:%d", m.ID), m.Message, spam)
+	if !spam {
+		a.deliverContactSubmission(bc, m.Message, m.Email)
+	}
+	if err = a.db.deleteContactSpam(blog, m.ID); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, bc.getRelativePath(defaultIfEmpty(bc.Contact.Path, defaultContactPath)+contactSpamPath), http.StatusFound)
+}
@@ -234,6 +234,25 @@ func (db *database) ExecContext(c context.Context, query string, args ...any) (s
 	return db.db.ExecContext(ctx, query, args...)
 }
 
+// Runs the function in a transaction, other executions wait until it's committed or rolled back
+func (db *database) transaction(f func(tx *sql.Tx) error) error {
+	if db == nil || db.db == nil {
+		return errors.New("database not initialized")
+	}
+	// Lock execution
+	db.em.Lock()
+	defer db.em.Unlock()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (db *database) Query(query string, args ...any) (*sql.Rows, error) {
 	return db.QueryContext(context.Background(), query, args...)
 }
@@ -0,0 +1,5 @@
+create table media (
+    name text not null,
+    alt text not null default '',
+    primary key (name)
+);
\ No newline at end of file
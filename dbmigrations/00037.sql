@@ -0,0 +1,7 @@
+alter table media add hash text not null default '';
+alter table media add filename text not null default '';
+alter table media add mimetype text not null default '';
+alter table media add width integer not null default 0;
+alter table media add height integer not null default 0;
+alter table media add uploaded text not null default '';
+alter table media add backend text not null default '';
\ No newline at end of file
@@ -0,0 +1,2 @@
+alter table media add original text not null default '';
+create index index_media_original on media (original);
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table media add exifpublished text not null default '';
+alter table media add exiflocation text not null default '';
+alter table media add exifcamera text not null default '';
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table media add orphaned text not null default '';
+alter table media add quarantined text not null default '';
+alter table media add keep integer not null default 0;
@@ -0,0 +1 @@
+create table websub_subscriptions (topic text not null, callback text not null, secret text not null default '', expires text not null, primary key (topic, callback));
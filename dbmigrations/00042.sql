@@ -0,0 +1,5 @@
+create table microsub_channels (uid text primary key, name text not null, position integer not null default 0);
+insert into microsub_channels (uid, name, position) values ('notifications', 'Notifications', 0);
+create table microsub_follows (channel text not null, url text not null, primary key (channel, url));
+create table microsub_entries (id integer primary key autoincrement, channel text not null, feed text not null, uid text not null, published text not null default '', data text not null, read integer not null default 0, unique (channel, uid));
+create index index_microsub_entries_channel on microsub_entries (channel, read);
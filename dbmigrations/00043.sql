@@ -0,0 +1,2 @@
+create table blogroll_entries (feed text not null, guid text not null, url text not null, title text not null default '', published integer not null, primary key (feed, guid));
+create index index_blogroll_entries_published on blogroll_entries (published);
@@ -0,0 +1,2 @@
+create table blogroll (id integer primary key autoincrement, blog text not null, category text not null, title text not null, url text not null default '', feed text not null default '', icon text not null default '');
+create index index_blogroll_blog on blogroll (blog);
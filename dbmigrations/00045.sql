@@ -0,0 +1,2 @@
+alter table comments add status text not null default "approved";
+create index index_comments_status on comments (status);
@@ -0,0 +1,3 @@
+create table spam_tokens (token text primary key, spam integer not null default 0, ham integer not null default 0);
+create table spam_trained (key text primary key, spam integer not null);
+create table contact_spam (id integer primary key autoincrement, blog text not null, created integer not null, message text not null, email text not null default "");
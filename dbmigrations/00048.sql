@@ -0,0 +1 @@
+create table comment_subscriptions (comment integer primary key, email text not null, token text not null unique, confirmed integer not null default 0);
@@ -0,0 +1,3 @@
+alter table comments add token text not null default "";
+alter table comments add created integer not null default 0;
+alter table comments add edited integer not null default 0;
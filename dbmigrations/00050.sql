@@ -0,0 +1,2 @@
+alter table comments add verified integer not null default 0;
+alter table comments add photo text not null default "";
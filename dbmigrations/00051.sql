@@ -0,0 +1,2 @@
+alter table media add size integer not null default 0;
+create index index_media_uploaded on media (uploaded);
\ No newline at end of file
@@ -0,0 +1 @@
+delete from blogroll_entries where url not like 'http://%' and url not like 'https://%';
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table webmentions add post text;
+create index index_wm_post on webmentions (post, status, created);
+create index index_wm_status_created on webmentions (status, created);
\ No newline at end of file
@@ -0,0 +1,2 @@
+create table microsub_tombstones (channel text not null, feed text not null, uid text not null, primary key (channel, uid));
+create index index_microsub_tombstones_feed on microsub_tombstones (feed);
\ No newline at end of file
@@ -3,33 +3,39 @@ package main
 import (
 	"net/http"
 	"sort"
+	"strings"
 
 	"github.com/samber/lo"
 )
 
 func (a *goBlog) serveEditorFiles(w http.ResponseWriter, r *http.Request) {
-	// Get files
-	files, err := a.mediaFiles()
+	query := r.URL.Query().Get("q")
+	// Get files from the media library, newest first and without responsive image variants
+	files, err := a.db.getMediaLibrary(0, 0)
 	if err != nil {
 		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Check if files at all
+	// Filter files by name, original filename or alt text
+	if query != "" {
+		lowerQuery := strings.ToLower(query)
+		files = lo.Filter(files, func(e *mediaEntry, _ int) bool {
+			return lo.SomeBy([]string{e.Name, e.Filename, e.Alt}, func(s string) bool {
+				return strings.Contains(strings.ToLower(s), lowerQuery)
+			})
+		})
+	}
 	if len(files) == 0 {
 		a.render(w, r, a.renderEditorFiles, &renderData{
-			Data: &editorFilesRenderData{},
+			Data: &editorFilesRenderData{query: query},
 		})
 		return
 	}
-	// Sort files time desc
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Time.After(files[j].Time)
-	})
 	// Find uses
-	fileNames := lo.Map(files, func(f *mediaFile, _ int) string {
-		return f.Name
+	fileNames := lo.Map(files, func(e *mediaEntry, _ int) string {
+		return e.Name
 	})
-	uses, err := a.db.usesOfMediaFile(fileNames...)
+	uses, err := a.db.postsUsingMediaFile(fileNames...)
 	if err != nil {
 		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
 		return
@@ -39,17 +45,23 @@ func (a *goBlog) serveEditorFiles(w http.ResponseWriter, r *http.Request) {
 		Data: &editorFilesRenderData{
 			files: files,
 			uses:  uses,
+			query: query,
 		},
 	})
 }
 
-func (a *goBlog) serveEditorFilesView(w http.ResponseWriter, r *http.Request) {
+func (a *goBlog) serveEditorFilesAlt(w http.ResponseWriter, r *http.Request) {
 	filename := r.FormValue("filename")
 	if filename == "" {
 		a.serveError(w, r, "No file selected", http.StatusBadRequest)
 		return
 	}
-	http.Redirect(w, r, a.mediaFileLocation(filename), http.StatusFound)
+	if err := a.db.saveMediaAlt(filename, r.FormValue("alt")); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, bc := a.getBlog(r)
+	http.Redirect(w, r, bc.getRelativePath("/editor/files"), http.StatusFound)
 }
 
 func (a *goBlog) serveEditorFilesDelete(w http.ResponseWriter, r *http.Request) {
@@ -65,3 +77,49 @@ func (a *goBlog) serveEditorFilesDelete(w http.ResponseWriter, r *http.Request)
 	_, bc := a.getBlog(r)
 	http.Redirect(w, r, bc.getRelativePath("/editor/files"), http.StatusFound)
 }
+
+func (a *goBlog) serveEditorFilesOrphans(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.db.getMediaEntries()
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	orphans := lo.Filter(lo.Values(entries), func(e *mediaEntry, _ int) bool {
+		return e.Orphaned != "" && e.Original == ""
+	})
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Orphaned < orphans[j].Orphaned
+	})
+	a.render(w, r, a.renderEditorFilesOrphans, &renderData{
+		Data: &editorFilesOrphansRenderData{
+			orphans: orphans,
+		},
+	})
+}
+
+func (a *goBlog) serveEditorFilesOrphansCheck(w http.ResponseWriter, r *http.Request) {
+	if err := a.collectMediaGarbage(); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, bc := a.getBlog(r)
+	http.Redirect(w, r, bc.getRelativePath(editorPath+mediaOrphansPath), http.StatusFound)
+}
+
+func (a *goBlog) serveEditorFilesKeep(w http.ResponseWriter, r *http.Request) {
+	filename := r.FormValue("filename")
+	if filename == "" {
+		a.serveError(w, r, "No file selected", http.StatusBadRequest)
+		return
+	}
+	if err := a.restoreMediaFile(filename); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.db.saveMediaKeep(filename); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, bc := a.getBlog(r)
+	http.Redirect(w, r, bc.getRelativePath(editorPath+mediaOrphansPath), http.StatusFound)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/jlelse/feeds"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+const (
+	enclosureInfoQueueName = "enclosureinfo"
+	// Failed lookups are tried again after this time
+	enclosureInfoRetry = 24 * time.Hour
+)
+
+type mediaEnclosure struct {
+	URL      string `json:"-"`
+	Length   int64  `json:"length"`
+	MimeType string `json:"mimeType"`
+	Failed   string `json:"failed,omitempty"` // Date of a failed or pending lookup
+}
+
+func (e *mediaEnclosure) medium() string {
+	medium, _, _ := strings.Cut(e.MimeType, "/")
+	switch medium {
+	case "image", "audio", "video":
+		return medium
+	default:
+		return ""
+	}
+}
+
+// Returns the URLs of the photos, audio and TTS audio files of a post
+func (a *goBlog) postEnclosureURLs(p *post) []string {
+	urls := []string{}
+	for _, param := range []string{a.cfg.Micropub.AudioParam, ttsParameter, a.cfg.Micropub.PhotoParam} {
+		for _, u := range p.Parameters[param] {
+			if u != "" {
+				urls = append(urls, a.getFullAddress(u))
+			}
+		}
+	}
+	return lo.Uniq(urls)
+}
+
+// Returns the photos, audio and TTS audio files of a post as enclosures with size and MIME type
+func (a *goBlog) postEnclosures(ctx context.Context, p *post) []*mediaEnclosure {
+	return lo.Map(a.postEnclosureURLs(p), func(u string, _ int) *mediaEnclosure {
+		length, mimeType := a.mediaEnclosureInfo(ctx, u, "application/octet-stream")
+		return &mediaEnclosure{URL: u, Length: length, MimeType: mimeType}
+	})
+}
+
+// Returns the size and MIME type of a media file, files of the media library use the database,
+// other files are looked up in the background and the results are cached persistently
+func (a *goBlog) mediaEnclosureInfo(ctx context.Context, mediaURL, fallbackType string) (length int64, mimeType string) {
+	u, err := url.Parse(mediaURL)
+	if err != nil {
+		return 0, fallbackType
+	}
+	fallbackType = defaultIfEmpty(mediaMimeType(path.Base(u.Path)), fallbackType)
+	if e := a.mediaLibraryEnclosure(mediaURL); e != nil {
+		return e.Length, defaultIfEmpty(e.MimeType, fallbackType)
+	}
+	e := a.cachedEnclosureInfo(ctx, mediaURL)
+	if e == nil {
+		// Not looked up yet
+		a.queueEnclosureInfo(ctx, mediaURL)
+		return 0, fallbackType
+	}
+	return e.Length, defaultIfEmpty(e.MimeType, fallbackType)
+}
+
+// Returns the size and MIME type of a file from the media library, nil if it's another file
+func (a *goBlog) mediaLibraryEnclosure(mediaURL string) *mediaEnclosure {
+	if !a.mediaStorageEnabled() {
+		return nil
+	}
+	name := path.Base(mediaURL)
+	if mediaURL != a.getFullAddress(a.mediaFileLocation(name)) {
+		return nil
+	}
+	entries, err := a.db.getMediaEntries(name)
+	if err != nil || entries[name] == nil || entries[name].Size <= 0 {
+		return nil
+	}
+	return &mediaEnclosure{URL: mediaURL, Length: entries[name].Size, MimeType: entries[name].MimeType}
+}
+
+func enclosureInfoCacheKey(mediaURL string) string {
+	return "enclosure_" + mediaURL
+}
+
+// Returns the cached info of a media file, nil if there's none or a failed lookup should be tried again
+func (a *goBlog) cachedEnclosureInfo(ctx context.Context, mediaURL string) *mediaEnclosure {
+	data, err := a.db.retrievePersistentCacheContext(ctx, enclosureInfoCacheKey(mediaURL))
+	if err != nil || data == nil {
+		return nil
+	}
+	e := &mediaEnclosure{}
+	if json.Unmarshal(data, e) != nil {
+		return nil
+	}
+	if failed, err := time.Parse(time.RFC3339, e.Failed); err == nil && failed.Add(enclosureInfoRetry).Before(time.Now()) {
+		return nil
+	}
+	return e
+}
+
+func (a *goBlog) cacheEnclosureInfo(mediaURL string, e *mediaEnclosure) {
+	if data, err := json.Marshal(e); err == nil {
+		_ = a.db.cachePersistently(enclosureInfoCacheKey(mediaURL), data)
+	}
+}
+
+// Queues the lookup of the size and MIME type of a file that isn't part of the media library
+func (a *goBlog) queueEnclosureInfo(ctx context.Context, mediaURL string) {
+	if a.mediaLibraryEnclosure(mediaURL) != nil || a.cachedEnclosureInfo(ctx, mediaURL) != nil {
+		return
+	}
+	// Mark as pending, so it's queued only once
+	a.cacheEnclosureInfo(mediaURL, &mediaEnclosure{Failed: time.Now().Format(time.RFC3339)})
+	if err := a.enqueue(enclosureInfoQueueName, []byte(mediaURL), time.Now()); err != nil {
+		log.Println("Failed to queue enclosure lookup:", err.Error())
+	}
+}
+
+// Looks up the enclosures of new and updated posts in the background
+func (a *goBlog) initEnclosureInfo() {
+	hook := func(p *post) {
+		for _, u := range a.postEnclosureURLs(p) {
+			a.queueEnclosureInfo(context.Background(), u)
+		}
+	}
+	a.pPostHooks = append(a.pPostHooks, hook)
+	a.pUpdateHooks = append(a.pUpdateHooks, hook)
+	a.listenOnQueue(enclosureInfoQueueName, 10*time.Second, func(qi *queueItem, dequeue func(), _ func(time.Duration)) {
+		a.lookupEnclosureInfo(string(qi.content))
+		dequeue()
+	})
+}
+
+// Gets the size and MIME type of a media file with a HEAD request, failures are cached as well
+func (a *goBlog) lookupEnclosureInfo(mediaURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	e := &mediaEnclosure{}
+	err := requests.URL(mediaURL).Method(http.MethodHead).Client(a.httpClient).
+		Handle(func(r *http.Response) error {
+			defer r.Body.Close()
+			e.Length = r.ContentLength
+			e.MimeType, _, _ = strings.Cut(r.Header.Get(contentType), ";")
+			return nil
+		}).
+		Fetch(ctx)
+	if err != nil {
+		log.Printf("Failed to get enclosure info of %s: %v", mediaURL, err)
+		e = &mediaEnclosure{Failed: time.Now().Format(time.RFC3339)}
+	} else if e.Length < 0 {
+		e.Length = 0
+	}
+	a.cacheEnclosureInfo(mediaURL, e)
+	if err == nil {
+		// Render the feeds with the new info
+		a.cache.purge()
+	}
+}
+
+// RSS with Media RSS elements, the RSS enclosure only supports a single file per item
+
+type rssMediaFeedXml struct {
+	XMLName          xml.Name `xml:"rss"`
+	Version          string   `xml:"version,attr"`
+	ContentNamespace string   `xml:"xmlns:content,attr"`
+	MediaNamespace   string   `xml:"xmlns:media,attr"`
+	AtomNamespace    string   `xml:"xmlns:atom,attr"`
+	Channel          *rssMediaChannel
+}
+
+type rssMediaChannel struct {
+	*feeds.RssFeed
+	AtomLinks []*rssAtomLink
+	Items     []*rssMediaItem `xml:"item"`
+}
+
+type rssMediaItem struct {
+	*feeds.RssItem
+	MediaContent []*rssMediaContent
+}
+
+type rssMediaContent struct {
+	XMLName  xml.Name `xml:"media:content"`
+	URL      string   `xml:"url,attr"`
+	Type     string   `xml:"type,attr,omitempty"`
+	FileSize int64    `xml:"fileSize,attr,omitempty"`
+	Medium   string   `xml:"medium,attr,omitempty"`
+}
+
+func (r *rssMediaFeedXml) FeedXml() any {
+	return r
+}
+
+func writeRssWithEnclosures(w io.Writer, feed *feeds.Feed, ext *feedExtensions) error {
+	rss := (&feeds.Rss{Feed: feed}).RssFeed()
+	channel := &rssMediaChannel{RssFeed: rss, AtomLinks: ext.rssAtomLinks(contenttype.RSS)}
+	for i, item := range rss.Items {
+		mi := &rssMediaItem{RssItem: item}
+		enclosures := ext.itemEnclosures(i)
+		// Prefer audio for the enclosure (like podcasts do)
+		if primary, ok := lo.Find(enclosures, func(e *mediaEnclosure) bool {
+			return e.medium() == "audio"
+		}); ok {
+			item.Enclosure = &feeds.RssEnclosure{Url: primary.URL, Length: strconv.FormatInt(primary.Length, 10), Type: primary.MimeType}
+		} else if len(enclosures) > 0 {
+			primary := enclosures[0]
+			item.Enclosure = &feeds.RssEnclosure{Url: primary.URL, Length: strconv.FormatInt(primary.Length, 10), Type: primary.MimeType}
+		}
+		for _, e := range enclosures {
+			mi.MediaContent = append(mi.MediaContent, &rssMediaContent{URL: e.URL, Type: e.MimeType, FileSize: e.Length, Medium: e.medium()})
+		}
+		channel.Items = append(channel.Items, mi)
+	}
+	return feeds.WriteXML(&rssMediaFeedXml{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		MediaNamespace:   "http://search.yahoo.com/mrss/",
+		AtomNamespace:    "http://www.w3.org/2005/Atom",
+		Channel:          channel,
+	}, w)
+}
+
+func writeAtomWithEnclosures(w io.Writer, feed *feeds.Feed, ext *feedExtensions) error {
+	atom := (&feeds.Atom{Feed: feed}).AtomFeed()
+	for i, entry := range atom.Entries {
+		for _, e := range ext.itemEnclosures(i) {
+			entry.Links = append(entry.Links, feeds.AtomLink{Href: e.URL, Rel: "enclosure", Type: e.MimeType, Length: strconv.FormatInt(e.Length, 10)})
+		}
+	}
+	return feeds.WriteXML(ext.atomFeedWithLinks(atom), w)
+}
+
+func writeJSONWithEnclosures(w io.Writer, feed *feeds.Feed, ext *feedExtensions) error {
+	jf := (&feeds.JSON{Feed: feed}).JSONFeed()
+	for i, item := range jf.Items {
+		for _, e := range ext.itemEnclosures(i) {
+			if item.Image == "" && e.medium() == "image" {
+				item.Image = e.URL
+			}
+			item.Attachments = append(item.Attachments, &feeds.JSONAttachment{Url: e.URL, MIMEType: e.MimeType, Size: int(e.Length)})
+		}
+	}
+	ext.addJSONFeedLinks(jf)
+	return json.NewEncoder(w).Encode(jf)
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/xml"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/araddon/dateparse"
+	"github.com/carlmjohnson/requests"
 	"github.com/jlelse/feeds"
+	"github.com/mmcdole/gofeed"
 	"go.goblog.app/app/pkgs/bufferpool"
 	"go.goblog.app/app/pkgs/contenttype"
 )
@@ -22,17 +27,20 @@ const (
 	minRssFeed  feedType = "min.rss"
 	minAtomFeed feedType = "min.atom"
 	minJsonFeed feedType = "min.json"
+	podcastFeed feedType = "podcast"
 )
 
-func (a *goBlog) generateFeed(blog string, f feedType, w http.ResponseWriter, r *http.Request, posts []*post, title, description string) {
-	now := time.Now()
+func (a *goBlog) generateFeed(blog string, f feedType, w http.ResponseWriter, r *http.Request, posts []*post, title, description string, updated time.Time, paging *feedPaging) {
+	if updated.IsZero() {
+		updated = time.Now()
+	}
 	title = a.renderMdTitle(defaultIfEmpty(title, a.cfg.Blogs[blog].Title))
 	description = defaultIfEmpty(description, a.cfg.Blogs[blog].Description)
 	feed := &feeds.Feed{
 		Title:       title,
 		Description: description,
 		Link:        &feeds.Link{Href: a.getFullAddress(strings.TrimSuffix(r.URL.Path, "."+string(f)))},
-		Created:     now,
+		Created:     updated,
 		Author: &feeds.Author{
 			Name:  a.cfg.User.Name,
 			Email: a.cfg.User.Email,
@@ -41,7 +49,9 @@ func (a *goBlog) generateFeed(blog string, f feedType, w http.ResponseWriter, r
 			Url: a.profileImagePath(profileImageFormatJPEG, 0, 0),
 		},
 	}
+	enclosures := make([][]*mediaEnclosure, 0, len(posts))
 	for _, p := range posts {
+		enclosures = append(enclosures, a.postEnclosures(r.Context(), p))
 		buf := bufferpool.Get()
 		switch f {
 		case minRssFeed, minAtomFeed, minJsonFeed:
@@ -60,26 +70,153 @@ func (a *goBlog) generateFeed(blog string, f feedType, w http.ResponseWriter, r
 		})
 		bufferpool.Put(buf)
 	}
-	var feedWriteFunc func(w io.Writer) error
+	a.writeFeed(w, r, f, feed, &feedExtensions{enclosures: enclosures, self: a.getFullAddress(r.URL.Path), hub: a.webSubHub(), paging: paging})
+}
+
+// Writes the feed in the requested format including the additional elements
+func (a *goBlog) writeFeed(w http.ResponseWriter, r *http.Request, f feedType, feed *feeds.Feed, ext *feedExtensions) {
+	var feedWriteFunc func(w io.Writer, feed *feeds.Feed, ext *feedExtensions) error
 	var feedMediaType string
 	switch f {
 	case rssFeed, minRssFeed:
 		feedMediaType = contenttype.RSS
-		feedWriteFunc = feed.WriteRss
+		feedWriteFunc = writeRssWithEnclosures
 	case atomFeed, minAtomFeed:
 		feedMediaType = contenttype.ATOM
-		feedWriteFunc = feed.WriteAtom
+		feedWriteFunc = writeAtomWithEnclosures
 	case jsonFeed, minJsonFeed:
 		feedMediaType = contenttype.JSONFeed
-		feedWriteFunc = feed.WriteJSON
+		feedWriteFunc = writeJSONWithEnclosures
 	default:
 		a.serve404(w, r)
 		return
 	}
+	if ext.hub != "" {
+		setWebSubLinkHeader(w, ext.hub, ext.self)
+	}
 	pipeReader, pipeWriter := io.Pipe()
 	go func() {
-		_ = pipeWriter.CloseWithError(feedWriteFunc(pipeWriter))
+		_ = pipeWriter.CloseWithError(feedWriteFunc(pipeWriter, feed, ext))
 	}()
 	w.Header().Set(contentType, feedMediaType+contenttype.CharsetUtf8Suffix)
 	_ = pipeReader.CloseWithError(a.min.Get().Minify(feedMediaType, w, pipeReader))
 }
+
+// Links for paged feeds (RFC 5005)
+type feedPaging struct {
+	first, prev, next, last string
+}
+
+func (a *goBlog) newFeedPaging(path string, f feedType, hasPrev, hasNext bool, prevPage, nextPage, lastPage int) *feedPaging {
+	pageURL := func(page int) string {
+		if page < 2 {
+			return a.getFullAddress(path + "." + string(f))
+		}
+		return a.getFullAddress(fmt.Sprintf("%s/page/%d.%s", strings.TrimSuffix(path, "/"), page, f))
+	}
+	paging := &feedPaging{first: pageURL(1), last: pageURL(lastPage)}
+	if hasPrev {
+		paging.prev = pageURL(prevPage)
+	}
+	if hasNext {
+		paging.next = pageURL(nextPage)
+	}
+	return paging
+}
+
+// Returns the paging links with their relation
+func (fp *feedPaging) links() (links [][2]string) {
+	if fp == nil {
+		return nil
+	}
+	for _, l := range [][2]string{{"first", fp.first}, {"previous", fp.prev}, {"next", fp.next}, {"last", fp.last}} {
+		if l[1] != "" {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+// Additional feed elements that the feeds library doesn't support
+type feedExtensions struct {
+	enclosures [][]*mediaEnclosure // Per item
+	self, hub  string              // WebSub
+	paging     *feedPaging
+}
+
+func (ext *feedExtensions) itemEnclosures(i int) []*mediaEnclosure {
+	if i < len(ext.enclosures) {
+		return ext.enclosures[i]
+	}
+	return nil
+}
+
+// Atom links in RSS feeds (self, WebSub hub and paging)
+type rssAtomLink struct {
+	XMLName xml.Name `xml:"atom:link"`
+	Href    string   `xml:"href,attr"`
+	Rel     string   `xml:"rel,attr"`
+	Type    string   `xml:"type,attr,omitempty"`
+}
+
+func (ext *feedExtensions) rssAtomLinks(selfType string) (links []*rssAtomLink) {
+	if ext.self != "" {
+		links = append(links, &rssAtomLink{Href: ext.self, Rel: "self", Type: selfType})
+	}
+	if ext.hub != "" {
+		links = append(links, &rssAtomLink{Href: ext.hub, Rel: "hub"})
+	}
+	for _, l := range ext.paging.links() {
+		links = append(links, &rssAtomLink{Href: l[1], Rel: l[0], Type: selfType})
+	}
+	return links
+}
+
+// Atom with multiple feed links
+type atomFeedXml struct {
+	*feeds.AtomFeed
+	Links []*feeds.AtomLink
+}
+
+func (a *atomFeedXml) FeedXml() any {
+	return a
+}
+
+func (ext *feedExtensions) atomFeedWithLinks(atom *feeds.AtomFeed) *atomFeedXml {
+	ax := &atomFeedXml{AtomFeed: atom}
+	if atom.Link != nil {
+		ax.Links, atom.Link = append(ax.Links, atom.Link), nil
+	}
+	if ext.self != "" {
+		ax.Links = append(ax.Links, &feeds.AtomLink{Href: ext.self, Rel: "self", Type: contenttype.ATOM})
+	}
+	if ext.hub != "" {
+		ax.Links = append(ax.Links, &feeds.AtomLink{Href: ext.hub, Rel: "hub"})
+	}
+	for _, l := range ext.paging.links() {
+		ax.Links = append(ax.Links, &feeds.AtomLink{Href: l[1], Rel: l[0], Type: contenttype.ATOM})
+	}
+	return ax
+}
+
+func (ext *feedExtensions) addJSONFeedLinks(jf *feeds.JSONFeed) {
+	jf.FeedUrl = ext.self
+	if ext.paging != nil {
+		jf.NextUrl = ext.paging.next
+	}
+	if ext.hub != "" {
+		jf.Hubs = append(jf.Hubs, &feeds.JSONHub{Type: "WebSub", Url: ext.hub})
+	}
+}
+
+// Fetches and parses an external feed (RSS, Atom or JSON Feed)
+func (a *goBlog) fetchFeed(feedURL string) (feed *gofeed.Feed, err error) {
+	err = requests.URL(feedURL).Client(a.httpClient).
+		Handle(func(r *http.Response) (err error) {
+			defer r.Body.Close()
+			feed, err = gofeed.NewParser().Parse(r.Body)
+			return
+		}).
+		Fetch(context.Background())
+	return
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/carlmjohnson/requests"
 	"github.com/mmcdole/gofeed"
@@ -56,3 +60,278 @@ func Test_feeds(t *testing.T) {
 		}
 	}
 }
+
+func Test_feedEnclosures(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+
+	_ = app.initConfig(false)
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		switch r.URL.Path {
+		case "/photo.jpg":
+			w.Header().Set("Content-Length", "100")
+			w.Header().Set(contentType, "image/jpeg")
+		case "/audio.mp3":
+			w.Header().Set("Content-Length", "200")
+			w.Header().Set(contentType, "audio/mpeg")
+		}
+	}))
+
+	err := app.createPost(&post{
+		Path:      "/testpost",
+		Section:   "posts",
+		Status:    "published",
+		Published: "2020-01-01T00:00:00Z",
+		Parameters: map[string][]string{
+			"title":                     {"Test Post"},
+			app.cfg.Micropub.PhotoParam: {"https://example.com/photo.jpg"},
+			app.cfg.Micropub.AudioParam: {"https://example.com/audio.mp3"},
+		},
+		Content: "Test Content",
+	})
+	require.NoError(t, err)
+
+	// The enclosure info is looked up in the background after saving the post
+	p, err := app.getPost("/testpost")
+	require.NoError(t, err)
+	for _, u := range app.postEnclosureURLs(p) {
+		app.queueEnclosureInfo(context.Background(), u)
+	}
+	processEnclosureInfoQueue(t, app)
+
+	for _, typ := range []feedType{rssFeed, atomFeed, jsonFeed} {
+		var raw string
+		err := requests.URL("http://localhost:8080/posts." + string(typ)).Client(handlerClient).ToString(&raw).Fetch(context.Background())
+		require.NoError(t, err)
+		feed, err := gofeed.NewParser().ParseString(raw)
+		require.NoError(t, err)
+
+		if assert.Len(t, feed.Items, 1) {
+			item := feed.Items[0]
+			switch typ {
+			case rssFeed:
+				// Only one enclosure is allowed, audio is preferred
+				if assert.Len(t, item.Enclosures, 1) {
+					assert.Equal(t, "https://example.com/audio.mp3", item.Enclosures[0].URL)
+					assert.Equal(t, "200", item.Enclosures[0].Length, raw)
+					assert.Equal(t, "audio/mpeg", item.Enclosures[0].Type)
+				}
+				assert.Contains(t, raw, `<media:content url="https://example.com/audio.mp3" type="audio/mpeg" fileSize="200" medium="audio"/>`)
+				assert.Contains(t, raw, `<media:content url="https://example.com/photo.jpg" type="image/jpeg" fileSize="100" medium="image"/>`)
+			case jsonFeed:
+				assert.Equal(t, "https://example.com/photo.jpg", item.Image.URL)
+				assert.Contains(t, raw, `"attachments":[{"url":"https://example.com/audio.mp3","mime_type":"audio/mpeg","size_in_bytes":200},{"url":"https://example.com/photo.jpg","mime_type":"image/jpeg","size_in_bytes":100}]`)
+			case atomFeed:
+				if assert.Len(t, item.Enclosures, 2) {
+					assert.Equal(t, "https://example.com/audio.mp3", item.Enclosures[0].URL)
+					assert.Equal(t, "200", item.Enclosures[0].Length)
+					assert.Equal(t, "audio/mpeg", item.Enclosures[0].Type)
+					assert.Equal(t, "https://example.com/photo.jpg", item.Enclosures[1].URL)
+					assert.Equal(t, "100", item.Enclosures[1].Length)
+					assert.Equal(t, "image/jpeg", item.Enclosures[1].Type)
+				}
+			}
+		}
+	}
+}
+
+func processEnclosureInfoQueue(t *testing.T, app *goBlog) {
+	for {
+		qi, err := app.peekQueue(context.Background(), enclosureInfoQueueName)
+		require.NoError(t, err)
+		if qi == nil {
+			return
+		}
+		app.lookupEnclosureInfo(string(qi.content))
+		require.NoError(t, app.dequeue(qi))
+	}
+}
+
+func Test_mediaEnclosureInfo(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	_ = app.initConfig(false)
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+		app.mediaStorageBackend = mediaStorageLocal
+	})
+
+	heads := 0
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads++
+		if r.URL.Path == "/missing.mp3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "300")
+		w.Header().Set(contentType, "audio/ogg")
+	}))
+	ctx := context.Background()
+
+	// Files of the media library use the database
+	loc, err := app.saveMediaFile("abc.mp3", strings.NewReader("audio"))
+	require.NoError(t, err)
+	length, mimeType := app.mediaEnclosureInfo(ctx, app.getFullAddress(loc), "application/octet-stream")
+	assert.Equal(t, int64(5), length)
+	assert.Equal(t, "audio/mpeg", mimeType)
+	qi, err := app.peekQueue(ctx, enclosureInfoQueueName)
+	require.NoError(t, err)
+	assert.Nil(t, qi)
+
+	// Other files are looked up in the background
+	length, mimeType = app.mediaEnclosureInfo(ctx, "https://example.com/audio.ogg", "application/octet-stream")
+	assert.Equal(t, int64(0), length)
+	assert.Equal(t, "audio/ogg", mimeType)
+	assert.Equal(t, 0, heads)
+	_, _ = app.mediaEnclosureInfo(ctx, "https://example.com/audio", "audio/mpeg")
+	_, _ = app.mediaEnclosureInfo(ctx, "https://example.com/missing.mp3", "audio/mpeg")
+	// Queued only once
+	_, _ = app.mediaEnclosureInfo(ctx, "https://example.com/missing.mp3", "audio/mpeg")
+	processEnclosureInfoQueue(t, app)
+	assert.Equal(t, 3, heads)
+
+	length, mimeType = app.mediaEnclosureInfo(ctx, "https://example.com/audio", "audio/mpeg")
+	assert.Equal(t, int64(300), length)
+	assert.Equal(t, "audio/ogg", mimeType)
+
+	// Failures are cached as well
+	length, mimeType = app.mediaEnclosureInfo(ctx, "https://example.com/missing.mp3", "application/octet-stream")
+	assert.Equal(t, int64(0), length)
+	assert.Equal(t, "audio/mpeg", mimeType)
+	processEnclosureInfoQueue(t, app)
+	assert.Equal(t, 3, heads)
+
+	// And tried again later
+	app.cacheEnclosureInfo("https://example.com/missing.mp3", &mediaEnclosure{Failed: time.Now().Add(-enclosureInfoRetry - time.Hour).Format(time.RFC3339)})
+	_, _ = app.mediaEnclosureInfo(ctx, "https://example.com/missing.mp3", "audio/mpeg")
+	processEnclosureInfoQueue(t, app)
+	assert.Equal(t, 4, heads)
+}
+
+func Test_feedValidatorsAndPaging(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+
+	_ = app.initConfig(false)
+	app.cfg.Blogs[app.cfg.DefaultBlog].Pagination = 2
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	for i, date := range []string{"2020-01-01", "2020-01-02", "2020-01-03", "2020-01-04", "2020-01-05"} {
+		require.NoError(t, app.createPost(&post{
+			Path:      fmt.Sprintf("/test%d", i+1),
+			Section:   "posts",
+			Status:    statusPublished,
+			Published: date + "T00:00:00Z",
+			Updated:   date + "T12:00:00Z",
+			Content:   "Test",
+		}))
+	}
+
+	fetch := func(url string, header http.Header) (status int, h http.Header, body string) {
+		rb := requests.URL(url).Client(handlerClient)
+		for k, v := range header {
+			rb.Header(k, v...)
+		}
+		err := rb.AddValidator(nil).
+			Handle(func(r *http.Response) error {
+				defer r.Body.Close()
+				status, h = r.StatusCode, r.Header
+				b, err := io.ReadAll(r.Body)
+				body = string(b)
+				return err
+			}).
+			Fetch(context.Background())
+		require.NoError(t, err)
+		return
+	}
+
+	// The ETag is derived from the posts on the page, there's no Last-Modified
+	status, h, _ := fetch("http://localhost:8080/posts.rss", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, h.Get("Last-Modified"))
+	eTag := h.Get("ETag")
+	assert.NotEmpty(t, eTag)
+
+	// They stay the same after a cache purge
+	app.cache.purge()
+	_, h, _ = fetch("http://localhost:8080/posts.rss", nil)
+	assert.Equal(t, eTag, h.Get("ETag"))
+
+	status, _, _ = fetch("http://localhost:8080/posts.rss", http.Header{"If-None-Match": {eTag}})
+	assert.Equal(t, http.StatusNotModified, status)
+	status, _, _ = fetch("http://localhost:8080/posts.rss", http.Header{"If-Modified-Since": {"Sun, 05 Jan 2020 12:00:00 GMT"}})
+	assert.Equal(t, http.StatusOK, status)
+
+	// Also without cache
+	app.cfg.Cache = &configCache{Enable: false}
+	_ = app.initCache()
+	app.d = app.buildRouter()
+	handlerClient = newHandlerClient(app.d)
+	_, h, _ = fetch("http://localhost:8080/posts.rss", nil)
+	assert.Equal(t, eTag, h.Get("ETag"))
+	assert.Empty(t, h.Get("Last-Modified"))
+
+	// They change with the assets and settings
+	app.assetFileNames = map[string]string{"css/test.css": "abc.css"}
+	_, h, _ = fetch("http://localhost:8080/posts.rss", nil)
+	assert.NotEqual(t, eTag, h.Get("ETag"))
+	eTag = h.Get("ETag")
+	_, h, _ = fetch("http://localhost:8080/posts.rss", nil)
+	assert.Equal(t, eTag, h.Get("ETag"))
+	require.NoError(t, app.saveSettingValue(userNameSetting, "Test"))
+	_, h, _ = fetch("http://localhost:8080/posts.rss", nil)
+	assert.NotEqual(t, eTag, h.Get("ETag"))
+	eTag = h.Get("ETag")
+
+	// Paged feeds
+	status, _, body := fetch("http://localhost:8080/posts/page/2.rss", nil)
+	assert.Equal(t, http.StatusOK, status)
+	feed, err := gofeed.NewParser().ParseString(body)
+	require.NoError(t, err)
+	if assert.Len(t, feed.Items, 2) {
+		assert.Equal(t, "http://localhost:8080/test3", feed.Items[0].Link)
+	}
+	assert.Contains(t, body, `<atom:link href="http://localhost:8080/posts.rss" rel="first" type="application/rss+xml"/>`)
+	assert.Contains(t, body, `<atom:link href="http://localhost:8080/posts.rss" rel="previous" type="application/rss+xml"/>`)
+	assert.Contains(t, body, `<atom:link href="http://localhost:8080/posts/page/3.rss" rel="next" type="application/rss+xml"/>`)
+	assert.Contains(t, body, `<atom:link href="http://localhost:8080/posts/page/3.rss" rel="last" type="application/rss+xml"/>`)
+
+	_, _, body = fetch("http://localhost:8080/posts/page/3.atom", nil)
+	assert.Contains(t, body, `<link href="http://localhost:8080/posts/page/2.atom" rel="previous" type="application/atom+xml"/>`)
+	assert.NotContains(t, body, `rel="next"`)
+
+	_, _, body = fetch("http://localhost:8080/page/2.json", nil)
+	assert.Contains(t, body, `"next_url":"http://localhost:8080/page/3.json"`)
+
+	// The ETag changes when a post that isn't the newest one is deleted
+	require.NoError(t, app.deletePost("/test4"))
+	status, h, _ = fetch("http://localhost:8080/posts.rss", http.Header{"If-None-Match": {eTag}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, eTag, h.Get("ETag"))
+}
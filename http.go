@@ -17,6 +17,7 @@ import (
 	"github.com/justinas/alice"
 	"github.com/klauspost/compress/flate"
 	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bodylimit"
 	"go.goblog.app/app/pkgs/httpcompress"
 	"go.goblog.app/app/pkgs/maprouter"
 	"go.goblog.app/app/pkgs/plugintypes"
@@ -28,8 +29,9 @@ const (
 	userAgent    = "User-Agent"
 	appUserAgent = "GoBlog"
 
-	blogKey contextKey = "blog"
-	pathKey contextKey = "httpPath"
+	blogKey       contextKey = "blog"
+	pathKey       contextKey = "httpPath"
+	remoteAddrKey contextKey = "remoteAddr"
 )
 
 func (a *goBlog) startServer() (err error) {
@@ -132,6 +134,7 @@ func (*goBlog) redirectToHttps(w http.ResponseWriter, r *http.Request) {
 const (
 	paginationPath = "/page/{page:[0-9-]+}"
 	feedPath       = ".{feed:(rss|json|atom|min\\.rss|min\\.json|min\\.atom)}"
+	podcastPath    = ".{feed:podcast}"
 )
 
 func (a *goBlog) reloadRouter() {
@@ -189,6 +192,11 @@ func (a *goBlog) buildRouter() http.Handler {
 	// Micropub
 	r.Route(micropubPath, a.micropubRouter)
 
+	// Microsub
+	if a.microsubEnabled() {
+		r.Route(microsubPath, a.microsubRouter)
+	}
+
 	// IndieAuth
 	r.Group(a.indieAuthRouter)
 
@@ -234,6 +242,11 @@ func (a *goBlog) buildRouter() http.Handler {
 		}
 	}
 
+	// WebSub hub
+	if a.webSubEnabled() && !a.webSubExternalHub() {
+		r.With(a.rateLimitMiddleware(rateLimitWebSub), bodylimit.BodyLimit(100*bodylimit.KB)).Post(webSubPath, a.serveWebSubHub)
+	}
+
 	// Robots.txt
 	r.With(cacheLoggedIn, a.cacheMiddleware).Get(robotsTXTPath, a.serveRobotsTXT)
 
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"net"
 	"net/http"
+	"syscall"
 	"time"
 
 	"github.com/klauspost/compress/gzhttp"
@@ -20,6 +23,83 @@ func newHttpClient() *http.Client {
 	}
 }
 
+var errNonPublicAddress = errors.New("address isn't public")
+
+// Client for requests to URLs from untrusted sources, it only connects to public addresses and doesn't follow redirects.
+// The address is checked when connecting, so hosts that resolve to another address later can't reach the local network.
+func newPublicHttpClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errNonPublicAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: time.Minute,
+		Transport: newAddUserAgentTransport(
+			gzhttp.Transport(
+				&http.Transport{
+					DialContext:       dialer.DialContext,
+					DisableKeepAlives: true,
+				},
+			),
+		),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Special purpose ranges that aren't covered by the checks of net.IP and aren't globally reachable
+var nonPublicNetworks = func() (networks []*net.IPNet) {
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // This network
+		"100.64.0.0/10",   // Carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // Documentation
+		"198.18.0.0/15",   // Benchmarking
+		"198.51.100.0/24", // Documentation
+		"203.0.113.0/24",  // Documentation
+		"240.0.0.0/4",     // Reserved
+		"64:ff9b:1::/48",  // Local-use NAT64
+		"100::/64",        // Discard-only
+		"2001::/23",       // IETF protocol assignments
+		"2001:db8::/32",   // Documentation
+		"fec0::/10",       // Site-local (deprecated)
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return
+}()
+
+var nat64Network = &net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)}
+
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if nat64Network.Contains(ip) {
+		// Check the embedded IPv4 address
+		return isPublicIP(ip[12:])
+	}
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
 type addUserAgentTransport struct {
 	t http.RoundTripper
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -94,3 +95,37 @@ func Test_addUserAgent(t *testing.T) {
 
 	assert.Equal(t, appUserAgent, ua)
 }
+
+func Test_isPublicIP(t *testing.T) {
+	for _, ip := range []string{"93.184.215.14", "1.1.1.1", "2606:4700:4700::1111", "64:ff9b::5db8:d70e"} {
+		assert.True(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{
+		"127.0.0.1", "::1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fc00::1",
+		"0.0.0.0", "::", "100.64.0.1", "100.127.255.254", "192.0.0.8", "198.18.0.1", "203.0.113.10", "240.0.0.1",
+		"255.255.255.255", "224.0.0.1", "ff02::1", "::ffff:127.0.0.1", "::ffff:100.64.0.1", "64:ff9b::7f00:1", "2001:db8::1",
+	} {
+		assert.False(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func Test_publicHttpClient(t *testing.T) {
+	client := newPublicHttpClient()
+
+	// Doesn't connect to local addresses
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	err := requests.URL(srv.URL).Client(client).Fetch(context.Background())
+	assert.ErrorIs(t, err, errNonPublicAddress)
+	assert.False(t, called)
+
+	// Doesn't follow redirects
+	client.Transport = &handlerRoundTripper{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://127.0.0.1/", http.StatusFound)
+	})}
+	err = requests.URL("http://example.com/").Client(client).Fetch(context.Background())
+	assert.True(t, requests.HasStatusErr(err, http.StatusFound))
+}
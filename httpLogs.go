@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -25,7 +26,8 @@ func (a *goBlog) initHTTPLog() (err error) {
 func (a *goBlog) logMiddleware(next http.Handler) http.Handler {
 	h := handlers.CombinedLoggingHandler(a.logf, next)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Remove remote address for privacy
+		// Remove remote address for privacy, keep it in the context for rate limiting
+		r = r.WithContext(context.WithValue(r.Context(), remoteAddrKey, r.RemoteAddr))
 		r.RemoteAddr = ""
 		h.ServeHTTP(w, r)
 	})
@@ -18,7 +18,8 @@ func (a *goBlog) micropubRouter(r chi.Router) {
 	r.Use(a.checkIndieAuth)
 	r.Get("/", a.serveMicropubQuery)
 	r.With(bodylimit.BodyLimit(10*bodylimit.MB)).Post("/", a.serveMicropubPost)
-	r.With(bodylimit.BodyLimit(30*bodylimit.MB)).Post(micropubMediaSubPath, a.serveMicropubMedia)
+	r.Get(micropubMediaSubPath, a.serveMicropubMediaQuery)
+	r.With(bodylimit.BodyLimit(a.micropubMediaBodyLimit())).Post(micropubMediaSubPath, a.serveMicropubMedia)
 }
 
 // IndieAuth
@@ -42,10 +43,10 @@ func (a *goBlog) activityPubRouter(r chi.Router) {
 	}
 	if ap := a.cfg.ActivityPub; ap != nil && ap.Enabled {
 		r.Route("/activitypub", func(r chi.Router) {
-			r.With(bodylimit.BodyLimit(10*bodylimit.MB)).Post("/inbox/{blog}", a.apHandleInbox)
+			r.With(a.rateLimitMiddleware(rateLimitInbox), bodylimit.BodyLimit(10*bodylimit.MB)).Post("/inbox/{blog}", a.apHandleInbox)
 			r.With(a.checkActivityStreamsRequest).Get("/followers/{blog}", a.apShowFollowers)
 			r.With(a.cacheMiddleware).Get("/remote_follow/{blog}", a.apRemoteFollow)
-			r.With(bodylimit.BodyLimit(100*bodylimit.KB)).Post("/remote_follow/{blog}", a.apRemoteFollow)
+			r.With(a.rateLimitMiddleware(rateLimitRemoteFollow), bodylimit.BodyLimit(100*bodylimit.KB)).Post("/remote_follow/{blog}", a.apRemoteFollow)
 		})
 		r.Group(func(r chi.Router) {
 			r.Use(cacheLoggedIn, a.cacheMiddleware)
@@ -64,13 +65,13 @@ func (a *goBlog) webmentionsRouter(r chi.Router) {
 		return
 	}
 	// Endpoint
-	r.With(bodylimit.BodyLimit(bodylimit.MB)).Post("/", a.handleWebmention)
+	r.With(a.rateLimitMiddleware(rateLimitWebmentions), bodylimit.BodyLimit(bodylimit.MB)).Post("/", a.handleWebmention)
 	// Authenticated routes
 	r.Group(func(r chi.Router) {
 		r.Use(a.authMiddleware)
 		r.Get("/", a.webmentionAdmin)
 		r.Get(paginationPath, a.webmentionAdmin)
-		r.Post("/{action:(delete|approve|reverify)}", a.webmentionAdminAction)
+		r.Post("/{action:(delete|approve|reverify|spam)}", a.webmentionAdminAction)
 	})
 }
 
@@ -124,7 +125,7 @@ func (a *goBlog) otherRoutesRouter(r chi.Router) {
 	// Reactions
 	if a.reactionsEnabled() {
 		r.Get("/reactions", a.getReactions)
-		r.With(bodylimit.BodyLimit(100*bodylimit.KB)).Post("/reactions", a.postReaction)
+		r.With(a.rateLimitMiddleware(rateLimitReactions), bodylimit.BodyLimit(100*bodylimit.KB)).Post("/reactions", a.postReaction)
 	}
 }
 
@@ -194,6 +195,7 @@ func (a *goBlog) blogHomeRouter(conf *configBlog) func(r chi.Router) {
 			r.With(a.checkActivityStreamsRequest, a.cacheMiddleware).Get(conf.getRelativePath(""), a.serveHome)
 			r.With(a.cacheMiddleware).Get(conf.getRelativePath("")+feedPath, a.serveHome)
 			r.With(a.cacheMiddleware).Get(conf.getRelativePath(paginationPath), a.serveHome)
+			r.With(a.cacheMiddleware).Get(conf.getRelativePath(paginationPath)+feedPath, a.serveHome)
 		}
 	}
 }
@@ -214,7 +216,14 @@ func (a *goBlog) blogSectionsRouter(conf *configBlog) func(r chi.Router) {
 				}))
 				r.Get(secPath, a.serveIndex)
 				r.Get(secPath+feedPath, a.serveIndex)
+				if conf.podcastEnabled() {
+					r.Get(secPath+podcastPath, a.serveIndex)
+				}
 				r.Get(secPath+paginationPath, a.serveIndex)
+				r.Get(secPath+paginationPath+feedPath, a.serveIndex)
+				if conf.podcastEnabled() {
+					r.Get(secPath+paginationPath+podcastPath, a.serveIndex)
+				}
 				r.Group(a.dateRoutes(conf, section.Name))
 			})
 		}
@@ -237,7 +246,14 @@ func (a *goBlog) blogTaxonomiesRouter(conf *configBlog) func(r chi.Router) {
 					taxValPath := taxBasePath + "/{taxValue}"
 					r.Get(taxValPath, a.serveTaxonomyValue)
 					r.Get(taxValPath+feedPath, a.serveTaxonomyValue)
+					if conf.podcastEnabled() {
+						r.Get(taxValPath+podcastPath, a.serveTaxonomyValue)
+					}
 					r.Get(taxValPath+paginationPath, a.serveTaxonomyValue)
+					r.Get(taxValPath+paginationPath+feedPath, a.serveTaxonomyValue)
+					if conf.podcastEnabled() {
+						r.Get(taxValPath+paginationPath+podcastPath, a.serveTaxonomyValue)
+					}
 				})
 			}
 		}
@@ -262,16 +278,19 @@ func (a *goBlog) dateRoutes(conf *configBlog, pathPrefix string) func(r chi.Rout
 		r.Get(yearPath, a.serveDate)
 		r.Get(yearPath+feedPath, a.serveDate)
 		r.Get(yearPath+paginationPath, a.serveDate)
+		r.Get(yearPath+paginationPath+feedPath, a.serveDate)
 
 		monthPath := yearPath + `/{month:(x|\d{2})}`
 		r.Get(monthPath, a.serveDate)
 		r.Get(monthPath+feedPath, a.serveDate)
 		r.Get(monthPath+paginationPath, a.serveDate)
+		r.Get(monthPath+paginationPath+feedPath, a.serveDate)
 
 		dayPath := monthPath + `/{day:(\d{2})}`
 		r.Get(dayPath, a.serveDate)
 		r.Get(dayPath+feedPath, a.serveDate)
 		r.Get(dayPath+paginationPath, a.serveDate)
+		r.Get(dayPath+paginationPath+feedPath, a.serveDate)
 	}
 }
 
@@ -294,6 +313,7 @@ func (a *goBlog) blogPhotosRouter(conf *configBlog) func(r chi.Router) {
 			r.Get(photoPath, a.serveIndex)
 			r.Get(photoPath+feedPath, a.serveIndex)
 			r.Get(photoPath+paginationPath, a.serveIndex)
+			r.Get(photoPath+paginationPath+feedPath, a.serveIndex)
 		}
 	}
 }
@@ -316,6 +336,7 @@ func (a *goBlog) blogSearchRouter(conf *configBlog) func(r chi.Router) {
 					r.Get(searchResultPath, a.serveSearchResult)
 					r.Get(searchResultPath+feedPath, a.serveSearchResult)
 					r.Get(searchResultPath+paginationPath, a.serveSearchResult)
+					r.Get(searchResultPath+paginationPath+feedPath, a.serveSearchResult)
 				})
 				r.With(
 					// No private mode, to allow using OpenSearch in browser
@@ -352,23 +373,31 @@ func (a *goBlog) blogEditorRouter(_ *configBlog) func(r chi.Router) {
 		r.Get("/", a.serveEditor)
 		r.Post("/", a.serveEditorPost)
 		r.Get("/files", a.serveEditorFiles)
-		r.Post("/files/view", a.serveEditorFilesView)
+		r.Post("/files/alt", a.serveEditorFilesAlt)
 		r.Post("/files/delete", a.serveEditorFilesDelete)
+		r.Get(mediaOrphansPath, a.serveEditorFilesOrphans)
+		r.Post(mediaOrphansPath, a.serveEditorFilesOrphansCheck)
+		r.Post("/files/keep", a.serveEditorFilesKeep)
 		r.Get("/drafts", a.serveDrafts)
 		r.Get("/drafts"+feedPath, a.serveDrafts)
 		r.Get("/drafts"+paginationPath, a.serveDrafts)
+		r.Get("/drafts"+paginationPath+feedPath, a.serveDrafts)
 		r.Get("/private", a.servePrivate)
 		r.Get("/private"+feedPath, a.servePrivate)
 		r.Get("/private"+paginationPath, a.servePrivate)
+		r.Get("/private"+paginationPath+feedPath, a.servePrivate)
 		r.Get("/unlisted", a.serveUnlisted)
 		r.Get("/unlisted"+feedPath, a.serveUnlisted)
 		r.Get("/unlisted"+paginationPath, a.serveUnlisted)
+		r.Get("/unlisted"+paginationPath+feedPath, a.serveUnlisted)
 		r.Get("/scheduled", a.serveScheduled)
 		r.Get("/scheduled"+feedPath, a.serveScheduled)
 		r.Get("/scheduled"+paginationPath, a.serveScheduled)
+		r.Get("/scheduled"+paginationPath+feedPath, a.serveScheduled)
 		r.Get("/deleted", a.serveDeleted)
 		r.Get("/deleted"+feedPath, a.serveDeleted)
 		r.Get("/deleted"+paginationPath, a.serveDeleted)
+		r.Get("/deleted"+paginationPath+feedPath, a.serveDeleted)
 		r.HandleFunc("/preview", a.serveEditorPreview)
 		r.HandleFunc("/sync", a.serveEditorStateSync)
 	}
@@ -378,20 +407,38 @@ func (a *goBlog) blogEditorRouter(_ *configBlog) func(r chi.Router) {
 func (a *goBlog) blogCommentsRouter(conf *configBlog) func(r chi.Router) {
 	return func(r chi.Router) {
 		if commentsConfig := conf.Comments; commentsConfig != nil && commentsConfig.Enabled {
+			r.With(a.privateModeHandler, a.cacheMiddleware).Get(conf.getRelativePath(interactionsPath)+feedPath, a.serveInteractionsFeed)
 			commentsPath := conf.getRelativePath(commentPath)
 			r.Route(commentsPath, func(r chi.Router) {
 				r.Use(
 					a.privateModeHandler,
 					middleware.WithValue(pathKey, commentsPath),
 				)
-				r.With(a.cacheMiddleware, noIndexHeader).Get("/{id:[0-9]+}", a.serveComment)
-				r.With(a.captchaMiddleware, bodylimit.BodyLimit(bodylimit.MB)).Post("/", a.createCommentFromRequest)
+				r.With(a.commentCacheMiddleware, noIndexHeader).Get("/{id:[0-9]+}", a.serveComment)
+				r.With(noIndexHeader).Get("/{id:[0-9]+}"+commentManageSubPath, a.serveCommentManage)
+				r.With(a.rateLimitMiddleware(rateLimitComments), bodylimit.BodyLimit(bodylimit.MB)).Post("/{id:[0-9]+}"+commentManageSubPath, a.serveCommentManage)
+				r.With(a.rateLimitMiddleware(rateLimitComments), a.captchaMiddleware, bodylimit.BodyLimit(bodylimit.MB)).Post("/", a.createCommentFromRequest)
+				r.With(noIndexHeader).Get(commentSubscriptionConfirmSubPath, a.serveCommentSubscriptionConfirm)
+				r.Post(commentSubscriptionConfirmSubPath, a.serveCommentSubscriptionConfirm)
+				r.With(noIndexHeader).Get(commentSubscriptionUnsubscribeSubPath, a.serveCommentSubscriptionUnsubscribe)
+				r.Post(commentSubscriptionUnsubscribeSubPath, a.serveCommentSubscriptionUnsubscribe)
+				if conf.commentsSignInEnabled() {
+					// Sign in for commenters
+					r.With(noIndexHeader).Get(commentSignInSubPath, a.serveCommentSignIn)
+					r.With(a.rateLimitMiddleware(rateLimitComments)).Post(commentSignInSubPath, a.startCommentSignIn)
+					r.With(noIndexHeader).Get(commentSignInCallbackSubPath, a.commentSignInCallback)
+					r.With(noIndexHeader).Get(commentSignInEmailSubPath, a.commentSignInEmail)
+					r.Post(commentSignOutSubPath, a.commentSignOut)
+				}
 				r.Group(func(r chi.Router) {
 					// Admin
 					r.Use(a.authMiddleware)
 					r.Get("/", a.commentsAdmin)
 					r.Get(paginationPath, a.commentsAdmin)
 					r.Post(commentDeleteSubPath, a.commentsAdminDelete)
+					r.Post(commentApproveSubPath, a.commentsAdminApprove)
+					r.Post(commentSpamSubPath, a.commentsAdminSpam)
+					r.Post(commentReplySubPath, a.commentsAdminReply)
 					r.Get(commentEditSubPath, a.serveCommentsEditor)
 					r.Post(commentEditSubPath, a.serveCommentsEditor)
 				})
@@ -424,6 +471,10 @@ func (a *goBlog) blogBlogrollRouter(conf *configBlog) func(r chi.Router) {
 			)
 			r.Get(brPath, a.serveBlogroll)
 			r.Get(brPath+".opml", a.serveBlogrollExport)
+			if brConfig.Latest {
+				r.Get(brPath+blogrollLatestPath, a.serveBlogrollLatest)
+				r.Get(brPath+blogrollLatestPath+feedPath, a.serveBlogrollLatest)
+			}
 		}
 	}
 }
@@ -447,9 +498,15 @@ func (a *goBlog) blogContactRouter(conf *configBlog) func(r chi.Router) {
 		if cc := conf.Contact; cc != nil && cc.Enabled {
 			contactPath := conf.getRelativePath(defaultIfEmpty(cc.Path, defaultContactPath))
 			r.Route(contactPath, func(r chi.Router) {
-				r.Use(a.privateModeHandler, a.cacheMiddleware)
-				r.Get("/", a.serveContactForm)
-				r.With(a.captchaMiddleware, bodylimit.BodyLimit(bodylimit.MB)).Post("/", a.sendContactSubmission)
+				r.Use(a.privateModeHandler)
+				r.With(a.cacheMiddleware).Get("/", a.serveContactForm)
+				r.With(a.rateLimitMiddleware(rateLimitContact), a.captchaMiddleware, bodylimit.BodyLimit(bodylimit.MB)).Post("/", a.sendContactSubmission)
+				// Spam folder
+				r.Group(func(r chi.Router) {
+					r.Use(a.authMiddleware)
+					r.Get(contactSpamPath, a.serveContactSpam)
+					r.Post(contactSpamPath+"/{action:(deliver|delete)}", a.contactSpamAction)
+				})
 			})
 		}
 	}
@@ -485,5 +542,9 @@ func (a *goBlog) blogSettingsRouter(_ *configBlog) func(r chi.Router) {
 		r.Post(settingsUpdateUserPath, a.settingsUpdateUser)
 		r.Post(settingsUpdateProfileImagePath, a.serveUpdateProfileImage)
 		r.Post(settingsDeleteProfileImagePath, a.serveDeleteProfileImage)
+		r.Post(settingsCreateBlogrollItemPath, a.settingsCreateBlogrollItem)
+		r.Post(settingsUpdateBlogrollItemPath, a.settingsUpdateBlogrollItem)
+		r.Post(settingsDeleteBlogrollItemPath, a.settingsDeleteBlogrollItem)
+		r.With(bodylimit.BodyLimit(10*bodylimit.MB)).Post(settingsImportBlogrollPath, a.settingsImportBlogroll)
 	}
 }
@@ -41,7 +41,7 @@ func (a *goBlog) indieAuthMetadata(w http.ResponseWriter, _ *http.Request) {
 		"introspection_endpoint": a.getFullAddress(indieAuthPath + indieAuthTokenSubpath),
 		"revocation_endpoint":    a.getFullAddress(indieAuthPath + indieAuthTokenRevocationSubpath),
 		"revocation_endpoint_auth_methods_supported": []string{"none"},
-		"scopes_supported":                           []string{"create", "update", "delete", "undelete", "media"},
+		"scopes_supported":                           []string{"create", "update", "delete", "undelete", "media", "read", "follow"},
 		"code_challenge_methods_supported":           indieauth.CodeChallengeMethods,
 	}
 	pr, pw := io.Pipe()
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jlelse/feeds"
+	"go.goblog.app/app/pkgs/bufferpool"
+	"go.goblog.app/app/pkgs/builderpool"
+	"go.goblog.app/app/pkgs/htmlbuilder"
+)
+
+const (
+	interactionsPath      = "/interactions"
+	interactionsFeedLimit = 50
+)
+
+type interaction struct {
+	*mention
+	Path string // Path of the target post
+}
+
+type interactionsRequestConfig struct {
+	blog, path string
+	visibility []postVisibility
+	limit      int
+}
+
+// Returns approved webmentions (including comments and ActivityPub replies) of published posts, newest first.
+// Threaded replies target the comment they reply to, their post is the post of that comment (see setWebmentionPosts).
+func (a *goBlog) getInteractions(config *interactionsRequestConfig) ([]*interaction, error) {
+	query, args := buildInteractionsQuery(config)
+	rows, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	interactions := []*interaction{}
+	for rows.Next() {
+		i := &interaction{mention: &mention{}}
+		if err = rows.Scan(&i.ID, &i.Source, &i.Url, &i.Created, &i.Title, &i.Content, &i.Author, &i.Path); err != nil {
+			return nil, err
+		}
+		if i.Url == "" {
+			i.Url = i.Source
+		}
+		interactions = append(interactions, i)
+	}
+	return interactions, rows.Err()
+}
+
+func buildInteractionsQuery(config *interactionsRequestConfig) (query string, args []any) {
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	queryBuilder.WriteString(`
+	select w.id, w.source, w.url, w.created, w.title, w.content, w.author, p.path
+	from webmentions w join posts p on p.path = w.post
+	where w.status = @approved and p.blog = @blog and p.status = @published`)
+	args = []any{
+		sql.Named("approved", webmentionStatusApproved),
+		sql.Named("blog", config.blog),
+		sql.Named("published", statusPublished),
+	}
+	if config.path != "" {
+		queryBuilder.WriteString(" and w.post = @path")
+		args = append(args, sql.Named("path", config.path))
+	}
+	if len(config.visibility) > 0 {
+		queryBuilder.WriteString(" and p.visibility in (")
+		for i, v := range config.visibility {
+			if i > 0 {
+				queryBuilder.WriteString(", ")
+			}
+			named := fmt.Sprintf("visibility%d", i)
+			queryBuilder.WriteString("@" + named)
+			args = append(args, sql.Named(named, v))
+		}
+		queryBuilder.WriteString(")")
+	}
+	queryBuilder.WriteString(" order by w.created desc, w.id desc limit @limit")
+	args = append(args, sql.Named("limit", config.limit))
+	return queryBuilder.String(), args
+}
+
+func (a *goBlog) interactionsFeedURL(p *post, f feedType) string {
+	bc := a.getBlogFromPost(p)
+	return a.getFullAddress(bc.getRelativePath(interactionsPath+"."+string(f))) + "?post=" + url.QueryEscape(p.Path)
+}
+
+// Checks if the interactions of the post are publicly available
+func (a *goBlog) hasPublicInteractions(p *post) bool {
+	return a.commentsEnabledForPost(p) && p.Status == statusPublished && (p.Visibility == visibilityPublic || p.Visibility == visibilityUnlisted)
+}
+
+func (a *goBlog) serveInteractionsFeed(w http.ResponseWriter, r *http.Request) {
+	blog, bc := a.getBlog(r)
+	ft := feedType(chi.URLParam(r, "feed"))
+	config := &interactionsRequestConfig{blog: blog, visibility: []postVisibility{visibilityPublic}, limit: interactionsFeedLimit}
+	title, link := a.renderMdTitle(bc.Title), a.getFullAddress(bc.getRelativePath(""))
+	if postPath := r.URL.Query().Get("post"); postPath != "" {
+		// Feed of a single post
+		p, err := a.getPost(postPath)
+		if errors.Is(err, errPostNotFound) {
+			a.serve404(w, r)
+			return
+		} else if err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if p.Blog != blog || !a.commentsEnabledForPost(p) || (!a.hasPublicInteractions(p) && !a.isLoggedIn(r)) {
+			a.serve404(w, r)
+			return
+		}
+		config.path, config.visibility = p.Path, nil
+		title, link = defaultIfEmpty(p.RenderedTitle, a.fallbackTitle(p)), a.fullPostURL(p)
+	}
+	interactions, err := a.getInteractions(config)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Validators
+	h := sha256.New()
+	var lastModified time.Time
+	for _, i := range interactions {
+		if created := time.Unix(i.Created, 0); created.After(lastModified) {
+			lastModified = created
+		}
+		_, _ = fmt.Fprintf(h, "%d\n", i.ID)
+	}
+	_, _ = fmt.Fprintf(h, "%t", a.isLoggedIn(r))
+	eTag := fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+	w.Header().Set("ETag", eTag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, eTag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// Create feed
+	interactionsTitle := a.ts.GetTemplateStringVariant(bc.Lang, "interactions")
+	feed := &feeds.Feed{
+		Title:   fmt.Sprintf("%s (%s)", interactionsTitle, title),
+		Link:    &feeds.Link{Href: link},
+		Created: lastModified,
+	}
+	if feed.Created.IsZero() {
+		feed.Created = time.Now()
+	}
+	posts := map[string]*post{}
+	for _, i := range interactions {
+		p, ok := posts[i.Path]
+		if !ok {
+			if p, err = a.getPost(i.Path); err != nil {
+				a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			posts[i.Path] = p
+		}
+		postTitle, postURL := defaultIfEmpty(p.RenderedTitle, a.fallbackTitle(p)), a.fullPostURL(p)
+		author := defaultIfEmpty(i.Author, i.Url)
+		buf := bufferpool.Get()
+		a.interactionFeedHtml(buf, i.mention, author, postTitle, postURL)
+		feed.Add(&feeds.Item{
+			Title:       fmt.Sprintf(a.ts.GetTemplateStringVariant(bc.Lang, "interactionsfeeditem"), author, postTitle),
+			Link:        &feeds.Link{Href: i.Url},
+			Author:      &feeds.Author{Name: author},
+			Id:          fmt.Sprintf("%s#interaction-%d", postURL, i.ID),
+			Description: strings.TrimSpace(defaultIfEmpty(i.Content, i.Title)),
+			Content:     buf.String(),
+			Created:     time.Unix(i.Created, 0),
+		})
+		bufferpool.Put(buf)
+	}
+	a.writeFeed(w, r, ft, feed, &feedExtensions{self: a.getFullAddress(r.URL.RequestURI())})
+}
+
+func (a *goBlog) interactionFeedHtml(w io.Writer, m *mention, author, postTitle, postURL string) {
+	hb := htmlbuilder.NewHtmlBuilder(w)
+	hb.WriteElementOpen("p")
+	hb.WriteElementOpen("a", "href", m.Url, "rel", "nofollow noopener noreferrer ugc")
+	hb.WriteEscaped(author)
+	hb.WriteElementClose("a")
+	if m.Title != "" {
+		hb.WriteUnescaped(" ")
+		hb.WriteElementOpen("strong")
+		hb.WriteEscaped(m.Title)
+		hb.WriteElementClose("strong")
+	}
+	hb.WriteElementClose("p")
+	if m.Content != "" {
+		hb.WriteElementOpen("blockquote")
+		hb.WriteEscaped(m.Content)
+		hb.WriteElementClose("blockquote")
+	}
+	hb.WriteElementOpen("p")
+	hb.WriteUnescaped("→ ")
+	hb.WriteElementOpen("a", "href", postURL)
+	hb.WriteEscaped(postTitle)
+	hb.WriteElementClose("a")
+	hb.WriteElementClose("p")
+}
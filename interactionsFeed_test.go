@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_interactionsFeed(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+
+	_ = app.initConfig(false)
+	app.cfg.Blogs[app.cfg.DefaultBlog].Comments = &configComments{Enabled: true}
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	for _, p := range []*post{
+		{Path: "/public", Parameters: map[string][]string{"title": {"Public post"}}, Visibility: visibilityPublic},
+		{Path: "/unlisted", Parameters: map[string][]string{"title": {"Unlisted post"}}, Visibility: visibilityUnlisted},
+		{Path: "/private", Parameters: map[string][]string{"title": {"Private post"}}, Visibility: visibilityPrivate},
+	} {
+		p.Section, p.Status, p.Content = "posts", statusPublished, "Test"
+		require.NoError(t, app.createPost(p))
+	}
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, m := range []*mention{
+		{Source: "https://example.com/reply", Target: "http://localhost:8080/public", Author: "Alice", Content: "Nice post!"},
+		{Source: "https://example.com/like", Target: "http://localhost:8080/PUBLIC", Author: "Bob", Title: "Liked"},
+		{Source: "https://example.com/unlisted", Target: "http://localhost:8080/unlisted", Author: "Carol", Content: "Unlisted reply"},
+		{Source: "https://example.com/private", Target: "http://localhost:8080/private", Author: "Dave", Content: "Private reply"},
+	} {
+		m.Created = created.Add(time.Duration(i) * time.Hour).Unix()
+		require.NoError(t, app.db.insertWebmention(m, webmentionStatusApproved))
+	}
+	require.NoError(t, app.db.insertWebmention(&mention{
+		Source: "https://example.com/spam", Target: "http://localhost:8080/public", Author: "Spammer", Created: created.Unix(),
+	}, webmentionStatusVerified))
+	// Threaded reply to a comment of the public post
+	_, err := app.db.Exec("insert into comments (target, name, website, comment) values ('/public', 'Alice', '', 'Nice post!')")
+	require.NoError(t, err)
+	require.NoError(t, app.db.insertWebmention(&mention{
+		Source: "http://localhost:8080/comment/2", Target: "http://localhost:8080/comment/1", Author: "Erin", Content: "Agreed!",
+		Created: created.Add(5 * time.Hour).Unix(),
+	}, webmentionStatusApproved))
+	require.NoError(t, app.setWebmentionPosts())
+
+	fetchFeed := func(url string) (*gofeed.Feed, int) {
+		var feed *gofeed.Feed
+		var status int
+		err := requests.URL(url).Client(handlerClient).
+			AddValidator(nil).
+			Handle(func(r *http.Response) (err error) {
+				defer r.Body.Close()
+				status = r.StatusCode
+				if status == http.StatusOK {
+					feed, err = gofeed.NewParser().Parse(r.Body)
+				}
+				return
+			}).
+			Fetch(context.Background())
+		require.NoError(t, err)
+		return feed, status
+	}
+
+	// Blog feed only contains approved interactions of public posts
+	feed, status := fetchFeed("http://localhost:8080/interactions.rss")
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, feed.Title, "(My Blog)")
+	if assert.Len(t, feed.Items, 3) {
+		assert.Contains(t, feed.Items[0].Title, "Erin")
+		assert.Contains(t, feed.Items[0].Title, "Public post")
+		assert.Contains(t, feed.Items[1].Title, "Bob")
+		assert.Equal(t, "https://example.com/like", feed.Items[1].Link)
+		assert.Contains(t, feed.Items[2].Title, "Alice")
+		assert.Contains(t, feed.Items[2].Title, "Public post")
+		assert.Equal(t, "Alice", feed.Items[2].Author.Name)
+		assert.Equal(t, "Nice post!", feed.Items[2].Description)
+		assert.Contains(t, feed.Items[2].Content, `<a href="http://localhost:8080/public">Public post</a>`)
+	}
+
+	// Post feed with the threaded reply
+	feed, status = fetchFeed("http://localhost:8080/interactions.rss?post=/public")
+	require.Equal(t, http.StatusOK, status)
+	assert.Len(t, feed.Items, 3)
+
+	// Post feed
+	feed, status = fetchFeed("http://localhost:8080/interactions.atom?post=/unlisted")
+	require.Equal(t, http.StatusOK, status)
+	if assert.Len(t, feed.Items, 1) {
+		assert.Contains(t, feed.Items[0].Title, "Carol")
+	}
+
+	_, status = fetchFeed("http://localhost:8080/interactions.json?post=/private")
+	assert.Equal(t, http.StatusNotFound, status)
+	_, status = fetchFeed("http://localhost:8080/interactions.json?post=/notexisting")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// The post links the feed
+	var page string
+	err = requests.URL("http://localhost:8080/public").Client(handlerClient).ToString(&page).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, page, `href="http://localhost:8080/interactions.rss?post=%2Fpublic"`)
+}
+
+func Test_interactionsQuery(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+
+	_ = app.initConfig(false)
+	app.cfg.Blogs[app.cfg.DefaultBlog].Comments = &configComments{Enabled: true}
+
+	// 1000 posts with 5 webmentions each and a comment on every tenth post
+	_, err := app.db.Exec(`
+	with recursive n(i) as (select 1 union all select i + 1 from n where i < 1000)
+	insert into posts (path, content, published, updated, blog, section, status, visibility)
+	select '/post' || i, 'Test', '', '', @blog, 'posts', @published, @public from n`,
+		sql.Named("blog", app.cfg.DefaultBlog), sql.Named("published", statusPublished), sql.Named("public", visibilityPublic))
+	require.NoError(t, err)
+	_, err = app.db.Exec(`
+	with recursive n(i) as (select 1 union all select i + 1 from n where i < 5000)
+	insert into webmentions (source, target, created, status, title, content, author)
+	select 'https://example.com/reply' || i, 'http://localhost:8080/post' || (i % 1000 + 1), i, @approved, '', 'Reply', 'Alice' from n`,
+		sql.Named("approved", webmentionStatusApproved))
+	require.NoError(t, err)
+	_, err = app.db.Exec(`
+	with recursive n(i) as (select 1 union all select i + 1 from n where i < 100)
+	insert into comments (target, name, website, comment) select '/post' || (i * 10), 'Bob', '', 'Comment' from n`)
+	require.NoError(t, err)
+	require.NoError(t, app.db.insertWebmention(&mention{
+		Source: "https://example.com/thread", Target: "http://localhost:8080/comment/3", Author: "Carol", Created: 6000,
+	}, webmentionStatusApproved))
+	require.NoError(t, app.setWebmentionPosts())
+
+	interactions, err := app.getInteractions(&interactionsRequestConfig{blog: app.cfg.DefaultBlog, limit: interactionsFeedLimit})
+	require.NoError(t, err)
+	if assert.Len(t, interactions, interactionsFeedLimit) {
+		assert.Equal(t, "https://example.com/thread", interactions[0].Source)
+		assert.Equal(t, "/post30", interactions[0].Path)
+		assert.Equal(t, "https://example.com/reply5000", interactions[1].Source)
+		assert.Equal(t, "/post1", interactions[1].Path)
+	}
+
+	config := &interactionsRequestConfig{blog: app.cfg.DefaultBlog, path: "/post30", limit: interactionsFeedLimit}
+	interactions, err = app.getInteractions(config)
+	require.NoError(t, err)
+	assert.Len(t, interactions, 6)
+
+	// Both queries use indexes instead of scanning the tables
+	for _, config := range []*interactionsRequestConfig{config, {blog: app.cfg.DefaultBlog, limit: interactionsFeedLimit}} {
+		query, args := buildInteractionsQuery(config)
+		rows, err := app.db.Query("explain query plan "+query, args...)
+		require.NoError(t, err)
+		plan := []string{}
+		for rows.Next() {
+			var id, parent, notUsed int
+			var detail string
+			require.NoError(t, rows.Scan(&id, &parent, &notUsed, &detail))
+			plan = append(plan, detail)
+		}
+		require.NoError(t, rows.Close())
+		for _, detail := range plan {
+			if strings.HasPrefix(detail, "SCAN") {
+				assert.Contains(t, detail, "USING", plan)
+			}
+			assert.NotContains(t, detail, "TEMP B-TREE", plan)
+		}
+	}
+}
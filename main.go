@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"log"
 	"net"
@@ -54,7 +55,8 @@ func main() {
 	}
 
 	app := &goBlog{
-		httpClient: newHttpClient(),
+		httpClient:       newHttpClient(),
+		publicHttpClient: newPublicHttpClient(),
 	}
 
 	// Initialize config
@@ -111,6 +113,7 @@ func main() {
 			pprofHandler.HandleFunc("/debug/pprof/profile", netpprof.Profile)
 			pprofHandler.HandleFunc("/debug/pprof/symbol", netpprof.Symbol)
 			pprofHandler.HandleFunc("/debug/pprof/trace", netpprof.Trace)
+			pprofHandler.Handle("/debug/vars", expvar.Handler())
 			// Build server and listener
 			pprofServer := &http.Server{
 				Addr:              defaultIfEmpty(pprofCfg.Address, "localhost:0"),
@@ -164,6 +167,37 @@ func main() {
 		return
 	}
 
+	// Media storage migration
+	if len(os.Args) >= 3 && os.Args[1] == "media" && os.Args[2] == "migrate" {
+		migrateFlags := flag.NewFlagSet("media migrate", flag.ExitOnError)
+		from := migrateFlags.String("from", "", "media storage to migrate from (local, ftp, bunny, sftp, webdav or s3)")
+		to := migrateFlags.String("to", "", "media storage to migrate to (local, ftp, bunny, sftp, webdav or s3)")
+		fromURL := migrateFlags.String("from-url", "", "URL prefix of the files in the old media storage (optional)")
+		_ = migrateFlags.Parse(os.Args[3:])
+		if err = app.migrateMedia(*from, *to, *fromURL); err != nil {
+			app.logErrAndQuit("Failed to migrate media files:", err.Error())
+			return
+		}
+		app.shutdown.ShutdownAndWait()
+		return
+	}
+
+	// Import blogroll to Microsub
+	if len(os.Args) >= 3 && os.Args[1] == "microsub" && os.Args[2] == "import-blogroll" {
+		blog := app.cfg.DefaultBlog
+		if len(os.Args) >= 4 {
+			blog = os.Args[3]
+		}
+		count, err := app.microsubImportBlogroll(blog)
+		if err != nil {
+			app.logErrAndQuit("Failed to import blogroll:", err.Error())
+			return
+		}
+		log.Printf("Imported %d feeds from the blogroll", count)
+		app.shutdown.ShutdownAndWait()
+		return
+	}
+
 	// Initialize components
 	app.initComponents()
 
@@ -220,6 +254,14 @@ func (app *goBlog) initComponents() {
 	app.startPostsScheduler()
 	app.initPostsDeleter()
 	app.initIndexNow()
+	app.initWebSub()
+	app.initEnclosureInfo()
+	app.initMicrosub()
+	app.initBlogrollLatest()
+	app.initMediaLibrary()
+	app.initMediaGc()
+	app.initVideoHls()
+	app.initImageVariants()
 
 	log.Println("Initialized components")
 }
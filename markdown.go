@@ -44,13 +44,19 @@ func (a *goBlog) initMarkdown() {
 	if srv := a.cfg.Server; srv != nil {
 		publicAddress = srv.PublicAddress
 	}
+	var imageSrcsets imageSrcsetsFunc
+	if a.imageVariantsEnabled() {
+		imageSrcsets = a.imageVariantSrcsets
+	}
 	a.md = goldmark.New(append(defaultGoldmarkOptions, goldmark.WithExtensions(&customExtension{
 		absoluteLinks: false,
 		publicAddress: publicAddress,
+		imageSrcsets:  imageSrcsets,
 	}))...)
 	a.absoluteMd = goldmark.New(append(defaultGoldmarkOptions, goldmark.WithExtensions(&customExtension{
 		absoluteLinks: true,
 		publicAddress: publicAddress,
+		imageSrcsets:  imageSrcsets,
 	}))...)
 	a.titleMd = goldmark.New(
 		goldmark.WithParser(
@@ -114,17 +120,22 @@ func (a *goBlog) renderMdTitle(s string) string {
 
 // Extensions etc...
 
-// Links
+// Links and images
 type customExtension struct {
 	publicAddress string
 	absoluteLinks bool
+	imageSrcsets  imageSrcsetsFunc
 }
 
+// Returns the srcset for an image and the <picture> sources for other formats, empty if there are none
+type imageSrcsetsFunc func(dest string) (srcset string, sources []*imageSource)
+
 func (l *customExtension) Extend(m goldmark.Markdown) {
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
 		util.Prioritized(&customRenderer{
 			absoluteLinks: l.absoluteLinks,
 			publicAddress: l.publicAddress,
+			imageSrcsets:  l.imageSrcsets,
 		}, 500),
 	))
 }
@@ -132,6 +143,7 @@ func (l *customExtension) Extend(m goldmark.Markdown) {
 type customRenderer struct {
 	publicAddress string
 	absoluteLinks bool
+	imageSrcsets  imageSrcsetsFunc
 }
 
 func (c *customRenderer) RegisterFuncs(r renderer.NodeRendererFuncRegisterer) {
@@ -183,13 +195,31 @@ func (c *customRenderer) renderImage(w util.BufWriter, source []byte, node ast.N
 			dest = resolved[0]
 		}
 	}
+	// Get responsive variants
+	var srcset string
+	var sources []*imageSource
+	if c.imageSrcsets != nil {
+		srcset, sources = c.imageSrcsets(dest)
+	}
 	hb := htmlbuilder.NewHtmlBuilder(w)
 	hb.WriteElementOpen("a", "href", dest)
+	if len(sources) > 0 {
+		hb.WriteElementOpen("picture")
+		for _, source := range sources {
+			hb.WriteElementOpen("source", "type", source.mimeType, "srcset", source.srcset, "sizes", imageVariantSizes)
+		}
+	}
 	imgEls := []any{"src", dest, "alt", string(n.Text(source)), "loading", "lazy"}
 	if len(n.Title) > 0 {
 		imgEls = append(imgEls, "title", string(n.Title))
 	}
+	if srcset != "" {
+		imgEls = append(imgEls, "srcset", srcset, "sizes", imageVariantSizes)
+	}
 	hb.WriteElementOpen("img", imgEls...)
+	if len(sources) > 0 {
+		hb.WriteElementClose("picture")
+	}
 	hb.WriteElementClose("a")
 	return ast.WalkSkipChildren, nil
 }
@@ -10,10 +10,16 @@ import (
 
 const (
 	mediaFilePath  = "data/media"
-	mediaFileRoute = `/{file:[0-9a-fA-F]+(\.[0-9a-zA-Z]+)?}`
+	mediaFileRoute = `/{file:[0-9a-fA-F]+(-[0-9a-zA-Z]+)*(\.[0-9a-zA-Z]+)?}`
 )
 
-func (*goBlog) serveMediaFile(w http.ResponseWriter, r *http.Request) {
+func (a *goBlog) serveMediaFile(w http.ResponseWriter, r *http.Request) {
+	if a.mediaStorageEnabled() {
+		if s, ok := a.mediaStorage.(*s3MediaStorage); ok && s.signedURLs {
+			a.serveS3SignedMediaFile(w, r, s)
+			return
+		}
+	}
 	f := filepath.Join(mediaFilePath, chi.URLParam(r, "file"))
 	_, err := os.Stat(f)
 	if err != nil {
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+
+	"go.goblog.app/app/pkgs/builderpool"
+)
+
+type mediaEntry struct {
+	Name     string
+	Hash     string
+	Filename string
+	MimeType string
+	Width    int
+	Height   int
+	Alt      string
+	Uploaded string
+	Size     int64
+	Backend  string
+	Original string
+	Exif     mediaExif
+	// Garbage collection of unused files
+	Orphaned    string // Date since when the file is unused
+	Quarantined string // Date since when the file is moved out of public serving before its deletion
+	Keep        bool   // Never collect the file
+}
+
+// Saves the metadata of a media file, alt text and original filename are only overwritten when set
+func (db *database) saveMediaEntry(e *mediaEntry) error {
+	_, err := db.Exec(
+		`insert into media (name, hash, filename, mimetype, width, height, alt, uploaded, size, backend)
+		values (@name, @hash, @filename, @mimetype, @width, @height, @alt, @uploaded, @size, @backend)
+		on conflict (name) do update set
+		hash = excluded.hash,
+		filename = iif(excluded.filename = '', filename, excluded.filename),
+		mimetype = excluded.mimetype,
+		width = excluded.width,
+		height = excluded.height,
+		alt = iif(excluded.alt = '', alt, excluded.alt),
+		uploaded = excluded.uploaded,
+		size = excluded.size,
+		backend = excluded.backend`,
+		sql.Named("name", e.Name), sql.Named("hash", e.Hash), sql.Named("filename", e.Filename),
+		sql.Named("mimetype", e.MimeType), sql.Named("width", e.Width), sql.Named("height", e.Height),
+		sql.Named("alt", e.Alt), sql.Named("uploaded", e.Uploaded), sql.Named("size", e.Size), sql.Named("backend", e.Backend),
+	)
+	return err
+}
+
+func (db *database) saveMediaSize(name string, size int64) error {
+	_, err := db.Exec("update media set size = @size where name = @name", sql.Named("size", size), sql.Named("name", name))
+	return err
+}
+
+func (db *database) saveMediaProbe(name, mimeType string, width, height int) error {
+	_, err := db.Exec(
+		"update media set mimetype = @mimetype, width = @width, height = @height where name = @name",
+		sql.Named("mimetype", mimeType), sql.Named("width", width), sql.Named("height", height), sql.Named("name", name),
+	)
+	return err
+}
+
+func (db *database) saveMediaAlt(name, alt string) error {
+	_, err := db.Exec(
+		"insert into media (name, alt) values (@name, @alt) on conflict (name) do update set alt = @alt2",
+		sql.Named("name", name), sql.Named("alt", alt), sql.Named("alt2", alt),
+	)
+	return err
+}
+
+func (db *database) saveMediaFilename(name, filename string) error {
+	_, err := db.Exec(
+		"insert into media (name, filename) values (@name, @filename) on conflict (name) do update set filename = @filename2",
+		sql.Named("name", name), sql.Named("filename", filename), sql.Named("filename2", filename),
+	)
+	return err
+}
+
+func (db *database) saveMediaBackend(name, backend string) error {
+	_, err := db.Exec(
+		"insert into media (name, backend) values (@name, @backend) on conflict (name) do update set backend = @backend2",
+		sql.Named("name", name), sql.Named("backend", backend), sql.Named("backend2", backend),
+	)
+	return err
+}
+
+func (db *database) saveMediaOrphanState(name, orphaned, quarantined string) error {
+	_, err := db.Exec(
+		`insert into media (name, orphaned, quarantined) values (@name, @orphaned, @quarantined)
+		on conflict (name) do update set orphaned = excluded.orphaned, quarantined = excluded.quarantined`,
+		sql.Named("name", name), sql.Named("orphaned", orphaned), sql.Named("quarantined", quarantined),
+	)
+	return err
+}
+
+// Marks a file to never be collected as unused file and resets its orphan state
+func (db *database) saveMediaKeep(name string) error {
+	_, err := db.Exec(
+		"insert into media (name, keep) values (@name, 1) on conflict (name) do update set keep = 1, orphaned = '', quarantined = ''",
+		sql.Named("name", name),
+	)
+	return err
+}
+
+func (db *database) saveMediaExif(name string, e *mediaExif) error {
+	_, err := db.Exec(
+		`insert into media (name, exifpublished, exiflocation, exifcamera) values (@name, @published, @location, @camera)
+		on conflict (name) do update set exifpublished = excluded.exifpublished, exiflocation = excluded.exiflocation, exifcamera = excluded.exifcamera`,
+		sql.Named("name", name), sql.Named("published", e.Published), sql.Named("location", e.Location), sql.Named("camera", e.Camera),
+	)
+	return err
+}
+
+const mediaEntrySelect = "select name, hash, filename, mimetype, width, height, alt, uploaded, size, backend, original, exifpublished, exiflocation, exifcamera, orphaned, quarantined, keep from media"
+
+// Returns the metadata of all media files if no names are given
+func (db *database) getMediaEntries(names ...string) (map[string]*mediaEntry, error) {
+	sqlArgs := []any{}
+	query := builderpool.Get()
+	defer builderpool.Put(query)
+	query.WriteString(mediaEntrySelect)
+	if len(names) > 0 {
+		sqlArgs = append(sqlArgs, dbNoCache)
+		query.WriteString(" where name in (")
+		for i, n := range names {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			named := "name" + strconv.Itoa(i)
+			query.WriteString("@")
+			query.WriteString(named)
+			sqlArgs = append(sqlArgs, sql.Named(named, n))
+		}
+		query.WriteString(")")
+	}
+	rows, err := db.Query(query.String(), sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := map[string]*mediaEntry{}
+	for rows.Next() {
+		e, err := scanMediaEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries[e.Name] = e
+	}
+	return entries, rows.Err()
+}
+
+// Returns the uploaded media files without responsive image variants, newest first
+func (db *database) getMediaLibrary(offset, limit int) ([]*mediaEntry, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(
+		mediaEntrySelect+" where original = '' and uploaded != '' order by uploaded desc, name limit @limit offset @offset",
+		sql.Named("limit", limit), sql.Named("offset", offset),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*mediaEntry
+	for rows.Next() {
+		e, err := scanMediaEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func scanMediaEntry(rows *sql.Rows) (*mediaEntry, error) {
+	e := &mediaEntry{}
+	err := rows.Scan(&e.Name, &e.Hash, &e.Filename, &e.MimeType, &e.Width, &e.Height, &e.Alt, &e.Uploaded, &e.Size, &e.Backend, &e.Original, &e.Exif.Published, &e.Exif.Location, &e.Exif.Camera, &e.Orphaned, &e.Quarantined, &e.Keep)
+	return e, err
+}
+
+// Saves the original of a variant, the width is only overwritten when set
+func (db *database) saveMediaVariant(name, original string, width int) error {
+	_, err := db.Exec(
+		`insert into media (name, original, width) values (@name, @original, @width)
+		on conflict (name) do update set original = excluded.original, width = iif(excluded.width = 0, width, excluded.width)`,
+		sql.Named("name", name), sql.Named("original", original), sql.Named("width", width),
+	)
+	return err
+}
+
+type mediaVariant struct {
+	Name     string
+	MimeType string
+	Width    int
+}
+
+// Returns the media file itself and its variants with known width, ordered by width
+func (db *database) getMediaVariants(original string) ([]*mediaVariant, error) {
+	rows, err := db.Query(
+		"select name, mimetype, width from media where (name = @name or original = @original) and width > 0 order by width",
+		sql.Named("name", original), sql.Named("original", original),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	variants := []*mediaVariant{}
+	for rows.Next() {
+		v := &mediaVariant{}
+		if err = rows.Scan(&v.Name, &v.MimeType, &v.Width); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// Returns the names of all files that belong to the original, like image variants or HLS files of videos
+func (db *database) getMediaVariantNames(original string) ([]string, error) {
+	rows, err := db.Query("select name from media where original = @original", sql.Named("original", original))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	var name string
+	for rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (db *database) deleteMediaEntry(name string) error {
+	_, err := db.Exec("delete from media where name = @name", sql.Named("name", name))
+	return err
+}
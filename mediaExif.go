@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// EXIF data of a photo that can be used as suggestions for post parameters
+type mediaExif struct {
+	Published string // RFC 3339 date the photo was taken
+	Location  string // Geo URI
+	Camera    string
+}
+
+func (e *mediaExif) empty() bool {
+	return e == nil || (e.Published == "" && e.Location == "" && e.Camera == "")
+}
+
+// Returns the EXIF data as post parameters
+func (e *mediaExif) suggestions(locationParam string) map[string][]string {
+	params := map[string][]string{}
+	if e.Published != "" {
+		params["published"] = []string{e.Published}
+	}
+	if e.Location != "" {
+		params[locationParam] = []string{e.Location}
+	}
+	if e.Camera != "" {
+		params["camera"] = []string{e.Camera}
+	}
+	return params
+}
+
+// Returns the query to open the editor with a new post using the photo and its EXIF data
+func (a *goBlog) exifEditorQuery(location string, e *mediaExif) string {
+	query := url.Values{}
+	query.Set("p:"+a.cfg.Micropub.PhotoParam, location)
+	for param, values := range e.suggestions(a.cfg.Micropub.LocationParam) {
+		query["p:"+param] = values
+	}
+	return query.Encode()
+}
+
+// Reads the EXIF data from a JPEG or PNG file, returns nil if there is none
+func readMediaExif(fileExtension string, r io.Reader) *mediaExif {
+	if fileExtension == "png" {
+		data, err := pngExifChunk(r)
+		if err != nil || len(data) == 0 {
+			return nil
+		}
+		r = bytes.NewReader(data)
+	} else if !isJpegExtension(fileExtension) {
+		return nil
+	}
+	x, err := exif.Decode(r)
+	if err != nil || x == nil {
+		return nil
+	}
+	me := &mediaExif{}
+	if dt, err := x.DateTime(); err == nil {
+		me.Published = dt.Format(time.RFC3339)
+	}
+	if lat, lon, err := x.LatLong(); err == nil {
+		me.Location = fmt.Sprintf("geo:%.6f,%.6f", lat, lon)
+	}
+	camera := []string{}
+	for _, field := range []exif.FieldName{exif.Make, exif.Model, exif.LensModel} {
+		if tag, err := x.Get(field); err == nil {
+			if s, err := tag.StringVal(); err == nil && strings.TrimSpace(s) != "" {
+				camera = append(camera, strings.TrimSpace(s))
+			}
+		}
+	}
+	me.Camera = strings.Join(camera, ", ")
+	if me.empty() {
+		return nil
+	}
+	return me
+}
+
+func isJpegExtension(fileExtension string) bool {
+	return fileExtension == "jpg" || fileExtension == "jpeg"
+}
+
+// Only JPEG and PNG files get their metadata stripped, other files (like videos) are kept as they are
+func hasStrippableExif(fileExtension string) bool {
+	return fileExtension == "png" || isJpegExtension(fileExtension)
+}
+
+// Writes the file without EXIF and XMP metadata (which includes GPS coordinates, camera serials etc.)
+// to w, only the image orientation of JPEG files is kept. Other file types are copied unchanged.
+func stripExif(fileExtension string, r io.Reader, w io.Writer) error {
+	if fileExtension == "png" {
+		return stripPngExif(r, w)
+	} else if isJpegExtension(fileExtension) {
+		return stripJpegExif(r, w)
+	}
+	_, err := io.Copy(w, r)
+	return err
+}
+
+const (
+	jpegExifPrefix = "Exif\x00\x00"
+	jpegXmpPrefix  = "http://ns.adobe.com/xap/1.0/\x00"
+)
+
+func stripJpegExif(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return err
+	}
+	if header[0] != 0xFF || header[1] != 0xD8 {
+		return errors.New("not a JPEG file")
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for {
+		prefix, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prefix != 0xFF {
+			return errors.New("invalid JPEG marker")
+		}
+		// Markers can be preceded by any number of 0xFF fill bytes
+		code := byte(0xFF)
+		for code == 0xFF {
+			if code, err = br.ReadByte(); err != nil {
+				return err
+			}
+		}
+		marker := []byte{0xFF, code}
+		// Start of scan, copy the rest of the file
+		if marker[1] == 0xDA {
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			_, err := io.Copy(w, br)
+			return err
+		}
+		// Markers without length
+		if marker[1] == 0x01 || (marker[1] >= 0xD0 && marker[1] <= 0xD7) {
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			continue
+		}
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(br, length); err != nil {
+			return err
+		}
+		segmentLength := int(binary.BigEndian.Uint16(length))
+		if segmentLength < 2 {
+			return errors.New("invalid JPEG segment length")
+		}
+		data := make([]byte, segmentLength-2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return err
+		}
+		if marker[1] == 0xE1 {
+			if bytes.HasPrefix(data, []byte(jpegExifPrefix)) {
+				// Replace EXIF with a minimal EXIF segment that only contains the orientation
+				if orientation := jpegExifOrientation(data); orientation > 1 {
+					if _, err := w.Write(minimalJpegExif(orientation)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if bytes.HasPrefix(data, []byte(jpegXmpPrefix)) {
+				continue
+			}
+		}
+		for _, b := range [][]byte{marker, length, data} {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func jpegExifOrientation(app1 []byte) int {
+	x, err := exif.Decode(bytes.NewReader(app1))
+	if err != nil {
+		return 0
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 0
+	}
+	orientation, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return orientation
+}
+
+// Returns an APP1 segment with an EXIF IFD that only contains the orientation tag
+func minimalJpegExif(orientation int) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(jpegExifPrefix)
+	// TIFF header (little endian) with offset to the first IFD
+	buf.WriteString("II*\x00")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(8))
+	// IFD with one entry: orientation (0x0112), type SHORT (3), count 1, value
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1))
+	_ = binary.Write(buf, binary.LittleEndian, []uint16{0x0112, 3})
+	_ = binary.Write(buf, binary.LittleEndian, uint32(1))
+	_ = binary.Write(buf, binary.LittleEndian, []uint16{uint16(orientation), 0})
+	// No next IFD
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0))
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(buf.Len()+2))
+	return append(segment, buf.Bytes()...)
+}
+
+const (
+	pngSignature      = "\x89PNG\r\n\x1a\n"
+	pngMaxChunkLength = 1<<31 - 1
+)
+
+// Calls f for every chunk of a PNG file, stops if f returns false
+func walkPngChunks(r io.Reader, f func(length, chunkType, data, crc []byte) (bool, error)) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return err
+	}
+	if string(signature) != pngSignature {
+		return errors.New("not a PNG file")
+	}
+	for {
+		length := make([]byte, 4)
+		if _, err := io.ReadFull(r, length); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		chunkType := make([]byte, 4)
+		if _, err := io.ReadFull(r, chunkType); err != nil {
+			return err
+		}
+		// Don't trust the length for the allocation, the buffer only grows with the data actually read
+		chunkLength := binary.BigEndian.Uint32(length)
+		if chunkLength > pngMaxChunkLength {
+			return errors.New("invalid PNG chunk length")
+		}
+		data := &bytes.Buffer{}
+		if _, err := io.CopyN(data, r, int64(chunkLength)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		crc := make([]byte, 4)
+		if _, err := io.ReadFull(r, crc); err != nil {
+			return err
+		}
+		if cont, err := f(length, chunkType, data.Bytes(), crc); err != nil || !cont {
+			return err
+		}
+	}
+}
+
+func pngExifChunk(r io.Reader) (exifData []byte, err error) {
+	err = walkPngChunks(bufio.NewReader(r), func(_, chunkType, data, _ []byte) (bool, error) {
+		if string(chunkType) == "eXIf" {
+			exifData = data
+			return false, nil
+		}
+		return string(chunkType) != "IDAT", nil
+	})
+	return exifData, err
+}
+
+func stripPngExif(r io.Reader, w io.Writer) error {
+	if _, err := w.Write([]byte(pngSignature)); err != nil {
+		return err
+	}
+	return walkPngChunks(bufio.NewReader(r), func(length, chunkType, data, crc []byte) (bool, error) {
+		switch string(chunkType) {
+		case "eXIf":
+			return true, nil
+		case "iTXt":
+			if bytes.HasPrefix(data, []byte("XML:com.adobe.xmp\x00")) {
+				return true, nil
+			}
+		}
+		for _, b := range [][]byte{length, chunkType, data, crc} {
+			if _, err := w.Write(b); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
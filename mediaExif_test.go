@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a TIFF structure (little endian) with the camera make, date and orientation
+func testExifTiff(orientation int) []byte {
+	type entry struct {
+		tag, typ uint16
+		value    []byte
+	}
+	entries := []entry{
+		{0x010F, 2, []byte("TestCam\x00")},
+		{0x0112, 3, []byte{byte(orientation), 0}},
+		{0x0132, 2, []byte("2022:01:02 03:04:05\x00")},
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("II*\x00")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(8))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+	// Values bigger than 4 bytes are stored after the IFD
+	dataOffset := 8 + 2 + len(entries)*12 + 4
+	data := &bytes.Buffer{}
+	for _, e := range entries {
+		_ = binary.Write(buf, binary.LittleEndian, []uint16{e.tag, e.typ})
+		count := uint32(len(e.value))
+		if e.typ == 3 {
+			count = 1
+		}
+		_ = binary.Write(buf, binary.LittleEndian, count)
+		if len(e.value) <= 4 {
+			buf.Write(append(e.value, make([]byte, 4-len(e.value))...))
+		} else {
+			_ = binary.Write(buf, binary.LittleEndian, uint32(dataOffset+data.Len()))
+			data.Write(e.value)
+		}
+	}
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+func testExifJpeg(t *testing.T) []byte {
+	img := &bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(img, image.NewRGBA(image.Rect(0, 0, 20, 10)), nil))
+	app1 := append([]byte(jpegExifPrefix), testExifTiff(6)...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(app1)+2))
+	// Insert the EXIF segment after the SOI marker
+	result := append([]byte{}, img.Bytes()[:2]...)
+	result = append(result, segment...)
+	result = append(result, app1...)
+	return append(result, img.Bytes()[2:]...)
+}
+
+func testExifPng(t *testing.T) []byte {
+	img := &bytes.Buffer{}
+	require.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 20, 10))))
+	data := testExifTiff(1)
+	chunk := &bytes.Buffer{}
+	_ = binary.Write(chunk, binary.BigEndian, uint32(len(data)))
+	chunk.WriteString("eXIf")
+	chunk.Write(data)
+	_ = binary.Write(chunk, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("eXIf"), data...)))
+	// Insert the eXIf chunk after the IHDR chunk (signature + 25 bytes)
+	ihdrEnd := len(pngSignature) + 25
+	result := append([]byte{}, img.Bytes()[:ihdrEnd]...)
+	result = append(result, chunk.Bytes()...)
+	return append(result, img.Bytes()[ihdrEnd:]...)
+}
+
+func Test_mediaExif(t *testing.T) {
+	t.Run("JPEG", func(t *testing.T) {
+		file := testExifJpeg(t)
+
+		e := readMediaExif("jpg", bytes.NewReader(file))
+		require.NotNil(t, e)
+		assert.Equal(t, "TestCam", e.Camera)
+		assert.Contains(t, e.Published, "2022-01-02T03:04:05")
+		assert.Empty(t, e.Location)
+
+		stripped := &bytes.Buffer{}
+		require.NoError(t, stripExif("jpg", bytes.NewReader(file), stripped))
+		assert.Less(t, stripped.Len(), len(file))
+
+		// Metadata is removed, but the orientation is kept
+		assert.Nil(t, readMediaExif("jpg", bytes.NewReader(stripped.Bytes())))
+		assert.NotContains(t, stripped.String(), "TestCam")
+		idx := bytes.Index(stripped.Bytes(), []byte(jpegExifPrefix))
+		require.Greater(t, idx, 0)
+		assert.Equal(t, 6, jpegExifOrientation(stripped.Bytes()[idx:]))
+
+		_, err := jpeg.Decode(bytes.NewReader(stripped.Bytes()))
+		assert.NoError(t, err)
+	})
+
+	t.Run("PNG", func(t *testing.T) {
+		file := testExifPng(t)
+
+		e := readMediaExif("png", bytes.NewReader(file))
+		require.NotNil(t, e)
+		assert.Equal(t, "TestCam", e.Camera)
+
+		stripped := &bytes.Buffer{}
+		require.NoError(t, stripExif("png", bytes.NewReader(file), stripped))
+		assert.NotContains(t, stripped.String(), "eXIf")
+		assert.Nil(t, readMediaExif("png", bytes.NewReader(stripped.Bytes())))
+
+		_, err := png.Decode(bytes.NewReader(stripped.Bytes()))
+		assert.NoError(t, err)
+	})
+
+	t.Run("JPEG fill bytes", func(t *testing.T) {
+		file := testExifJpeg(t)
+		// Fill bytes before the APP1 marker
+		filled := append([]byte{}, file[:2]...)
+		filled = append(filled, 0xFF, 0xFF)
+		filled = append(filled, file[2:]...)
+
+		stripped := &bytes.Buffer{}
+		require.NoError(t, stripExif("jpg", bytes.NewReader(filled), stripped))
+		assert.NotContains(t, stripped.String(), "TestCam")
+		_, err := jpeg.Decode(bytes.NewReader(stripped.Bytes()))
+		assert.NoError(t, err)
+	})
+
+	t.Run("PNG chunk length", func(t *testing.T) {
+		// A huge chunk length in a small file doesn't allocate the length
+		file := append([]byte(pngSignature), 0x7F, 0xFF, 0xFF, 0xF0)
+		file = append(file, []byte("tEXtshort")...)
+		assert.ErrorIs(t, stripExif("png", bytes.NewReader(file), &bytes.Buffer{}), io.ErrUnexpectedEOF)
+
+		file = append([]byte(pngSignature), 0xFF, 0xFF, 0xFF, 0xF0)
+		file = append(file, []byte("tEXtshort")...)
+		assert.Error(t, stripExif("png", bytes.NewReader(file), &bytes.Buffer{}))
+	})
+
+	t.Run("Other files", func(t *testing.T) {
+		assert.Nil(t, readMediaExif("txt", bytes.NewReader([]byte("Test"))))
+		out := &bytes.Buffer{}
+		require.NoError(t, stripExif("txt", bytes.NewReader([]byte("Test")), out))
+		assert.Equal(t, "Test", out.String())
+	})
+}
+
+func Test_micropubMediaExif(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+
+	_ = app.initConfig(false)
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+	})
+
+	handler := addAllScopes(http.HandlerFunc(app.serveMicropubMedia))
+
+	upload := func(file []byte, keep bool) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, err := mw.CreateFormFile("file", "photo.jpg")
+		require.NoError(t, err)
+		_, _ = fw.Write(file)
+		if keep {
+			_ = mw.WriteField("mp-keep-exif", "true")
+		}
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/micropub/media", body)
+		req.Header.Set(contentType, mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Stripped by default, EXIF data is returned as suggestions
+	rec := upload(testExifJpeg(t), false)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get("Location")
+	require.NotEmpty(t, location)
+
+	var result struct {
+		URL         string              `json:"url"`
+		Suggestions map[string][]string `json:"suggestions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, location, result.URL)
+	assert.Equal(t, []string{"TestCam"}, result.Suggestions["camera"])
+
+	entries, err := app.db.getMediaEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	for _, e := range entries {
+		assert.Equal(t, "TestCam", e.Exif.Camera)
+	}
+
+	// Keeping the EXIF data results in a different file
+	rec = upload(testExifJpeg(t), true)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotEqual(t, location, rec.Header().Get("Location"))
+
+	// Files the parser doesn't understand are kept as they are
+	broken := []byte("\xFF\xD8broken")
+	rec = upload(broken, false)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	location = rec.Header().Get("Location")
+	saved, err := os.ReadFile(filepath.Join(mediaDir, path.Base(location)))
+	require.NoError(t, err)
+	assert.Equal(t, broken, saved)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/builderpool"
+)
+
+const (
+	mediaGcDefaultDays = 30
+	mediaOrphansPath   = "/files/orphans"
+	// Quarantined files are stored with this prefix
+	mediaQuarantinePrefix = "quarantine-"
+)
+
+func (a *goBlog) mediaGcEnabled() bool {
+	if a.cfg.Micropub == nil {
+		return false
+	}
+	ms := a.cfg.Micropub.MediaStorage
+	return ms != nil && ms.MediaGCEnabled
+}
+
+// Returns the days a file has to be unused before it's quarantined and the days until it gets deleted
+func (a *goBlog) mediaGcPeriods() (grace, deletion time.Duration) {
+	graceDays, deleteDays := mediaGcDefaultDays, mediaGcDefaultDays
+	if ms := a.cfg.Micropub.MediaStorage; ms != nil {
+		if ms.MediaGCGraceDays > 0 {
+			graceDays = ms.MediaGCGraceDays
+		}
+		if ms.MediaGCDeleteDays > 0 {
+			deleteDays = ms.MediaGCDeleteDays
+		}
+	}
+	return time.Duration(graceDays) * 24 * time.Hour, time.Duration(deleteDays) * 24 * time.Hour
+}
+
+func (a *goBlog) initMediaGc() {
+	if !a.mediaGcEnabled() {
+		return
+	}
+	a.hourlyHooks = append(a.hourlyHooks, func() {
+		if err := a.collectMediaGarbage(); err != nil {
+			log.Println("Failed to collect unused media files:", err.Error())
+		}
+	})
+}
+
+// Finds media files of the media library that aren't used anywhere, quarantines them
+// after the grace period and deletes them when the deletion period is over.
+// Quarantined files are moved to another name, so they aren't accessible anymore,
+// and are moved back when they are used again.
+func (a *goBlog) collectMediaGarbage() error {
+	if !a.mediaStorageEnabled() {
+		return nil
+	}
+	files, err := a.mediaFiles()
+	if err != nil {
+		return err
+	}
+	entries, err := a.db.getMediaEntries()
+	if err != nil {
+		return err
+	}
+	stored := map[string]bool{}
+	for _, f := range files {
+		stored[f.Name] = true
+	}
+	// Only files of the media library are collected, files added to the storage
+	// by other means are left alone.
+	// Variants (responsive images or HLS files of videos) are handled together with their original.
+	names := []string{}
+	for name, e := range entries {
+		if e.Original == "" && (stored[name] || e.Quarantined != "") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	used, err := a.mediaFilesInUse(lo.Keys(entries)...)
+	if err != nil {
+		return err
+	}
+	// An original is used as long as one of its variants is used
+	for name := range used {
+		if e, ok := entries[name]; ok && e.Original != "" {
+			used[e.Original] = true
+		}
+	}
+	grace, deletion := a.mediaGcPeriods()
+	now := time.Now()
+	var quarantined, restored, deleted int
+	for _, name := range names {
+		e := entries[name]
+		if used[name] || e.Keep {
+			// Used (again), reset state
+			if e.Quarantined != "" {
+				log.Println("Restoring media file that is used again:", name)
+				err = a.restoreMediaFile(name)
+				restored++
+			} else if e.Orphaned != "" {
+				err = a.db.saveMediaOrphanState(name, "", "")
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		orphaned, orphanedErr := time.Parse(time.RFC3339, e.Orphaned)
+		quarantinedSince, quarantinedErr := time.Parse(time.RFC3339, e.Quarantined)
+		switch {
+		case orphanedErr != nil && quarantinedErr != nil:
+			// Newly found unused file
+			err = a.db.saveMediaOrphanState(name, now.Format(time.RFC3339), "")
+		case quarantinedErr != nil:
+			if orphaned.Add(grace).Before(now) {
+				err = a.quarantineMediaFile(name, e.Orphaned)
+				quarantined++
+			}
+		case quarantinedSince.Add(deletion).Before(now):
+			log.Println("Deleting unused media file:", name)
+			err = a.deleteMediaFile(name)
+			deleted++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if quarantined > 0 {
+		a.sendNotification(fmt.Sprintf(
+			"%d unused media files were quarantined and will be deleted in %d days. Review them: %s",
+			quarantined, int(deletion.Hours()/24), a.getFullAddress(a.getRelativePath(a.cfg.DefaultBlog, editorPath+mediaOrphansPath)),
+		))
+	}
+	if quarantined > 0 || restored > 0 || deleted > 0 {
+		log.Printf("Media garbage collection: %d files quarantined, %d files restored, %d files deleted", quarantined, restored, deleted)
+	}
+	return nil
+}
+
+// Returns the name a quarantined media file is stored with, it doesn't match the media file route
+func mediaQuarantineName(name string) string {
+	return mediaQuarantinePrefix + name
+}
+
+// Moves a media file and its variants out of public serving
+func (a *goBlog) quarantineMediaFile(name, orphaned string) error {
+	variants, err := a.db.getMediaVariantNames(name)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Format(time.RFC3339)
+	for _, n := range append(variants, name) {
+		if err = a.moveMediaFile(n, mediaQuarantineName(n)); err != nil {
+			return err
+		}
+		if err = a.db.saveMediaOrphanState(n, lo.If(n == name, orphaned).Else(""), now); err != nil {
+			return err
+		}
+	}
+	a.purgeImageVariantsCache()
+	return nil
+}
+
+// Moves a quarantined media file and its variants back
+func (a *goBlog) restoreMediaFile(name string) error {
+	variants, err := a.db.getMediaVariantNames(name)
+	if err != nil {
+		return err
+	}
+	entries, err := a.db.getMediaEntries(append(variants, name)...)
+	if err != nil {
+		return err
+	}
+	for _, n := range append(variants, name) {
+		if e, ok := entries[n]; ok && e.Quarantined != "" {
+			if err = a.moveMediaFile(mediaQuarantineName(n), n); err != nil {
+				return err
+			}
+		}
+		if err = a.db.saveMediaOrphanState(n, "", ""); err != nil {
+			return err
+		}
+	}
+	a.purgeImageVariantsCache()
+	return nil
+}
+
+// Checks which media files are used in posts (content and parameters like photos or TTS audio), comments or settings
+func (a *goBlog) mediaFilesInUse(names ...string) (map[string]bool, error) {
+	used := map[string]bool{}
+	uses, err := a.db.usesOfMediaFile(names...)
+	if err != nil {
+		return nil, err
+	}
+	for i, count := range uses {
+		if count > 0 {
+			used[names[i]] = true
+		}
+	}
+	otherUses, err := a.db.mediaFilesUsedOutsidePosts(names...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range otherUses {
+		used[name] = true
+	}
+	return used, nil
+}
+
+const mediaOtherUseSql = `
+with mediafiles (name) as (values %s)
+select distinct m.name from mediafiles m, comments c where instr(c.comment, m.name) > 0
+union
+select distinct m.name from mediafiles m, settings s where instr(s.value, m.name) > 0;
+`
+
+func (db *database) mediaFilesUsedOutsidePosts(names ...string) ([]string, error) {
+	sqlArgs := []any{dbNoCache}
+	nameValues := builderpool.Get()
+	defer builderpool.Put(nameValues)
+	for i, n := range names {
+		if i > 0 {
+			nameValues.WriteString(", ")
+		}
+		named := "name" + strconv.Itoa(i)
+		nameValues.WriteString("(@")
+		nameValues.WriteString(named)
+		nameValues.WriteString(")")
+		sqlArgs = append(sqlArgs, sql.Named(named, n))
+	}
+	rows, err := db.Query(fmt.Sprintf(mediaOtherUseSql, nameValues.String()), sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []string
+	var name string
+	for rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+	}
+	return result, rows.Err()
+}
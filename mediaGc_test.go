@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mediaGc(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Micropub.MediaStorage = &configMicropubMedia{
+		MediaGCEnabled: true,
+	}
+	_ = app.initConfig(false)
+	_ = app.initCache()
+	app.initMarkdown()
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+		app.mediaStorageBackend = mediaStorageLocal
+	})
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "c-100.jpg", "d.jpg", "e.mp4", "e.m3u8"} {
+		_, err := app.saveMediaFile(name, strings.NewReader(name))
+		require.NoError(t, err)
+	}
+	// f.jpg isn't part of the media library
+	require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "f.jpg"), []byte("f.jpg"), 0644))
+	require.NoError(t, app.db.saveMediaEntry(&mediaEntry{Name: "c-100.jpg", MimeType: "image/jpeg", Width: 100, Height: 50}))
+	require.NoError(t, app.db.saveMediaVariant("c-100.jpg", "c.jpg", 100))
+	require.NoError(t, app.db.saveMediaKeep("d.jpg"))
+	require.NoError(t, app.db.saveMediaVariant("e.m3u8", "e.mp4", 0))
+
+	// a.jpg is used in a post, b.jpg in a comment, e.mp4 only by its HLS playlist
+	require.NoError(t, app.createPost(&post{
+		Path:    "/test",
+		Content: "![Test](/m/a.jpg)",
+		Parameters: map[string][]string{
+			videoPlaylistParam: {"/m/e.m3u8"},
+		},
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+	}))
+	_, err := app.db.Exec("insert into comments (target, name, website, comment) values ('/test', 'Test', '', 'Look: /m/b.jpg')")
+	require.NoError(t, err)
+
+	getEntry := func(name string) *mediaEntry {
+		entries, err := app.db.getMediaEntries(name)
+		require.NoError(t, err)
+		require.Contains(t, entries, name)
+		return entries[name]
+	}
+	setState := func(name string, orphaned, quarantined time.Time) {
+		format := func(d time.Time) string {
+			if d.IsZero() {
+				return ""
+			}
+			return d.Format(time.RFC3339)
+		}
+		require.NoError(t, app.db.saveMediaOrphanState(name, format(orphaned), format(quarantined)))
+	}
+	notifications := func() (count int) {
+		row, err := app.db.QueryRow("select count(*) from notifications")
+		require.NoError(t, err)
+		require.NoError(t, row.Scan(&count))
+		return
+	}
+
+	// Unused files are found
+	require.NoError(t, app.collectMediaGarbage())
+	assert.NotEmpty(t, getEntry("c.jpg").Orphaned)
+	assert.Empty(t, getEntry("c.jpg").Quarantined)
+	entries, err := app.db.getMediaEntries("a.jpg", "b.jpg", "c-100.jpg", "d.jpg", "e.mp4", "e.m3u8")
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.Empty(t, e.Orphaned, e.Name)
+	}
+	entries, err = app.db.getMediaEntries("f.jpg")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(mediaDir, name))
+		return err == nil
+	}
+
+	// Quarantined with variants after the grace period with a notification
+	setState("c.jpg", time.Now().AddDate(0, 0, -31), time.Time{})
+	require.NoError(t, app.collectMediaGarbage())
+	assert.NotEmpty(t, getEntry("c.jpg").Quarantined)
+	assert.Equal(t, 1, notifications())
+	for _, name := range []string{"c.jpg", "c-100.jpg"} {
+		assert.False(t, exists(name), name)
+		assert.True(t, exists(mediaQuarantineName(name)), name)
+	}
+	// Quarantined files aren't added to the media library again
+	app.syncMediaLibrary()
+	entries, err = app.db.getMediaEntries(mediaQuarantineName("c.jpg"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Files used again are restored
+	_, err = app.db.Exec("insert into settings (name, value) values ('test', @value)", sql.Named("value", "/m/c.jpg"))
+	require.NoError(t, err)
+	require.NoError(t, app.collectMediaGarbage())
+	assert.Empty(t, getEntry("c.jpg").Orphaned)
+	assert.Empty(t, getEntry("c.jpg").Quarantined)
+	assert.Empty(t, getEntry("c-100.jpg").Quarantined)
+	for _, name := range []string{"c.jpg", "c-100.jpg"} {
+		assert.True(t, exists(name), name)
+		assert.False(t, exists(mediaQuarantineName(name)), name)
+	}
+	_, err = app.db.Exec("delete from settings where name = 'test'")
+	require.NoError(t, err)
+
+	// Deleted with variants after the deletion period
+	setState("c.jpg", time.Now().AddDate(0, 0, -31), time.Time{})
+	require.NoError(t, app.collectMediaGarbage())
+	setState("c.jpg", time.Now().AddDate(0, 0, -62), time.Now().AddDate(0, 0, -31))
+	require.NoError(t, app.collectMediaGarbage())
+	for _, name := range []string{"c.jpg", "c-100.jpg"} {
+		assert.False(t, exists(name), name)
+		assert.False(t, exists(mediaQuarantineName(name)), name)
+	}
+	entries, err = app.db.getMediaEntries("c.jpg", "c-100.jpg")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	for _, name := range []string{"a.jpg", "b.jpg", "d.jpg", "e.mp4", "e.m3u8", "f.jpg"} {
+		assert.True(t, exists(name), name)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Maximum number of bytes kept to detect the MIME type and image dimensions
+const mediaProbeHeadSize = 512 * 1024
+
+// mediaProbe collects the hash and the beginning of a media file while it gets saved
+type mediaProbe struct {
+	hash hash.Hash
+	head bytes.Buffer
+	size int64
+}
+
+func newMediaProbe() *mediaProbe {
+	return &mediaProbe{hash: sha256.New()}
+}
+
+func (p *mediaProbe) Write(b []byte) (int, error) {
+	_, _ = p.hash.Write(b)
+	p.size += int64(len(b))
+	if remaining := mediaProbeHeadSize - p.head.Len(); remaining > 0 {
+		if len(b) < remaining {
+			remaining = len(b)
+		}
+		_, _ = p.head.Write(b[:remaining])
+	}
+	return len(b), nil
+}
+
+func (p *mediaProbe) entry(name string) *mediaEntry {
+	e := &mediaEntry{
+		Name:     name,
+		Hash:     fmt.Sprintf("%x", p.hash.Sum(nil)),
+		MimeType: mediaMimeType(name),
+		Uploaded: time.Now().Local().Format(time.RFC3339),
+		Size:     p.size,
+	}
+	probeMediaHead(e, p.head.Bytes())
+	return e
+}
+
+// Detects the MIME type if unknown and the dimensions of images from the beginning of the file
+func probeMediaHead(e *mediaEntry, head []byte) {
+	if e.MimeType == "" {
+		e.MimeType = http.DetectContentType(head)
+	}
+	if strings.HasPrefix(e.MimeType, "image/") {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+			e.Width, e.Height = cfg.Width, cfg.Height
+		}
+	}
+}
+
+// Entries without MIME type or decodable images without dimensions
+func mediaEntryNeedsProbe(e *mediaEntry) bool {
+	switch e.MimeType {
+	case "":
+		return true
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return e.Width == 0 || e.Height == 0
+	default:
+		return false
+	}
+}
+
+func mediaMimeType(name string) string {
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(filepath.Ext(name)), ";")
+	return mimeType
+}
+
+func (a *goBlog) saveMediaEntry(name string, probe *mediaProbe) {
+	e := probe.entry(name)
+	e.Backend = a.mediaStorageBackend
+	if err := a.db.saveMediaEntry(e); err != nil {
+		log.Println("Failed to save media metadata:", err.Error())
+	}
+}
+
+func (a *goBlog) initMediaLibrary() {
+	a.hourlyHooks = append(a.hourlyHooks, a.syncMediaLibrary)
+	go a.syncMediaLibrary()
+}
+
+// Adds entries for files in the media storage that are not yet in the database
+// and fills in missing MIME types and image dimensions
+func (a *goBlog) syncMediaLibrary() {
+	if !a.mediaStorageEnabled() {
+		return
+	}
+	files, err := a.mediaFiles()
+	if err != nil {
+		log.Println("Failed to get media files:", err.Error())
+		return
+	}
+	entries, err := a.db.getMediaEntries()
+	if err != nil {
+		log.Println("Failed to get media metadata:", err.Error())
+		return
+	}
+	added := 0
+	for _, f := range files {
+		if strings.HasPrefix(f.Name, mediaQuarantinePrefix) {
+			// Quarantined files keep their entry
+			continue
+		}
+		if e, ok := entries[f.Name]; ok && e.Uploaded != "" {
+			if e.Size == 0 && f.Size > 0 {
+				// Entries from before sizes were saved
+				if err = a.db.saveMediaSize(f.Name, f.Size); err != nil {
+					log.Println("Failed to save media metadata:", err.Error())
+					return
+				}
+			}
+			continue
+		}
+		e := &mediaEntry{
+			// File names are generated from the SHA-256 hash of the content
+			Name:     f.Name,
+			Hash:     strings.TrimSuffix(f.Name, filepath.Ext(f.Name)),
+			MimeType: mediaMimeType(f.Name),
+			Uploaded: f.Time.Local().Format(time.RFC3339),
+			Size:     f.Size,
+			Backend:  a.mediaStorageBackend,
+		}
+		if err = a.db.saveMediaEntry(e); err != nil {
+			log.Println("Failed to save media metadata:", err.Error())
+			return
+		}
+		entries[f.Name] = e
+		added++
+	}
+	if added > 0 {
+		log.Println("Added", added, "media files to the media library")
+	}
+	// Only read the beginning of files without MIME type or image dimensions
+	probed := 0
+	for _, f := range files {
+		e, ok := entries[f.Name]
+		if !ok || e.Original != "" || !mediaEntryNeedsProbe(e) {
+			continue
+		}
+		head, err := a.mediaFileHead(f.Name, mediaProbeHeadSize)
+		if err != nil {
+			log.Println("Failed to read media file:", err.Error())
+			continue
+		}
+		probeMediaHead(e, head)
+		if err = a.db.saveMediaProbe(e.Name, e.MimeType, e.Width, e.Height); err != nil {
+			log.Println("Failed to save media metadata:", err.Error())
+			return
+		}
+		probed++
+	}
+	if probed > 0 {
+		log.Println("Detected the type of", probed, "media files")
+	}
+}
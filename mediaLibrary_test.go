@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mediaLibrary(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	_ = app.initConfig(false)
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+		app.mediaStorageBackend = mediaStorageLocal
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		img := &bytes.Buffer{}
+		require.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 30, 20))))
+
+		_, err := app.saveMediaFile("test.png", img)
+		require.NoError(t, err)
+
+		entries, err := app.db.getMediaEntries("test.png")
+		require.NoError(t, err)
+		if assert.Contains(t, entries, "test.png") {
+			e := entries["test.png"]
+			assert.Equal(t, "image/png", e.MimeType)
+			assert.Equal(t, 30, e.Width)
+			assert.Equal(t, 20, e.Height)
+			assert.Equal(t, mediaStorageLocal, e.Backend)
+			assert.Len(t, e.Hash, 64)
+			assert.NotEmpty(t, e.Uploaded)
+		}
+
+		// Alt text and filename are kept when saving again
+		require.NoError(t, app.db.saveMediaAlt("test.png", "Test alt"))
+		require.NoError(t, app.db.saveMediaFilename("test.png", "original.png"))
+		require.NoError(t, app.db.saveMediaEntry(&mediaEntry{Name: "test.png", MimeType: "image/png"}))
+
+		entries, err = app.db.getMediaEntries("test.png")
+		require.NoError(t, err)
+		if assert.Contains(t, entries, "test.png") {
+			assert.Equal(t, "Test alt", entries["test.png"].Alt)
+			assert.Equal(t, "original.png", entries["test.png"].Filename)
+		}
+	})
+
+	t.Run("Backfill", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "abc.mp3"), []byte("test"), 0644))
+		img := &bytes.Buffer{}
+		require.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 40, 10))))
+		require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "def.png"), img.Bytes(), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "ghi"), img.Bytes(), 0644))
+
+		app.syncMediaLibrary()
+
+		entries, err := app.db.getMediaEntries()
+		require.NoError(t, err)
+		if assert.Contains(t, entries, "abc.mp3") {
+			e := entries["abc.mp3"]
+			assert.Equal(t, "abc", e.Hash)
+			assert.Equal(t, "audio/mpeg", e.MimeType)
+			assert.Equal(t, mediaStorageLocal, e.Backend)
+			assert.NotEmpty(t, e.Uploaded)
+		}
+		assert.Contains(t, entries, "test.png")
+		// MIME type and dimensions are detected from the beginning of the file
+		if assert.Contains(t, entries, "def.png") {
+			assert.Equal(t, "image/png", entries["def.png"].MimeType)
+			assert.Equal(t, 40, entries["def.png"].Width)
+			assert.Equal(t, 10, entries["def.png"].Height)
+		}
+		if assert.Contains(t, entries, "ghi") {
+			assert.Equal(t, "image/png", entries["ghi"].MimeType)
+			assert.Equal(t, 40, entries["ghi"].Width)
+		}
+
+		// The editor lists the files from the media library
+		files, err := app.db.getMediaLibrary(0, 0)
+		require.NoError(t, err)
+		assert.Len(t, files, 4)
+	})
+}
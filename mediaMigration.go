@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Copies all files from one media storage backend to another and rewrites the URLs in posts,
+// fromURL optionally overrides the URL prefix of the files in the source storage
+func (a *goBlog) migrateMedia(from, to, fromURL string) error {
+	if from == "" || to == "" {
+		return errors.New("source and target storage required")
+	}
+	if from == to {
+		return errors.New("source and target storage are the same")
+	}
+	source, target := a.initMediaStorageBackend(from), a.initMediaStorageBackend(to)
+	if from == mediaStorageLocal {
+		// The configured media URL belongs to the new storage, local files are served by GoBlog
+		source = &localMediaStorage{path: mediaFilePath}
+	}
+	if source == nil {
+		return fmt.Errorf("media storage %s not configured", from)
+	}
+	if target == nil {
+		return fmt.Errorf("media storage %s not configured", to)
+	}
+	return a.migrateMediaStorage(source, target, to, fromURL)
+}
+
+// Files that already exist in the target storage are skipped, so it can be resumed after a failure
+func (a *goBlog) migrateMediaStorage(source, target mediaStorage, to, fromURL string) error {
+	files, err := source.files()
+	if err != nil {
+		return err
+	}
+	targetFiles, err := target.files()
+	if err != nil {
+		return err
+	}
+	existing := map[string]int64{}
+	for _, f := range targetFiles {
+		existing[f.Name] = f.Size
+	}
+	fromURL = strings.TrimSuffix(fromURL, "/")
+	if fromURL == "" && source.location("") == target.location("") {
+		// Both storages use the same configured media URL, the old one isn't known
+		return errors.New("source and target storage have the same media URL, pass the old URL prefix with --from-url")
+	}
+	copied, rewritten := 0, 0
+	for i, f := range files {
+		// Copy file (if it doesn't exist already)
+		if size, ok := existing[f.Name]; !ok || size != f.Size {
+			if err = copyMediaFile(source, target, f.Name); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", f.Name, err)
+			}
+			copied++
+		}
+		if err = a.db.saveMediaBackend(f.Name, to); err != nil {
+			return err
+		}
+		// Rewrite URLs
+		oldLocation := source.location(f.Name)
+		if fromURL != "" {
+			oldLocation = fromURL + "/" + f.Name
+		}
+		n, err := a.db.rewriteMediaURLs(f.Name, oldLocation, a.getFullAddress(oldLocation), a.getFullAddress(target.location(f.Name)))
+		if err != nil {
+			return fmt.Errorf("failed to rewrite URLs of %s: %w", f.Name, err)
+		}
+		rewritten += n
+		log.Printf("Migrated media file %d/%d: %s", i+1, len(files), f.Name)
+	}
+	a.db.rebuildFTSIndex()
+	log.Printf("Migrated %d media files (%d copied), rewrote %d posts, parameters, comments and settings", len(files), copied, rewritten)
+	return nil
+}
+
+func copyMediaFile(source, target mediaStorage, name string) error {
+	file, err := source.open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = target.save(name, file)
+	return err
+}
+
+// Replaces the old URLs of a media file with the new URL in the content and parameters of all posts,
+// in comments and in settings, returns the number of changed values
+func (db *database) rewriteMediaURLs(name, oldLocation, oldFullLocation, newLocation string) (int, error) {
+	if oldFullLocation == newLocation {
+		return 0, nil
+	}
+	// Relative URLs, but not as part of an absolute URL with another host
+	var relative *regexp.Regexp
+	if oldLocation != oldFullLocation {
+		relative = regexp.MustCompile(`(^|[^\w.:/-])` + regexp.QuoteMeta(oldLocation))
+	}
+	replace := func(s string) string {
+		s = strings.ReplaceAll(s, oldFullLocation, newLocation)
+		if relative != nil {
+			s = relative.ReplaceAllString(s, "${1}"+strings.ReplaceAll(newLocation, "$", "$$"))
+		}
+		return s
+	}
+	db.pcm.Lock()
+	defer db.pcm.Unlock()
+	changed := 0
+	for _, table := range []struct{ query, update string }{
+		{"select path, content from posts where instr(content, @name) > 0", "update posts set content = @value where path = @key"},
+		{"select id, value from post_parameters where instr(value, @name) > 0", "update post_parameters set value = @value where id = @key"},
+		{"select id, comment from comments where instr(comment, @name) > 0", "update comments set comment = @value where id = @key"},
+		{"select name, value from settings where instr(value, @name) > 0", "update settings set value = @value where name = @key"},
+	} {
+		rows, err := db.Query(table.query, sql.Named("name", name))
+		if err != nil {
+			return changed, err
+		}
+		updates := map[string]string{}
+		var key, value string
+		for rows.Next() {
+			if err = rows.Scan(&key, &value); err != nil {
+				_ = rows.Close()
+				return changed, err
+			}
+			if newValue := replace(value); newValue != value {
+				updates[key] = newValue
+			}
+		}
+		_ = rows.Close()
+		for key, value := range updates {
+			if _, err = db.Exec(table.update, sql.Named("value", value), sql.Named("key", key)); err != nil {
+				return changed, err
+			}
+			changed++
+		}
+	}
+	return changed, nil
+}
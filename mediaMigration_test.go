@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+func Test_migrateMedia(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	_ = app.initConfig(false)
+	_ = app.initCache()
+	app.initMarkdown()
+
+	// Source: local storage
+	sourceDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "abc.jpg"), []byte("abc"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "def.mp3"), []byte("def"), 0644))
+	source := &localMediaStorage{path: sourceDir}
+
+	// Target: WebDAV storage, count uploads
+	uploads := 0
+	davHandler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			uploads++
+		}
+		davHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	app.cfg.Micropub.MediaStorage = &configMicropubMedia{
+		MediaURL:  "https://media.example.com",
+		WebDAVURL: server.URL,
+	}
+	target := app.initWebdavMediaStorage()
+
+	require.NoError(t, app.createPost(&post{
+		Path:    "/test",
+		Content: "![Photo](http://localhost:8080/m/abc.jpg) [Audio](/m/def.mp3) ![Other](https://example.com/m/abc.jpg)",
+		Parameters: map[string][]string{
+			"images": {"http://localhost:8080/m/abc.jpg"},
+			"audio":  {"/m/def.mp3"},
+		},
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+	}))
+
+	_, err := app.db.Exec("insert into comments (target, name, website, comment) values ('/test', 'Alice', '', 'Look: http://localhost:8080/m/abc.jpg')")
+	require.NoError(t, err)
+	require.NoError(t, app.saveSettingValue("test", "/m/def.mp3"))
+
+	// The same media URL for both storages requires the old URL prefix
+	assert.Error(t, app.migrateMediaStorage(&localMediaStorage{path: sourceDir, mediaURL: "https://media.example.com"}, target, mediaStorageWebdav, ""))
+	assert.Equal(t, 0, uploads)
+
+	require.NoError(t, app.migrateMediaStorage(source, target, mediaStorageWebdav, ""))
+	assert.Equal(t, 2, uploads)
+
+	files, err := target.files()
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	p, err := app.getPost("/test")
+	require.NoError(t, err)
+	assert.Equal(t, "![Photo](https://media.example.com/abc.jpg) [Audio](https://media.example.com/def.mp3) ![Other](https://example.com/m/abc.jpg)", p.Content)
+	assert.Equal(t, "https://media.example.com/abc.jpg", p.firstParameter("images"))
+	assert.Equal(t, "https://media.example.com/def.mp3", p.firstParameter("audio"))
+
+	comments, err := app.db.getComments(&commentsRequestConfig{})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Look: https://media.example.com/abc.jpg", comments[0].Comment)
+	setting, err := app.getSettingValue("test")
+	require.NoError(t, err)
+	assert.Equal(t, "https://media.example.com/def.mp3", setting)
+
+	entries, err := app.db.getMediaEntries("abc.jpg")
+	require.NoError(t, err)
+	if assert.Contains(t, entries, "abc.jpg") {
+		assert.Equal(t, mediaStorageWebdav, entries["abc.jpg"].Backend)
+	}
+
+	// Running it again doesn't copy or change anything
+	require.NoError(t, app.migrateMediaStorage(source, target, mediaStorageWebdav, ""))
+	assert.Equal(t, 2, uploads)
+
+	p, err = app.getPost("/test")
+	require.NoError(t, err)
+	assert.Equal(t, "![Photo](https://media.example.com/abc.jpg) [Audio](https://media.example.com/def.mp3) ![Other](https://example.com/m/abc.jpg)", p.Content)
+
+	// Unconfigured storage
+	assert.Error(t, app.migrateMedia(mediaStorageFtp, mediaStorageWebdav, ""))
+	assert.Error(t, app.migrateMedia(mediaStorageWebdav, mediaStorageWebdav, ""))
+}
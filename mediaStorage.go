@@ -12,18 +12,45 @@ import (
 	"github.com/jlaffaye/ftp"
 )
 
+const (
+	mediaStorageBunny  = "bunny"
+	mediaStorageFtp    = "ftp"
+	mediaStorageLocal  = "local"
+	mediaStorageS3     = "s3"
+	mediaStorageSftp   = "sftp"
+	mediaStorageWebdav = "webdav"
+)
+
 func (a *goBlog) initMediaStorage() {
 	a.mediaStorageInit.Do(func() {
-		type initFunc func() mediaStorage
-		for _, fc := range []initFunc{a.initBunnyCdnMediaStorage, a.initFtpMediaStorage, a.initLocalMediaStorage} {
-			a.mediaStorage = fc()
+		for _, backend := range []string{mediaStorageBunny, mediaStorageFtp, mediaStorageSftp, mediaStorageWebdav, mediaStorageS3, mediaStorageLocal} {
+			a.mediaStorage = a.initMediaStorageBackend(backend)
 			if a.mediaStorage != nil {
+				a.mediaStorageBackend = backend
 				break
 			}
 		}
 	})
 }
 
+func (a *goBlog) initMediaStorageBackend(backend string) mediaStorage {
+	switch backend {
+	case mediaStorageBunny:
+		return a.initBunnyCdnMediaStorage()
+	case mediaStorageFtp:
+		return a.initFtpMediaStorage()
+	case mediaStorageSftp:
+		return a.initSftpMediaStorage()
+	case mediaStorageWebdav:
+		return a.initWebdavMediaStorage()
+	case mediaStorageS3:
+		return a.initS3MediaStorage()
+	case mediaStorageLocal:
+		return a.initLocalMediaStorage()
+	}
+	return nil
+}
+
 func (a *goBlog) mediaStorageEnabled() bool {
 	a.initMediaStorage()
 	return a.mediaStorage != nil
@@ -38,10 +65,12 @@ func (a *goBlog) saveMediaFile(filename string, f io.Reader) (string, error) {
 	if a.mediaStorage == nil {
 		return "", errNoMediaStorageConfigured
 	}
-	loc, err := a.mediaStorage.save(filename, f)
+	probe := newMediaProbe()
+	loc, err := a.mediaStorage.save(filename, io.TeeReader(f, probe))
 	if err != nil {
 		return "", err
 	}
+	a.saveMediaEntry(filename, probe)
 	return a.getFullAddress(loc), nil
 }
 
@@ -50,7 +79,50 @@ func (a *goBlog) deleteMediaFile(filename string) error {
 	if a.mediaStorage == nil {
 		return errNoMediaStorageConfigured
 	}
-	return a.mediaStorage.delete(filepath.Base(filename))
+	name := filepath.Base(filename)
+	storedName := name
+	if entries, err := a.db.getMediaEntries(name); err == nil && entries[name] != nil && entries[name].Quarantined != "" {
+		storedName = mediaQuarantineName(name)
+	}
+	if err := a.mediaStorage.delete(storedName); err != nil {
+		return err
+	}
+	if err := a.db.deleteMediaEntry(name); err != nil {
+		return err
+	}
+	a.purgeImageVariantsCache()
+	// Delete responsive variants and HLS files as well
+	variants, err := a.db.getMediaVariantNames(name)
+	if err != nil {
+		return err
+	}
+	for _, v := range variants {
+		if v == name {
+			continue
+		}
+		if err = a.deleteMediaFile(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Moves a file in the media storage by copying it to the new name
+func (a *goBlog) moveMediaFile(from, to string) error {
+	a.initMediaStorage()
+	if a.mediaStorage == nil {
+		return errNoMediaStorageConfigured
+	}
+	file, err := a.mediaStorage.open(from)
+	if err != nil {
+		return err
+	}
+	_, err = a.mediaStorage.save(to, file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+	return a.mediaStorage.delete(from)
 }
 
 type mediaFile struct {
@@ -76,13 +148,39 @@ func (a *goBlog) mediaFileLocation(name string) string {
 	return a.mediaStorage.location(name)
 }
 
+// Reads the first bytes of a media file, with a ranged request when the storage supports it
+func (a *goBlog) mediaFileHead(name string, size int64) ([]byte, error) {
+	a.initMediaStorage()
+	if a.mediaStorage == nil {
+		return nil, errNoMediaStorageConfigured
+	}
+	var file io.ReadCloser
+	var err error
+	if rs, ok := a.mediaStorage.(mediaRangeStorage); ok {
+		file, err = rs.openHead(name, size)
+	} else {
+		file, err = a.mediaStorage.open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, size))
+}
+
 type mediaStorage interface {
 	save(filename string, file io.Reader) (location string, err error)
+	open(filename string) (file io.ReadCloser, err error)
 	delete(filename string) (err error)
 	files() (files []*mediaFile, err error)
 	location(filename string) (location string)
 }
 
+// Implemented by media storages that can read only the beginning of a file
+type mediaRangeStorage interface {
+	openHead(filename string, size int64) (file io.ReadCloser, err error)
+}
+
 type localMediaStorage struct {
 	mediaURL string // optional
 	path     string // required
@@ -105,6 +203,10 @@ func (l *localMediaStorage) save(filename string, file io.Reader) (location stri
 	return l.location(filename), nil
 }
 
+func (l *localMediaStorage) open(filename string) (file io.ReadCloser, err error) {
+	return os.Open(filepath.Join(l.path, filename))
+}
+
 func (l *localMediaStorage) delete(filename string) (err error) {
 	if err = os.MkdirAll(l.path, 0777); err != nil {
 		return err
@@ -195,6 +297,31 @@ func (f *ftpMediaStorage) save(filename string, file io.Reader) (location string
 	return f.location(filename), nil
 }
 
+func (f *ftpMediaStorage) open(filename string) (file io.ReadCloser, err error) {
+	c, err := f.connection()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Retr(filename)
+	if err != nil {
+		_ = c.Quit()
+		return nil, err
+	}
+	return &ftpFileReader{Response: resp, conn: c}, nil
+}
+
+// Closes the FTP connection after reading the file
+type ftpFileReader struct {
+	*ftp.Response
+	conn *ftp.ServerConn
+}
+
+func (r *ftpFileReader) Close() error {
+	err := r.Response.Close()
+	_ = r.conn.Quit()
+	return err
+}
+
 func (f *ftpMediaStorage) delete(filename string) (err error) {
 	c, err := f.connection()
 	if err != nil {
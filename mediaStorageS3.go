@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bufferpool"
+)
+
+const (
+	// Files bigger than this are uploaded using multipart uploads
+	s3DefaultPartSize = 16 * 1024 * 1024
+	// Validity of signed URLs
+	s3SignedURLExpiry = time.Hour
+)
+
+type s3MediaStorage struct {
+	client     *minio.Client // required
+	bucket     string        // required
+	baseURL    string        // required, public URL prefix of the files
+	signedURLs bool          // optional, serve files via GoBlog and redirect to signed URLs
+	partSize   uint64        // required
+}
+
+func (a *goBlog) initS3MediaStorage() mediaStorage {
+	config := a.cfg.Micropub.MediaStorage
+	if config == nil || config.S3Endpoint == "" || config.S3Bucket == "" || config.S3AccessKey == "" || config.S3SecretKey == "" {
+		return nil
+	}
+	ms, err := newS3MediaStorage(config)
+	if err != nil {
+		log.Println("Failed to initialize S3 media storage:", err.Error())
+		return nil
+	}
+	return ms
+}
+
+func newS3MediaStorage(config *configMicropubMedia) (*s3MediaStorage, error) {
+	endpoint, err := url.Parse(config.S3Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Host == "" {
+		return nil, errors.New("invalid S3 endpoint")
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.S3AccessKey, config.S3SecretKey, ""),
+		Secure:       endpoint.Scheme != "http",
+		Region:       config.S3Region,
+		BucketLookup: lo.If(config.S3PathStyle, minio.BucketLookupPath).Else(minio.BucketLookupDNS),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ms := &s3MediaStorage{
+		client:     client,
+		bucket:     config.S3Bucket,
+		signedURLs: config.S3SignedURLs,
+		partSize:   s3DefaultPartSize,
+	}
+	switch {
+	case config.MediaURL != "":
+		ms.baseURL = config.MediaURL
+	case config.S3PathStyle:
+		ms.baseURL = fmt.Sprintf("%s://%s/%s", endpoint.Scheme, endpoint.Host, config.S3Bucket)
+	default:
+		ms.baseURL = fmt.Sprintf("%s://%s.%s", endpoint.Scheme, config.S3Bucket, endpoint.Host)
+	}
+	return ms, nil
+}
+
+func (s *s3MediaStorage) save(filename string, file io.Reader) (location string, err error) {
+	opts := minio.PutObjectOptions{
+		ContentType: mediaMimeType(filename),
+		PartSize:    s.partSize,
+	}
+	if !s.signedURLs {
+		opts.CacheControl = "public,max-age=31536000,immutable"
+	}
+	// Read the first part to decide whether a multipart upload is needed
+	head := &bytes.Buffer{}
+	n, err := io.CopyN(head, file, int64(s.partSize))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	size := int64(-1) // Unknown size, multipart upload
+	reader := io.MultiReader(head, file)
+	if n < int64(s.partSize) {
+		size = n
+		reader = head
+	}
+	if _, err = s.client.PutObject(context.Background(), s.bucket, filename, reader, size, opts); err != nil {
+		return "", err
+	}
+	return s.location(filename), nil
+}
+
+func (s *s3MediaStorage) open(filename string) (file io.ReadCloser, err error) {
+	return s.client.GetObject(context.Background(), s.bucket, filename, minio.GetObjectOptions{})
+}
+
+func (s *s3MediaStorage) openHead(filename string, size int64) (file io.ReadCloser, err error) {
+	opts := minio.GetObjectOptions{}
+	if err = opts.SetRange(0, size-1); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(context.Background(), s.bucket, filename, opts)
+}
+
+func (s *s3MediaStorage) delete(filename string) (err error) {
+	return s.client.RemoveObject(context.Background(), s.bucket, filename, minio.RemoveObjectOptions{})
+}
+
+func (s *s3MediaStorage) files() (files []*mediaFile, err error) {
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			// Skip directories
+			continue
+		}
+		files = append(files, &mediaFile{
+			Name:     object.Key,
+			Location: s.location(object.Key),
+			Time:     object.LastModified,
+			Size:     object.Size,
+		})
+	}
+	return files, nil
+}
+
+func (s *s3MediaStorage) location(name string) string {
+	if s.signedURLs {
+		// Served by GoBlog, which redirects to a signed URL
+		return fmt.Sprintf("/m/%s", name)
+	}
+	return fmt.Sprintf("%s/%s", s.baseURL, name)
+}
+
+func (s *s3MediaStorage) signedURL(name string) (string, error) {
+	u, err := s.client.PresignedGetObject(context.Background(), s.bucket, name, s3SignedURLExpiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Redirects to a signed URL of a file from a private S3 bucket,
+// files that are only used in private posts (or not at all) require login
+func (a *goBlog) serveS3SignedMediaFile(w http.ResponseWriter, r *http.Request, s *s3MediaStorage) {
+	name := chi.URLParam(r, "file")
+	if !a.isLoggedIn(r) && !a.mediaFileUsedPublicly(name) {
+		a.serve404(w, r)
+		return
+	}
+	if strings.HasSuffix(name, ".m3u8") {
+		a.serveS3SignedHlsPlaylist(w, r, s, name)
+		return
+	}
+	signed, err := s.signedURL(name)
+	if err != nil {
+		log.Println("Failed to sign media URL:", err.Error())
+		a.serveError(w, r, "", http.StatusInternalServerError)
+		return
+	}
+	// Signed URLs expire, so only cache for a short time
+	w.Header().Set(cacheControl, "private,max-age=600")
+	http.Redirect(w, r, signed, http.StatusFound)
+}
+
+// HLS playlists are served directly, because relative URLs would resolve against the signed URL,
+// segments are rewritten to signed URLs and other playlists stay relative to be served the same way
+func (a *goBlog) serveS3SignedHlsPlaylist(w http.ResponseWriter, r *http.Request, s *s3MediaStorage, name string) {
+	file, err := s.open(name)
+	if err != nil {
+		log.Println("Failed to open HLS playlist:", err.Error())
+		a.serveError(w, r, "", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	playlist := bufferpool.Get()
+	defer bufferpool.Put(playlist)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if uri := strings.TrimSpace(line); uri != "" && !strings.HasPrefix(uri, "#") && !strings.HasSuffix(uri, ".m3u8") && !strings.Contains(uri, "/") {
+			if line, err = s.signedURL(uri); err != nil {
+				log.Println("Failed to sign media URL:", err.Error())
+				a.serveError(w, r, "", http.StatusInternalServerError)
+				return
+			}
+		}
+		_, _ = playlist.WriteString(line + "\n")
+	}
+	if err = scanner.Err(); err != nil {
+		log.Println("Failed to read HLS playlist:", err.Error())
+		a.serveError(w, r, "", http.StatusInternalServerError)
+		return
+	}
+	// Signed URLs expire, so only cache for a short time
+	w.Header().Set(cacheControl, "private,max-age=600")
+	w.Header().Set(contentType, "application/vnd.apple.mpegurl")
+	_, _ = io.Copy(w, playlist)
+}
+
+// Checks if a media file (or the original of a responsive image variant) is used in a published, non-private post
+func (a *goBlog) mediaFileUsedPublicly(name string) bool {
+	if entries, err := a.db.getMediaEntries(name); err == nil {
+		if e, ok := entries[name]; ok && e.Original != "" {
+			name = e.Original
+		}
+	}
+	uses, err := a.db.postsUsingMediaFile(name)
+	if err != nil || len(uses) == 0 {
+		return false
+	}
+	for _, path := range uses[0] {
+		p, err := a.getPost(path)
+		if err != nil {
+			continue
+		}
+		if p.Status == statusPublished && p.Visibility != visibilityPrivate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Minimal S3 server supporting the requests the S3 media storage uses
+type fakeS3 struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	parts      map[string]map[string][]byte
+	multiparts int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		type content struct {
+			Key          string
+			LastModified string
+			Size         int
+			ETag         string
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			KeyCount    int
+			IsTruncated bool
+			Contents    []content
+		}{Name: "bucket", KeyCount: len(f.objects)}
+		for k, v := range f.objects {
+			result.Contents = append(result.Contents, content{k, time.Now().UTC().Format(time.RFC3339), len(v), `"etag"`})
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.multiparts++
+		f.parts[key] = map[string][]byte{}
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>", key)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		body, _ := io.ReadAll(r.Body)
+		f.parts[key][query.Get("partNumber")] = body
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var data []byte
+		for i := 1; i <= len(f.parts[key]); i++ {
+			data = append(data, f.parts[key][fmt.Sprint(i)]...)
+		}
+		f.objects[key] = data
+		_, _ = fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><ETag>\"etag\"</ETag></CompleteMultipartUploadResult>", key)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, key, time.Now(), bytes.NewReader(body))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func Test_s3MediaStorage(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, parts: map[string]map[string][]byte{}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:        credentials.NewStaticV4("access", "secret", ""),
+		Secure:       true,
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    server.Client().Transport,
+	})
+	require.NoError(t, err)
+
+	ms := &s3MediaStorage{
+		client:   client,
+		bucket:   "bucket",
+		baseURL:  "https://media.example.com",
+		partSize: 5 * 1024 * 1024,
+	}
+
+	// Small file
+	loc, err := ms.save("abc.txt", strings.NewReader("Test"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://media.example.com/abc.txt", loc)
+	assert.Equal(t, []byte("Test"), fake.objects["abc.txt"])
+	assert.Equal(t, 0, fake.multiparts)
+
+	// Large file uses a multipart upload
+	large := bytes.Repeat([]byte("a"), 6*1024*1024)
+	_, err = ms.save("def.mp4", bytes.NewReader(large))
+	require.NoError(t, err)
+	assert.Equal(t, 1, fake.multiparts)
+	assert.Equal(t, large, fake.objects["def.mp4"])
+
+	files, err := ms.files()
+	require.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, "abc.txt", files[0].Name)
+		assert.Equal(t, "https://media.example.com/abc.txt", files[0].Location)
+		assert.Equal(t, int64(4), files[0].Size)
+	}
+
+	require.NoError(t, ms.delete("def.mp4"))
+	assert.NotContains(t, fake.objects, "def.mp4")
+
+	// Signed URLs
+	ms.signedURLs = true
+	assert.Equal(t, "/m/abc.txt", ms.location("abc.txt"))
+	signed, err := ms.signedURL("abc.txt")
+	require.NoError(t, err)
+	assert.Contains(t, signed, server.URL+"/bucket/abc.txt?")
+	assert.Contains(t, signed, "X-Amz-Signature=")
+}
+
+func Test_s3MediaStorageConfig(t *testing.T) {
+	config := &configMicropubMedia{
+		S3Endpoint:  "http://localhost:9000",
+		S3Bucket:    "media",
+		S3AccessKey: "access",
+		S3SecretKey: "secret",
+		S3PathStyle: true,
+	}
+	ms, err := newS3MediaStorage(config)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000/media/abc.jpg", ms.location("abc.jpg"))
+
+	config.S3Endpoint = "https://s3.example.com"
+	config.S3PathStyle = false
+	ms, err = newS3MediaStorage(config)
+	require.NoError(t, err)
+	assert.Equal(t, "https://media.s3.example.com/abc.jpg", ms.location("abc.jpg"))
+
+	config.MediaURL = "https://cdn.example.com"
+	ms, err = newS3MediaStorage(config)
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/abc.jpg", ms.location("abc.jpg"))
+
+	config.S3Endpoint = "invalid"
+	_, err = newS3MediaStorage(config)
+	assert.Error(t, err)
+}
+
+func Test_s3SignedMediaFile(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	_ = app.initConfig(false)
+	_ = app.initCache()
+	app.initMarkdown()
+	app.initSessions()
+
+	fake := &fakeS3{objects: map[string][]byte{}, parts: map[string]map[string][]byte{}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:        credentials.NewStaticV4("access", "secret", ""),
+		Secure:       true,
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    server.Client().Transport,
+	})
+	require.NoError(t, err)
+
+	ms := &s3MediaStorage{
+		client:     client,
+		bucket:     "bucket",
+		partSize:   5 * 1024 * 1024,
+		signedURLs: true,
+	}
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = ms
+		app.mediaStorageBackend = mediaStorageS3
+	})
+
+	router := chi.NewRouter()
+	router.Route("/m", app.mediaFilesRouter)
+
+	getFile := func(name string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/m/"+name, nil))
+		return rec
+	}
+	get := func() *httptest.ResponseRecorder {
+		return getFile("abc.jpg")
+	}
+
+	// Unused files require login
+	assert.Equal(t, http.StatusNotFound, get().Code)
+
+	// Files only used in private posts require login
+	require.NoError(t, app.createPost(&post{
+		Path:       "/private",
+		Content:    "![Test](/m/abc.jpg)",
+		Status:     statusPublished,
+		Visibility: visibilityPrivate,
+	}))
+	assert.Equal(t, http.StatusNotFound, get().Code)
+
+	// Files used in public posts redirect to a signed URL
+	require.NoError(t, app.createPost(&post{
+		Path:       "/public",
+		Content:    "![Test](/m/abc.jpg)",
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+	}))
+	rec := get()
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Location"), server.URL+"/bucket/abc.jpg?"))
+	assert.Contains(t, rec.Header().Get("Location"), "X-Amz-Signature=")
+
+	// HLS playlists are served directly with signed segment URLs
+	fake.objects["def.m3u8"] = []byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\ndef-720.m3u8\n")
+	fake.objects["def-720.m3u8"] = []byte("#EXTM3U\n#EXTINF:4.0,\ndef-720-000.ts\n#EXT-X-ENDLIST\n")
+	for _, name := range []string{"def.m3u8", "def-720.m3u8", "def-720-000.ts"} {
+		require.NoError(t, app.db.saveMediaVariant(name, "def.mp4", 0))
+	}
+	require.NoError(t, app.createPost(&post{
+		Path:       "/video",
+		Content:    "![Video](/m/def.mp4)",
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+	}))
+	rec = getFile("def.m3u8")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/vnd.apple.mpegurl", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\ndef-720.m3u8\n", rec.Body.String())
+	rec = getFile("def-720.m3u8")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "#EXTINF:4.0,\n"+server.URL+"/bucket/def-720-000.ts?")
+	assert.Contains(t, rec.Body.String(), "X-Amz-Signature=")
+	assert.Equal(t, http.StatusFound, getFile("def-720-000.ts").Code)
+}
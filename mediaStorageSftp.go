@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/samber/lo"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Maximum number of open SFTP connections, operations wait for a free connection
+const sftpMaxConnections = 4
+
+type sftpMediaStorage struct {
+	dial     func() (*sftp.Client, io.Closer, error) // required
+	path     string                                  // optional
+	mediaURL string                                  // required
+	// Connection pool
+	slots  chan struct{} // one for every connection in use
+	mu     sync.Mutex
+	idle   []*sftpConnection
+	closed bool
+}
+
+type sftpConnection struct {
+	client *sftp.Client
+	conn   io.Closer
+}
+
+func newSftpMediaStorage(dial func() (*sftp.Client, io.Closer, error), path, mediaURL string) *sftpMediaStorage {
+	return &sftpMediaStorage{
+		dial:     dial,
+		path:     path,
+		mediaURL: mediaURL,
+		slots:    make(chan struct{}, sftpMaxConnections),
+	}
+}
+
+func (a *goBlog) initSftpMediaStorage() mediaStorage {
+	config := a.cfg.Micropub.MediaStorage
+	if config == nil || config.SFTPAddress == "" || config.SFTPUser == "" || config.MediaURL == "" ||
+		(config.SFTPPassword == "" && config.SFTPPrivateKey == "") {
+		return nil
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:    config.SFTPUser,
+		Timeout: 5 * time.Second,
+	}
+	if config.SFTPPrivateKey != "" {
+		key, err := os.ReadFile(config.SFTPPrivateKey)
+		if err != nil {
+			log.Println("Failed to read SFTP private key:", err.Error())
+			return nil
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			log.Println("Failed to parse SFTP private key:", err.Error())
+			return nil
+		}
+		sshConfig.Auth = append(sshConfig.Auth, ssh.PublicKeys(signer))
+	}
+	if config.SFTPPassword != "" {
+		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(config.SFTPPassword))
+	}
+	// Always verify the host key, with the configured key or the user's known_hosts file
+	if config.SFTPHostKey != "" {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.SFTPHostKey))
+		if err != nil {
+			log.Println("Failed to parse SFTP host key:", err.Error())
+			return nil
+		}
+		sshConfig.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Println("No SFTP host key configured and no home directory for known_hosts:", err.Error())
+			return nil
+		}
+		callback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+		if err != nil {
+			log.Println("No SFTP host key configured and failed to read known_hosts:", err.Error())
+			return nil
+		}
+		sshConfig.HostKeyCallback = callback
+	}
+	ms := newSftpMediaStorage(func() (*sftp.Client, io.Closer, error) {
+		conn, err := ssh.Dial("tcp", config.SFTPAddress, sshConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+		return client, conn, nil
+	}, config.SFTPPath, config.MediaURL)
+	a.shutdown.Add(ms.close)
+	return ms
+}
+
+// Takes an idle connection from the pool or opens a new one, waits if all connections are in use
+func (s *sftpMediaStorage) get() (*sftpConnection, error) {
+	s.slots <- struct{}{}
+	s.mu.Lock()
+	var c *sftpConnection
+	if n := len(s.idle); n > 0 {
+		c, s.idle = s.idle[n-1], s.idle[:n-1]
+	}
+	s.mu.Unlock()
+	if c != nil {
+		// Check if the idle connection is still alive
+		if _, err := c.client.Getwd(); err == nil || !isSftpConnectionError(err) {
+			return c, nil
+		}
+		c.close()
+	}
+	client, conn, err := s.dial()
+	if err != nil {
+		<-s.slots
+		return nil, err
+	}
+	return &sftpConnection{client: client, conn: conn}, nil
+}
+
+// Returns the connection to the pool, closes it if the connection got lost
+func (s *sftpMediaStorage) put(c *sftpConnection, err error) {
+	defer func() { <-s.slots }()
+	if err != nil && isSftpConnectionError(err) {
+		c.close()
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// Runs f with a connection from the pool
+func (s *sftpMediaStorage) withClient(f func(c *sftp.Client) error) error {
+	c, err := s.get()
+	if err != nil {
+		return err
+	}
+	err = f(c.client)
+	s.put(c, err)
+	return err
+}
+
+func isSftpConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+func (c *sftpConnection) close() {
+	// Close the underlying connection first, closing the SFTP client could block otherwise
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	_ = c.client.Close()
+}
+
+func (s *sftpMediaStorage) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, c := range s.idle {
+		c.close()
+	}
+	s.idle = nil
+}
+
+func (s *sftpMediaStorage) filePath(filename string) string {
+	if s.path == "" {
+		return filename
+	}
+	return path.Join(s.path, filename)
+}
+
+func (s *sftpMediaStorage) save(filename string, file io.Reader) (location string, err error) {
+	err = s.withClient(func(c *sftp.Client) error {
+		if s.path != "" {
+			if err := c.MkdirAll(s.path); err != nil {
+				return err
+			}
+		}
+		f, err := c.Create(s.filePath(filename))
+		if err != nil {
+			return err
+		}
+		if _, err = f.ReadFrom(file); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.location(filename), nil
+}
+
+func (s *sftpMediaStorage) open(filename string) (file io.ReadCloser, err error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.client.Open(s.filePath(filename))
+	if err != nil {
+		s.put(c, err)
+		return nil, err
+	}
+	// The file keeps the connection until it's closed
+	return &sftpPooledFile{file: f, storage: s, conn: c}, nil
+}
+
+type sftpPooledFile struct {
+	file    *sftp.File
+	storage *sftpMediaStorage
+	conn    *sftpConnection
+	err     error // First read error, to check the connection
+	once    sync.Once
+}
+
+func (f *sftpPooledFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+func (f *sftpPooledFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := f.file.WriteTo(w)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+func (f *sftpPooledFile) Close() error {
+	err := f.file.Close()
+	f.once.Do(func() {
+		if f.err == nil {
+			f.err = err
+		}
+		f.storage.put(f.conn, f.err)
+	})
+	return err
+}
+
+func (s *sftpMediaStorage) delete(filename string) (err error) {
+	return s.withClient(func(c *sftp.Client) error {
+		return c.Remove(s.filePath(filename))
+	})
+}
+
+func (s *sftpMediaStorage) files() (files []*mediaFile, err error) {
+	err = s.withClient(func(c *sftp.Client) error {
+		files = nil
+		entries, err := c.ReadDir(lo.If(s.path != "", s.path).Else("."))
+		if err != nil {
+			return err
+		}
+		for _, fi := range entries {
+			if fi.Mode().IsRegular() {
+				files = append(files, &mediaFile{
+					Name:     fi.Name(),
+					Location: s.location(fi.Name()),
+					Time:     fi.ModTime(),
+					Size:     fi.Size(),
+				})
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (s *sftpMediaStorage) location(name string) string {
+	return fmt.Sprintf("%s/%s", s.mediaURL, name)
+}
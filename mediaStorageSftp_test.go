@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func Test_sftpMediaStorage(t *testing.T) {
+	handlers := sftp.InMemHandler()
+	dials := 0
+	var servers []*sftp.RequestServer
+
+	ms := newSftpMediaStorage(
+		func() (*sftp.Client, io.Closer, error) {
+			dials++
+			// In-memory SFTP server connected via pipes
+			serverReader, clientWriter := io.Pipe()
+			clientReader, serverWriter := io.Pipe()
+			server := sftp.NewRequestServer(pipeConn{serverReader, serverWriter}, handlers)
+			servers = append(servers, server)
+			go func() {
+				_ = server.Serve()
+			}()
+			client, err := sftp.NewClientPipe(clientReader, clientWriter)
+			return client, server, err
+		},
+		"/media",
+		"https://media.example.com",
+	)
+	defer ms.close()
+
+	loc, err := ms.save("abc.txt", strings.NewReader("Test"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://media.example.com/abc.txt", loc)
+
+	_, err = ms.save("def.txt", strings.NewReader("Test 2"))
+	require.NoError(t, err)
+
+	files, err := ms.files()
+	require.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		names := []string{files[0].Name, files[1].Name}
+		assert.ElementsMatch(t, []string{"abc.txt", "def.txt"}, names)
+	}
+
+	// The connection is reused
+	assert.Equal(t, 1, dials)
+
+	// Reconnect after the connection got lost
+	_ = servers[0].Close()
+	require.NoError(t, ms.delete("def.txt"))
+	assert.Equal(t, 2, dials)
+
+	files, err = ms.files()
+	require.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "abc.txt", files[0].Name)
+		assert.Equal(t, int64(4), files[0].Size)
+	}
+
+	// An open file keeps its connection, other operations use another one
+	f, err := ms.open("abc.txt")
+	require.NoError(t, err)
+	_, err = ms.files()
+	require.NoError(t, err)
+	assert.Equal(t, 3, dials)
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "Test", string(content))
+	require.NoError(t, f.Close())
+	assert.Len(t, ms.idle, 2)
+
+	// The pool is limited
+	var conns []*sftpConnection
+	for i := 0; i < sftpMaxConnections; i++ {
+		c, err := ms.get()
+		require.NoError(t, err)
+		conns = append(conns, c)
+	}
+	select {
+	case ms.slots <- struct{}{}:
+		t.Error("more connections than allowed")
+	default:
+	}
+	for _, c := range conns {
+		ms.put(c, nil)
+	}
+	assert.Len(t, ms.idle, sftpMaxConnections)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+type webdavMediaStorage struct {
+	client   *gowebdav.Client // required, reuses connections (HTTP keep-alive)
+	mediaURL string           // required
+}
+
+func (a *goBlog) initWebdavMediaStorage() mediaStorage {
+	config := a.cfg.Micropub.MediaStorage
+	if config == nil || config.WebDAVURL == "" || config.MediaURL == "" {
+		return nil
+	}
+	client := gowebdav.NewClient(config.WebDAVURL, config.WebDAVUser, config.WebDAVPassword)
+	client.SetTimeout(5 * time.Minute)
+	return &webdavMediaStorage{
+		client:   client,
+		mediaURL: config.MediaURL,
+	}
+}
+
+func (w *webdavMediaStorage) save(filename string, file io.Reader) (location string, err error) {
+	if err = w.client.WriteStream(filename, file, 0644); err != nil {
+		return "", err
+	}
+	return w.location(filename), nil
+}
+
+func (w *webdavMediaStorage) open(filename string) (file io.ReadCloser, err error) {
+	return w.client.ReadStream(filename)
+}
+
+func (w *webdavMediaStorage) openHead(filename string, size int64) (file io.ReadCloser, err error) {
+	return w.client.ReadStreamRange(filename, 0, size)
+}
+
+func (w *webdavMediaStorage) delete(filename string) (err error) {
+	return w.client.Remove(filename)
+}
+
+func (w *webdavMediaStorage) files() (files []*mediaFile, err error) {
+	entries, err := w.client.ReadDir("/")
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range entries {
+		if !fi.IsDir() {
+			files = append(files, &mediaFile{
+				Name:     fi.Name(),
+				Location: w.location(fi.Name()),
+				Time:     fi.ModTime(),
+				Size:     fi.Size(),
+			})
+		}
+	}
+	return files, nil
+}
+
+func (w *webdavMediaStorage) location(name string) string {
+	return fmt.Sprintf("%s/%s", w.mediaURL, name)
+}
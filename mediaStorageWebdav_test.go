@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+func Test_webdavMediaStorage(t *testing.T) {
+	server := httptest.NewServer(&webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	})
+	defer server.Close()
+
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Micropub.MediaStorage = &configMicropubMedia{
+		MediaURL:  "https://media.example.com",
+		WebDAVURL: server.URL,
+	}
+	ms := app.initWebdavMediaStorage()
+	require.NotNil(t, ms)
+
+	loc, err := ms.save("abc.txt", strings.NewReader("Test"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://media.example.com/abc.txt", loc)
+
+	_, err = ms.save("def.txt", strings.NewReader("Test 2"))
+	require.NoError(t, err)
+
+	files, err := ms.files()
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	require.NoError(t, ms.delete("def.txt"))
+
+	files, err = ms.files()
+	require.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "abc.txt", files[0].Name)
+		assert.Equal(t, "https://media.example.com/abc.txt", files[0].Location)
+		assert.Equal(t, int64(4), files[0].Size)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/carlmjohnson/requests"
+	"github.com/dgraph-io/ristretto"
+	"github.com/disintegration/imaging"
+	"go.goblog.app/app/pkgs/bufferpool"
+)
+
+var defaultImageVariantWidths = []int{480, 960, 1440}
+
+const (
+	// Used for the sizes attribute, the content is at most 700px wide
+	imageVariantSizes      = "(max-width: 700px) 100vw, 700px"
+	imageVariantsQueueName = "imagevariants"
+)
+
+// Formats Cloudflare converts images to, in the order browsers should prefer them
+var cloudflareImageVariantFormats = []string{"avif", "webp"}
+
+func (a *goBlog) imageVariantsEnabled() bool {
+	if a.cfg.Micropub == nil {
+		return false
+	}
+	ms := a.cfg.Micropub.MediaStorage
+	return ms != nil && ms.ImageVariantsEnabled
+}
+
+func (a *goBlog) imageVariantWidths() []int {
+	if ms := a.cfg.Micropub.MediaStorage; ms != nil && len(ms.ImageVariantWidths) > 0 {
+		return ms.ImageVariantWidths
+	}
+	return defaultImageVariantWidths
+}
+
+// Creates smaller variants of an uploaded JPEG or PNG image,
+// original is the name of the stored file the variants belong to
+func (a *goBlog) createImageVariants(original string, file io.Reader) error {
+	fileExtension, allowed := urlHasExt(original, "jpg", "jpeg", "png")
+	if !allowed {
+		return nil
+	}
+	// Keep the original to compare its size with the WebP variant
+	src := bufferpool.Get()
+	defer bufferpool.Put(src)
+	if _, err := io.Copy(src, file); err != nil {
+		return err
+	}
+	originalSize := src.Len()
+	img, err := imaging.Decode(src, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(original, filepath.Ext(original))
+	originalWidth := img.Bounds().Dx()
+	// AVIF needs Cloudflare (there's no pure Go AVIF encoder), which also creates smaller lossy WebP variants
+	cloudflare := a.cfg.Micropub.MediaStorage.CloudflareCompressionEnabled && !a.isPrivate()
+	// Lossless WebP is usually only smaller than PNG, not than JPEG
+	localWebp := !cloudflare && fileExtension == "png"
+	widths := []int{}
+	for _, width := range a.imageVariantWidths() {
+		if width <= 0 || width >= originalWidth {
+			continue
+		}
+		widths = append(widths, width)
+		// Resize and encode in the original format
+		resized := imaging.Resize(img, width, 0, imaging.Lanczos)
+		buf := bufferpool.Get()
+		switch fileExtension {
+		case "png":
+			err = imaging.Encode(buf, resized, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+		default:
+			err = imaging.Encode(buf, resized, imaging.JPEG, imaging.JPEGQuality(75))
+		}
+		size := buf.Len()
+		if err == nil {
+			err = a.saveImageVariant(fmt.Sprintf("%s-%d.%s", base, width, fileExtension), original, buf, width)
+		}
+		bufferpool.Put(buf)
+		if err == nil && localWebp {
+			err = a.saveWebpImageVariant(base, original, resized, width, size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if localWebp {
+		return a.saveWebpImageVariant(base, original, img, originalWidth, originalSize)
+	}
+	if !cloudflare {
+		return nil
+	}
+	// Cloudflare requires a public URL of the original
+	originalURL := a.getFullAddress(a.mediaFileLocation(original))
+	for _, format := range cloudflareImageVariantFormats {
+		for _, width := range append(widths, originalWidth) {
+			buf := bufferpool.Get()
+			err = requests.
+				URL(fmt.Sprintf("https://www.cloudflare.com/cdn-cgi/image/f=%s,q=75,metadata=none,fit=scale-down,w=%d/%s", format, width, originalURL)).
+				Client(a.httpClient).
+				ToBytesBuffer(buf).
+				Fetch(context.Background())
+			if err == nil {
+				// The width of AVIF images can't be decoded, but it's known
+				err = a.saveImageVariant(fmt.Sprintf("%s-%d.%s", base, width, format), original, buf, width)
+			}
+			bufferpool.Put(buf)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Encodes a lossless WebP variant, it's only saved if it's smaller than the variant in the original format
+func (a *goBlog) saveWebpImageVariant(base, original string, img image.Image, width, maxSize int) error {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+	if err := encodeWebp(buf, img); err != nil {
+		return err
+	}
+	if buf.Len() >= maxSize {
+		return nil
+	}
+	return a.saveImageVariant(fmt.Sprintf("%s-%d.webp", base, width), original, buf, width)
+}
+
+// The encoder panics for some images, which must not crash the queue
+func encodeWebp(w io.Writer, img image.Image) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("encoding WebP failed: %v", r)
+		}
+	}()
+	return nativewebp.Encode(w, img, nil)
+}
+
+func (a *goBlog) saveImageVariant(name, original string, file io.Reader, width int) error {
+	if _, err := a.saveMediaFile(name, file); err != nil {
+		return err
+	}
+	return a.db.saveMediaVariant(name, original, width)
+}
+
+type imageVariantsJob struct {
+	Name string
+	Try  int
+}
+
+func (j *imageVariantsJob) encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(j)
+}
+
+// Creates the image variants in the background, so uploads don't wait for the resizing
+func (a *goBlog) initImageVariants() {
+	if !a.imageVariantsEnabled() {
+		return
+	}
+	a.listenOnQueue(imageVariantsQueueName, 30*time.Second, func(qi *queueItem, dequeue func(), reschedule func(time.Duration)) {
+		var j imageVariantsJob
+		if err := gob.NewDecoder(bytes.NewReader(qi.content)).Decode(&j); err != nil {
+			log.Println("image variants queue:", err.Error())
+			dequeue()
+			return
+		}
+		if err := a.processImageVariants(j.Name); err != nil {
+			log.Printf("creating image variants of %s failed: %v", j.Name, err)
+			if j.Try++; j.Try < 5 {
+				// Try it again
+				buf := bufferpool.Get()
+				_ = j.encode(buf)
+				qi.content = buf.Bytes()
+				reschedule(time.Duration(j.Try) * time.Minute)
+				bufferpool.Put(buf)
+				return
+			}
+			log.Println("Creating image variants failed for the 5th time:", j.Name)
+		}
+		dequeue()
+	})
+}
+
+func (a *goBlog) queueImageVariants(name string) error {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+	if err := (&imageVariantsJob{Name: name}).encode(buf); err != nil {
+		return err
+	}
+	return a.enqueue(imageVariantsQueueName, buf.Bytes(), time.Now())
+}
+
+// Creates the variants of an image from the media storage
+func (a *goBlog) processImageVariants(name string) error {
+	if !a.mediaStorageEnabled() {
+		return errNoMediaStorageConfigured
+	}
+	file, err := a.mediaStorage.open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = a.createImageVariants(name, file); err != nil {
+		return err
+	}
+	// Render the new srcsets
+	a.purgeImageVariantsCache()
+	a.cache.purge()
+	return nil
+}
+
+// Caches the variants of rendered images, so rendering a post doesn't query the database for every image
+func (a *goBlog) initImageVariantsCache() {
+	a.imageVariantsCacheInit.Do(func() {
+		a.imageVariantsCache, _ = ristretto.NewCache(&ristretto.Config{
+			NumCounters:        10000,
+			MaxCost:            1000, // Cache variants for 1000 images
+			BufferItems:        64,
+			IgnoreInternalCost: true,
+		})
+	})
+}
+
+func (a *goBlog) getMediaVariants(name string) ([]*mediaVariant, error) {
+	a.initImageVariantsCache()
+	if val, cached := a.imageVariantsCache.Get(name); cached {
+		return val.([]*mediaVariant), nil
+	}
+	variants, err := a.db.getMediaVariants(name)
+	if err != nil {
+		return nil, err
+	}
+	a.imageVariantsCache.Set(name, variants, 1)
+	return variants, nil
+}
+
+func (a *goBlog) purgeImageVariantsCache() {
+	a.initImageVariantsCache()
+	a.imageVariantsCache.Clear()
+}
+
+// A <picture> source for a format not every browser supports
+type imageSource struct {
+	mimeType, srcset string
+}
+
+// Returns the srcset attribute for an image from the media storage and
+// the sources for the AVIF and WebP variants, if there are any
+func (a *goBlog) imageVariantSrcsets(dest string) (srcset string, sources []*imageSource) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", nil
+	}
+	name := path.Base(u.Path)
+	// Check if the image is from the media storage
+	if loc := a.mediaFileLocation(name); loc == "" || (dest != loc && dest != a.getFullAddress(loc)) {
+		return "", nil
+	}
+	variants, err := a.getMediaVariants(name)
+	if err != nil || len(variants) < 2 {
+		return "", nil
+	}
+	// Variants are stored next to the original
+	dir := strings.TrimSuffix(dest, name)
+	var fallback []string
+	formats := map[string][]string{}
+	for _, v := range variants {
+		candidate := fmt.Sprintf("%s%s %dw", dir, v.Name, v.Width)
+		switch v.MimeType {
+		case "image/avif", "image/webp":
+			formats[v.MimeType] = append(formats[v.MimeType], candidate)
+		default:
+			fallback = append(fallback, candidate)
+		}
+	}
+	if len(fallback) > 1 {
+		srcset = strings.Join(fallback, ", ")
+	}
+	for _, format := range cloudflareImageVariantFormats {
+		mimeType := "image/" + format
+		if candidates := formats[mimeType]; len(candidates) > 0 {
+			sources = append(sources, &imageSource{mimeType: mimeType, srcset: strings.Join(candidates, ", ")})
+		}
+	}
+	return srcset, sources
+}
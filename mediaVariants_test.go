@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_imageVariants(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Micropub.MediaStorage = &configMicropubMedia{
+		ImageVariantsEnabled: true,
+		ImageVariantWidths:   []int{100, 200, 1000},
+	}
+	_ = app.initConfig(false)
+	app.initMarkdown()
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+		app.mediaStorageBackend = mediaStorageLocal
+	})
+
+	img := &bytes.Buffer{}
+	require.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 300, 150))))
+
+	_, err := app.saveMediaFile("abc.png", bytes.NewReader(img.Bytes()))
+	require.NoError(t, err)
+	// Variants are created in the background
+	require.NoError(t, app.queueImageVariants("abc.png"))
+	qi, err := app.peekQueue(context.Background(), imageVariantsQueueName)
+	require.NoError(t, err)
+	require.NotNil(t, qi)
+	require.NoError(t, app.processImageVariants("abc.png"))
+
+	// Variants wider than the original are skipped
+	_, err = os.Stat(filepath.Join(mediaDir, "abc-100.png"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(mediaDir, "abc-200.png"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(mediaDir, "abc-1000.png"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Smaller lossless WebP variants are encoded locally
+	_, err = os.Stat(filepath.Join(mediaDir, "abc-300.webp"))
+	assert.NoError(t, err)
+
+	variants, err := app.db.getMediaVariants("abc.png")
+	require.NoError(t, err)
+	pngVariants := lo.Filter(variants, func(v *mediaVariant, _ int) bool {
+		return v.MimeType == "image/png"
+	})
+	if assert.Len(t, pngVariants, 3) {
+		assert.Equal(t, "abc-100.png", pngVariants[0].Name)
+		assert.Equal(t, 100, pngVariants[0].Width)
+		assert.Equal(t, "abc.png", pngVariants[2].Name)
+	}
+	assert.Len(t, variants, 6)
+
+	// Render srcset for images from the media storage
+	srcset, sources := app.imageVariantSrcsets("/m/abc.png")
+	assert.Equal(t, "/m/abc-100.png 100w, /m/abc-200.png 200w, /m/abc.png 300w", srcset)
+	if assert.Len(t, sources, 1) {
+		assert.Equal(t, "image/webp", sources[0].mimeType)
+		assert.Equal(t, "/m/abc-100.webp 100w, /m/abc-200.webp 200w, /m/abc-300.webp 300w", sources[0].srcset)
+	}
+
+	srcset, _ = app.imageVariantSrcsets("http://localhost:8080/m/abc.png")
+	assert.Equal(t, "http://localhost:8080/m/abc-100.png 100w, http://localhost:8080/m/abc-200.png 200w, http://localhost:8080/m/abc.png 300w", srcset)
+
+	srcset, _ = app.imageVariantSrcsets("https://example.com/abc.png")
+	assert.Empty(t, srcset)
+
+	var buf bytes.Buffer
+	require.NoError(t, app.renderMarkdownToWriter(&buf, "![Test](/m/abc.png)", false))
+	assert.Contains(t, buf.String(), `srcset="/m/abc-100.png 100w, /m/abc-200.png 200w, /m/abc.png 300w"`)
+	assert.Contains(t, buf.String(), `sizes="(max-width: 700px) 100vw, 700px"`)
+
+	buf.Reset()
+	require.NoError(t, app.renderMarkdownToWriter(&buf, "![Test](https://example.com/abc.png)", false))
+	assert.NotContains(t, buf.String(), "srcset")
+
+	// AVIF variants (from Cloudflare) are picture sources before WebP
+	for _, name := range []string{"abc-100.avif", "abc-300.avif"} {
+		require.NoError(t, app.saveImageVariant(name, "abc.png", bytes.NewReader([]byte("variant")), stringToInt(strings.TrimSuffix(strings.TrimPrefix(name, "abc-"), filepath.Ext(name)))))
+	}
+	app.purgeImageVariantsCache()
+	srcset, sources = app.imageVariantSrcsets("/m/abc.png")
+	assert.Equal(t, "/m/abc-100.png 100w, /m/abc-200.png 200w, /m/abc.png 300w", srcset)
+	if assert.Len(t, sources, 2) {
+		assert.Equal(t, "image/avif", sources[0].mimeType)
+		assert.Equal(t, "/m/abc-100.avif 100w, /m/abc-300.avif 300w", sources[0].srcset)
+		assert.Equal(t, "image/webp", sources[1].mimeType)
+		assert.Equal(t, "/m/abc-100.webp 100w, /m/abc-200.webp 200w, /m/abc-300.webp 300w", sources[1].srcset)
+	}
+
+	buf.Reset()
+	require.NoError(t, app.renderMarkdownToWriter(&buf, "![Test](/m/abc.png)", false))
+	assert.Contains(t, buf.String(), `<picture><source type="image/avif" srcset="/m/abc-100.avif 100w, /m/abc-300.avif 300w"`)
+
+	// Deleting the original deletes the variants
+	require.NoError(t, app.deleteMediaFile("abc.png"))
+	_, err = os.Stat(filepath.Join(mediaDir, "abc-100.png"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	variants, err = app.db.getMediaVariants("abc.png")
+	require.NoError(t, err)
+	assert.Empty(t, variants)
+}
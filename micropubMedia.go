@@ -1,26 +1,46 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"path/filepath"
 	"strings"
 
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bodylimit"
 	"go.goblog.app/app/pkgs/contenttype"
 )
 
 const micropubMediaSubPath = "/media"
 
+// Videos are usually a lot larger than other media files
+func (a *goBlog) micropubMediaBodyLimit() int64 {
+	if a.videoHlsEnabled() {
+		return 500 * bodylimit.MB
+	}
+	return 30 * bodylimit.MB
+}
+
 func (a *goBlog) serveMicropubMedia(w http.ResponseWriter, r *http.Request) {
 	// Check scope
 	if !a.micropubCheckScope(w, r, "media") {
 		return
 	}
-	// Check if request is multipart
-	if ct := r.Header.Get(contentType); !strings.Contains(ct, contenttype.MultipartForm) {
+	// Check for actions
+	if ct := r.Header.Get(contentType); strings.Contains(ct, contenttype.WWWForm) {
+		if err := r.ParseForm(); err != nil {
+			a.serveError(w, r, "failed to parse form", http.StatusBadRequest)
+			return
+		}
+		a.micropubMediaAction(w, r)
+		return
+	} else if !strings.Contains(ct, contenttype.MultipartForm) {
 		a.serveError(w, r, "wrong content-type", http.StatusBadRequest)
 		return
 	}
@@ -30,6 +50,10 @@ func (a *goBlog) serveMicropubMedia(w http.ResponseWriter, r *http.Request) {
 		a.serveError(w, r, "failed to parse multipart form", http.StatusBadRequest)
 		return
 	}
+	if r.Form.Get("action") != "" {
+		a.micropubMediaAction(w, r)
+		return
+	}
 	// Get file
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -37,13 +61,6 @@ func (a *goBlog) serveMicropubMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
-	// Generate sha256 hash for file
-	hash := sha256.New()
-	_, err = io.Copy(hash, file)
-	if err != nil {
-		a.serveError(w, r, "failed to get file hash", http.StatusBadRequest)
-		return
-	}
 	// Get file extension
 	fileExtension := filepath.Ext(header.Filename)
 	if fileExtension == "" {
@@ -56,15 +73,43 @@ func (a *goBlog) serveMicropubMedia(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	lowerExtension := strings.ToLower(strings.TrimPrefix(fileExtension, "."))
+	// Read EXIF data and strip it from the file (unless it should be kept)
+	var upload io.ReadSeeker = file
+	exifData := readMediaExif(lowerExtension, file)
+	if r.Form.Get("mp-keep-exif") != "true" && hasStrippableExif(lowerExtension) {
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			a.serveError(w, r, "failed to read multipart file", http.StatusInternalServerError)
+			return
+		}
+		stripped := &bytes.Buffer{}
+		if err = stripExif(lowerExtension, file, stripped); err != nil {
+			// Images the parser doesn't understand are uploaded as they are
+			log.Println("Failed to strip EXIF data, keeping the original file:", err.Error())
+		} else {
+			upload = bytes.NewReader(stripped.Bytes())
+		}
+	}
+	// Generate sha256 hash for file
+	if _, err = upload.Seek(0, io.SeekStart); err != nil {
+		a.serveError(w, r, "failed to read multipart file", http.StatusInternalServerError)
+		return
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, upload)
+	if err != nil {
+		a.serveError(w, r, "failed to get file hash", http.StatusBadRequest)
+		return
+	}
 	// Generate the file name
 	fileName := fmt.Sprintf("%x%s", hash.Sum(nil), fileExtension)
 	// Save file
-	_, err = file.Seek(0, io.SeekStart)
+	_, err = upload.Seek(0, io.SeekStart)
 	if err != nil {
 		a.serveError(w, r, "failed to read multipart file", http.StatusInternalServerError)
 		return
 	}
-	location, err := a.saveMediaFile(fileName, file)
+	location, err := a.saveMediaFile(fileName, upload)
 	if err != nil {
 		a.serveError(w, r, "failed to save original file", http.StatusInternalServerError)
 		return
@@ -81,5 +126,129 @@ func (a *goBlog) serveMicropubMedia(w http.ResponseWriter, r *http.Request) {
 			location = compressedLocation
 		}
 	}
+	// Queue the creation of responsive image variants
+	if a.imageVariantsEnabled() {
+		if err = a.queueImageVariants(filepath.Base(location)); err != nil {
+			a.serveError(w, r, "failed to queue image variants: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// Queue the HLS packaging of videos
+	if a.videoHlsEnabled() && isVideoMimeType(defaultIfEmpty(mediaMimeType(fileName), header.Header.Get(contentType))) {
+		if err = a.queueVideoProcessing(fileName); err != nil {
+			a.serveError(w, r, "failed to queue video processing: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// Remember original filename and alt text
+	for _, name := range lo.Uniq([]string{fileName, filepath.Base(location)}) {
+		if err = a.db.saveMediaFilename(name, header.Filename); err != nil {
+			a.serveError(w, r, "failed to save media metadata", http.StatusInternalServerError)
+			return
+		}
+		if alt := r.Form.Get("alt"); alt != "" {
+			if err = a.db.saveMediaAlt(name, alt); err != nil {
+				a.serveError(w, r, "failed to save alt text", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !exifData.empty() {
+			if err = a.db.saveMediaExif(name, exifData); err != nil {
+				a.serveError(w, r, "failed to save EXIF data", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	// Return the EXIF data as suggested post parameters
+	if !exifData.empty() {
+		w.Header().Set("Location", location)
+		w.Header().Set(contentType, contenttype.JSONUTF8)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"url":         location,
+			"suggestions": exifData.suggestions(a.cfg.Micropub.LocationParam),
+		})
+		return
+	}
 	http.Redirect(w, r, location, http.StatusCreated)
 }
+
+func (a *goBlog) micropubMediaAction(w http.ResponseWriter, r *http.Request) {
+	switch micropubAction(r.Form.Get("action")) {
+	case actionDelete:
+		if !a.micropubCheckScope(w, r, "delete") {
+			return
+		}
+		location := a.mediaFileLocation("")
+		if location == "" {
+			a.serveError(w, r, errNoMediaStorageConfigured.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Only delete files of the media storage
+		prefix, fileURL := a.getFullAddress(location), r.Form.Get("url")
+		name := strings.TrimPrefix(fileURL, prefix)
+		if !strings.HasPrefix(fileURL, prefix) || name == "" || strings.ContainsAny(name, "/\\?#") {
+			a.serveError(w, r, "missing or invalid url", http.StatusBadRequest)
+			return
+		}
+		if err := a.deleteMediaFile(name); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		a.serveError(w, r, "Action not supported", http.StatusNotImplemented)
+	}
+}
+
+func (a *goBlog) serveMicropubMediaQuery(w http.ResponseWriter, r *http.Request) {
+	// Check scope
+	if !a.micropubCheckScope(w, r, "media") {
+		return
+	}
+	var result any
+	switch query := r.URL.Query(); query.Get("q") {
+	case "config":
+		result = map[string]any{}
+	case "source":
+		if !a.mediaStorageEnabled() {
+			a.serveError(w, r, errNoMediaStorageConfigured.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Page through the media library instead of listing the whole storage
+		entries, err := a.db.getMediaLibrary(stringToInt(query.Get("offset")), stringToInt(query.Get("limit")))
+		if err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items := []map[string]any{}
+		for _, e := range entries {
+			item := map[string]any{
+				"url":       a.getFullAddress(a.mediaFileLocation(e.Name)),
+				"mime_type": defaultIfEmpty(e.MimeType, mediaMimeType(e.Name)),
+				"published": e.Uploaded,
+				"size":      e.Size,
+			}
+			if e.Alt != "" {
+				item["alt"] = e.Alt
+			}
+			if e.Width > 0 && e.Height > 0 {
+				item["width"], item["height"] = e.Width, e.Height
+			}
+			if !e.Exif.empty() {
+				item["suggestions"] = e.Exif.suggestions(a.cfg.Micropub.LocationParam)
+			}
+			items = append(items, item)
+		}
+		result = map[string]any{"items": items}
+	default:
+		a.serve404(w, r)
+		return
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(json.NewEncoder(pw).Encode(result))
+	}()
+	w.Header().Set(contentType, contenttype.JSONUTF8)
+	_ = pr.CloseWithError(a.min.Get().Minify(contenttype.JSON, w, pr))
+}
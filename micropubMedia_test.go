@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+func Test_micropubMedia(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+
+	_ = app.initConfig(false)
+	_ = app.initTemplateStrings()
+	app.initMarkdown()
+	app.initSessions()
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+	})
+
+	handler := addAllScopes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.serveMicropubMediaQuery(w, r)
+		} else {
+			app.serveMicropubMedia(w, r)
+		}
+	}))
+
+	// Upload file with alt text
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "test.txt")
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte("Test file"))
+	_ = mw.WriteField("alt", "Test alt")
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/micropub/media", body)
+	req.Header.Set(contentType, mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get("Location")
+	assert.Equal(t, "http://localhost:8080/m/b1ab25c55913c95cc6913f1dbce9bef185ebf00a64553a8ef194193e52ea5015.txt", location)
+
+	fileName := filepath.Base(location)
+	_, err = os.Stat(filepath.Join(mediaDir, fileName))
+	require.NoError(t, err)
+
+	entries, err := app.db.getMediaEntries(fileName)
+	require.NoError(t, err)
+	if assert.Contains(t, entries, fileName) {
+		assert.Equal(t, "test.txt", entries[fileName].Filename)
+		assert.Equal(t, "Test alt", entries[fileName].Alt)
+		assert.Equal(t, strings.TrimSuffix(fileName, ".txt"), entries[fileName].Hash)
+	}
+
+	// Query files
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/micropub/media?q=source&limit=10", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result struct {
+		Items []struct {
+			URL      string `json:"url"`
+			MimeType string `json:"mime_type"`
+			Size     int64  `json:"size"`
+			Alt      string `json:"alt"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, location, result.Items[0].URL)
+	assert.Equal(t, "text/plain", result.Items[0].MimeType)
+	assert.Equal(t, int64(9), result.Items[0].Size)
+	assert.Equal(t, "Test alt", result.Items[0].Alt)
+
+	// Offset behind the last file
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/micropub/media?q=source&offset=5", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"items\":[]}", rec.Body.String())
+
+	// Only files of the media storage can be deleted
+	for _, u := range []string{"https://example.com/m/" + fileName, "http://localhost:8080/" + fileName, "http://localhost:8080/m/../" + fileName} {
+		req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/micropub/media", strings.NewReader(url.Values{
+			"action": {"delete"},
+			"url":    {u},
+		}.Encode()))
+		req.Header.Set(contentType, contenttype.WWWForm)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, u)
+	}
+	_, err = os.Stat(filepath.Join(mediaDir, fileName))
+	assert.NoError(t, err)
+
+	// Delete file
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/micropub/media", strings.NewReader(url.Values{
+		"action": {"delete"},
+		"url":    {location},
+	}.Encode()))
+	req.Header.Set(contentType, contenttype.WWWForm)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	_, err = os.Stat(filepath.Join(mediaDir, fileName))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err = app.db.getMediaEntries(fileName)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,774 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kaorimatz/go-opml"
+	"github.com/mmcdole/gofeed"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bodylimit"
+	"go.goblog.app/app/pkgs/builderpool"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+// Implement a Microsub server to read followed feeds with any Microsub client
+// https://indieweb.org/Microsub-spec
+
+const (
+	microsubPath      = "/microsub"
+	microsubQueueName = "microsub"
+
+	microsubNotificationsChannel = "notifications"
+	microsubTimelineLimit        = 20
+	microsubMaxFeedItems         = 50
+	microsubDefaultRetentionDays = 90
+)
+
+var errMicrosubChannelNotFound = errors.New("channel not found")
+
+func (a *goBlog) microsubEnabled() bool {
+	return a.cfg.Microsub != nil && a.cfg.Microsub.Enabled
+}
+
+// Returns how long entries are kept
+func (a *goBlog) microsubRetention() time.Duration {
+	days := microsubDefaultRetentionDays
+	if a.cfg.Microsub.RetentionDays > 0 {
+		days = a.cfg.Microsub.RetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (a *goBlog) initMicrosub() {
+	if !a.microsubEnabled() {
+		return
+	}
+	a.listenOnQueue(microsubQueueName, 30*time.Second, func(qi *queueItem, dequeue func(), _ func(time.Duration)) {
+		feedURL := string(qi.content)
+		if err := a.microsubFetch(feedURL); err != nil {
+			// Feeds are fetched again every hour, so don't retry
+			log.Println("Failed to fetch Microsub feed:", feedURL, err.Error())
+		}
+		dequeue()
+	})
+	a.hourlyHooks = append(a.hourlyHooks, func() {
+		if err := a.db.microsubDeleteOldEntries(time.Now().Add(-a.microsubRetention())); err != nil {
+			log.Println("Failed to delete old Microsub entries:", err.Error())
+		}
+		feeds, err := a.db.microsubFollowedFeeds()
+		if err != nil {
+			log.Println("Failed to get followed Microsub feeds:", err.Error())
+			return
+		}
+		for _, feedURL := range feeds {
+			a.microsubEnqueueFetch(feedURL)
+		}
+	})
+}
+
+func (a *goBlog) microsubRouter(r chi.Router) {
+	r.Use(a.checkIndieAuth)
+	r.Get("/", a.serveMicrosub)
+	r.With(bodylimit.BodyLimit(100*bodylimit.KB)).Post("/", a.serveMicrosub)
+}
+
+func (a *goBlog) serveMicrosub(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post := r.Method == http.MethodPost
+	switch action := r.Form.Get("action"); action {
+	case "channels":
+		if !a.micropubCheckScope(w, r, lo.Ternary(post, "follow", "read")) {
+			return
+		}
+		if post {
+			a.microsubPostChannels(w, r)
+			return
+		}
+		a.microsubGetChannels(w, r)
+	case "timeline":
+		if !a.micropubCheckScope(w, r, "read") {
+			return
+		}
+		if post {
+			a.microsubPostTimeline(w, r)
+			return
+		}
+		a.microsubGetTimeline(w, r)
+	case "follow", "unfollow":
+		if !a.micropubCheckScope(w, r, lo.Ternary(post, "follow", "read")) {
+			return
+		}
+		a.microsubFollow(w, r, action)
+	case "search":
+		if !a.micropubCheckScope(w, r, "follow") {
+			return
+		}
+		a.microsubSearch(w, r)
+	case "preview":
+		if !a.micropubCheckScope(w, r, "read") {
+			return
+		}
+		a.microsubPreview(w, r)
+	default:
+		a.serveError(w, r, "Action not supported", http.StatusNotImplemented)
+	}
+}
+
+func (a *goBlog) microsubRespond(w http.ResponseWriter, result any) {
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(json.NewEncoder(pw).Encode(result))
+	}()
+	w.Header().Set(contentType, contenttype.JSONUTF8)
+	_ = pr.CloseWithError(a.min.Get().Minify(contenttype.JSON, w, pr))
+}
+
+// Returns the form values of a parameter, clients send either "name" or "name[]"
+func microsubFormValues(r *http.Request, name string) []string {
+	return lo.Compact(append(r.Form[name], r.Form[name+"[]"]...))
+}
+
+// Channels
+
+type microsubChannel struct {
+	UID    string `json:"uid"`
+	Name   string `json:"name"`
+	Unread int    `json:"unread"`
+}
+
+func (a *goBlog) microsubGetChannels(w http.ResponseWriter, r *http.Request) {
+	channels, err := a.db.microsubChannels()
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.microsubRespond(w, map[string]any{"channels": channels})
+}
+
+func (a *goBlog) microsubPostChannels(w http.ResponseWriter, r *http.Request) {
+	uid, name := r.Form.Get("channel"), strings.TrimSpace(r.Form.Get("name"))
+	switch r.Form.Get("method") {
+	case "delete":
+		if uid == microsubNotificationsChannel {
+			a.serveError(w, r, "The notifications channel can't be deleted", http.StatusBadRequest)
+			return
+		}
+		if err := a.db.microsubDeleteChannel(uid); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "order":
+		if err := a.db.microsubOrderChannels(microsubFormValues(r, "channels")); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		if name == "" {
+			a.serveError(w, r, "Name missing", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if uid == "" {
+			uid, err = a.db.microsubCreateChannel(name)
+		} else {
+			err = a.db.microsubRenameChannel(uid, name)
+		}
+		if errors.Is(err, errMicrosubChannelNotFound) {
+			a.serveError(w, r, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		a.microsubRespond(w, &microsubChannel{UID: uid, Name: name})
+	}
+}
+
+func (db *database) microsubChannels() ([]*microsubChannel, error) {
+	rows, err := db.Query(`
+	select c.uid, c.name, (select count(*) from microsub_entries e where e.channel = c.uid and e.read = 0)
+	from microsub_channels c order by c.position, c.rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	channels := []*microsubChannel{}
+	for rows.Next() {
+		c := &microsubChannel{}
+		if err = rows.Scan(&c.UID, &c.Name, &c.Unread); err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+func (db *database) microsubChannelExists(uid string) (bool, error) {
+	row, err := db.QueryRow("select exists(select 1 from microsub_channels where uid = @uid)", sql.Named("uid", uid))
+	if err != nil {
+		return false, err
+	}
+	var exists bool
+	err = row.Scan(&exists)
+	return exists, err
+}
+
+func (db *database) microsubCreateChannel(name string) (string, error) {
+	uid := randomString(16)
+	_, err := db.Exec(
+		"insert into microsub_channels (uid, name, position) values (@uid, @name, (select coalesce(max(position), 0) + 1 from microsub_channels))",
+		sql.Named("uid", uid), sql.Named("name", name),
+	)
+	return uid, err
+}
+
+func (db *database) microsubRenameChannel(uid, name string) error {
+	res, err := db.Exec("update microsub_channels set name = @name where uid = @uid", sql.Named("uid", uid), sql.Named("name", name))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errMicrosubChannelNotFound
+	}
+	return nil
+}
+
+func (db *database) microsubDeleteChannel(uid string) error {
+	_, err := db.Exec(`
+	delete from microsub_channels where uid = ?;
+	delete from microsub_follows where channel = ?;
+	delete from microsub_entries where channel = ?;
+	delete from microsub_tombstones where channel = ?;`, dbNoCache, uid, uid, uid, uid)
+	return err
+}
+
+func (db *database) microsubOrderChannels(uids []string) error {
+	// The notifications channel always stays first
+	uids = lo.Without(uids, microsubNotificationsChannel)
+	if len(uids) == 0 {
+		return nil
+	}
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	args := []any{dbNoCache}
+	for i, uid := range uids {
+		queryBuilder.WriteString("update microsub_channels set position = ? where uid = ?;")
+		args = append(args, i+1, uid)
+	}
+	_, err := db.Exec(queryBuilder.String(), args...)
+	return err
+}
+
+// Timeline
+
+func (a *goBlog) microsubGetTimeline(w http.ResponseWriter, r *http.Request) {
+	channel := r.Form.Get("channel")
+	if exists, err := a.db.microsubChannelExists(channel); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !exists {
+		a.serveError(w, r, errMicrosubChannelNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	after, _ := strconv.Atoi(r.Form.Get("after"))
+	before, _ := strconv.Atoi(r.Form.Get("before"))
+	entries, paging, err := a.db.microsubTimeline(channel, after, before, microsubTimelineLimit)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.microsubRespond(w, map[string]any{"items": entries, "paging": paging})
+}
+
+func (a *goBlog) microsubPostTimeline(w http.ResponseWriter, r *http.Request) {
+	channel := r.Form.Get("channel")
+	var err error
+	switch method := r.Form.Get("method"); method {
+	case "mark_read", "mark_unread":
+		read := method == "mark_read"
+		if lastRead := r.Form.Get("last_read_entry"); lastRead != "" && read {
+			err = a.db.microsubMarkReadUntil(channel, lastRead)
+		} else {
+			err = a.db.microsubMarkRead(channel, microsubFormValues(r, "entry"), read)
+		}
+	case "remove":
+		err = a.db.microsubRemoveEntries(channel, microsubFormValues(r, "entry"))
+	default:
+		a.serveError(w, r, "Method not supported", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Returns the entries of a channel, newest first. Paging uses the entry IDs as cursors.
+func (db *database) microsubTimeline(channel string, after, before, limit int) ([]map[string]any, map[string]string, error) {
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	queryBuilder.WriteString("select id, data, read from microsub_entries where channel = @channel")
+	args := []any{sql.Named("channel", channel), sql.Named("limit", limit+1)}
+	if before > 0 {
+		queryBuilder.WriteString(" and id > @before order by id asc")
+		args = append(args, sql.Named("before", before))
+	} else {
+		if after > 0 {
+			queryBuilder.WriteString(" and id < @after")
+			args = append(args, sql.Named("after", after))
+		}
+		queryBuilder.WriteString(" order by id desc")
+	}
+	queryBuilder.WriteString(" limit @limit")
+	rows, err := db.Query(queryBuilder.String(), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	entries, ids := []map[string]any{}, []int{}
+	for rows.Next() {
+		var id int
+		var data string
+		var read bool
+		if err = rows.Scan(&id, &data, &read); err != nil {
+			return nil, nil, err
+		}
+		entry := map[string]any{}
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, nil, err
+		}
+		entry["_id"], entry["_is_read"] = strconv.Itoa(id), read
+		entries, ids = append(entries, entry), append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	more := len(entries) > limit
+	if more {
+		entries, ids = entries[:limit], ids[:limit]
+	}
+	if before > 0 {
+		entries, ids = lo.Reverse(entries), lo.Reverse(ids)
+	}
+	paging := map[string]string{}
+	if len(ids) > 0 {
+		if more || before > 0 {
+			paging["after"] = strconv.Itoa(ids[len(ids)-1])
+		}
+		if (more && before > 0) || after > 0 {
+			paging["before"] = strconv.Itoa(ids[0])
+		}
+	}
+	return entries, paging, nil
+}
+
+func (db *database) microsubMarkRead(channel string, ids []string, read bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	queryBuilder.WriteString("update microsub_entries set read = ? where channel = ? and id in (")
+	args := []any{dbNoCache, read, channel}
+	for i, id := range ids {
+		if i > 0 {
+			queryBuilder.WriteString(", ")
+		}
+		queryBuilder.WriteString("?")
+		args = append(args, id)
+	}
+	queryBuilder.WriteString(")")
+	_, err := db.Exec(queryBuilder.String(), args...)
+	return err
+}
+
+func (db *database) microsubMarkReadUntil(channel, lastRead string) error {
+	_, err := db.Exec("update microsub_entries set read = 1 where channel = @channel and id <= @id", sql.Named("channel", channel), sql.Named("id", lastRead))
+	return err
+}
+
+// Removes the entries and keeps tombstones, so fetching the feed again doesn't add them back
+func (db *database) microsubRemoveEntries(channel string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	idsBuilder := builderpool.Get()
+	defer builderpool.Put(idsBuilder)
+	idArgs := []any{}
+	for i, id := range ids {
+		if i > 0 {
+			idsBuilder.WriteString(", ")
+		}
+		idsBuilder.WriteString("?")
+		idArgs = append(idArgs, id)
+	}
+	args := []any{dbNoCache, channel}
+	args = append(args, idArgs...)
+	args = append(args, channel)
+	args = append(args, idArgs...)
+	_, err := db.Exec(`begin;
+	insert or ignore into microsub_tombstones (channel, feed, uid) select channel, feed, uid from microsub_entries where channel = ? and id in (`+idsBuilder.String()+`);
+	delete from microsub_entries where channel = ? and id in (`+idsBuilder.String()+`);
+	commit;`, args...)
+	return err
+}
+
+// Deletes entries published (or fetched, if they have no date) before the given time
+// and keeps tombstones, so entries without a date don't come back with the next fetch
+func (db *database) microsubDeleteOldEntries(before time.Time) error {
+	beforeString := before.UTC().Format(time.RFC3339)
+	_, err := db.Exec(`begin;
+	insert or ignore into microsub_tombstones (channel, feed, uid) select channel, feed, uid from microsub_entries where published < ?;
+	delete from microsub_entries where published < ?;
+	commit;`, dbNoCache, beforeString, beforeString)
+	return err
+}
+
+// Following
+
+func (a *goBlog) microsubFollow(w http.ResponseWriter, r *http.Request, action string) {
+	channel := r.Form.Get("channel")
+	if exists, err := a.db.microsubChannelExists(channel); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !exists {
+		a.serveError(w, r, errMicrosubChannelNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		feeds, err := a.db.microsubFollows(channel)
+		if err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items := lo.Map(feeds, func(feedURL string, _ int) map[string]any {
+			return map[string]any{"type": "feed", "url": feedURL}
+		})
+		a.microsubRespond(w, map[string]any{"items": items})
+		return
+	}
+	feedURL := r.Form.Get("url")
+	if !isAbsoluteURL(feedURL) {
+		a.serveError(w, r, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	if action == "unfollow" {
+		if err := a.db.microsubUnfollow(channel, feedURL); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := a.microsubFollowFeed(channel, feedURL); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.microsubRespond(w, map[string]any{"type": "feed", "url": feedURL})
+}
+
+// Follows the feed in the channel and fetches it
+func (a *goBlog) microsubFollowFeed(channel, feedURL string) error {
+	if _, err := a.db.Exec(
+		"insert or ignore into microsub_follows (channel, url) values (@channel, @url)",
+		sql.Named("channel", channel), sql.Named("url", feedURL),
+	); err != nil {
+		return err
+	}
+	a.microsubEnqueueFetch(feedURL)
+	return nil
+}
+
+func (db *database) microsubUnfollow(channel, feedURL string) error {
+	_, err := db.Exec(`
+	delete from microsub_follows where channel = ? and url = ?;
+	delete from microsub_entries where channel = ? and feed = ?;
+	delete from microsub_tombstones where channel = ? and feed = ?;`, dbNoCache, channel, feedURL, channel, feedURL, channel, feedURL)
+	return err
+}
+
+func (db *database) microsubFollows(channel string) ([]string, error) {
+	return db.microsubQueryStrings("select url from microsub_follows where channel = @channel order by url", sql.Named("channel", channel))
+}
+
+func (db *database) microsubFollowedFeeds() ([]string, error) {
+	return db.microsubQueryStrings("select distinct url from microsub_follows order by url")
+}
+
+func (db *database) microsubFollowingChannels(feedURL string) ([]string, error) {
+	return db.microsubQueryStrings("select channel from microsub_follows where url = @url", sql.Named("url", feedURL))
+}
+
+func (db *database) microsubQueryStrings(query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// Imports the feeds of the blogroll as follows, using a channel for each category
+func (a *goBlog) microsubImportBlogroll(blog string) (int, error) {
+	bc := a.cfg.Blogs[blog]
+	if bc == nil || bc.Blogroll == nil || !bc.Blogroll.Enabled {
+		return 0, errors.New("blogroll not enabled")
+	}
+	outlines, err := a.getBlogrollOutlines(blog)
+	if err != nil {
+		return 0, err
+	}
+	channels, err := a.db.microsubChannels()
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for _, category := range outlines {
+		feeds := lo.Filter(category.Outlines, func(o *opml.Outline, _ int) bool {
+			return o.XMLURL != nil && o.XMLURL.IsAbs()
+		})
+		if len(feeds) == 0 {
+			continue
+		}
+		name := defaultIfEmpty(category.Title, category.Text)
+		channel, ok := lo.Find(channels, func(c *microsubChannel) bool {
+			return c.Name == name
+		})
+		if !ok {
+			uid, err := a.db.microsubCreateChannel(name)
+			if err != nil {
+				return imported, err
+			}
+			channel = &microsubChannel{UID: uid, Name: name}
+			channels = append(channels, channel)
+		}
+		for _, feed := range feeds {
+			if err := a.microsubFollowFeed(channel.UID, feed.XMLURL.String()); err != nil {
+				return imported, err
+			}
+			imported++
+		}
+	}
+	return imported, nil
+}
+
+// Search and preview
+
+func (a *goBlog) microsubSearch(w http.ResponseWriter, r *http.Request) {
+	results := []map[string]any{}
+	// Only URLs of feeds are supported
+	if query := strings.TrimSpace(r.Form.Get("query")); isAbsoluteURL(query) {
+		if feed, err := a.fetchFeed(query); err == nil {
+			result := map[string]any{"type": "feed", "url": query, "name": feed.Title}
+			if feed.Description != "" {
+				result["description"] = feed.Description
+			}
+			if feed.Image != nil && feed.Image.URL != "" {
+				result["photo"] = feed.Image.URL
+			}
+			results = append(results, result)
+		}
+	}
+	a.microsubRespond(w, map[string]any{"results": results})
+}
+
+func (a *goBlog) microsubPreview(w http.ResponseWriter, r *http.Request) {
+	feedURL := r.Form.Get("url")
+	if !isAbsoluteURL(feedURL) {
+		a.serveError(w, r, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	feed, err := a.fetchFeed(feedURL)
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := lo.Map(microsubFeedItems(feed), func(item *gofeed.Item, _ int) map[string]any {
+		_, entry := microsubEntry(feed, item)
+		return entry
+	})
+	a.microsubRespond(w, map[string]any{"items": lo.Reverse(items)})
+}
+
+// Fetching
+
+func (a *goBlog) microsubEnqueueFetch(feedURL string) {
+	if err := a.enqueue(microsubQueueName, []byte(feedURL), time.Now()); err != nil {
+		log.Println("Failed to enqueue Microsub feed:", err.Error())
+	}
+}
+
+// Fetches the feed and saves new entries to all channels following it
+func (a *goBlog) microsubFetch(feedURL string) error {
+	channels, err := a.db.microsubFollowingChannels(feedURL)
+	if err != nil || len(channels) == 0 {
+		return err
+	}
+	feed, err := a.fetchFeed(feedURL)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	cutoff := now.Add(-a.microsubRetention())
+	uids := []string{}
+	for _, item := range microsubFeedItems(feed) {
+		uid, entry := microsubEntry(feed, item)
+		if uid == "" {
+			continue
+		}
+		uids = append(uids, uid)
+		// Skip entries that would be deleted right away, so deleted entries don't come back
+		if item.PublishedParsed != nil && item.PublishedParsed.Before(cutoff) {
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		// Entries without a date are kept from the time they were fetched
+		published, _ := entry["published"].(string)
+		published = defaultIfEmpty(published, now.UTC().Format(time.RFC3339))
+		for _, channel := range channels {
+			// Removed or deleted entries have a tombstone
+			if _, err = a.db.Exec(
+				`insert or ignore into microsub_entries (channel, feed, uid, published, data)
+				select @channel, @feed, @uid, @published, @data where not exists (select 1 from microsub_tombstones where channel = @channel and uid = @uid)`,
+				sql.Named("channel", channel), sql.Named("feed", feedURL), sql.Named("uid", uid),
+				sql.Named("published", published), sql.Named("data", string(data)),
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return a.db.microsubCleanupTombstones(feedURL, uids)
+}
+
+// Deletes the tombstones of entries that aren't in the feed anymore, they can't come back
+func (db *database) microsubCleanupTombstones(feedURL string, uids []string) error {
+	if len(uids) == 0 {
+		// Probably a temporary problem of the feed
+		return nil
+	}
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	queryBuilder.WriteString("delete from microsub_tombstones where feed = ? and uid not in (")
+	args := []any{dbNoCache, feedURL}
+	for i, uid := range uids {
+		if i > 0 {
+			queryBuilder.WriteString(", ")
+		}
+		queryBuilder.WriteString("?")
+		args = append(args, uid)
+	}
+	queryBuilder.WriteString(")")
+	_, err := db.Exec(queryBuilder.String(), args...)
+	return err
+}
+
+// Returns the newest items of the feed, oldest first, so newer entries get higher IDs.
+// Items without a date are considered oldest and keep their order.
+func microsubFeedItems(feed *gofeed.Feed) []*gofeed.Item {
+	items := lo.Compact(feed.Items)
+	sort.SliceStable(items, func(i, j int) bool {
+		pi, pj := items[i].PublishedParsed, items[j].PublishedParsed
+		if pi == nil || pj == nil {
+			return pi == nil && pj != nil
+		}
+		return pi.Before(*pj)
+	})
+	if len(items) > microsubMaxFeedItems {
+		items = items[len(items)-microsubMaxFeedItems:]
+	}
+	return items
+}
+
+// Converts the feed item to a jf2 entry
+func microsubEntry(feed *gofeed.Feed, item *gofeed.Item) (uid string, entry map[string]any) {
+	uid = defaultIfEmpty(item.GUID, item.Link)
+	entry = map[string]any{"type": "entry"}
+	if uid != "" {
+		entry["uid"] = uid
+	}
+	if item.Link != "" {
+		entry["url"] = item.Link
+	}
+	if item.Title != "" && item.Title != item.Description {
+		entry["name"] = item.Title
+	}
+	if item.PublishedParsed != nil {
+		entry["published"] = item.PublishedParsed.UTC().Format(time.RFC3339)
+	}
+	if item.UpdatedParsed != nil {
+		entry["updated"] = item.UpdatedParsed.UTC().Format(time.RFC3339)
+	}
+	if html := defaultIfEmpty(item.Content, item.Description); html != "" {
+		entry["content"] = map[string]any{"html": html, "text": htmlText(html)}
+		if item.Content != "" && item.Description != "" {
+			entry["summary"] = htmlText(item.Description)
+		}
+	}
+	author := map[string]any{"type": "card"}
+	if item.Author != nil && item.Author.Name != "" {
+		author["name"] = item.Author.Name
+	} else if feed.Title != "" {
+		author["name"] = feed.Title
+	}
+	if feed.Link != "" {
+		author["url"] = feed.Link
+	}
+	if feed.Image != nil && feed.Image.URL != "" {
+		author["photo"] = feed.Image.URL
+	}
+	if len(author) > 1 {
+		entry["author"] = author
+	}
+	if len(item.Categories) > 0 {
+		entry["category"] = item.Categories
+	}
+	if item.Image != nil && item.Image.URL != "" {
+		entry["photo"] = []string{item.Image.URL}
+	}
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		var property string
+		switch {
+		case strings.HasPrefix(enclosure.Type, "image/"):
+			property = "photo"
+		case strings.HasPrefix(enclosure.Type, "audio/"):
+			property = "audio"
+		case strings.HasPrefix(enclosure.Type, "video/"):
+			property = "video"
+		default:
+			continue
+		}
+		urls, _ := entry[property].([]string)
+		entry[property] = lo.Uniq(append(urls, enclosure.URL))
+	}
+	return uid, entry
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/hacdias/indieauth/v3"
+	"github.com/mmcdole/gofeed"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const microsubTestFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Friend</title>
+<link>https://friend.example/</link>
+<item><guid>https://friend.example/1</guid><link>https://friend.example/1</link><title>First</title><description>First post</description><pubDate>Mon, 02 Jan 2023 15:04:05 GMT</pubDate></item>
+<item><guid>https://friend.example/3</guid><link>https://friend.example/3</link><title>Third</title><description>&lt;p&gt;Third post&lt;/p&gt;</description><pubDate>Wed, 04 Jan 2023 15:04:05 GMT</pubDate><enclosure url="https://friend.example/3.jpg" type="image/jpeg" length="0"/></item>
+<item><guid>https://friend.example/2</guid><link>https://friend.example/2</link><title>Second</title><description>Second post</description><pubDate>Tue, 03 Jan 2023 15:04:05 GMT</pubDate></item>
+</channel>
+</rss>`
+
+func Test_microsub(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.Microsub = &configMicrosub{Enabled: true, RetentionDays: 100000} // The test feed is old
+
+	_ = app.initConfig(false)
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	fc.setFakeResponse(http.StatusOK, microsubTestFeed)
+
+	readToken, err := app.db.indieAuthSaveToken(&indieauth.AuthenticationRequest{ClientID: "https://client.example/", Scopes: []string{"read"}})
+	require.NoError(t, err)
+	token, err := app.db.indieAuthSaveToken(&indieauth.AuthenticationRequest{ClientID: "https://client.example/", Scopes: []string{"read", "follow"}})
+	require.NoError(t, err)
+
+	request := func(method, token string, values url.Values, result any) int {
+		var status int
+		rb := requests.URL("http://localhost:8080/microsub").Client(handlerClient).
+			Header("Authorization", "Bearer "+token).
+			AddValidator(nil).
+			Handle(func(r *http.Response) error {
+				defer r.Body.Close()
+				status = r.StatusCode
+				if result != nil && status == http.StatusOK {
+					return json.NewDecoder(r.Body).Decode(result)
+				}
+				return nil
+			})
+		if method == http.MethodPost {
+			rb.BodyForm(values)
+		} else {
+			for k, v := range values {
+				rb.Param(k, v...)
+			}
+		}
+		require.NoError(t, rb.Fetch(context.Background()))
+		return status
+	}
+
+	// Endpoint is advertised
+	var page string
+	err = requests.URL("http://localhost:8080/").Client(handlerClient).ToString(&page).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, page, `<link rel=microsub href=http://localhost:8080/microsub>`)
+
+	// Authentication and scopes
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "invalid", url.Values{"action": {"channels"}}, nil))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, readToken, url.Values{"action": {"channels"}, "name": {"Friends"}}, nil))
+
+	// Channels
+	var channel microsubChannel
+	require.Equal(t, http.StatusOK, request(http.MethodPost, token, url.Values{"action": {"channels"}, "name": {"Friends"}}, &channel))
+	assert.Equal(t, "Friends", channel.Name)
+	assert.NotEmpty(t, channel.UID)
+
+	var channels struct {
+		Channels []*microsubChannel `json:"channels"`
+	}
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"channels"}}, &channels))
+	if assert.Len(t, channels.Channels, 2) {
+		assert.Equal(t, microsubNotificationsChannel, channels.Channels[0].UID)
+		assert.Equal(t, channel.UID, channels.Channels[1].UID)
+	}
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, token, url.Values{"action": {"channels"}, "channel": {microsubNotificationsChannel}, "method": {"delete"}}, nil))
+
+	// Follow
+	require.Equal(t, http.StatusOK, request(http.MethodPost, token, url.Values{"action": {"follow"}, "channel": {channel.UID}, "url": {"https://friend.example/feed.xml"}}, nil))
+	qi, err := app.peekQueue(context.Background(), microsubQueueName)
+	require.NoError(t, err)
+	require.NotNil(t, qi)
+	assert.Equal(t, "https://friend.example/feed.xml", string(qi.content))
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+	// Fetching again doesn't duplicate entries
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+
+	var follows struct {
+		Items []map[string]string `json:"items"`
+	}
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"follow"}, "channel": {channel.UID}}, &follows))
+	assert.Equal(t, []map[string]string{{"type": "feed", "url": "https://friend.example/feed.xml"}}, follows.Items)
+
+	// Timeline
+	type timeline struct {
+		Items  []map[string]any  `json:"items"`
+		Paging map[string]string `json:"paging"`
+	}
+	var tl timeline
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"timeline"}, "channel": {channel.UID}}, &tl))
+	require.Len(t, tl.Items, 3)
+	assert.Equal(t, "Third", tl.Items[0]["name"])
+	assert.Equal(t, "https://friend.example/3", tl.Items[0]["url"])
+	assert.Equal(t, "2023-01-04T15:04:05Z", tl.Items[0]["published"])
+	assert.Equal(t, []any{"https://friend.example/3.jpg"}, tl.Items[0]["photo"])
+	assert.Equal(t, "Friend", tl.Items[0]["author"].(map[string]any)["name"])
+	assert.Equal(t, "<p>Third post</p>", tl.Items[0]["content"].(map[string]any)["html"])
+	assert.Equal(t, false, tl.Items[0]["_is_read"])
+	assert.Equal(t, "Second", tl.Items[1]["name"])
+	assert.Equal(t, "First", tl.Items[2]["name"])
+	assert.Empty(t, tl.Paging)
+
+	// Paging
+	entries, paging, err := app.db.microsubTimeline(channel.UID, 0, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Third", entries[0]["name"])
+	require.NotEmpty(t, paging["after"])
+	assert.Empty(t, paging["before"])
+	after, _ := strconv.Atoi(paging["after"])
+	entries, paging, err = app.db.microsubTimeline(channel.UID, after, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "First", entries[0]["name"])
+	assert.Empty(t, paging["after"])
+	require.NotEmpty(t, paging["before"])
+	before, _ := strconv.Atoi(paging["before"])
+	entries, _, err = app.db.microsubTimeline(channel.UID, 0, before, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Third", entries[0]["name"])
+	assert.Equal(t, "Second", entries[1]["name"])
+
+	// Mark read
+	require.Equal(t, http.StatusNoContent, request(http.MethodPost, readToken, url.Values{
+		"action": {"timeline"}, "method": {"mark_read"}, "channel": {channel.UID}, "last_read_entry": {tl.Items[1]["_id"].(string)},
+	}, nil))
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"channels"}}, &channels))
+	assert.Equal(t, 1, channels.Channels[1].Unread)
+	require.Equal(t, http.StatusNoContent, request(http.MethodPost, readToken, url.Values{
+		"action": {"timeline"}, "method": {"mark_read"}, "channel": {channel.UID}, "entry[]": {tl.Items[0]["_id"].(string)},
+	}, nil))
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"channels"}}, &channels))
+	assert.Equal(t, 0, channels.Channels[1].Unread)
+
+	// Search and preview
+	var search struct {
+		Results []map[string]string `json:"results"`
+	}
+	require.Equal(t, http.StatusOK, request(http.MethodPost, token, url.Values{"action": {"search"}, "query": {"https://friend.example/feed.xml"}}, &search))
+	if assert.Len(t, search.Results, 1) {
+		assert.Equal(t, "Friend", search.Results[0]["name"])
+	}
+	var preview timeline
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"preview"}, "url": {"https://friend.example/feed.xml"}}, &preview))
+	assert.Len(t, preview.Items, 3)
+
+	// Unfollow removes the entries
+	require.Equal(t, http.StatusNoContent, request(http.MethodPost, token, url.Values{"action": {"unfollow"}, "channel": {channel.UID}, "url": {"https://friend.example/feed.xml"}}, nil))
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"timeline"}, "channel": {channel.UID}}, &tl))
+	assert.Empty(t, tl.Items)
+
+	// Delete channel
+	require.Equal(t, http.StatusNoContent, request(http.MethodPost, token, url.Values{"action": {"channels"}, "channel": {channel.UID}, "method": {"delete"}}, nil))
+	require.Equal(t, http.StatusOK, request(http.MethodGet, readToken, url.Values{"action": {"channels"}}, &channels))
+	assert.Len(t, channels.Channels, 1)
+}
+
+func Test_microsubImportBlogroll(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.Microsub = &configMicrosub{Enabled: true}
+
+	_ = app.initConfig(false)
+	app.cfg.Blogs[app.cfg.DefaultBlog].Blogroll = &configBlogroll{Enabled: true, Opml: "https://example.com/blogroll.opml"}
+
+	fc.setFakeResponse(http.StatusOK, strings.TrimSpace(`
+<opml version="2.0">
+<body>
+<outline text="Friends">
+<outline text="Alice" type="rss" xmlUrl="https://alice.example/feed.xml" htmlUrl="https://alice.example/"/>
+<outline text="Bob" type="rss" xmlUrl="https://bob.example/feed.xml" htmlUrl="https://bob.example/"/>
+</outline>
+<outline text="Tech">
+<outline text="Carol" type="rss" xmlUrl="https://carol.example/feed.xml" htmlUrl="https://carol.example/"/>
+</outline>
+</body>
+</opml>`))
+
+	count, err := app.microsubImportBlogroll(app.cfg.DefaultBlog)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	channels, err := app.db.microsubChannels()
+	require.NoError(t, err)
+	require.Len(t, channels, 3)
+	assert.Equal(t, "Friends", channels[1].Name)
+	assert.Equal(t, "Tech", channels[2].Name)
+
+	follows, err := app.db.microsubFollows(channels[1].UID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://alice.example/feed.xml", "https://bob.example/feed.xml"}, follows)
+
+	// Importing again reuses the channels
+	count, err = app.microsubImportBlogroll(app.cfg.DefaultBlog)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	channels, err = app.db.microsubChannels()
+	require.NoError(t, err)
+	assert.Len(t, channels, 3)
+	feeds, err := app.db.microsubFollowedFeeds()
+	require.NoError(t, err)
+	assert.Len(t, feeds, 3)
+}
+
+func Test_microsubFeedItems(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	feed := &gofeed.Feed{Items: []*gofeed.Item{
+		{GUID: "3", PublishedParsed: day(3)},
+		{GUID: "a"},
+		{GUID: "1", PublishedParsed: day(1)},
+		{GUID: "b"},
+		{GUID: "2", PublishedParsed: day(2)},
+	}}
+	items := microsubFeedItems(feed)
+	assert.Equal(t, []string{"a", "b", "1", "2", "3"}, lo.Map(items, func(i *gofeed.Item, _ int) string { return i.GUID }))
+}
+
+func Test_microsubRetention(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.Microsub = &configMicrosub{Enabled: true, RetentionDays: 30}
+
+	_ = app.initConfig(false)
+
+	channel, err := app.db.microsubCreateChannel("Friends")
+	require.NoError(t, err)
+	require.NoError(t, app.microsubFollowFeed(channel, "https://friend.example/feed.xml"))
+
+	recent, old := time.Now().AddDate(0, 0, -10), time.Now().AddDate(0, 0, -40)
+	fc.setFakeResponse(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Friend</title>
+<item><guid>https://friend.example/old</guid><title>Old</title><pubDate>`+old.Format(time.RFC1123Z)+`</pubDate></item>
+<item><guid>https://friend.example/recent</guid><title>Recent</title><pubDate>`+recent.Format(time.RFC1123Z)+`</pubDate></item>
+<item><guid>https://friend.example/undated</guid><title>Undated</title></item>
+</channel>
+</rss>`)
+
+	// Old items aren't added, items without date are
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+	entries, _, err := app.db.microsubTimeline(channel, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"Recent", "Undated"}, lo.Map(entries, func(e map[string]any, _ int) any { return e["name"] }))
+
+	// Entries older than the retention are deleted
+	require.NoError(t, app.db.microsubDeleteOldEntries(time.Now().AddDate(0, 0, -5)))
+	entries, _, err = app.db.microsubTimeline(channel, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"Undated"}, lo.Map(entries, func(e map[string]any, _ int) any { return e["name"] }))
+	require.NoError(t, app.db.microsubDeleteOldEntries(time.Now().Add(time.Minute)))
+	entries, _, err = app.db.microsubTimeline(channel, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Deleted entries without a date don't come back
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+	entries, _, err = app.db.microsubTimeline(channel, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Neither do removed entries
+	_, err = app.db.Exec("delete from microsub_tombstones")
+	require.NoError(t, err)
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+	entries, _, err = app.db.microsubTimeline(channel, 0, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.NoError(t, app.db.microsubRemoveEntries(channel, []string{entries[0]["_id"].(string)}))
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+	entries, _, err = app.db.microsubTimeline(channel, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Tombstones of entries that aren't in the feed anymore are deleted
+	countTombstones := func() (count int) {
+		row, err := app.db.QueryRow("select count(*) from microsub_tombstones")
+		require.NoError(t, err)
+		require.NoError(t, row.Scan(&count))
+		return
+	}
+	assert.Equal(t, 1, countTombstones())
+	fc.setFakeResponse(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Friend</title>
+<item><guid>https://friend.example/new</guid><title>New</title></item>
+</channel>
+</rss>`)
+	require.NoError(t, app.microsubFetch("https://friend.example/feed.xml"))
+	assert.Equal(t, 0, countTombstones())
+}
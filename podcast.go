@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+const (
+	podcastFeedLimit = 100
+
+	podcastDurationParam   = "duration"
+	podcastChaptersParam   = "chapters"
+	podcastTranscriptParam = "transcript"
+)
+
+func (bc *configBlog) podcastEnabled() bool {
+	return bc.Podcast != nil && bc.Podcast.Enabled
+}
+
+type podcastRss struct {
+	XMLName   xml.Name        `xml:"rss"`
+	Version   string          `xml:"version,attr"`
+	ITunesNS  string          `xml:"xmlns:itunes,attr"`
+	PodcastNS string          `xml:"xmlns:podcast,attr"`
+	AtomNS    string          `xml:"xmlns:atom,attr"`
+	Channel   *podcastChannel `xml:"channel"`
+}
+
+type podcastChannel struct {
+	Title         string `xml:"title"`
+	Link          string `xml:"link"`
+	AtomLinks     []*rssAtomLink
+	Description   string           `xml:"description"`
+	Language      string           `xml:"language,omitempty"`
+	Generator     string           `xml:"generator"`
+	LastBuildDate string           `xml:"lastBuildDate,omitempty"`
+	Image         *podcastImage    `xml:"image"`
+	Author        string           `xml:"itunes:author,omitempty"`
+	Owner         *podcastOwner    `xml:"itunes:owner,omitempty"`
+	ITunesImage   *podcastHref     `xml:"itunes:image"`
+	Category      *podcastCategory `xml:"itunes:category,omitempty"`
+	Explicit      string           `xml:"itunes:explicit"`
+	Type          string           `xml:"itunes:type"`
+	Items         []*podcastItem   `xml:"item"`
+}
+
+type podcastImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type podcastOwner struct {
+	Name  string `xml:"itunes:name,omitempty"`
+	Email string `xml:"itunes:email,omitempty"`
+}
+
+type podcastHref struct {
+	Href string `xml:"href,attr"`
+}
+
+type podcastCategory struct {
+	Text        string           `xml:"text,attr"`
+	Subcategory *podcastCategory `xml:"itunes:category,omitempty"`
+}
+
+type podcastItem struct {
+	Title       string             `xml:"title"`
+	Link        string             `xml:"link"`
+	GUID        *podcastGUID       `xml:"guid"`
+	PubDate     string             `xml:"pubDate,omitempty"`
+	Description string             `xml:"description"`
+	Enclosure   *podcastEnclosure  `xml:"enclosure"`
+	Duration    string             `xml:"itunes:duration,omitempty"`
+	Chapters    *podcastTypedURL   `xml:"podcast:chapters,omitempty"`
+	Transcripts []*podcastTypedURL `xml:"podcast:transcript,omitempty"`
+}
+
+type podcastGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type podcastEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type podcastTypedURL struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+func (a *goBlog) generatePodcastFeed(blog string, w http.ResponseWriter, r *http.Request, posts []*post, title, description string, updated time.Time, paging *feedPaging) {
+	bc := a.cfg.Blogs[blog]
+	title = a.renderMdTitle(defaultIfEmpty(title, bc.Title))
+	link := a.getFullAddress(strings.TrimSuffix(r.URL.Path, "."+string(podcastFeed)))
+	artwork := a.getFullAddress(a.profileImagePath(profileImageFormatJPEG, 1400, 0))
+	channel := &podcastChannel{
+		Title:       title,
+		Link:        link,
+		Description: defaultIfEmpty(defaultIfEmpty(description, bc.Description), title),
+		Language:    bc.Lang,
+		Generator:   "GoBlog",
+		Image:       &podcastImage{URL: artwork, Title: title, Link: link},
+		Author:      a.cfg.User.Name,
+		ITunesImage: &podcastHref{Href: artwork},
+		Explicit:    strconv.FormatBool(bc.Podcast.Explicit),
+		Type:        "episodic",
+	}
+	if !updated.IsZero() {
+		channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+	ext := &feedExtensions{self: a.getFullAddress(r.URL.Path), hub: a.webSubHub(), paging: paging}
+	channel.AtomLinks = ext.rssAtomLinks(contenttype.RSS)
+	if ext.hub != "" {
+		setWebSubLinkHeader(w, ext.hub, ext.self)
+	}
+	if a.cfg.User.Name != "" || a.cfg.User.Email != "" {
+		channel.Owner = &podcastOwner{Name: a.cfg.User.Name, Email: a.cfg.User.Email}
+	}
+	if bc.Podcast.Category != "" {
+		channel.Category = &podcastCategory{Text: bc.Podcast.Category}
+		if bc.Podcast.Subcategory != "" {
+			channel.Category.Subcategory = &podcastCategory{Text: bc.Podcast.Subcategory}
+		}
+	}
+	for _, p := range posts {
+		audio := p.firstParameter(a.cfg.Micropub.AudioParam)
+		if audio == "" {
+			continue
+		}
+		audio = a.getFullAddress(audio)
+		length, mimeType := a.mediaEnclosureInfo(r.Context(), audio, "audio/mpeg")
+		item := &podcastItem{
+			Title:       defaultIfEmpty(p.RenderedTitle, a.fallbackTitle(p)),
+			Link:        a.fullPostURL(p),
+			GUID:        &podcastGUID{Value: a.fullPostURL(p), IsPermaLink: true},
+			Description: a.postSummary(p),
+			Enclosure:   &podcastEnclosure{URL: audio, Length: length, Type: mimeType},
+			Duration:    p.firstParameter(podcastDurationParam),
+		}
+		if published, err := dateparse.ParseLocal(p.Published); err == nil {
+			item.PubDate = published.Format(time.RFC1123Z)
+		}
+		if chapters := p.firstParameter(podcastChaptersParam); chapters != "" {
+			item.Chapters = &podcastTypedURL{URL: a.getFullAddress(chapters), Type: "application/json+chapters"}
+		}
+		for _, transcript := range p.Parameters[podcastTranscriptParam] {
+			item.Transcripts = append(item.Transcripts, &podcastTypedURL{URL: a.getFullAddress(transcript), Type: podcastTranscriptType(transcript)})
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(pipeWriter, xml.Header)
+		_ = pipeWriter.CloseWithError(xml.NewEncoder(pipeWriter).Encode(&podcastRss{
+			Version:   "2.0",
+			ITunesNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+			PodcastNS: "https://podcastindex.org/namespace/1.0",
+			AtomNS:    "http://www.w3.org/2005/Atom",
+			Channel:   channel,
+		}))
+	}()
+	w.Header().Set(contentType, contenttype.RSS+contenttype.CharsetUtf8Suffix)
+	_ = pipeReader.CloseWithError(a.min.Get().Minify(contenttype.RSS, w, pipeReader))
+}
+
+func podcastTranscriptType(transcript string) string {
+	u, err := url.Parse(transcript)
+	if err != nil {
+		return contenttype.Text
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".vtt":
+		return "text/vtt"
+	case ".srt":
+		return "application/x-subrip"
+	case ".json":
+		return contenttype.JSON
+	case ".html", ".htm":
+		return contenttype.HTML
+	default:
+		return contenttype.Text
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_podcastFeed(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.User = &configUser{
+		Name:  "Test User",
+		Email: "test@example.com",
+	}
+
+	_ = app.initConfig(false)
+	app.cfg.Blogs[app.cfg.DefaultBlog].Podcast = &configPodcast{
+		Enabled:     true,
+		Category:    "Technology",
+		Subcategory: "Tech News",
+	}
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	heads := 0
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		heads++
+		w.Header().Set("Content-Length", "1234")
+		w.Header().Set(contentType, "audio/mpeg")
+	}))
+
+	require.NoError(t, app.createPost(&post{
+		Path:      "/episode",
+		Section:   "posts",
+		Status:    statusPublished,
+		Published: "2020-01-02T00:00:00Z",
+		Parameters: map[string][]string{
+			"title":                     {"Episode 1"},
+			app.cfg.Micropub.AudioParam: {"https://example.com/episode.mp3"},
+			podcastDurationParam:        {"01:02:03"},
+			podcastChaptersParam:        {"https://example.com/chapters.json"},
+			podcastTranscriptParam:      {"https://example.com/transcript.vtt"},
+		},
+		Content: "Episode content",
+	}))
+	require.NoError(t, app.createPost(&post{
+		Path:       "/text",
+		Section:    "posts",
+		Status:     statusPublished,
+		Published:  "2020-01-03T00:00:00Z",
+		Parameters: map[string][]string{"title": {"Text post"}},
+		Content:    "Text content",
+	}))
+	p, err := app.getPost("/episode")
+	require.NoError(t, err)
+	for _, u := range app.postEnclosureURLs(p) {
+		app.queueEnclosureInfo(context.Background(), u)
+	}
+	processEnclosureInfoQueue(t, app)
+
+	fetchFeed := func() (feed *gofeed.Feed, raw string) {
+		headers := http.Header{}
+		err := requests.URL("http://localhost:8080/posts.podcast").Client(handlerClient).
+			CopyHeaders(headers).
+			ToString(&raw).
+			Fetch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "application/rss+xml; charset=utf-8", headers.Get(contentType))
+		feed, err = gofeed.NewParser().ParseString(raw)
+		require.NoError(t, err)
+		return
+	}
+
+	feed, raw := fetchFeed()
+	if assert.NotNil(t, feed.ITunesExt) {
+		assert.Equal(t, "Test User", feed.ITunesExt.Author)
+		assert.Equal(t, "false", feed.ITunesExt.Explicit)
+		assert.Equal(t, "http://localhost:8080/profile.jpg", feed.ITunesExt.Image)
+		if assert.Len(t, feed.ITunesExt.Categories, 1) {
+			assert.Equal(t, "Technology", feed.ITunesExt.Categories[0].Text)
+			assert.Equal(t, "Tech News", feed.ITunesExt.Categories[0].Subcategory.Text)
+		}
+		if assert.NotNil(t, feed.ITunesExt.Owner) {
+			assert.Equal(t, "test@example.com", feed.ITunesExt.Owner.Email)
+		}
+	}
+	// Only posts with audio
+	if assert.Len(t, feed.Items, 1) {
+		item := feed.Items[0]
+		assert.Equal(t, "Episode 1", item.Title)
+		assert.Equal(t, "http://localhost:8080/episode", item.Link)
+		if assert.Len(t, item.Enclosures, 1) {
+			assert.Equal(t, "https://example.com/episode.mp3", item.Enclosures[0].URL)
+			assert.Equal(t, "1234", item.Enclosures[0].Length)
+			assert.Equal(t, "audio/mpeg", item.Enclosures[0].Type)
+		}
+		if assert.NotNil(t, item.ITunesExt) {
+			assert.Equal(t, "01:02:03", item.ITunesExt.Duration)
+		}
+	}
+	assert.Contains(t, raw, `<podcast:chapters url="https://example.com/chapters.json" type="application/json+chapters"`)
+	assert.Contains(t, raw, `<podcast:transcript url="https://example.com/transcript.vtt" type="text/vtt"`)
+	assert.Equal(t, 1, heads)
+
+	// The enclosure info is cached
+	app.cache.purge()
+	_, _ = fetchFeed()
+	assert.Equal(t, 1, heads)
+
+	// The section page links the podcast feed
+	var page string
+	err = requests.URL("http://localhost:8080/posts").Client(handlerClient).ToString(&page).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, page, `title="Podcast (Posts)" href=http://localhost:8080/posts.podcast`)
+}
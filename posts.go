@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"path"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/araddon/dateparse"
 	"github.com/go-chi/chi/v5"
 	"github.com/samber/lo"
 	"github.com/vcraescu/go-paginator/v2"
@@ -318,12 +322,18 @@ func (a *goBlog) serveIndex(w http.ResponseWriter, r *http.Request) {
 	if len(visibility) == 0 {
 		visibility = defaultVisibility
 	}
+	ft := feedType(chi.URLParam(r, "feed"))
+	parameter, pageSize := ic.parameter, bc.Pagination
+	if ft == podcastFeed {
+		// Podcast feeds only contain posts with audio, but more of them
+		parameter, pageSize = a.cfg.Micropub.AudioParam, podcastFeedLimit
+	}
 	p := paginator.New(&postPaginationAdapter{config: &postsRequestConfig{
 		blog:           blog,
 		sections:       sections,
 		taxonomy:       ic.tax,
 		taxonomyValue:  ic.taxValue,
-		parameter:      ic.parameter,
+		parameter:      parameter,
 		search:         search,
 		publishedYear:  ic.year,
 		publishedMonth: ic.month,
@@ -331,7 +341,7 @@ func (a *goBlog) serveIndex(w http.ResponseWriter, r *http.Request) {
 		status:         status,
 		visibility:     visibility,
 		priorityOrder:  true,
-	}, a: a}, bc.Pagination)
+	}, a: a}, pageSize)
 	p.SetPage(stringToInt(chi.URLParam(r, "page")))
 	var posts []*post
 	err := p.Results(&posts)
@@ -358,11 +368,6 @@ func (a *goBlog) serveIndex(w http.ResponseWriter, r *http.Request) {
 	} else if ic.section != nil {
 		description = ic.section.Description
 	}
-	// Check if feed
-	if ft := feedType(chi.URLParam(r, "feed")); ft != noFeed {
-		a.generateFeed(blog, ft, w, r, posts, title, description)
-		return
-	}
 	// Path
 	path := ic.path
 	if strings.Contains(path, searchPlaceholder) {
@@ -390,6 +395,25 @@ func (a *goBlog) serveIndex(w http.ResponseWriter, r *http.Request) {
 		nextPage, _ = p.Page()
 	}
 	nextPath = fmt.Sprintf("%s/page/%d", strings.TrimSuffix(path, "/"), nextPage)
+	// Validators
+	// No Last-Modified, deleting or unpublishing a post or changing settings doesn't make the newest post newer
+	eTag, lastModified := a.indexValidators(r, posts)
+	w.Header().Set("ETag", eTag)
+	if notModified(r, eTag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// Check if feed
+	if ft != noFeed {
+		lastPage, _ := p.PageNums()
+		paging := a.newFeedPaging(path, ft, hasPrev, hasNext, prevPage, nextPage, lastPage)
+		if ft == podcastFeed {
+			a.generatePodcastFeed(blog, w, r, posts, title, description, lastModified, paging)
+		} else {
+			a.generateFeed(blog, ft, w, r, posts, title, description, lastModified, paging)
+		}
+		return
+	}
 	summaryTemplate := ic.summaryTemplate
 	if summaryTemplate == "" {
 		summaryTemplate = defaultSummary
@@ -406,6 +430,36 @@ func (a *goBlog) serveIndex(w http.ResponseWriter, r *http.Request) {
 			prev:            prevPath,
 			next:            nextPath,
 			summaryTemplate: summaryTemplate,
+			podcast:         bc.podcastEnabled() && (ic.section != nil || ic.tax != nil) && search == "" && ic.year == 0 && ic.month == 0 && ic.day == 0,
 		},
 	})
 }
+
+// Returns an ETag derived from the posts on the page, so it doesn't change when the cache is purged,
+// and the time of the newest updated post
+func (a *goBlog) indexValidators(r *http.Request, posts []*post) (eTag string, lastModified time.Time) {
+	h := sha256.New()
+	for _, p := range posts {
+		if t, err := dateparse.ParseLocal(defaultIfEmpty(p.Updated, p.Published)); err == nil && t.After(lastModified) {
+			lastModified = t
+		}
+		_, _ = io.WriteString(h, p.Path+"\n")
+	}
+	_, _ = fmt.Fprintf(h, "%s %t %s", lastModified.UTC().Format(time.RFC3339), a.isLoggedIn(r), a.renderVersion())
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16]), lastModified
+}
+
+// Returns a version of everything besides the posts that rendered pages depend on:
+// the assets (their cache-busting hashes), the binary and configuration loaded at startup
+// and the settings changed at runtime
+func (a *goBlog) renderVersion() string {
+	a.renderVersionInit.Do(func() {
+		a.renderVersionSeed = randomString(16)
+	})
+	assets := lo.Values(a.assetFileNames)
+	sort.Strings(assets)
+	h := sha256.New()
+	_, _ = io.WriteString(h, strings.Join(assets, "\n"))
+	_, _ = fmt.Fprintf(h, "\n%s %d", a.renderVersionSeed, a.settingsVersion.Load())
+	return fmt.Sprintf("%x", h.Sum(nil)[:8])
+}
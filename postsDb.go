@@ -689,19 +689,28 @@ func (d *database) allTaxonomyValues(blog string, taxonomy string) ([]string, er
 
 const mediaUseSql = `
 with mediafiles (name) as (values %s)
-select name, count(path) as count from (
-    select distinct m.name, p.path
-    from mediafiles m, post_parameters p
-    where instr(p.value, m.name) > 0
-    union
-    select distinct m.name, p.path
-    from mediafiles m, posts_fts p
-    where p.content match '"' || m.name || '"'
-)
-group by name;
+select distinct m.name, p.path
+from mediafiles m, post_parameters p
+where instr(p.value, m.name) > 0
+union
+select distinct m.name, p.path
+from mediafiles m, posts_fts p
+where p.content match '"' || m.name || '"'
+order by 1, 2;
 `
 
 func (db *database) usesOfMediaFile(names ...string) (counts []int, err error) {
+	uses, err := db.postsUsingMediaFile(names...)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(uses, func(paths []string, _ int) int {
+		return len(paths)
+	}), nil
+}
+
+// Returns the paths of the posts that use the media files, in the same order as the names
+func (db *database) postsUsingMediaFile(names ...string) (uses [][]string, err error) {
 	sqlArgs := []any{dbNoCache}
 	nameValues := builderpool.Get()
 	defer builderpool.Put(nameValues)
@@ -719,20 +728,20 @@ func (db *database) usesOfMediaFile(names ...string) (counts []int, err error) {
 	if err != nil {
 		return nil, err
 	}
-	counts = make([]int, len(names))
-	var name string
-	var count int
+	defer rows.Close()
+	uses = make([][]string, len(names))
+	var name, path string
 	for rows.Next() {
-		err = rows.Scan(&name, &count)
+		err = rows.Scan(&name, &path)
 		if err != nil {
 			return nil, err
 		}
 		for i, n := range names {
 			if n == name {
-				counts[i] = count
+				uses[i] = append(uses[i], path)
 				break
 			}
 		}
 	}
-	return counts, nil
+	return uses, nil
 }
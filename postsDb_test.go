@@ -348,6 +348,13 @@ func Test_usesOfMediaFile(t *testing.T) {
 	if assert.NotEmpty(t, counts) {
 		assert.Equal(t, 2, counts[0])
 	}
+
+	uses, err := app.db.postsUsingMediaFile("test.jpg", "unused.jpg")
+	require.NoError(t, err)
+	if assert.Len(t, uses, 2) {
+		assert.Equal(t, []string{"/test/abc", "/test/def"}, uses[0])
+		assert.Empty(t, uses[1])
+	}
 }
 
 func Test_replaceParams(t *testing.T) {
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitComments     = "comments"
+	rateLimitContact      = "contact"
+	rateLimitReactions    = "reactions"
+	rateLimitWebmentions  = "webmentions"
+	rateLimitRemoteFollow = "remotefollow"
+	rateLimitInbox        = "inbox"
+	rateLimitWebSub       = "websub"
+
+	rateLimitCleanupInterval = 10 * time.Minute
+)
+
+// Requests per minute and burst per client, if not configured
+var defaultRateLimitBudgets = map[string]*configRateLimitBudget{
+	rateLimitComments:     {Requests: 3, Burst: 10},
+	rateLimitContact:      {Requests: 1, Burst: 3},
+	rateLimitReactions:    {Requests: 30, Burst: 30},
+	rateLimitWebmentions:  {Requests: 10, Burst: 30},
+	rateLimitRemoteFollow: {Requests: 3, Burst: 5},
+	rateLimitInbox:        {Requests: 300, Burst: 600},
+	rateLimitWebSub:       {Requests: 3, Burst: 10},
+}
+
+// Counters of allowed and limited requests per endpoint, served at /debug/vars of the pprof server
+var rateLimitCounters = expvar.NewMap("ratelimit")
+
+func (a *goBlog) rateLimitEnabled() bool {
+	return a.cfg.RateLimit != nil && a.cfg.RateLimit.Enabled
+}
+
+type rateLimiter struct {
+	rate        float64 // Tokens per second
+	burst       float64
+	mutex       sync.Mutex
+	buckets     map[string]*rateLimitBucket
+	lastCleanup time.Time
+}
+
+type rateLimitBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(budget *configRateLimitBudget) *rateLimiter {
+	burst := budget.Burst
+	if burst <= 0 {
+		burst = budget.Requests
+	}
+	return &rateLimiter{
+		rate:    float64(budget.Requests) / 60,
+		burst:   math.Max(1, float64(burst)),
+		buckets: map[string]*rateLimitBucket{},
+	}
+}
+
+// Takes a token from the bucket of the client, returns the time until the next token if the bucket is empty
+func (rl *rateLimiter) take(client string, now time.Time) (bool, time.Duration) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	// Forget clients with full buckets from time to time
+	if now.Sub(rl.lastCleanup) > rateLimitCleanupInterval {
+		for c, b := range rl.buckets {
+			if rl.refill(b, now) >= rl.burst {
+				delete(rl.buckets, c)
+			}
+		}
+		rl.lastCleanup = now
+	}
+	b, ok := rl.buckets[client]
+	if !ok {
+		b = &rateLimitBucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = b
+	}
+	b.tokens, b.last = rl.refill(b, now), now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+}
+
+func (rl *rateLimiter) refill(b *rateLimitBucket, now time.Time) float64 {
+	return math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+}
+
+func (a *goBlog) initRateLimit() {
+	a.rateLimitInit.Do(func() {
+		if !a.rateLimitEnabled() {
+			return
+		}
+		a.rateLimiters = map[string]*rateLimiter{}
+		for endpoint, budget := range defaultRateLimitBudgets {
+			if configured, ok := a.cfg.RateLimit.Endpoints[endpoint]; ok && configured != nil {
+				budget = configured
+			}
+			if budget.Requests <= 0 {
+				// Disabled for this endpoint
+				continue
+			}
+			a.rateLimiters[endpoint] = newRateLimiter(budget)
+		}
+	})
+}
+
+// Limits the requests per client to the budget of the endpoint, logged in users are not limited
+func (a *goBlog) rateLimitMiddleware(endpoint string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a.initRateLimit()
+			rl, ok := a.rateLimiters[endpoint]
+			if !ok || a.isLoggedIn(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if allowed, wait := rl.take(a.clientAddress(r), time.Now()); !allowed {
+				rateLimitCounters.Add(endpoint+".limited", 1)
+				a.debug("Rate limited request to", endpoint)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+				a.serveError(w, r, "", http.StatusTooManyRequests)
+				return
+			}
+			rateLimitCounters.Add(endpoint+".allowed", 1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Returns the IP address of the client, the X-Forwarded-For header is only used when the request comes from a trusted proxy
+func (a *goBlog) clientAddress(r *http.Request) string {
+	remoteAddr := r.RemoteAddr
+	if addr, ok := r.Context().Value(remoteAddrKey).(string); ok {
+		// Removed by the log middleware
+		remoteAddr = addr
+	}
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if a.isTrustedProxy(ip) {
+		// The rightmost address that isn't a trusted proxy is the client
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			forwardedIP := net.ParseIP(strings.TrimSpace(forwarded[i]))
+			if forwardedIP == nil {
+				break
+			}
+			ip = forwardedIP
+			if !a.isTrustedProxy(ip) {
+				break
+			}
+		}
+	}
+	if ip.To4() == nil {
+		// Clients usually get a whole IPv6 /64 network
+		ip = ip.Mask(net.CIDRMask(64, 128))
+	}
+	return ip.String()
+}
+
+func (a *goBlog) isTrustedProxy(ip net.IP) bool {
+	if a.cfg.RateLimit == nil {
+		return false
+	}
+	for _, network := range a.cfg.RateLimit.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rateLimiter(t *testing.T) {
+	rl := newRateLimiter(&configRateLimitBudget{Requests: 6, Burst: 2})
+	now := time.Now()
+
+	// Burst
+	allowed, _ := rl.take("a", now)
+	assert.True(t, allowed)
+	allowed, _ = rl.take("a", now)
+	assert.True(t, allowed)
+	allowed, wait := rl.take("a", now)
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, wait)
+
+	// Other clients have their own bucket
+	allowed, _ = rl.take("b", now)
+	assert.True(t, allowed)
+
+	// Refill
+	allowed, _ = rl.take("a", now.Add(10*time.Second))
+	assert.True(t, allowed)
+	allowed, _ = rl.take("a", now.Add(10*time.Second))
+	assert.False(t, allowed)
+
+	// Full buckets are removed
+	_, _ = rl.take("c", now.Add(time.Hour))
+	assert.Len(t, rl.buckets, 1)
+}
+
+func Test_clientAddress(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.RateLimit = &configRateLimit{
+		TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8", "::1"},
+	}
+	require.NoError(t, app.initConfig(false))
+
+	client := func(remoteAddr string, forwarded ...string) string {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remoteAddr
+		for _, f := range forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		return app.clientAddress(req)
+	}
+
+	assert.Equal(t, "203.0.113.1", client("203.0.113.1:1234"))
+	// Header of untrusted clients is ignored
+	assert.Equal(t, "203.0.113.1", client("203.0.113.1:1234", "198.51.100.1"))
+	// Header of trusted proxies is used
+	assert.Equal(t, "198.51.100.1", client("127.0.0.1:1234", "198.51.100.1"))
+	assert.Equal(t, "198.51.100.1", client("[::1]:1234", "198.51.100.1"))
+	// Spoofed addresses left of the client are ignored
+	assert.Equal(t, "198.51.100.1", client("127.0.0.1:1234", "192.0.2.1, 198.51.100.1, 10.0.0.2"))
+	assert.Equal(t, "198.51.100.1", client("127.0.0.1:1234", "192.0.2.1", "198.51.100.1"))
+	// Only proxies
+	assert.Equal(t, "10.0.0.2", client("127.0.0.1:1234", "10.0.0.2"))
+	// IPv6 clients are grouped by network
+	assert.Equal(t, "2001:db8:1:2::", client("[2001:db8:1:2:3:4:5:6]:1234"))
+	// Address removed by the log middleware
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = ""
+	req = req.WithContext(context.WithValue(req.Context(), remoteAddrKey, "203.0.113.2:1234"))
+	assert.Equal(t, "203.0.113.2", app.clientAddress(req))
+}
+
+func Test_rateLimitMiddleware(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.RateLimit = &configRateLimit{
+		Enabled: true,
+		Endpoints: map[string]*configRateLimitBudget{
+			rateLimitComments: {Requests: 1, Burst: 2},
+			rateLimitContact:  {Requests: -1},
+		},
+	}
+	err := app.initConfig(false)
+	require.NoError(t, err)
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	app.initSessions()
+
+	r := chi.NewRouter()
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	r.With(app.rateLimitMiddleware(rateLimitComments)).Post("/comment", handler)
+	r.With(app.rateLimitMiddleware(rateLimitContact)).Post("/contact", handler)
+	r.With(app.rateLimitMiddleware(rateLimitWebmentions)).Post("/webmention", handler)
+
+	do := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Counters are global
+	limited := func() int64 {
+		if v, ok := rateLimitCounters.Get(rateLimitComments + ".limited").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	limitedBefore := limited()
+
+	assert.Equal(t, http.StatusOK, do("/comment", "203.0.113.1:1").Code)
+	assert.Equal(t, http.StatusOK, do("/comment", "203.0.113.1:2").Code)
+	rec := do("/comment", "203.0.113.1:3")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, do("/comment", "203.0.113.2:1").Code)
+
+	assert.Equal(t, limitedBefore+1, limited())
+
+	// Disabled endpoint
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, do("/contact", "203.0.113.1:1").Code)
+	}
+
+	// Default budget
+	for i := 0; i < defaultRateLimitBudgets[rateLimitWebmentions].Burst; i++ {
+		assert.Equal(t, http.StatusOK, do("/webmention", "203.0.113.1:1").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, do("/webmention", "203.0.113.1:1").Code)
+}
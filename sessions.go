@@ -52,6 +52,16 @@ func (a *goBlog) initSessions() {
 		},
 		db: a.db,
 	}
+	a.commenterSessions = &dbSessionStore{
+		options: &sessions.Options{
+			Secure:   a.useSecureCookies(),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   int((30 * 24 * time.Hour).Seconds()),
+			Path:     "/", // Cookie for all pages
+		},
+		db: a.db,
+	}
 }
 
 type dbSessionStore struct {
@@ -15,6 +15,15 @@ func (a *goBlog) serveSettings(w http.ResponseWriter, r *http.Request) {
 	sections := lo.Values(bc.Sections)
 	sort.Slice(sections, func(i, j int) bool { return sections[i].Name < sections[j].Name })
 
+	var blogroll []*blogrollItem
+	if bc.blogrollInDatabase() {
+		var err error
+		if blogroll, err = a.db.getBlogrollItems(blog); err != nil {
+			a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	a.render(w, r, a.renderSettings, &renderData{
 		Data: &settingsRenderData{
 			blog:                  blog,
@@ -29,6 +38,7 @@ func (a *goBlog) serveSettings(w http.ResponseWriter, r *http.Request) {
 			addLikeContext:        bc.addLikeContext,
 			userNick:              a.cfg.User.Nick,
 			userName:              a.cfg.User.Name,
+			blogroll:              blogroll,
 		},
 	})
 }
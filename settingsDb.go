@@ -59,7 +59,11 @@ func (a *goBlog) saveSettingValue(name, value string) error {
 		sql.Named("value", value),
 		sql.Named("value2", value),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	a.settingsVersion.Add(1)
+	return nil
 }
 
 func (a *goBlog) saveBooleanSettingValue(name string, value bool) error {
@@ -74,6 +78,7 @@ func (a *goBlog) loadSections() error {
 		}
 		bc.Sections = sections
 	}
+	a.settingsVersion.Add(1)
 	return nil
 }
 
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/builderpool"
+)
+
+const (
+	defaultSpamThreshold   = 0.9
+	defaultSpamMaxLinks    = 3
+	defaultSpamMinInterval = 30 // Seconds
+
+	spamMaxTokens      = 500
+	spamInterestingLen = 15
+)
+
+func (a *goBlog) spamFilterEnabled() bool {
+	return a.cfg.SpamFilter != nil && a.cfg.SpamFilter.Enabled
+}
+
+var (
+	spamWordRegex = regexp.MustCompile(`[\p{L}\p{N}][\p{L}\p{N}'_-]{2,29}`)
+	spamLinkRegex = regexp.MustCompile(`(?i)https?://[^\s"'<>]+`)
+)
+
+// Splits the text into unique tokens, links are represented by their domain
+func spamTokens(text string) []string {
+	links := spamLinkRegex.FindAllString(text, -1)
+	tokens := []string{}
+	for _, link := range links {
+		if u, err := url.Parse(link); err == nil && u.Hostname() != "" {
+			tokens = append(tokens, "domain:"+strings.ToLower(u.Hostname()))
+		}
+	}
+	for _, word := range spamWordRegex.FindAllString(strings.ToLower(spamLinkRegex.ReplaceAllString(text, " ")), -1) {
+		tokens = append(tokens, word)
+	}
+	tokens = lo.Uniq(tokens)
+	if len(tokens) > spamMaxTokens {
+		tokens = tokens[:spamMaxTokens]
+	}
+	return tokens
+}
+
+// Returns the probability of the text being spam based on the learned tokens (naive Bayes),
+// 0.5 if there isn't enough training data
+func (db *database) spamProbability(text string) (float64, error) {
+	// Count trained documents
+	var spamDocs, hamDocs int
+	row, err := db.QueryRow("select coalesce(sum(spam), 0), count(*) - coalesce(sum(spam), 0) from spam_trained")
+	if err != nil {
+		return 0, err
+	}
+	if err = row.Scan(&spamDocs, &hamDocs); err != nil {
+		return 0, err
+	}
+	tokens := spamTokens(text)
+	if spamDocs == 0 || hamDocs == 0 || len(tokens) == 0 {
+		return 0.5, nil
+	}
+	// Get token counts
+	queryBuilder := builderpool.Get()
+	defer builderpool.Put(queryBuilder)
+	queryBuilder.WriteString("select spam, ham from spam_tokens where token in (")
+	args := []any{}
+	for i, token := range tokens {
+		if i > 0 {
+			queryBuilder.WriteString(", ")
+		}
+		named := fmt.Sprintf("token%d", i)
+		queryBuilder.WriteString("@" + named)
+		args = append(args, sql.Named(named, token))
+	}
+	queryBuilder.WriteString(")")
+	rows, err := db.Query(queryBuilder.String(), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	probabilities := []float64{}
+	for rows.Next() {
+		var spam, ham int
+		if err = rows.Scan(&spam, &ham); err != nil {
+			return 0, err
+		}
+		if spam+ham == 0 {
+			continue
+		}
+		// Robinson's token probability with a weak prior of 0.5
+		s, g := float64(spam)/float64(spamDocs), float64(ham)/float64(hamDocs)
+		n := float64(spam + ham)
+		p := (0.5 + n*(s/(s+g))) / (1 + n)
+		probabilities = append(probabilities, math.Min(math.Max(p, 0.01), 0.99))
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(probabilities) == 0 {
+		return 0.5, nil
+	}
+	// Use the most interesting tokens
+	sort.Slice(probabilities, func(i, j int) bool {
+		return math.Abs(probabilities[i]-0.5) > math.Abs(probabilities[j]-0.5)
+	})
+	if len(probabilities) > spamInterestingLen {
+		probabilities = probabilities[:spamInterestingLen]
+	}
+	// Combine probabilities
+	eta := 0.0
+	for _, p := range probabilities {
+		eta += math.Log(1-p) - math.Log(p)
+	}
+	return 1 / (1 + math.Exp(eta)), nil
+}
+
+// Learns the tokens of the text as spam or ham, key identifies the document so it isn't learned twice.
+// Everything happens in one transaction, so concurrent training of the same document can't count it twice.
+func (db *database) spamTrain(key, text string, spam bool) error {
+	tokens := spamTokens(text)
+	return db.transaction(func(tx *sql.Tx) error {
+		// Check if already trained
+		var trainedSpam bool
+		trained := true
+		if err := tx.QueryRow("select spam from spam_trained where key = @key", sql.Named("key", key)).Scan(&trainedSpam); errors.Is(err, sql.ErrNoRows) {
+			trained = false
+		} else if err != nil {
+			return err
+		}
+		if trained && trainedSpam == spam {
+			return nil
+		}
+		// Update token counts
+		spamDelta, hamDelta := 1, 0
+		if !spam {
+			spamDelta, hamDelta = 0, 1
+		}
+		if trained {
+			// Move tokens to the other class
+			spamDelta, hamDelta = spamDelta-hamDelta, hamDelta-spamDelta
+		}
+		for _, token := range tokens {
+			if _, err := tx.Exec(
+				"insert into spam_tokens (token, spam, ham) values (@token, max(0, @spam), max(0, @ham)) on conflict (token) do update set spam = max(0, spam + @spam), ham = max(0, ham + @ham)",
+				sql.Named("token", token), sql.Named("spam", spamDelta), sql.Named("ham", hamDelta),
+			); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(
+			"insert or replace into spam_trained (key, spam) values (@key, @spam)",
+			sql.Named("key", key), sql.Named("spam", spam),
+		)
+		return err
+	})
+}
+
+// Returns the spam score of a submission by combining the learned probability with heuristics,
+// client is used to detect fast repeated submissions and can be empty
+func (a *goBlog) spamScore(text, client string) float64 {
+	sf := a.cfg.SpamFilter
+	score, err := a.db.spamProbability(text)
+	if err != nil {
+		score = 0.5
+	}
+	// Blocked domains
+	links := spamLinkRegex.FindAllString(text, -1)
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		for _, blocked := range sf.BlockedDomains {
+			blocked = strings.ToLower(blocked)
+			if host == blocked || strings.HasSuffix(host, "."+blocked) {
+				return 1
+			}
+		}
+	}
+	// Number of links
+	maxLinks := sf.MaxLinks
+	if maxLinks == 0 {
+		maxLinks = defaultSpamMaxLinks
+	}
+	if len(links) > maxLinks {
+		score += 0.1 * float64(len(links)-maxLinks)
+	}
+	// Submission speed
+	if client != "" && a.spamTooFast(client) {
+		score += 0.3
+	}
+	return math.Min(score, 1)
+}
+
+// Checks if the client already submitted something shortly before and records the submission
+func (a *goBlog) spamTooFast(client string) bool {
+	interval := time.Duration(a.cfg.SpamFilter.MinInterval) * time.Second
+	if interval == 0 {
+		interval = defaultSpamMinInterval * time.Second
+	}
+	a.spamClientsMutex.Lock()
+	defer a.spamClientsMutex.Unlock()
+	now := time.Now()
+	if a.spamClients == nil {
+		a.spamClients = map[string]time.Time{}
+	}
+	// Remove old entries
+	for c, t := range a.spamClients {
+		if now.Sub(t) > interval {
+			delete(a.spamClients, c)
+		}
+	}
+	_, tooFast := a.spamClients[client]
+	a.spamClients[client] = now
+	return tooFast
+}
+
+// Checks if the submission is spam, always false if the spam filter is disabled
+func (a *goBlog) isSpam(text, client string) bool {
+	if !a.spamFilterEnabled() {
+		return false
+	}
+	threshold := a.cfg.SpamFilter.Threshold
+	if threshold == 0 {
+		threshold = defaultSpamThreshold
+	}
+	return a.spamScore(text, client) >= threshold
+}
+
+// Learns from an admin action, does nothing if the spam filter is disabled
+func (a *goBlog) spamLearn(key, text string, spam bool) {
+	if !a.spamFilterEnabled() {
+		return
+	}
+	if err := a.db.spamTrain(key, text, spam); err != nil {
+		log.Println("Failed to train spam filter:", err.Error())
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+func Test_spamTokens(t *testing.T) {
+	tokens := spamTokens("Buy CHEAP pills at https://Pills.example.com/buy now, buy!")
+	assert.ElementsMatch(t, []string{"domain:pills.example.com", "buy", "cheap", "pills", "now"}, tokens)
+}
+
+func Test_spamFilter(t *testing.T) {
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.SpamFilter = &configSpamFilter{
+		Enabled:        true,
+		BlockedDomains: []string{"blocked.example"},
+	}
+	app.cfg.RateLimit = &configRateLimit{
+		// Only for the client address, rate limiting is disabled
+		TrustedProxies: []string{"127.0.0.1"},
+	}
+	app.cfg.Blogs = map[string]*configBlog{
+		"en": {
+			Lang: "en",
+			Comments: &configComments{
+				Enabled: true,
+			},
+			Contact: &configContact{
+				Enabled: true,
+			},
+		},
+	}
+	app.cfg.DefaultBlog = "en"
+
+	err := app.initConfig(false)
+	require.NoError(t, err)
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	t.Run("Heuristics", func(t *testing.T) {
+		// Untrained filter is neutral
+		assert.Equal(t, 0.5, app.spamScore("Hello there", ""))
+		// Blocked domains
+		assert.Equal(t, 1.0, app.spamScore("Visit https://www.blocked.example/", ""))
+		// Links
+		assert.InDelta(t, 0.7, app.spamScore("https://a.example https://b.example https://c.example https://d.example https://e.example", ""), 0.001)
+		// Submission speed
+		assert.Equal(t, 0.5, app.spamScore("Hello there", "192.0.2.1"))
+		assert.Equal(t, 0.8, app.spamScore("Hello there", "192.0.2.1"))
+		assert.Equal(t, 0.5, app.spamScore("Hello there", "192.0.2.2"))
+	})
+
+	t.Run("Learning", func(t *testing.T) {
+		require.NoError(t, app.db.spamTrain("a", "cheap pills casino bonus", true))
+		require.NoError(t, app.db.spamTrain("b", "great article thanks for sharing", false))
+		require.NoError(t, app.db.spamTrain("c", "casino bonus free spins", true))
+		require.NoError(t, app.db.spamTrain("d", "thanks for the article about go", false))
+		// Training twice doesn't change anything
+		require.NoError(t, app.db.spamTrain("a", "cheap pills casino bonus", true))
+
+		spamProb, err := app.db.spamProbability("free casino bonus")
+		require.NoError(t, err)
+		hamProb, err := app.db.spamProbability("thanks for the great article")
+		require.NoError(t, err)
+		assert.Greater(t, spamProb, 0.9)
+		assert.Less(t, hamProb, 0.1)
+
+		// Moving a document to the other class
+		require.NoError(t, app.db.spamTrain("d", "thanks for the article about go", true))
+		var spam, ham int
+		row, err := app.db.QueryRow("select spam, ham from spam_tokens where token = 'about'")
+		require.NoError(t, err)
+		require.NoError(t, row.Scan(&spam, &ham))
+		assert.Equal(t, 1, spam)
+		assert.Equal(t, 0, ham)
+		require.NoError(t, app.db.spamTrain("d", "thanks for the article about go", false))
+
+		// Concurrent training of the same document only counts once
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, app.db.spamTrain("e", "concurrent training", true))
+			}()
+		}
+		wg.Wait()
+		row, err = app.db.QueryRow("select spam, ham from spam_tokens where token = 'concurrent'")
+		require.NoError(t, err)
+		require.NoError(t, row.Scan(&spam, &ham))
+		assert.Equal(t, 1, spam)
+		assert.Equal(t, 0, ham)
+	})
+
+	t.Run("Comments", func(t *testing.T) {
+		data := url.Values{}
+		data.Add("target", "http://localhost:8080/test")
+		data.Add("comment", "Free casino bonus, cheap pills")
+		req := httptest.NewRequest(http.MethodPost, commentPath, strings.NewReader(data.Encode()))
+		req.Header.Add(contentType, contenttype.WWWForm)
+		rec := httptest.NewRecorder()
+		app.createCommentFromRequest(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		comments, err := app.db.getComments(&commentsRequestConfig{})
+		require.NoError(t, err)
+		require.Len(t, comments, 1)
+		assert.Equal(t, commentStatusSpam, comments[0].Status)
+
+		// No notification
+		notifications, err := app.db.getNotifications(&notificationsRequestConfig{})
+		require.NoError(t, err)
+		assert.Len(t, notifications, 0)
+
+		// Approving learns the comment as ham
+		mux := chi.NewMux()
+		mux.Use(middleware.WithValue(blogKey, "en"))
+		mux.Post("/comment"+commentApproveSubPath, app.commentsAdminApprove)
+		req = httptest.NewRequest(http.MethodPost, "/comment"+commentApproveSubPath, strings.NewReader("commentid=1"))
+		req.Header.Add(contentType, contenttype.WWWForm)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusFound, rec.Code)
+
+		var spam bool
+		row, err := app.db.QueryRow("select spam from spam_trained where key = 'comment:1'")
+		require.NoError(t, err)
+		require.NoError(t, row.Scan(&spam))
+		assert.False(t, spam)
+	})
+
+	t.Run("Contact", func(t *testing.T) {
+		data := url.Values{}
+		data.Add("message", "Casino bonus at https://casino.blocked.example")
+		req := httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(data.Encode()))
+		req.Header.Add(contentType, contenttype.WWWForm)
+		rec := httptest.NewRecorder()
+		app.sendContactSubmission(rec, req.WithContext(context.WithValue(req.Context(), blogKey, "en")))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		messages, err := app.db.getContactSpam("en", 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Contains(t, messages[0].Message, "Casino bonus")
+
+		notifications, err := app.db.getNotifications(&notificationsRequestConfig{})
+		require.NoError(t, err)
+		assert.Len(t, notifications, 0)
+
+		// Delete as spam
+		mux := chi.NewMux()
+		mux.Use(middleware.WithValue(blogKey, "en"))
+		mux.Post("/contact/spam/{action}", app.contactSpamAction)
+		req = httptest.NewRequest(http.MethodPost, "/contact/spam/delete", strings.NewReader("id=1"))
+		req.Header.Add(contentType, contenttype.WWWForm)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusFound, rec.Code)
+
+		messages, err = app.db.getContactSpam("en", 0)
+		require.NoError(t, err)
+		assert.Len(t, messages, 0)
+
+		var spam bool
+		row, err := app.db.QueryRow("select spam from spam_trained where key = 'contact:1'")
+		require.NoError(t, err)
+		require.NoError(t, row.Scan(&spam))
+		assert.True(t, spam)
+	})
+
+	t.Run("Client address with logging", func(t *testing.T) {
+		logf, err := rotatelogs.New(filepath.Join(t.TempDir(), "access.log.%Y%m%d"))
+		require.NoError(t, err)
+		app.logf = logf
+
+		handler := app.logMiddleware(middleware.WithValue(blogKey, "en")(http.HandlerFunc(app.createCommentFromRequest)))
+		post := func(remoteAddr, forwarded string) {
+			req := httptest.NewRequest(http.MethodPost, commentPath, strings.NewReader(url.Values{"target": {"http://localhost:8080/test"}, "comment": {"Hello there"}}.Encode()))
+			req.Header.Add(contentType, contenttype.WWWForm)
+			req.RemoteAddr = remoteAddr
+			if forwarded != "" {
+				req.Header.Set("X-Forwarded-For", forwarded)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		post("192.0.2.10:1234", "")
+		post("127.0.0.1:1234", "192.0.2.11")
+
+		app.spamClientsMutex.Lock()
+		defer app.spamClientsMutex.Unlock()
+		assert.Contains(t, app.spamClients, "192.0.2.10")
+		assert.Contains(t, app.spamClients, "192.0.2.11")
+		assert.NotContains(t, app.spamClients, "")
+		assert.NotContains(t, app.spamClients, "127.0.0.1")
+	})
+}
@@ -0,0 +1,30 @@
+(function () {
+    const form = document.querySelector('form#captchapow')
+    if (!form) return
+    const challenge = form.dataset.challenge
+    const difficulty = parseInt(form.dataset.difficulty)
+    const encoder = new TextEncoder()
+
+    // Count the leading zero bits of the hash
+    const zeroBits = (hash) => {
+        let bits = 0
+        for (const byte of new Uint8Array(hash)) {
+            if (byte !== 0) return bits + Math.clz32(byte) - 24
+            bits += 8
+        }
+        return bits
+    }
+
+    // Find a nonce, so that the hash of challenge and nonce has enough leading zero bits
+    const solve = async () => {
+        for (let nonce = 0; ; nonce++) {
+            const hash = await crypto.subtle.digest('SHA-256', encoder.encode(challenge + nonce))
+            if (zeroBits(hash) >= difficulty) return nonce
+        }
+    }
+
+    solve().then(nonce => {
+        form.querySelector('input[name=pownonce]').value = nonce
+        form.submit()
+    })
+})()
\ No newline at end of file
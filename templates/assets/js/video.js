@@ -10,6 +10,9 @@
         let videoEl = document.createElement('video')
         videoEl.controls = true
         videoEl.classList.add('fw')
+        if (videoDivEl.dataset.poster) {
+            videoEl.poster = videoDivEl.dataset.poster
+        }
 
         // Load video
         if (Hls.isSupported()) {
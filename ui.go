@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -49,6 +51,10 @@ func (a *goBlog) renderBase(hb *htmlbuilder.HtmlBuilder, rd *renderData, title,
 	hb.WriteElementOpen("link", "rel", "webmention", "href", a.getFullAddress("/webmention"))
 	// Micropub
 	hb.WriteElementOpen("link", "rel", "micropub", "href", a.getFullAddress("/micropub"))
+	// Microsub
+	if a.microsubEnabled() {
+		hb.WriteElementOpen("link", "rel", "microsub", "href", a.getFullAddress(microsubPath))
+	}
 	// IndieAuth
 	hb.WriteElementOpen("link", "rel", "authorization_endpoint", "href", a.getFullAddress("/indieauth"))
 	hb.WriteElementOpen("link", "rel", "token_endpoint", "href", a.getFullAddress("/indieauth/token"))
@@ -287,7 +293,17 @@ func (a *goBlog) renderComment(h *htmlbuilder.HtmlBuilder, rd *renderData) {
 			hb.WriteElementOpen("main", "class", "h-entry")
 			// Target
 			hb.WriteElementOpen("p")
-			hb.WriteElementOpen("a", "class", "u-in-reply-to", "href", a.getFullAddress(c.Target))
+			if c.Parent != 0 {
+				// Reply to another comment
+				parentURL := a.getFullAddress(rd.Blog.getRelativePath(fmt.Sprintf("%s/%d", commentPath, c.Parent)))
+				hb.WriteElementOpen("a", "class", "u-in-reply-to", "href", parentURL)
+				hb.WriteEscaped(parentURL)
+				hb.WriteElementClose("a")
+				hb.WriteElementOpen("br")
+				hb.WriteElementOpen("a", "href", a.getFullAddress(c.Target))
+			} else {
+				hb.WriteElementOpen("a", "class", "u-in-reply-to", "href", a.getFullAddress(c.Target))
+			}
 			hb.WriteEscaped(a.getFullAddress(c.Target))
 			hb.WriteElementClose("a")
 			hb.WriteElementClose("p")
@@ -295,6 +311,10 @@ func (a *goBlog) renderComment(h *htmlbuilder.HtmlBuilder, rd *renderData) {
 			hb.WriteElementOpen("p", "class", "p-author h-card")
 			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "acommentby"))
 			hb.WriteUnescaped(" ")
+			if c.Verified && c.Photo != "" {
+				hb.WriteElementOpen("img", "class", "u-photo", "src", c.Photo, "alt", "", "width", "24", "height", "24", "loading", "lazy")
+				hb.WriteUnescaped(" ")
+			}
 			if c.Website != "" {
 				hb.WriteElementOpen("a", "class", "p-name u-url", "target", "_blank", "rel", "nofollow noopener noreferrer ugc", "href", c.Website)
 				hb.WriteEscaped(c.Name)
@@ -304,12 +324,32 @@ func (a *goBlog) renderComment(h *htmlbuilder.HtmlBuilder, rd *renderData) {
 				hb.WriteEscaped(c.Name)
 				hb.WriteElementClose("span")
 			}
+			if c.Verified {
+				// Commenter signed in with the website
+				hb.WriteUnescaped(" ")
+				hb.WriteElementOpen("span", "class", "verified", "title", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "verified"))
+				hb.WriteEscaped("✔")
+				hb.WriteElementClose("span")
+			}
 			hb.WriteEscaped(":")
 			hb.WriteElementClose("p")
 			// Content
 			hb.WriteElementOpen("p", "class", "e-content")
 			hb.WriteUnescaped(c.Comment) // Already escaped
 			hb.WriteElementClose("p")
+			// Edited
+			if c.Edited != 0 {
+				hb.WriteElementOpen("p")
+				hb.WriteElementOpen("small")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "edited"))
+				hb.WriteEscaped(" ")
+				edited := time.Unix(c.Edited, 0)
+				hb.WriteElementOpen("time", "class", "dt-updated", "datetime", edited.UTC().Format(time.RFC3339))
+				hb.WriteEscaped(edited.Local().Format(isoDateFormat))
+				hb.WriteElementClose("time")
+				hb.WriteElementClose("small")
+				hb.WriteElementClose("p")
+			}
 			// Original
 			if c.Original != "" {
 				hb.WriteElementOpen("p", "class", "")
@@ -326,6 +366,13 @@ func (a *goBlog) renderComment(h *htmlbuilder.HtmlBuilder, rd *renderData) {
 				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "edit"))
 				hb.WriteElementClose("a")
 				hb.WriteElementClose("div")
+			} else if a.commenterToken(rd.req, rd.Blog, c) != "" {
+				// Commenter with edit token
+				hb.WriteElementOpen("div", "class", "actions")
+				hb.WriteElementOpen("a", "class", "button", "href", rd.Blog.getRelativePath(fmt.Sprintf("%s/%d%s", commentPath, c.ID, commentManageSubPath)))
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "editcommenttitle"))
+				hb.WriteElementClose("a")
+				hb.WriteElementClose("div")
 			}
 			// Interactions
 			if rd.Blog.commentsEnabled() {
@@ -335,12 +382,127 @@ func (a *goBlog) renderComment(h *htmlbuilder.HtmlBuilder, rd *renderData) {
 	)
 }
 
+func (a *goBlog) renderCommentPending(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	target, _ := rd.Data.(string)
+	a.renderBase(
+		hb, rd, nil,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementsOpen("main", "p")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentpending"))
+			hb.WriteElementClose("p")
+			if target != "" {
+				hb.WriteElementOpen("p")
+				hb.WriteElementOpen("a", "href", target)
+				hb.WriteEscaped(target)
+				hb.WriteElementClose("a")
+				hb.WriteElementClose("p")
+			}
+			hb.WriteElementClose("main")
+		},
+	)
+}
+
+func (a *goBlog) renderCommentSignIn(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	sd, ok := rd.Data.(*commentSignInRenderData)
+	if !ok {
+		return
+	}
+	a.renderBase(
+		hb, rd,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			a.renderTitleTag(hb, rd.Blog, a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsigninwithdomain"))
+		},
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementOpen("main")
+			hb.WriteElementOpen("h1")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsigninwithdomain"))
+			hb.WriteElementClose("h1")
+			switch {
+			case sd.emailSent:
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(fmt.Sprintf(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsigninemailsent"), sd.email))
+				hb.WriteElementClose("p")
+			case sd.email != "":
+				// Confirm the address for the sign in email
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(fmt.Sprintf(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsigninemailconfirm"), sd.email))
+				hb.WriteElementClose("p")
+				hb.WriteElementOpen("form", "class", "fw p", "method", "post", "action", rd.Blog.getRelativePath(commentPath+commentSignInSubPath))
+				hb.WriteElementOpen("input", "type", "hidden", "name", "redirect", "value", sd.redirect)
+				hb.WriteElementOpen("input", "type", "hidden", "name", "me", "value", sd.me)
+				hb.WriteElementOpen("input", "type", "hidden", "name", "email", "value", sd.email)
+				hb.WriteElementOpen("input", "type", "hidden", "name", "confirm", "value", "1")
+				hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsigninemailsend"))
+				hb.WriteElementClose("form")
+			case sd.commenter != nil:
+				// Signed in
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsignedinas"))
+				hb.WriteUnescaped(" ")
+				hb.WriteElementOpen("a", "href", sd.commenter.Me, "target", "_blank", "rel", "nofollow noopener noreferrer ugc")
+				hb.WriteEscaped(sd.commenter.Name)
+				hb.WriteElementClose("a")
+				hb.WriteEscaped(" ✔")
+				hb.WriteElementClose("p")
+				hb.WriteElementOpen("form", "class", "fw p", "method", "post", "action", rd.Blog.getRelativePath(commentPath+commentSignOutSubPath))
+				hb.WriteElementOpen("input", "type", "hidden", "name", "redirect", "value", sd.redirect)
+				hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "logout"))
+				hb.WriteElementClose("form")
+			default:
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsignindesc"))
+				hb.WriteElementClose("p")
+				hb.WriteElementOpen("form", "class", "fw p", "method", "post", "action", rd.Blog.getRelativePath(commentPath+commentSignInSubPath))
+				hb.WriteElementOpen("input", "type", "hidden", "name", "redirect", "value", sd.redirect)
+				hb.WriteElementOpen("input", "type", "url", "name", "me", "placeholder", "https://example.com/", "required", "")
+				hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "login"))
+				hb.WriteElementClose("form")
+			}
+			hb.WriteElementOpen("p")
+			hb.WriteElementOpen("a", "href", sd.redirect)
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "back"))
+			hb.WriteElementClose("a")
+			hb.WriteElementClose("p")
+			hb.WriteElementClose("main")
+		},
+	)
+}
+
+func (a *goBlog) renderCommentSubscription(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	message, _ := rd.Data.(string)
+	a.renderBase(
+		hb, rd, nil,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementsOpen("main", "p")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, message))
+			hb.WriteElementsClose("p", "main")
+		},
+	)
+}
+
+func (a *goBlog) renderCommentSubscriptionConfirm(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	token, _ := rd.Data.(string)
+	a.renderBase(
+		hb, rd, nil,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementsOpen("main", "p")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "subscriptionconfirm"))
+			hb.WriteElementClose("p")
+			hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+			hb.WriteElementOpen("input", "type", "hidden", "name", "token", "value", token)
+			hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "subscriptionconfirmbutton"))
+			hb.WriteElementsClose("form", "main")
+		},
+	)
+}
+
 type indexRenderData struct {
 	title, description string
 	posts              []*post
 	hasPrev, hasNext   bool
 	first, prev, next  string
 	summaryTemplate    summaryTyp
+	podcast            bool
 }
 
 func (a *goBlog) renderIndex(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
@@ -362,6 +524,9 @@ func (a *goBlog) renderIndex(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 			hb.WriteElementOpen("link", "rel", "alternate", "type", "application/rss+xml", "title", "RSS"+feedTitle, "href", a.getFullAddress(id.first+".rss"))
 			hb.WriteElementOpen("link", "rel", "alternate", "type", "application/atom+xml", "title", "ATOM"+feedTitle, "href", a.getFullAddress(id.first+".atom"))
 			hb.WriteElementOpen("link", "rel", "alternate", "type", "application/feed+json", "title", "JSON Feed"+feedTitle, "href", a.getFullAddress(id.first+".json"))
+			if id.podcast {
+				hb.WriteElementOpen("link", "rel", "alternate", "type", "application/rss+xml", "title", "Podcast"+feedTitle, "href", a.getFullAddress(id.first+".podcast"))
+			}
 		},
 		func(hb *htmlbuilder.HtmlBuilder) {
 			hb.WriteElementOpen("main", "class", "h-feed")
@@ -607,6 +772,9 @@ type blogrollRenderData struct {
 	description string
 	outlines    []*opml.Outline
 	download    string
+	latest      map[string]*blogrollEntry
+	latestPath  string
+	icons       map[string]string
 }
 
 func (a *goBlog) renderBlogroll(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
@@ -639,6 +807,12 @@ func (a *goBlog) renderBlogroll(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 			hb.WriteElementOpen("a", "href", rd.Blog.getRelativePath(bd.download), "class", "button", "download", "")
 			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "download"))
 			hb.WriteElementClose("a")
+			if bd.latestPath != "" {
+				hb.WriteUnescaped(" ")
+				hb.WriteElementOpen("a", "href", bd.latestPath, "class", "button")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrolllatest"))
+				hb.WriteElementClose("a")
+			}
 			hb.WriteElementClose("p")
 			// Outlines
 			for _, outline := range bd.outlines {
@@ -656,14 +830,36 @@ func (a *goBlog) renderBlogroll(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 						subTitle = subOutline.Text
 					}
 					hb.WriteElementOpen("li")
-					hb.WriteElementOpen("a", "href", subOutline.HTMLURL, "target", "_blank")
-					hb.WriteEscaped(subTitle)
-					hb.WriteElementClose("a")
-					hb.WriteUnescaped(" (")
-					hb.WriteElementOpen("a", "href", subOutline.XMLURL, "target", "_blank")
-					hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "feed"))
-					hb.WriteElementClose("a")
-					hb.WriteUnescaped(")")
+					if icon := bd.icons[blogrollOutlineKey(subOutline)]; icon != "" {
+						hb.WriteElementOpen("img", "src", icon, "alt", "", "width", 16, "height", 16, "loading", "lazy")
+						hb.WriteUnescaped(" ")
+					}
+					if subOutline.HTMLURL != nil {
+						hb.WriteElementOpen("a", "href", subOutline.HTMLURL, "target", "_blank")
+						hb.WriteEscaped(subTitle)
+						hb.WriteElementClose("a")
+					} else {
+						hb.WriteEscaped(subTitle)
+					}
+					if subOutline.XMLURL != nil {
+						hb.WriteUnescaped(" (")
+						hb.WriteElementOpen("a", "href", subOutline.XMLURL, "target", "_blank")
+						hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "feed"))
+						hb.WriteElementClose("a")
+						hb.WriteUnescaped(")")
+					}
+					// Latest post
+					if subOutline.XMLURL != nil {
+						if latest, ok := bd.latest[subOutline.XMLURL.String()]; ok {
+							hb.WriteElementOpen("br")
+							hb.WriteElementOpen("small")
+							hb.WriteElementOpen("a", "href", latest.URL, "target", "_blank")
+							hb.WriteEscaped(defaultIfEmpty(latest.Title, latest.URL))
+							hb.WriteElementClose("a")
+							hb.WriteEscaped(", " + time.Unix(latest.Published, 0).Local().Format(isoDateFormat))
+							hb.WriteElementClose("small")
+						}
+					}
 					hb.WriteElementClose("li")
 				}
 				hb.WriteElementClose("ul")
@@ -740,11 +936,58 @@ func (a *goBlog) renderContactSent(hb *htmlbuilder.HtmlBuilder, rd *renderData)
 	)
 }
 
+func (a *goBlog) renderContactSpam(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	messages, ok := rd.Data.([]*contactSpam)
+	if !ok {
+		return
+	}
+	spamPath := rd.Blog.getRelativePath(defaultIfEmpty(rd.Blog.Contact.Path, defaultContactPath) + contactSpamPath)
+	a.renderBase(
+		hb, rd,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			a.renderTitleTag(hb, rd.Blog, a.ts.GetTemplateStringVariant(rd.Blog.Lang, "spam"))
+		},
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementOpen("main")
+			// Title
+			hb.WriteElementOpen("h1")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "spam"))
+			hb.WriteElementClose("h1")
+			// Messages
+			tdLocale := matchTimeDiffLocale(rd.Blog.Lang)
+			for _, m := range messages {
+				hb.WriteElementOpen("div", "class", "p")
+				// Date
+				hb.WriteElementOpen("p")
+				hb.WriteElementOpen("i")
+				hb.WriteEscaped(timediff.TimeDiff(time.Unix(m.Created, 0), timediff.WithLocale(tdLocale)))
+				hb.WriteElementClose("i")
+				hb.WriteElementClose("p")
+				// Message
+				hb.WriteElementOpen("pre")
+				hb.WriteEscaped(m.Message)
+				hb.WriteElementClose("pre")
+				// Actions
+				hb.WriteElementOpen("form", "class", "actions", "method", "post")
+				hb.WriteElementOpen("input", "type", "hidden", "name", "id", "value", m.ID)
+				hb.WriteElementOpen("input", "type", "submit", "formaction", spamPath+"/deliver", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "notspam"))
+				hb.WriteElementOpen("input", "type", "submit", "formaction", spamPath+"/delete", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"))
+				hb.WriteElementClose("form")
+				hb.WriteElementClose("div")
+			}
+			hb.WriteElementClose("main")
+		},
+	)
+}
+
 type captchaRenderData struct {
-	captchaMethod  string
-	captchaHeaders string
-	captchaBody    string
-	captchaId      string
+	captchaMode       string
+	captchaMethod     string
+	captchaHeaders    string
+	captchaBody       string
+	captchaId         string
+	captchaChallenge  string
+	captchaDifficulty int
 }
 
 func (a *goBlog) renderCaptcha(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
@@ -759,27 +1002,77 @@ func (a *goBlog) renderCaptcha(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 		},
 		func(hb *htmlbuilder.HtmlBuilder) {
 			hb.WriteElementOpen("main")
-			// Captcha image
-			hb.WriteElementOpen("p")
-			hb.WriteElementOpen("img", "src", "/captcha/"+crd.captchaId+".png", "class", "captchaimg")
-			hb.WriteElementClose("p")
-			// Form
-			hb.WriteElementOpen("form", "class", "fw p", "method", "post")
-			// Hidden fields
-			hb.WriteElementOpen("input", "type", "hidden", "name", "captchaaction", "value", "captcha")
-			hb.WriteElementOpen("input", "type", "hidden", "name", "captchamethod", "value", crd.captchaMethod)
-			hb.WriteElementOpen("input", "type", "hidden", "name", "captchaheaders", "value", crd.captchaHeaders)
-			hb.WriteElementOpen("input", "type", "hidden", "name", "captchabody", "value", crd.captchaBody)
-			// Text
-			hb.WriteElementOpen("input", "type", "text", "name", "digits", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchainstructions"), "required", "")
-			// Submit
-			hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "submit"))
-			hb.WriteElementClose("form")
+			switch crd.captchaMode {
+			case captchaModePoW:
+				// Description
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchapow"))
+				hb.WriteElementClose("p")
+				hb.WriteElementOpen("noscript")
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchapownoscript"))
+				hb.WriteElementClose("p")
+				hb.WriteElementClose("noscript")
+				// Form, submitted by the script when solved
+				hb.WriteElementOpen("form", "id", "captchapow", "class", "fw p", "method", "post", "data-challenge", crd.captchaChallenge, "data-difficulty", crd.captchaDifficulty)
+				a.renderCaptchaHiddenFields(hb, crd)
+				hb.WriteElementOpen("input", "type", "hidden", "name", "pownonce", "value", "")
+				hb.WriteElementClose("form")
+				hb.WriteElementOpen("script", "src", a.assetFileName("js/captcha.js"), "defer", "")
+				hb.WriteElementClose("script")
+			case captchaModeHoneypot:
+				// Description
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchahoneypot"))
+				hb.WriteElementClose("p")
+				// Form
+				hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+				a.renderCaptchaHiddenFields(hb, crd)
+				// Field for bots, hidden for humans
+				hb.WriteElementOpen("div", "class", "hide", "aria-hidden", "true")
+				hb.WriteElementOpen("label", "for", "captcha-"+captchaHoneypotField)
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchahoneypotfield"))
+				hb.WriteElementClose("label")
+				hb.WriteElementOpen("input", "type", "text", "id", "captcha-"+captchaHoneypotField, "name", captchaHoneypotField, "value", "", "tabindex", "-1", "autocomplete", "off")
+				hb.WriteElementClose("div")
+				// Submit
+				hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "submit"))
+				hb.WriteElementClose("form")
+			default:
+				// Captcha image
+				hb.WriteElementOpen("p")
+				hb.WriteElementOpen("img", "src", "/captcha/"+crd.captchaId+".png", "class", "captchaimg", "alt", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchaimage"))
+				hb.WriteElementClose("p")
+				// Audio fallback, unsupported languages fall back to English
+				audioLang, _, _ := strings.Cut(rd.Blog.Lang, "-")
+				hb.WriteElementOpen("details")
+				hb.WriteElementOpen("summary")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchaaudio"))
+				hb.WriteElementClose("summary")
+				hb.WriteElementOpen("audio", "controls", "", "preload", "none", "class", "fw", "src", "/captcha/"+crd.captchaId+".wav?lang="+url.QueryEscape(audioLang))
+				hb.WriteElementClose("audio")
+				hb.WriteElementClose("details")
+				// Form
+				hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+				a.renderCaptchaHiddenFields(hb, crd)
+				// Text
+				hb.WriteElementOpen("input", "type", "text", "name", "digits", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "captchainstructions"), "inputmode", "numeric", "autocomplete", "off", "required", "")
+				// Submit
+				hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "submit"))
+				hb.WriteElementClose("form")
+			}
 			hb.WriteElementClose("main")
 		},
 	)
 }
 
+func (*goBlog) renderCaptchaHiddenFields(hb *htmlbuilder.HtmlBuilder, crd *captchaRenderData) {
+	hb.WriteElementOpen("input", "type", "hidden", "name", "captchaaction", "value", "captcha")
+	hb.WriteElementOpen("input", "type", "hidden", "name", "captchamethod", "value", crd.captchaMethod)
+	hb.WriteElementOpen("input", "type", "hidden", "name", "captchaheaders", "value", crd.captchaHeaders)
+	hb.WriteElementOpen("input", "type", "hidden", "name", "captchabody", "value", crd.captchaBody)
+}
+
 type taxonomyRenderData struct {
 	taxonomy    *configTaxonomy
 	valueGroups []stringGroup
@@ -848,6 +1141,9 @@ func (a *goBlog) renderPost(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 			if su := a.shortPostURL(p); su != "" {
 				hb.WriteElementOpen("link", "rel", "shortlink", "href", su)
 			}
+			if a.hasPublicInteractions(p) {
+				hb.WriteElementOpen("link", "rel", "alternate", "type", "application/rss+xml", "title", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "interactionsfeed"), "href", a.interactionsFeedURL(p, rssFeed))
+			}
 		},
 		func(origHb *htmlbuilder.HtmlBuilder) {
 			// Wrap plugins
@@ -1052,8 +1348,9 @@ func (a *goBlog) renderIndieAuth(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 }
 
 type editorFilesRenderData struct {
-	files []*mediaFile
-	uses  []int
+	files []*mediaEntry
+	uses  [][]string
+	query string
 }
 
 func (a *goBlog) renderEditorFiles(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
@@ -1072,38 +1369,172 @@ func (a *goBlog) renderEditorFiles(hb *htmlbuilder.HtmlBuilder, rd *renderData)
 			hb.WriteElementOpen("h1")
 			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "mediafiles"))
 			hb.WriteElementClose("h1")
+			// Search
+			hb.WriteElementOpen("form", "method", "get", "class", "fw p")
+			hb.WriteElementOpen("input", "type", "text", "name", "q", "value", ef.query, "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "search"))
+			hb.WriteElementOpen("input", "type", "submit", "value", "🔍 "+a.ts.GetTemplateStringVariant(rd.Blog.Lang, "search"))
+			hb.WriteElementClose("form")
+			// Unused files
+			if a.mediaGcEnabled() {
+				hb.WriteElementOpen("p")
+				hb.WriteElementOpen("a", "href", rd.Blog.getRelativePath(editorPath+mediaOrphansPath))
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "unusedfiles"))
+				hb.WriteElementClose("a")
+				hb.WriteElementClose("p")
+			}
 			// Files
-			if len(ef.files) > 0 {
-				// Form
-				hb.WriteElementOpen("form", "method", "post", "class", "fw p")
-				// Select with number of uses
-				hb.WriteElementOpen("select", "name", "filename")
-				usesString := a.ts.GetTemplateStringVariant(rd.Blog.Lang, "fileuses")
-				for i, f := range ef.files {
-					hb.WriteElementOpen("option", "value", f.Name)
-					hb.WriteEscaped(fmt.Sprintf("%s (%s), %s, ~%d %s", f.Name, f.Time.Local().Format(isoDateFormat), mBytesString(f.Size), ef.uses[i], usesString))
-					hb.WriteElementClose("option")
+			if len(ef.files) == 0 {
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "nofiles"))
+				hb.WriteElementClose("p")
+				hb.WriteElementClose("main")
+				return
+			}
+			usesString := a.ts.GetTemplateStringVariant(rd.Blog.Lang, "fileuses")
+			for i, e := range ef.files {
+				location := a.mediaFileLocation(e.Name)
+				hb.WriteElementOpen("div", "class", "p border-bottom")
+				// Thumbnail
+				if strings.HasPrefix(e.MimeType, "image/") {
+					hb.WriteElementOpen("a", "href", location)
+					hb.WriteElementOpen("img", "src", location, "alt", e.Alt, "class", "thumb", "loading", "lazy")
+					hb.WriteElementClose("a")
+				}
+				// File info
+				hb.WriteElementOpen("p")
+				hb.WriteElementOpen("a", "href", location)
+				hb.WriteEscaped(lo.If(e.Filename != "", e.Filename).Else(e.Name))
+				hb.WriteElementClose("a")
+				hb.WriteEscaped(fmt.Sprintf(" (%s), %s", toLocalTime(e.Uploaded).Format(isoDateFormat), mBytesString(e.Size)))
+				if e.Width > 0 && e.Height > 0 {
+					hb.WriteEscaped(fmt.Sprintf(", %d×%d", e.Width, e.Height))
 				}
-				hb.WriteElementClose("select")
-				// View button
+				hb.WriteElementClose("p")
+				// EXIF suggestions
+				if !e.Exif.empty() {
+					hb.WriteElementOpen("p")
+					hb.WriteEscaped(strings.Join(lo.Compact([]string{e.Exif.Published, e.Exif.Location, e.Exif.Camera}), ", "))
+					hb.WriteEscaped(" (")
+					hb.WriteElementOpen("a", "href", rd.Blog.getRelativePath(editorPath)+"?"+a.exifEditorQuery(location, &e.Exif))
+					hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "exifnewpost"))
+					hb.WriteElementClose("a")
+					hb.WriteEscaped(")")
+					hb.WriteElementClose("p")
+				}
+				// Uses
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(fmt.Sprintf("~%d %s", len(ef.uses[i]), usesString))
+				for j, use := range ef.uses[i] {
+					hb.WriteEscaped(lo.If(j == 0, ": ").Else(", "))
+					hb.WriteElementOpen("a", "href", use)
+					hb.WriteEscaped(use)
+					hb.WriteElementClose("a")
+				}
+				hb.WriteElementClose("p")
+				// Alt text and delete
+				hb.WriteElementOpen("form", "method", "post", "class", "fw")
+				hb.WriteElementOpen("input", "type", "hidden", "name", "filename", "value", e.Name)
+				hb.WriteElementOpen("input", "type", "text", "name", "alt", "value", e.Alt, "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "alttext"))
+				hb.WriteElementOpen("div", "class", "actions")
 				hb.WriteElementOpen(
-					"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "view"),
-					"formaction", rd.Blog.getRelativePath("/editor/files/view"),
+					"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "update"),
+					"formaction", rd.Blog.getRelativePath("/editor/files/alt"),
 				)
-				// Delete button
 				hb.WriteElementOpen(
 					"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"),
 					"formaction", rd.Blog.getRelativePath("/editor/files/delete"),
 					"class", "confirm", "data-confirmmessage", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "confirmdelete"),
 				)
-				hb.WriteElementOpen("script", "src", a.assetFileName("js/formconfirm.js"), "defer", "")
-				hb.WriteElementClose("script")
+				hb.WriteElementClose("div")
 				hb.WriteElementClose("form")
-			} else {
+				hb.WriteElementClose("div")
+			}
+			hb.WriteElementOpen("script", "src", a.assetFileName("js/formconfirm.js"), "defer", "")
+			hb.WriteElementClose("script")
+			hb.WriteElementClose("main")
+		},
+	)
+}
+
+type editorFilesOrphansRenderData struct {
+	orphans []*mediaEntry
+}
+
+func (a *goBlog) renderEditorFilesOrphans(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
+	od, ok := rd.Data.(*editorFilesOrphansRenderData)
+	if !ok {
+		return
+	}
+	a.renderBase(
+		hb, rd,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			a.renderTitleTag(hb, rd.Blog, a.ts.GetTemplateStringVariant(rd.Blog.Lang, "unusedfiles"))
+		},
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementOpen("main")
+			// Title
+			hb.WriteElementOpen("h1")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "unusedfiles"))
+			hb.WriteElementClose("h1")
+			grace, deletion := a.mediaGcPeriods()
+			hb.WriteElementOpen("p")
+			hb.WriteEscaped(fmt.Sprintf(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "unusedfilesdesc"), int(grace.Hours()/24), int(deletion.Hours()/24)))
+			hb.WriteElementClose("p")
+			// Check now
+			hb.WriteElementOpen("form", "method", "post", "class", "fw p")
+			hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "checknow"))
+			hb.WriteElementClose("form")
+			// Files
+			if len(od.orphans) == 0 {
 				hb.WriteElementOpen("p")
-				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "nofiles"))
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "nounusedfiles"))
+				hb.WriteElementClose("p")
+				hb.WriteElementClose("main")
+				return
+			}
+			for _, e := range od.orphans {
+				hb.WriteElementOpen("div", "class", "p border-bottom")
+				// File info
+				hb.WriteElementOpen("p")
+				if e.Quarantined != "" {
+					// Not accessible anymore
+					hb.WriteEscaped(lo.If(e.Filename != "", e.Filename).Else(e.Name))
+				} else {
+					hb.WriteElementOpen("a", "href", a.mediaFileLocation(e.Name))
+					hb.WriteEscaped(lo.If(e.Filename != "", e.Filename).Else(e.Name))
+					hb.WriteElementClose("a")
+				}
+				hb.WriteElementClose("p")
+				hb.WriteElementOpen("p")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "unusedsince"))
+				hb.WriteEscaped(": ")
+				hb.WriteEscaped(toLocalSafe(e.Orphaned))
+				if quarantined, err := time.Parse(time.RFC3339, e.Quarantined); err == nil {
+					hb.WriteEscaped(", ")
+					hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "scheduleddeletion"))
+					hb.WriteEscaped(": ")
+					hb.WriteEscaped(quarantined.Add(deletion).Local().Format(isoDateFormat))
+				}
 				hb.WriteElementClose("p")
+				// Keep and delete
+				hb.WriteElementOpen("form", "method", "post", "class", "fw")
+				hb.WriteElementOpen("input", "type", "hidden", "name", "filename", "value", e.Name)
+				hb.WriteElementOpen("div", "class", "actions")
+				hb.WriteElementOpen(
+					"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "keep"),
+					"formaction", rd.Blog.getRelativePath("/editor/files/keep"),
+				)
+				hb.WriteElementOpen(
+					"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"),
+					"formaction", rd.Blog.getRelativePath("/editor/files/delete"),
+					"class", "confirm", "data-confirmmessage", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "confirmdelete"),
+				)
+				hb.WriteElementClose("div")
+				hb.WriteElementClose("form")
+				hb.WriteElementClose("div")
 			}
+			hb.WriteElementOpen("script", "src", a.assetFileName("js/formconfirm.js"), "defer", "")
+			hb.WriteElementClose("script")
 			hb.WriteElementClose("main")
 		},
 	)
@@ -1165,6 +1596,7 @@ func (a *goBlog) renderNotificationsAdmin(hb *htmlbuilder.HtmlBuilder, rd *rende
 
 type commentsRenderData struct {
 	comments         []*comment
+	status           commentStatus
 	hasPrev, hasNext bool
 	prev, next       string
 }
@@ -1185,13 +1617,42 @@ func (a *goBlog) renderCommentsAdmin(hb *htmlbuilder.HtmlBuilder, rd *renderData
 			hb.WriteElementOpen("h1")
 			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "comments"))
 			hb.WriteElementClose("h1")
+			// Status filter
+			commentsPath := rd.Blog.getRelativePath(commentPath)
+			hb.WriteElementOpen("p")
+			for i, status := range []commentStatus{"", commentStatusPending, commentStatusApproved, commentStatusSpam} {
+				if i > 0 {
+					hb.WriteEscaped(" • ")
+				}
+				title := a.ts.GetTemplateStringVariant(rd.Blog.Lang, defaultIfEmpty(string(status), "all"))
+				if status == crd.status {
+					hb.WriteElementOpen("strong")
+					hb.WriteEscaped(title)
+					hb.WriteElementClose("strong")
+					continue
+				}
+				href := commentsPath
+				if status != "" {
+					href += "?status=" + string(status)
+				}
+				hb.WriteElementOpen("a", "href", href)
+				hb.WriteEscaped(title)
+				hb.WriteElementClose("a")
+			}
+			hb.WriteElementClose("p")
 			// Comments
 			for _, c := range crd.comments {
-				hb.WriteElementOpen("div", "class", "p")
+				hb.WriteElementOpen("div", "id", fmt.Sprintf("comment-%d", c.ID), "class", "p")
 				// ID, Target, Name
 				hb.WriteElementOpen("p")
 				hb.WriteEscaped("ID: ")
+				hb.WriteElementOpen("a", "href", rd.Blog.getRelativePath(fmt.Sprintf("%s/%d", commentPath, c.ID)))
 				hb.WriteEscaped(fmt.Sprintf("%d", c.ID))
+				hb.WriteElementClose("a")
+				hb.WriteElementOpen("br")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "status"))
+				hb.WriteEscaped(": ")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, string(c.Status)))
 				hb.WriteElementOpen("br")
 				hb.WriteEscaped("Target: ")
 				hb.WriteElementOpen("a", "href", c.Target, "target", "_blank")
@@ -1206,6 +1667,10 @@ func (a *goBlog) renderCommentsAdmin(hb *htmlbuilder.HtmlBuilder, rd *renderData
 				if c.Website != "" {
 					hb.WriteElementClose("a")
 				}
+				if c.Verified {
+					hb.WriteEscaped(" ✔ ")
+					hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "verified"))
+				}
 				if c.Original != "" {
 					hb.WriteElementOpen("br")
 					hb.WriteEscaped("Original: ")
@@ -1218,11 +1683,29 @@ func (a *goBlog) renderCommentsAdmin(hb *htmlbuilder.HtmlBuilder, rd *renderData
 				hb.WriteElementOpen("p")
 				hb.WriteUnescaped(c.Comment)
 				hb.WriteElementClose("p")
-				// Delete form
-				hb.WriteElementOpen("form", "class", "actions", "method", "post", "action", rd.Blog.getRelativePath(commentPath+commentDeleteSubPath))
+				// Actions
+				hb.WriteElementOpen("form", "class", "actions", "method", "post", "action", commentsPath+commentDeleteSubPath)
 				hb.WriteElementOpen("input", "type", "hidden", "name", "commentid", "value", c.ID)
+				if crd.status != "" {
+					hb.WriteElementOpen("input", "type", "hidden", "name", "redir", "value", commentsPath+"?status="+string(crd.status))
+				}
+				if c.Status != commentStatusApproved {
+					hb.WriteElementOpen("input", "type", "submit", "formaction", commentsPath+commentApproveSubPath, "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "approve"))
+				}
+				if c.Status != commentStatusSpam {
+					hb.WriteElementOpen("input", "type", "submit", "formaction", commentsPath+commentSpamSubPath, "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "markasspam"))
+				}
 				hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"))
 				hb.WriteElementClose("form")
+				// Reply form
+				if c.Status == commentStatusApproved {
+					hb.WriteElementOpen("form", "class", "fw p", "method", "post", "action", commentsPath+commentReplySubPath)
+					hb.WriteElementOpen("input", "type", "hidden", "name", "commentid", "value", c.ID)
+					hb.WriteElementOpen("textarea", "name", "comment", "required", "", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "reply"))
+					hb.WriteElementClose("textarea")
+					hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "reply"))
+					hb.WriteElementClose("form")
+				}
 				hb.WriteElementClose("div")
 			}
 			// Pagination
@@ -1308,10 +1791,14 @@ func (a *goBlog) renderWebmentionAdmin(hb *htmlbuilder.HtmlBuilder, rd *renderDa
 				hb.WriteElementOpen("form", "method", "post", "class", "actions")
 				hb.WriteElementOpen("input", "type", "hidden", "name", "mentionid", "value", m.ID)
 				hb.WriteElementOpen("input", "type", "hidden", "name", "redir", "value", fmt.Sprintf("%s#mention-%d", wrd.current, m.ID))
-				if m.Status == webmentionStatusVerified {
+				if m.Status == webmentionStatusVerified || m.Status == webmentionStatusSpam {
 					// Approve verified mention
 					hb.WriteElementOpen("input", "type", "submit", "formaction", "/webmention/approve", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "approve"))
 				}
+				if m.Status != webmentionStatusSpam {
+					// Mark mention as spam
+					hb.WriteElementOpen("input", "type", "submit", "formaction", "/webmention/spam", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "markasspam"))
+				}
 				// Delete mention
 				hb.WriteElementOpen("input", "type", "submit", "formaction", "/webmention/delete", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"))
 				// Reverify mention
@@ -1432,6 +1919,13 @@ func (a *goBlog) renderEditor(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 			hb.WriteElementOpen("form", "class", "fw p", "method", "post", "enctype", "multipart/form-data")
 			hb.WriteElementOpen("input", "type", "hidden", "name", "editoraction", "value", "upload")
 			hb.WriteElementOpen("input", "type", "file", "name", "file")
+			hb.WriteElementOpen("input", "type", "text", "name", "alt", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "alttextopt"))
+			hb.WriteElementOpen("p")
+			hb.WriteElementOpen("input", "type", "checkbox", "name", "mp-keep-exif", "value", "true", "id", "keepexif")
+			hb.WriteElementOpen("label", "for", "keepexif")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "keepexif"))
+			hb.WriteElementClose("label")
+			hb.WriteElementClose("p")
 			hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "upload"))
 			hb.WriteElementClose("form")
 			// Media files
@@ -1490,6 +1984,7 @@ type settingsRenderData struct {
 	addLikeContext        bool
 	userNick              string
 	userName              string
+	blogroll              []*blogrollItem
 }
 
 func (a *goBlog) renderSettings(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
@@ -1571,6 +2066,11 @@ func (a *goBlog) renderSettings(hb *htmlbuilder.HtmlBuilder, rd *renderData) {
 			// Post sections
 			a.renderPostSectionSettings(hb, rd, srd)
 
+			// Blogroll
+			if rd.Blog.blogrollInDatabase() {
+				a.renderBlogrollSettings(hb, rd, srd)
+			}
+
 			// Scripts
 			hb.WriteElementOpen("script", "src", a.assetFileName("js/settings.js"), "defer", "")
 			hb.WriteElementClose("script")
@@ -1648,6 +2148,53 @@ func (a *goBlog) renderActivityPubRemoteFollow(hb *htmlbuilder.HtmlBuilder, rd *
 	)
 }
 
+func (a *goBlog) renderCommentManage(h *htmlbuilder.HtmlBuilder, rd *renderData) {
+	md, ok := rd.Data.(*commentManageRenderData)
+	if !ok {
+		return
+	}
+	c := md.comment
+	a.renderBase(
+		h, rd,
+		func(hb *htmlbuilder.HtmlBuilder) {
+			a.renderTitleTag(hb, rd.Blog, a.ts.GetTemplateStringVariant(rd.Blog.Lang, "editcommenttitle"))
+		},
+		func(hb *htmlbuilder.HtmlBuilder) {
+			hb.WriteElementOpen("main")
+			hb.WriteElementOpen("h1")
+			hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "editcommenttitle"))
+			hb.WriteElementClose("h1")
+			// Edit window
+			hb.WriteElementOpen("p")
+			hb.WriteEscaped(fmt.Sprintf(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commenteditableuntil"), md.until.Local().Format("2006-01-02 15:04")))
+			hb.WriteElementClose("p")
+			// Edit
+			hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+			hb.WriteElementOpen("input", "type", "hidden", "name", "token", "value", md.token)
+			hb.WriteElementOpen("input", "type", "hidden", "name", "action", "value", "edit")
+			hb.WriteElementOpen("input", "type", "text", "name", "name", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "nameopt"), "value", c.Name)
+			hb.WriteElementOpen("input", "type", "url", "name", "website", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "websiteopt"), "value", c.Website)
+			hb.WriteElementOpen("textarea", "name", "comment", "required", "", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "comment"))
+			hb.WriteEscaped(c.Comment)
+			hb.WriteElementClose("textarea")
+			hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "update"))
+			hb.WriteElementClose("form")
+			// Delete
+			hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+			hb.WriteElementOpen("input", "type", "hidden", "name", "token", "value", md.token)
+			hb.WriteElementOpen("input", "type", "hidden", "name", "action", "value", "delete")
+			hb.WriteElementOpen(
+				"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"),
+				"class", "confirm", "data-confirmmessage", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "confirmdelete"),
+			)
+			hb.WriteElementClose("form")
+			hb.WriteElementOpen("script", "src", a.assetFileName("js/formconfirm.js"), "defer", "")
+			hb.WriteElementClose("script")
+			hb.WriteElementClose("main")
+		},
+	)
+}
+
 func (a *goBlog) renderCommentEditor(h *htmlbuilder.HtmlBuilder, rd *renderData) {
 	c, ok := rd.Data.(*comment)
 	if !ok {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -346,6 +347,13 @@ func (a *goBlog) renderInteractions(hb *htmlbuilder.HtmlBuilder, rd *renderData)
 				hb.WriteEscaped(mention.Content)
 				hb.WriteElementClose("i")
 			}
+			if _, _, ok := a.localCommentID(mention.Source); ok {
+				// Link to the comment to reply
+				hb.WriteUnescaped(" ")
+				hb.WriteElementOpen("a", "href", mention.Source+"#interactions", "class", "comment-reply")
+				hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "reply"))
+				hb.WriteElementClose("a")
+			}
 			if len(mention.Submentions) > 0 {
 				renderMentions(mention.Submentions)
 			}
@@ -354,6 +362,14 @@ func (a *goBlog) renderInteractions(hb *htmlbuilder.HtmlBuilder, rd *renderData)
 		hb.WriteElementClose("ul")
 	}
 	renderMentions(a.db.getWebmentionsByAddress(rd.Canonical))
+	// Link the feed of the interactions
+	if p, ok := rd.Data.(*post); ok && a.hasPublicInteractions(p) {
+		hb.WriteElementOpen("p")
+		hb.WriteElementOpen("a", "href", a.interactionsFeedURL(p, rssFeed))
+		hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "interactionsfeed"))
+		hb.WriteElementClose("a")
+		hb.WriteElementClose("p")
+	}
 	// Show form to send a webmention
 	hb.WriteElementOpen("form", "class", "fw p", "method", "post", "action", "/webmention")
 	hb.WriteElementOpen("label", "for", "wm-source", "class", "p")
@@ -365,11 +381,35 @@ func (a *goBlog) renderInteractions(hb *htmlbuilder.HtmlBuilder, rd *renderData)
 	hb.WriteElementClose("form")
 	// Show form to create a new comment
 	hb.WriteElementOpen("form", "class", "fw p", "method", "post", "action", rd.Blog.getRelativePath(commentPath))
-	hb.WriteElementOpen("input", "type", "hidden", "name", "target", "value", rd.Canonical)
+	if c, ok := rd.Data.(*comment); ok {
+		// Reply to the comment
+		hb.WriteElementOpen("input", "type", "hidden", "name", "target", "value", a.getFullAddress(c.Target))
+		hb.WriteElementOpen("input", "type", "hidden", "name", "parent", "value", c.ID)
+	} else {
+		hb.WriteElementOpen("input", "type", "hidden", "name", "target", "value", rd.Canonical)
+	}
+	if rd.Blog.commentsSignInEnabled() {
+		// Sign in with the website instead of name and website
+		hb.WriteElementOpen("p")
+		hb.WriteElementOpen("a", "href", rd.Blog.getRelativePath(commentPath+commentSignInSubPath)+"?redirect="+url.QueryEscape(rd.Canonical+"#interactions"))
+		hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "commentsigninwithdomain"))
+		hb.WriteElementClose("a")
+		hb.WriteElementClose("p")
+	}
 	hb.WriteElementOpen("input", "type", "text", "name", "name", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "nameopt"))
 	hb.WriteElementOpen("input", "type", "url", "name", "website", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "websiteopt"))
 	hb.WriteElementOpen("textarea", "name", "comment", "required", "", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "comment"))
 	hb.WriteElementClose("textarea")
+	if rd.Blog.commentsEmailEnabled() {
+		// Reply notifications
+		hb.WriteElementOpen("input", "type", "email", "name", "email", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "emailopt"))
+		hb.WriteElementOpen("p")
+		hb.WriteElementOpen("input", "type", "checkbox", "name", "notify", "value", "true", "id", "comment-notify")
+		hb.WriteElementOpen("label", "for", "comment-notify")
+		hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "notifyreplies"))
+		hb.WriteElementClose("label")
+		hb.WriteElementClose("p")
+	}
 	hb.WriteElementOpen("input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "docomment"))
 	hb.WriteElementClose("form")
 	// Finish accordion
@@ -532,7 +572,7 @@ func (a *goBlog) renderPostVideo(hb *htmlbuilder.HtmlBuilder, p *post) {
 	if !p.hasVideoPlaylist() {
 		return
 	}
-	hb.WriteElementOpen("div", "id", "video", "data-url", p.firstParameter(videoPlaylistParam))
+	hb.WriteElementOpen("div", "id", "video", "data-url", p.firstParameter(videoPlaylistParam), "data-poster", p.firstParameter(videoPosterParam))
 	hb.WriteElementClose("div")
 	hb.WriteElementOpen("script", "defer", "", "src", a.assetFileName("js/video.js"))
 	hb.WriteElementClose("script")
@@ -688,6 +728,83 @@ func (a *goBlog) renderUserSettings(hb *htmlbuilder.HtmlBuilder, rd *renderData,
 	hb.WriteElementClose("form")
 }
 
+func (a *goBlog) renderBlogrollSettings(hb *htmlbuilder.HtmlBuilder, rd *renderData, srd *settingsRenderData) {
+	hb.WriteElementOpen("h2")
+	hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogroll"))
+	hb.WriteElementClose("h2")
+
+	// Existing categories for autocompletion
+	hb.WriteElementOpen("datalist", "id", "blogrollcategories")
+	for _, category := range lo.Uniq(lo.Map(srd.blogroll, func(i *blogrollItem, _ int) string { return i.Category })) {
+		hb.WriteElementOpen("option", "value", category)
+		hb.WriteElementClose("option")
+	}
+	hb.WriteElementClose("datalist")
+
+	for _, item := range srd.blogroll {
+		hb.WriteElementOpen("details")
+
+		hb.WriteElementOpen("summary")
+		hb.WriteElementOpen("h3")
+		hb.WriteEscaped(fmt.Sprintf("%s (%s)", item.Title, item.Category))
+		hb.WriteElementClose("h3")
+		hb.WriteElementClose("summary")
+
+		hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+		hb.WriteElementOpen("input", "type", "hidden", "name", "id", "value", item.ID)
+		hb.WriteElementOpen("input", "type", "text", "name", "category", "list", "blogrollcategories", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollcategory"), "required", "", "value", item.Category)
+		hb.WriteElementOpen("input", "type", "text", "name", "title", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrolltitle"), "required", "", "value", item.Title)
+		hb.WriteElementOpen("input", "type", "url", "name", "url", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollwebsite"), "value", item.URL)
+		hb.WriteElementOpen("input", "type", "url", "name", "feed", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollfeed"), "value", item.Feed)
+		hb.WriteElementOpen("input", "type", "url", "name", "icon", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollicon"), "value", item.Icon)
+		// Actions
+		hb.WriteElementOpen("div", "class", "p")
+		// Update
+		hb.WriteElementOpen(
+			"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "update"),
+			"formaction", rd.Blog.getRelativePath(settingsPath+settingsUpdateBlogrollItemPath),
+		)
+		// Delete
+		hb.WriteElementOpen(
+			"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "delete"),
+			"formaction", rd.Blog.getRelativePath(settingsPath+settingsDeleteBlogrollItemPath),
+			"class", "confirm", "data-confirmmessage", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "confirmdelete"),
+		)
+		hb.WriteElementClose("div")
+		hb.WriteElementClose("form")
+
+		hb.WriteElementClose("details")
+	}
+
+	// Add new item
+	hb.WriteElementOpen("form", "class", "fw p", "method", "post")
+	hb.WriteElementOpen("input", "type", "url", "name", "url", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollwebsite"), "required", "")
+	hb.WriteElementOpen("input", "type", "text", "name", "category", "list", "blogrollcategories", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollcategory"), "required", "")
+	hb.WriteElementOpen("input", "type", "text", "name", "title", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrolltitle"))
+	hb.WriteElementOpen("input", "type", "url", "name", "feed", "placeholder", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollfeed"))
+	hb.WriteElementOpen("p")
+	hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrolldiscoverdesc"))
+	hb.WriteElementClose("p")
+	hb.WriteElementOpen(
+		"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "create"),
+		"formaction", rd.Blog.getRelativePath(settingsPath+settingsCreateBlogrollItemPath),
+	)
+	hb.WriteElementClose("form")
+
+	// Import OPML
+	hb.WriteElementOpen("h3")
+	hb.WriteEscaped(a.ts.GetTemplateStringVariant(rd.Blog.Lang, "blogrollimport"))
+	hb.WriteElementClose("h3")
+
+	hb.WriteElementOpen("form", "class", "fw p", "method", "post", "enctype", "multipart/form-data")
+	hb.WriteElementOpen("input", "type", "file", "name", "file", "accept", ".opml,.xml", "required", "")
+	hb.WriteElementOpen(
+		"input", "type", "submit", "value", a.ts.GetTemplateStringVariant(rd.Blog.Lang, "upload"),
+		"formaction", rd.Blog.getRelativePath(settingsPath+settingsImportBlogrollPath),
+	)
+	hb.WriteElementClose("form")
+}
+
 func (a *goBlog) renderFooter(origHb *htmlbuilder.HtmlBuilder, rd *renderData) {
 	// Wrap plugins
 	hb, finish := a.wrapForPlugins(origHb, a.getPlugins(pluginUiFooterType), func(plugin any, doc *goquery.Document) {
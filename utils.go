@@ -72,6 +72,15 @@ func isAbsoluteURL(s string) bool {
 	return true
 }
 
+// Checks if a redirect stays on the same origin, browsers treat backslashes like slashes
+func isLocalRedirect(s string) bool {
+	if s == "" || strings.Contains(s, "\\") {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.User == nil
+}
+
 func allLinksFromHTMLString(html, baseURL string) ([]string, error) {
 	return allLinksFromHTML(strings.NewReader(html), baseURL)
 }
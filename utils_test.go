@@ -43,6 +43,17 @@ func Test_isAbsoluteURL(t *testing.T) {
 	assert.False(t, isAbsoluteURL("/test"))
 }
 
+func Test_isLocalRedirect(t *testing.T) {
+	assert.True(t, isLocalRedirect("/comment?status=pending"))
+	assert.True(t, isLocalRedirect("."))
+	assert.True(t, isLocalRedirect("/webmention#mention-1"))
+	assert.False(t, isLocalRedirect(""))
+	assert.False(t, isLocalRedirect("https://evil.example/"))
+	assert.False(t, isLocalRedirect("//evil.example"))
+	assert.False(t, isLocalRedirect("/\\evil.example"))
+	assert.False(t, isLocalRedirect("javascript:alert(1)"))
+}
+
 func Test_wordCount(t *testing.T) {
 	assert.Equal(t, 3, wordCount("abc def abc"))
 }
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.goblog.app/app/pkgs/bufferpool"
+)
+
+const (
+	videoPosterParam       = "videoposter"
+	videoQueueName         = "video"
+	videoHlsSegmentSeconds = 6
+	defaultFFmpegPath      = "ffmpeg"
+)
+
+var defaultVideoHlsHeights = []int{360, 720}
+
+func init() {
+	// Not all systems know the types of videos and HLS files
+	for ext, mimeType := range map[string]string{
+		".mp4":  "video/mp4",
+		".m4v":  "video/mp4",
+		".mov":  "video/quicktime",
+		".webm": "video/webm",
+		".m3u8": "application/vnd.apple.mpegurl",
+		".ts":   "video/mp2t",
+	} {
+		_ = mime.AddExtensionType(ext, mimeType)
+	}
+}
+
+func isVideoMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/")
+}
+
+func (a *goBlog) videoHlsEnabled() bool {
+	if a.cfg.Micropub == nil {
+		return false
+	}
+	ms := a.cfg.Micropub.MediaStorage
+	return ms != nil && ms.VideoHLSEnabled
+}
+
+func (a *goBlog) videoHlsHeights() []int {
+	if ms := a.cfg.Micropub.MediaStorage; ms != nil && len(ms.VideoHLSHeights) > 0 {
+		return ms.VideoHLSHeights
+	}
+	return defaultVideoHlsHeights
+}
+
+func (a *goBlog) ffmpegPath() string {
+	if ms := a.cfg.Micropub.MediaStorage; ms != nil && ms.FFmpegPath != "" {
+		return ms.FFmpegPath
+	}
+	return defaultFFmpegPath
+}
+
+// Returns the names of the HLS master playlist and the poster image of a video
+func videoHlsNames(original string) (playlist, poster string) {
+	base := strings.TrimSuffix(original, filepath.Ext(original))
+	return base + ".m3u8", base + "-poster.jpg"
+}
+
+type videoJob struct {
+	Name string
+	Try  int
+}
+
+func (j *videoJob) encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(j)
+}
+
+func (a *goBlog) initVideoHls() {
+	if !a.videoHlsEnabled() {
+		return
+	}
+	a.listenOnQueue(videoQueueName, time.Minute, func(qi *queueItem, dequeue func(), reschedule func(time.Duration)) {
+		var j videoJob
+		if err := gob.NewDecoder(bytes.NewReader(qi.content)).Decode(&j); err != nil {
+			log.Println("video queue:", err.Error())
+			dequeue()
+			return
+		}
+		if err := a.processVideo(j.Name); err != nil {
+			log.Printf("processing video %s failed: %v", j.Name, err)
+			if j.Try++; j.Try < 5 {
+				// Try it again
+				buf := bufferpool.Get()
+				_ = j.encode(buf)
+				qi.content = buf.Bytes()
+				reschedule(time.Duration(j.Try) * 10 * time.Minute)
+				bufferpool.Put(buf)
+				return
+			}
+			log.Println("Processing video failed for the 5th time:", j.Name)
+		}
+		dequeue()
+	})
+	// Set the playlist for posts that use an already processed video
+	setPlaylist := func(p *post) {
+		if err := a.setPostVideoPlaylist(p.Path); err != nil {
+			log.Printf("setting video playlist for %s failed: %v", p.Path, err)
+		}
+	}
+	a.pPostHooks = append(a.pPostHooks, setPlaylist)
+	a.pUpdateHooks = append(a.pUpdateHooks, setPlaylist)
+}
+
+func (a *goBlog) queueVideoProcessing(name string) error {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+	if err := (&videoJob{Name: name}).encode(buf); err != nil {
+		return err
+	}
+	return a.enqueue(videoQueueName, buf.Bytes(), time.Now())
+}
+
+// Transcodes a video from the media storage into HLS renditions with a poster image,
+// saves them next to the video and sets the playlist on posts using the video
+func (a *goBlog) processVideo(name string) error {
+	if !a.mediaStorageEnabled() {
+		return errNoMediaStorageConfigured
+	}
+	dir, err := os.MkdirTemp("", "goblog-video-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// Get the original file
+	input := filepath.Join(dir, "input"+filepath.Ext(name))
+	if err = a.downloadMediaFile(name, input); err != nil {
+		return err
+	}
+	// Create the renditions
+	playlistName, posterName := videoHlsNames(name)
+	base := strings.TrimSuffix(playlistName, filepath.Ext(playlistName))
+	master := bufferpool.Get()
+	defer bufferpool.Put(master)
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	outputs := []string{}
+	for _, height := range a.videoHlsHeights() {
+		rendition := fmt.Sprintf("%s-%d.m3u8", base, height)
+		segmentPattern := fmt.Sprintf("%s-%d-%%03d.ts", base, height)
+		if err = a.runFFmpeg(dir,
+			"-i", input,
+			"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", height),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+			"-c:a", "aac", "-b:a", "128k", "-ac", "2",
+			"-f", "hls", "-hls_time", strconv.Itoa(videoHlsSegmentSeconds), "-hls_playlist_type", "vod",
+			"-hls_segment_filename", segmentPattern,
+			rendition,
+		); err != nil {
+			return err
+		}
+		segments, bandwidth, err := hlsRenditionInfo(dir, rendition)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, segments...)
+		outputs = append(outputs, rendition)
+		fmt.Fprintf(master, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n", bandwidth, rendition)
+	}
+	// Create the poster image
+	if err = a.runFFmpeg(dir, "-i", input, "-vf", "thumbnail,scale=-2:'min(720,ih)'", "-frames:v", "1", posterName); err != nil {
+		return err
+	}
+	outputs = append(outputs, posterName)
+	if err = os.WriteFile(filepath.Join(dir, playlistName), master.Bytes(), 0644); err != nil {
+		return err
+	}
+	// Save the master playlist last, it marks the video as processed
+	outputs = append(outputs, playlistName)
+	for _, output := range outputs {
+		if err = a.saveVideoFile(dir, output, name); err != nil {
+			return err
+		}
+	}
+	log.Println("Created HLS playlist for video:", name)
+	// Set the playlist on posts using the video
+	uses, err := a.db.postsUsingMediaFile(name)
+	if err != nil {
+		return err
+	}
+	for _, path := range uses[0] {
+		if err = a.setPostVideoPlaylist(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *goBlog) downloadMediaFile(name, path string) error {
+	src, err := a.mediaStorage.open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (a *goBlog) runFFmpeg(dir string, args ...string) error {
+	cmd := exec.Command(a.ffmpegPath(), append([]string{"-y", "-hide_banner", "-loglevel", "error"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (a *goBlog) saveVideoFile(dir, name, original string) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = a.saveMediaFile(name, f); err != nil {
+		return err
+	}
+	return a.db.saveMediaVariant(name, original, 0)
+}
+
+// Returns the segment files of a HLS rendition and its peak bandwidth in bits per second
+func hlsRenditionInfo(dir, rendition string) (segments []string, bandwidth int, err error) {
+	f, err := os.Open(filepath.Join(dir, rendition))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	duration := 0.0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if extinf, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			extinf, _, _ = strings.Cut(extinf, ",")
+			duration, _ = strconv.ParseFloat(extinf, 64)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, line))
+		if err != nil {
+			return nil, 0, err
+		}
+		segments = append(segments, line)
+		if duration > 0 {
+			if segmentBandwidth := int(math.Ceil(float64(fi.Size()*8) / duration)); segmentBandwidth > bandwidth {
+				bandwidth = segmentBandwidth
+			}
+		}
+		duration = 0
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(segments) == 0 {
+		return nil, 0, errors.New("no segments in HLS playlist")
+	}
+	return segments, bandwidth, nil
+}
+
+var mediaFileNameRegex = regexp.MustCompile(`[0-9a-fA-F]{64}\.[0-9a-zA-Z]+`)
+
+// Sets the HLS playlist and poster of the first processed video the post uses, if the post has no playlist yet.
+// The post is read again, so hooks running in parallel don't share the parameters and it's always the latest version.
+func (a *goBlog) setPostVideoPlaylist(path string) error {
+	p, err := a.getPost(path)
+	if errors.Is(err, errPostNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if p.hasVideoPlaylist() {
+		return nil
+	}
+	// Find media files used by the post
+	texts := []string{p.Content}
+	for _, values := range p.Parameters {
+		texts = append(texts, values...)
+	}
+	names := mediaFileNameRegex.FindAllString(strings.Join(texts, " "), -1)
+	if len(names) == 0 {
+		return nil
+	}
+	entries, err := a.db.getMediaEntries(names...)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		e, ok := entries[name]
+		if !ok || !isVideoMimeType(e.MimeType) {
+			continue
+		}
+		playlistName, posterName := videoHlsNames(name)
+		hlsEntries, err := a.db.getMediaEntries(playlistName, posterName)
+		if err != nil {
+			return err
+		}
+		if playlist, ok := hlsEntries[playlistName]; !ok || playlist.Original != name {
+			// Not processed yet
+			continue
+		}
+		if err = a.db.replacePostParam(p.Path, videoPlaylistParam, []string{a.getFullAddress(a.mediaFileLocation(playlistName))}); err != nil {
+			return err
+		}
+		if _, ok := hlsEntries[posterName]; ok {
+			if err = a.db.replacePostParam(p.Path, videoPosterParam, []string{a.getFullAddress(a.mediaFileLocation(posterName))}); err != nil {
+				return err
+			}
+		}
+		a.cache.purge()
+		return nil
+	}
+	return nil
+}
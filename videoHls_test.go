@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates the output files like ffmpeg would do
+const fakeFFmpeg = `#!/bin/sh
+for last; do :; done
+case "$last" in
+*.m3u8)
+	while [ "$1" != "-hls_segment_filename" ]; do shift; done
+	segment=$(printf "$2" 0)
+	printf 'segment' > "$segment"
+	printf '#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:2.000000,\n%s\n#EXT-X-ENDLIST\n' "$segment" > "$last"
+	;;
+*)
+	printf 'poster' > "$last"
+	;;
+esac
+`
+
+func Test_videoHls(t *testing.T) {
+	ffmpeg := filepath.Join(t.TempDir(), "ffmpeg")
+	require.NoError(t, os.WriteFile(ffmpeg, []byte(fakeFFmpeg), 0755))
+
+	app := &goBlog{
+		cfg: createDefaultTestConfig(t),
+	}
+	app.cfg.Micropub.MediaStorage = &configMicropubMedia{
+		VideoHLSEnabled: true,
+		VideoHLSHeights: []int{360},
+		FFmpegPath:      ffmpeg,
+	}
+	_ = app.initConfig(false)
+	_ = app.initCache()
+	app.initMarkdown()
+
+	mediaDir := t.TempDir()
+	app.mediaStorageInit.Do(func() {
+		app.mediaStorage = &localMediaStorage{path: mediaDir}
+		app.mediaStorageBackend = mediaStorageLocal
+	})
+
+	// Upload queues the video
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fileHeader := textproto.MIMEHeader{}
+	fileHeader.Set("Content-Disposition", `form-data; name="file"; filename="video.mp4"`)
+	fileHeader.Set(contentType, "video/mp4")
+	fw, err := mw.CreatePart(fileHeader)
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte("video"))
+	require.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "/micropub/media", body)
+	req.Header.Set(contentType, mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	addAllScopes(http.HandlerFunc(app.serveMicropubMedia)).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	name := filepath.Base(rec.Header().Get("Location"))
+	assert.True(t, strings.HasSuffix(name, ".mp4"))
+
+	qi, err := app.peekQueue(context.Background(), videoQueueName)
+	require.NoError(t, err)
+	require.NotNil(t, qi)
+
+	// The post uses the video
+	require.NoError(t, app.createPost(&post{
+		Path:       "/test",
+		Content:    "[Video](/m/" + name + ")",
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+	}))
+
+	// Process the video
+	require.NoError(t, app.processVideo(name))
+
+	base := strings.TrimSuffix(name, ".mp4")
+	for _, file := range []string{base + ".m3u8", base + "-360.m3u8", base + "-360-000.ts", base + "-poster.jpg"} {
+		assert.FileExists(t, filepath.Join(mediaDir, file))
+	}
+	master, err := os.ReadFile(filepath.Join(mediaDir, base+".m3u8"))
+	require.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=28\n"+base+"-360.m3u8\n", string(master))
+
+	// The HLS files are variants of the video
+	names, err := app.db.getMediaVariantNames(name)
+	require.NoError(t, err)
+	assert.Len(t, names, 4)
+
+	// The playlist and poster are set on the post
+	p, err := app.getPost("/test")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/m/"+base+".m3u8", p.firstParameter(videoPlaylistParam))
+	assert.Equal(t, "http://localhost:8080/m/"+base+"-poster.jpg", p.firstParameter(videoPosterParam))
+
+	// New posts using the processed video get the playlist as well
+	require.NoError(t, app.createPost(&post{
+		Path:       "/test2",
+		Content:    "[Video](/m/" + name + ")",
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+	}))
+	require.NoError(t, app.setPostVideoPlaylist("/test2"))
+	p, err = app.getPost("/test2")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/m/"+base+".m3u8", p.firstParameter(videoPlaylistParam))
+
+	// Deleting the video deletes the HLS files
+	require.NoError(t, app.deleteMediaFile(name))
+	files, err := os.ReadDir(mediaDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func Test_hlsRenditionInfo(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.ts"), make([]byte, 1000), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.ts"), make([]byte, 3000), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.m3u8"), []byte("#EXTM3U\n#EXTINF:4.0,\na.ts\n#EXTINF:6.0,Title\nb.ts\n#EXT-X-ENDLIST\n"), 0644))
+
+	segments, bandwidth, err := hlsRenditionInfo(dir, "a.m3u8")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.ts", "b.ts"}, segments)
+	assert.Equal(t, 4000, bandwidth)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.m3u8"), []byte("#EXTM3U\n#EXT-X-ENDLIST\n"), 0644))
+	_, _, err = hlsRenditionInfo(dir, "b.m3u8")
+	assert.Error(t, err)
+}
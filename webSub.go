@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/samber/lo"
+	"go.goblog.app/app/pkgs/bufferpool"
+	"go.goblog.app/app/pkgs/contenttype"
+)
+
+// Implement WebSub publishing and a built-in hub
+// https://www.w3.org/TR/websub/
+
+const (
+	webSubPath            = "/websub"
+	webSubQueueName       = "websub"
+	webSubVerifyQueueName = "websubverify"
+
+	webSubDefaultLease = 10 * 24 * time.Hour
+	webSubMinLease     = time.Hour
+	webSubMaxLease     = 30 * 24 * time.Hour
+	webSubMaxSecret    = 200
+)
+
+// All feed types that can be subscribed to
+var webSubFeedTypes = []feedType{rssFeed, atomFeed, jsonFeed, minRssFeed, minAtomFeed, minJsonFeed}
+
+func (a *goBlog) initWebSub() {
+	if !a.webSubEnabled() {
+		return
+	}
+	if !a.webSubExternalHub() {
+		// Verifications are processed one after another, so subscription requests can't make the hub send lots of requests at once
+		a.listenOnQueue(webSubVerifyQueueName, 10*time.Second, func(qi *queueItem, dequeue func(), reschedule func(time.Duration)) {
+			var v webSubVerification
+			if err := gob.NewDecoder(bytes.NewReader(qi.content)).Decode(&v); err != nil {
+				log.Println("websub verify queue:", err.Error())
+			} else if err := a.webSubVerify(&v); err != nil {
+				log.Printf("WebSub %s verification failed for %s: %v", v.Mode, v.Callback, err)
+			}
+			dequeue()
+		})
+		a.listenOnQueue(webSubQueueName, 30*time.Second, func(qi *queueItem, dequeue func(), reschedule func(time.Duration)) {
+			var d webSubDelivery
+			if err := gob.NewDecoder(bytes.NewReader(qi.content)).Decode(&d); err != nil {
+				log.Println("websub queue:", err.Error())
+				dequeue()
+				return
+			}
+			if err := a.webSubDeliver(d.Topic, d.Callback); err != nil {
+				if d.Try++; d.Try < 5 {
+					// Try it again
+					buf := bufferpool.Get()
+					_ = d.encode(buf)
+					qi.content = buf.Bytes()
+					reschedule(time.Duration(d.Try) * 10 * time.Minute)
+					bufferpool.Put(buf)
+					return
+				}
+				log.Println("WebSub delivery failed for the 5th time:", d.Callback, err.Error())
+			}
+			dequeue()
+		})
+		a.hourlyHooks = append(a.hourlyHooks, func() {
+			if err := a.db.webSubDeleteExpired(); err != nil {
+				log.Println("Failed to delete expired WebSub subscriptions:", err.Error())
+			}
+		})
+	}
+	// Add hooks
+	hook := func(p *post) {
+		a.webSubPublish(a.webSubTopics(p)...)
+	}
+	a.pPostHooks = append(a.pPostHooks, hook)
+	a.pUpdateHooks = append(a.pUpdateHooks, hook)
+	a.pDeleteHooks = append(a.pDeleteHooks, hook)
+	a.pUndeleteHooks = append(a.pUndeleteHooks, hook)
+}
+
+func (a *goBlog) webSubEnabled() bool {
+	// Check if private mode is enabled
+	if a.isPrivate() {
+		return false
+	}
+	// Check if WebSub is disabled
+	if wsc := a.cfg.WebSub; wsc == nil || !wsc.Enabled {
+		return false
+	}
+	return true
+}
+
+func (a *goBlog) webSubExternalHub() bool {
+	return a.cfg.WebSub != nil && a.cfg.WebSub.Hub != ""
+}
+
+// Returns the hub to advertise in feeds or an empty string if WebSub is disabled
+func (a *goBlog) webSubHub() string {
+	if !a.webSubEnabled() {
+		return ""
+	}
+	if a.webSubExternalHub() {
+		return a.cfg.WebSub.Hub
+	}
+	return a.getFullAddress(webSubPath)
+}
+
+func setWebSubLinkHeader(w http.ResponseWriter, hub, self string) {
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, hub))
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, self))
+}
+
+// Returns the feed URLs that change when the post changes (home, section and taxonomy values)
+func (a *goBlog) webSubTopics(p *post) []string {
+	if p.Status != statusPublished && p.Status != statusPublishedDeleted {
+		return nil
+	}
+	bc := a.getBlogFromPost(p)
+	if bc == nil {
+		return nil
+	}
+	paths, podcastPaths := []string{bc.getRelativePath("")}, []string{}
+	if p.Section != "" {
+		podcastPaths = append(podcastPaths, bc.getRelativePath(p.Section))
+	}
+	for _, tax := range bc.Taxonomies {
+		for _, value := range p.Parameters[tax.Name] {
+			if value != "" {
+				podcastPaths = append(podcastPaths, bc.getRelativePath(tax.Name+"/"+urlize(value)))
+			}
+		}
+	}
+	paths = append(paths, podcastPaths...)
+	topics := []string{}
+	for _, path := range lo.Uniq(paths) {
+		for _, ft := range webSubFeedTypes {
+			topics = append(topics, a.getFullAddress(path+"."+string(ft)))
+		}
+	}
+	if bc.podcastEnabled() {
+		for _, path := range lo.Uniq(podcastPaths) {
+			topics = append(topics, a.getFullAddress(path+"."+string(podcastFeed)))
+		}
+	}
+	return topics
+}
+
+// Notifies the hub about updated topics
+func (a *goBlog) webSubPublish(topics ...string) {
+	if !a.webSubEnabled() || len(topics) == 0 {
+		return
+	}
+	if a.webSubExternalHub() {
+		for _, topic := range topics {
+			err := requests.URL(a.cfg.WebSub.Hub).
+				Client(a.httpClient).
+				BodyForm(url.Values{"hub.mode": {"publish"}, "hub.url": {topic}}).
+				Fetch(context.Background())
+			if err != nil {
+				log.Println("Sending WebSub publish request failed:", err.Error())
+			}
+		}
+		return
+	}
+	for _, topic := range topics {
+		callbacks, err := a.db.webSubCallbacks(topic)
+		if err != nil {
+			log.Println("Failed to get WebSub subscriptions:", err.Error())
+			return
+		}
+		for _, callback := range callbacks {
+			buf := bufferpool.Get()
+			err = (&webSubDelivery{Topic: topic, Callback: callback}).encode(buf)
+			if err == nil {
+				err = a.enqueue(webSubQueueName, buf.Bytes(), time.Now())
+			}
+			bufferpool.Put(buf)
+			if err != nil {
+				log.Println("Failed to queue WebSub delivery:", err.Error())
+			}
+		}
+	}
+}
+
+// Hub endpoint for subscription requests
+func (a *goBlog) serveWebSubHub(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.serveError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, topic, callback, secret := r.Form.Get("hub.mode"), r.Form.Get("hub.topic"), r.Form.Get("hub.callback"), r.Form.Get("hub.secret")
+	if mode != "subscribe" && mode != "unsubscribe" {
+		a.serveError(w, r, "Unsupported hub.mode", http.StatusBadRequest)
+		return
+	}
+	if !a.isWebSubTopic(topic) {
+		a.serveError(w, r, "Unsupported hub.topic", http.StatusBadRequest)
+		return
+	}
+	if err := webSubCheckCallback(r.Context(), callback); err != nil {
+		a.serveError(w, r, "Invalid hub.callback", http.StatusBadRequest)
+		return
+	}
+	if len(secret) >= webSubMaxSecret {
+		a.serveError(w, r, "hub.secret too long", http.StatusBadRequest)
+		return
+	}
+	lease := webSubDefaultLease
+	if ls, err := strconv.Atoi(r.Form.Get("hub.lease_seconds")); err == nil && ls > 0 {
+		lease = time.Duration(ls) * time.Second
+		if lease < webSubMinLease {
+			lease = webSubMinLease
+		} else if lease > webSubMaxLease {
+			lease = webSubMaxLease
+		}
+	}
+	// Verify the intent of the subscriber asynchronously using the queue
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+	err := (&webSubVerification{Mode: mode, Topic: topic, Callback: callback, Secret: secret, Lease: lease}).encode(buf)
+	if err == nil {
+		err = a.enqueue(webSubVerifyQueueName, buf.Bytes(), time.Now())
+	}
+	if err != nil {
+		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *goBlog) isWebSubTopic(topic string) bool {
+	if !strings.HasPrefix(topic, a.getFullAddress("/")) {
+		return false
+	}
+	return lo.SomeBy(append([]feedType{podcastFeed}, webSubFeedTypes...), func(ft feedType) bool {
+		return strings.HasSuffix(topic, "."+string(ft))
+	})
+}
+
+// Returns an error if the callback isn't an http(s) URL of a public host, to reject obviously local callbacks early.
+// Verification and delivery use the public HTTP client, which checks the address again when connecting.
+func webSubCheckCallback(ctx context.Context, callback string) error {
+	cu, err := url.Parse(callback)
+	if err != nil || (cu.Scheme != "http" && cu.Scheme != "https") || cu.Hostname() == "" {
+		return errors.New("invalid callback url")
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, cu.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip.IP) {
+			return errors.New("callback host isn't public")
+		}
+	}
+	return nil
+}
+
+type webSubVerification struct {
+	Mode, Topic, Callback, Secret string
+	Lease                         time.Duration
+}
+
+func (v *webSubVerification) encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func (a *goBlog) webSubVerify(v *webSubVerification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	challenge := randomString(32)
+	var response string
+	err := requests.URL(v.Callback).
+		Client(a.publicHttpClient).
+		Param("hub.mode", v.Mode).
+		Param("hub.topic", v.Topic).
+		Param("hub.challenge", challenge).
+		Param("hub.lease_seconds", strconv.Itoa(int(v.Lease.Seconds()))).
+		ToString(&response).
+		Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if response != challenge {
+		return errors.New("challenge not echoed")
+	}
+	if v.Mode == "unsubscribe" {
+		return a.db.webSubUnsubscribe(v.Topic, v.Callback)
+	}
+	if err = a.db.webSubSubscribe(v.Topic, v.Callback, v.Secret, time.Now().Add(v.Lease)); err != nil {
+		return err
+	}
+	log.Println("New WebSub subscription for", v.Topic)
+	return nil
+}
+
+type webSubDelivery struct {
+	Topic, Callback string
+	Try             int
+}
+
+func (d *webSubDelivery) encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(d)
+}
+
+// Sends the current content of the topic to the subscriber
+func (a *goBlog) webSubDeliver(topic, callback string) error {
+	secret, ok, err := a.db.webSubSecret(topic, callback)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Unsubscribed or expired in the meantime
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// Get the topic content
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, topic, nil)
+	if err != nil {
+		return err
+	}
+	res, err := doHandlerRequest(req, a.d)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("topic returned status %d", res.StatusCode)
+	}
+	// Send the content
+	rb := requests.URL(callback).
+		Client(a.publicHttpClient).
+		BodyBytes(body).
+		ContentType(defaultIfEmpty(res.Header.Get(contentType), contenttype.XML)).
+		Header("Link", fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, a.webSubHub(), topic))
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write(body)
+		rb.Header("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	err = rb.Fetch(ctx)
+	if requests.HasStatusErr(err, http.StatusGone) {
+		// The subscriber doesn't want updates anymore
+		return a.db.webSubUnsubscribe(topic, callback)
+	}
+	return err
+}
+
+func (db *database) webSubSubscribe(topic, callback, secret string, expires time.Time) error {
+	_, err := db.Exec(
+		"insert or replace into websub_subscriptions (topic, callback, secret, expires) values (@topic, @callback, @secret, @expires)",
+		sql.Named("topic", topic),
+		sql.Named("callback", callback),
+		sql.Named("secret", secret),
+		sql.Named("expires", expires.UTC().Format(time.RFC3339)),
+	)
+	return err
+}
+
+func (db *database) webSubUnsubscribe(topic, callback string) error {
+	_, err := db.Exec(
+		"delete from websub_subscriptions where topic = @topic and callback = @callback",
+		sql.Named("topic", topic),
+		sql.Named("callback", callback),
+	)
+	return err
+}
+
+func (db *database) webSubCallbacks(topic string) ([]string, error) {
+	rows, err := db.Query(
+		"select callback from websub_subscriptions where topic = @topic and expires > @now",
+		sql.Named("topic", topic),
+		sql.Named("now", time.Now().UTC().Format(time.RFC3339)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	callbacks := []string{}
+	for rows.Next() {
+		var callback string
+		if err = rows.Scan(&callback); err != nil {
+			return nil, err
+		}
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks, rows.Err()
+}
+
+func (db *database) webSubSecret(topic, callback string) (secret string, ok bool, err error) {
+	row, err := db.QueryRow(
+		"select secret from websub_subscriptions where topic = @topic and callback = @callback and expires > @now",
+		sql.Named("topic", topic),
+		sql.Named("callback", callback),
+		sql.Named("now", time.Now().UTC().Format(time.RFC3339)),
+	)
+	if err != nil {
+		return "", false, err
+	}
+	if err = row.Scan(&secret); errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+func (db *database) webSubDeleteExpired() error {
+	_, err := db.Exec(
+		"delete from websub_subscriptions where expires <= @now",
+		sql.Named("now", time.Now().UTC().Format(time.RFC3339)),
+	)
+	return err
+}
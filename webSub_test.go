@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_webSub(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient:       fc.Client,
+		publicHttpClient: fc.Client,
+		cfg:              createDefaultTestConfig(t),
+	}
+	app.cfg.WebSub = &configWebSub{Enabled: true}
+
+	_ = app.initConfig(false)
+	app.initMarkdown()
+	_ = app.initTemplateStrings()
+	_ = app.initCache()
+	app.initSessions()
+
+	app.d = app.buildRouter()
+	handlerClient := newHandlerClient(app.d)
+
+	const (
+		hub      = "http://localhost:8080/websub"
+		topic    = "http://localhost:8080/posts.rss"
+		callback = "https://93.184.215.14/callback"
+		secret   = "secret"
+	)
+
+	// Feeds advertise the hub
+	headers := http.Header{}
+	var rss string
+	err := requests.URL(topic).Client(handlerClient).CopyHeaders(headers).ToString(&rss).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{`<` + hub + `>; rel="hub"`, `<` + topic + `>; rel="self"`}, headers.Values("Link"))
+	assert.Contains(t, rss, `<atom:link href="`+hub+`" rel="hub"/>`)
+	assert.Contains(t, rss, `<atom:link href="`+topic+`" rel="self" type="application/rss+xml"/>`)
+
+	var atom string
+	err = requests.URL("http://localhost:8080/posts.atom").Client(handlerClient).ToString(&atom).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, atom, `<link href="http://localhost:8080/posts"/><link href="http://localhost:8080/posts.atom" rel="self" type="application/atom+xml"/><link href="`+hub+`" rel="hub"/>`)
+
+	var jsonFeed string
+	err = requests.URL("http://localhost:8080/posts.json").Client(handlerClient).ToString(&jsonFeed).Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, jsonFeed, `"hubs":[{"type":"WebSub","url":"`+hub+`"}]`)
+	assert.Contains(t, jsonFeed, `"feed_url":"http://localhost:8080/posts.json"`)
+
+	// Subscribe
+	var mu sync.Mutex
+	var verification url.Values
+	var delivered *http.Request
+	var deliveredBody []byte
+	deliveryStatus := http.StatusOK
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet {
+			verification = r.URL.Query()
+			_, _ = io.WriteString(w, verification.Get("hub.challenge"))
+			return
+		}
+		delivered = r
+		deliveredBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(deliveryStatus)
+	}))
+
+	subscribe := func(values url.Values) int {
+		var status int
+		_ = requests.URL(hub).Client(handlerClient).BodyForm(values).
+			AddValidator(nil).
+			Handle(func(r *http.Response) error {
+				status = r.StatusCode
+				return r.Body.Close()
+			}).
+			Fetch(context.Background())
+		return status
+	}
+
+	assert.Equal(t, http.StatusBadRequest, subscribe(url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://example.org/feed.rss"}, "hub.callback": {callback}}))
+	assert.Equal(t, http.StatusBadRequest, subscribe(url.Values{"hub.mode": {"subscribe"}, "hub.topic": {topic}, "hub.callback": {"ftp://subscriber.example"}}))
+	// Callbacks in the local network are rejected
+	for _, local := range []string{"http://localhost/callback", "http://127.0.0.1:8080/callback", "http://[::1]/callback", "http://192.168.1.1/callback", "http://169.254.169.254/latest", "http://100.64.0.1/callback"} {
+		assert.Equal(t, http.StatusBadRequest, subscribe(url.Values{"hub.mode": {"subscribe"}, "hub.topic": {topic}, "hub.callback": {local}}), local)
+	}
+
+	status := subscribe(url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {callback},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {"60"},
+	})
+	assert.Equal(t, http.StatusAccepted, status)
+	// The verification is queued
+	qi, err := app.peekQueue(context.Background(), webSubVerifyQueueName)
+	require.NoError(t, err)
+	require.NotNil(t, qi)
+	var v webSubVerification
+	require.NoError(t, gob.NewDecoder(bytes.NewReader(qi.content)).Decode(&v))
+	require.NoError(t, app.webSubVerify(&v))
+	callbacks, err := app.db.webSubCallbacks(topic)
+	require.NoError(t, err)
+	assert.Equal(t, []string{callback}, callbacks)
+	mu.Lock()
+	assert.Equal(t, "subscribe", verification.Get("hub.mode"))
+	assert.Equal(t, topic, verification.Get("hub.topic"))
+	// Lease is at least one hour
+	assert.Equal(t, "3600", verification.Get("hub.lease_seconds"))
+	mu.Unlock()
+
+	// Publishing a post queues the delivery
+	p := &post{
+		Path:       "/test",
+		Section:    "posts",
+		Status:     statusPublished,
+		Visibility: visibilityPublic,
+		Parameters: map[string][]string{"tags": {"Go Lang"}},
+		Content:    "Test",
+	}
+	require.NoError(t, app.createPost(p))
+	topics := app.webSubTopics(p)
+	assert.Contains(t, topics, "http://localhost:8080/.rss")
+	assert.Contains(t, topics, topic)
+	assert.Contains(t, topics, "http://localhost:8080/tags/go-lang.min.json")
+	assert.Empty(t, app.webSubTopics(&post{Path: "/draft", Section: "posts", Status: statusDraft}))
+
+	app.webSubPublish(topics...)
+	qi, err = app.peekQueue(context.Background(), webSubQueueName)
+	require.NoError(t, err)
+	require.NotNil(t, qi)
+
+	// Deliver the content
+	require.NoError(t, app.webSubDeliver(topic, callback))
+	mu.Lock()
+	require.NotNil(t, delivered)
+	assert.Equal(t, http.MethodPost, delivered.Method)
+	assert.Contains(t, delivered.Header.Get(contentType), "application/rss+xml")
+	assert.Equal(t, `<`+hub+`>; rel="hub", <`+topic+`>; rel="self"`, delivered.Header.Get("Link"))
+	assert.Contains(t, string(deliveredBody), "http://localhost:8080/test")
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(deliveredBody)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), delivered.Header.Get("X-Hub-Signature"))
+	deliveryStatus = http.StatusGone
+	mu.Unlock()
+
+	// Subscribers can stop the delivery with 410 Gone
+	require.NoError(t, app.webSubDeliver(topic, callback))
+	callbacks, err = app.db.webSubCallbacks(topic)
+	require.NoError(t, err)
+	assert.Empty(t, callbacks)
+}
+
+func Test_webSubExternalHub(t *testing.T) {
+	fc := newFakeHttpClient()
+
+	app := &goBlog{
+		httpClient: fc.Client,
+		cfg:        createDefaultTestConfig(t),
+	}
+	app.cfg.WebSub = &configWebSub{Enabled: true, Hub: "https://hub.example/"}
+
+	_ = app.initConfig(false)
+
+	assert.Equal(t, "https://hub.example/", app.webSubHub())
+
+	fc.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	app.webSubPublish("http://localhost:8080/posts.rss")
+	require.NotNil(t, fc.req)
+	assert.Equal(t, http.MethodPost, fc.req.Method)
+	assert.Equal(t, "https://hub.example/", fc.req.URL.String())
+	require.NoError(t, fc.req.ParseForm())
+	assert.Equal(t, "publish", fc.req.Form.Get("hub.mode"))
+	assert.Equal(t, "http://localhost:8080/posts.rss", fc.req.Form.Get("hub.url"))
+}
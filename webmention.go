@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -17,6 +18,7 @@ type webmentionStatus string
 const (
 	webmentionStatusVerified webmentionStatus = "verified"
 	webmentionStatusApproved webmentionStatus = "approved"
+	webmentionStatusSpam     webmentionStatus = "spam"
 
 	webmentionPath = "/webmention"
 )
@@ -47,6 +49,10 @@ func (a *goBlog) initWebmention() {
 	a.pUndeleteHooks = append(a.pUndeleteHooks, hookFunc)
 	// Start verifier
 	a.initWebmentionQueue()
+	// Resolve the posts of webmentions from before the post column existed
+	if err := a.setWebmentionPosts(); err != nil {
+		log.Println("Failed to set posts of webmentions:", err.Error())
+	}
 }
 
 func (a *goBlog) handleWebmention(w http.ResponseWriter, r *http.Request) {
@@ -160,7 +166,8 @@ func (db *database) updateWebmention(m *mention, newStatus webmentionStatus) err
 				status = @status,
 				title = @title,
 				content = @content,
-				author = @author
+				author = @author,
+				post = null
 			where
 				lowerunescaped(source) in (lowerunescaped(@source), lowerunescaped(@newsource2))
 				and lowerunescaped(target) in (lowerunescaped(@target), lowerunescaped(@newtarget2))
@@ -180,6 +187,64 @@ func (db *database) updateWebmention(m *mention, newStatus webmentionStatus) err
 	return err
 }
 
+// Stores the path of the post that new or updated webmentions belong to, so interactions can be queried using an index
+func (a *goBlog) setWebmentionPosts() error {
+	rows, err := a.db.Query("select id, target from webmentions where post is null")
+	if err != nil {
+		return err
+	}
+	targets := map[int]string{}
+	for rows.Next() {
+		var id int
+		var target string
+		if err = rows.Scan(&id, &target); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		targets[id] = target
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for id, target := range targets {
+		path, err := a.webmentionPostPath(target)
+		if err != nil {
+			return err
+		}
+		if _, err = a.db.Exec("update webmentions set post = @post where id = @id", sql.Named("post", path), sql.Named("id", id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the path of the post the (lowercase and unescaped) target belongs to or an empty string.
+// Threaded replies target a comment and belong to the post of the comment.
+func (a *goBlog) webmentionPostPath(target string) (string, error) {
+	var row *sql.Row
+	var err error
+	if _, id, ok := a.localCommentID(target); ok {
+		row, err = a.db.QueryRow("select target from comments where id = @id", sql.Named("id", id))
+	} else if path, ok := strings.CutPrefix(target, lowerUnescapedPath(a.cfg.Server.PublicAddress)); ok {
+		// Most paths are lowercase already, only compare all paths if there's no exact match
+		row, err = a.db.QueryRow(
+			"select path from posts where path = @path union all select path from posts where lowerunescaped(path) = @path limit 1",
+			sql.Named("path", defaultIfEmpty(path, "/")),
+		)
+	} else {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var path string
+	if err = row.Scan(&path); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return path, nil
+}
+
 func (db *database) deleteWebmentionId(id int) error {
 	_, err := db.Exec("delete from webmentions where id = @id", sql.Named("id", id))
 	return err
@@ -202,7 +267,11 @@ func (db *database) deleteWebmention(m *mention) error {
 }
 
 func (db *database) approveWebmentionId(id int) error {
-	_, err := db.Exec("update webmentions set status = ? where id = ?", webmentionStatusApproved, id)
+	return db.setWebmentionStatusId(id, webmentionStatusApproved)
+}
+
+func (db *database) setWebmentionStatusId(id int, status webmentionStatus) error {
+	_, err := db.Exec("update webmentions set status = ? where id = ?", status, id)
 	return err
 }
 
@@ -228,8 +297,12 @@ type webmentionsRequestConfig struct {
 	asc           bool
 	offset, limit int
 	submentions   bool
+	depth         int // Depth of the submentions
 }
 
+// Maximum depth of nested submentions (e.g. replies to comments)
+const maxSubmentionsDepth = 5
+
 func buildWebmentionsQuery(config *webmentionsRequestConfig) (query string, args []any) {
 	queryBuilder := builderpool.Get()
 	defer builderpool.Put(queryBuilder)
@@ -285,7 +358,8 @@ func (db *database) getWebmentions(config *webmentionsRequestConfig) ([]*mention
 		if config.submentions {
 			m.Submentions, err = db.getWebmentions(&webmentionsRequestConfig{
 				target:      m.Source,
-				submentions: false, // prevent infinite recursion
+				submentions: config.depth+1 < maxSubmentionsDepth, // prevent infinite recursion
+				depth:       config.depth + 1,
 				asc:         config.asc,
 				status:      config.status,
 			})
@@ -45,6 +45,8 @@ func (a *goBlog) webmentionAdmin(w http.ResponseWriter, r *http.Request) {
 		status = webmentionStatusVerified
 	case webmentionStatusApproved:
 		status = webmentionStatusApproved
+	case webmentionStatusSpam:
+		status = webmentionStatusSpam
 	}
 	sourcelike := r.URL.Query().Get("source")
 	p := paginator.New(&webmentionPaginationAdapter{config: &webmentionsRequestConfig{
@@ -109,7 +111,7 @@ func (a *goBlog) webmentionAdmin(w http.ResponseWriter, r *http.Request) {
 
 func (a *goBlog) webmentionAdminAction(w http.ResponseWriter, r *http.Request) {
 	action := chi.URLParam(r, "action")
-	if action != "delete" && action != "approve" && action != "reverify" {
+	if action != "delete" && action != "approve" && action != "reverify" && action != "spam" {
 		a.serveError(w, r, "Invalid action", http.StatusBadRequest)
 		return
 	}
@@ -122,7 +124,11 @@ func (a *goBlog) webmentionAdminAction(w http.ResponseWriter, r *http.Request) {
 	case "delete":
 		err = a.db.deleteWebmentionId(id)
 	case "approve":
+		a.webmentionSpamLearn(id, false)
 		err = a.db.approveWebmentionId(id)
+	case "spam":
+		a.webmentionSpamLearn(id, true)
+		err = a.db.setWebmentionStatusId(id, webmentionStatusSpam)
 	case "reverify":
 		err = a.reverifyWebmentionId(id)
 	}
@@ -130,7 +136,7 @@ func (a *goBlog) webmentionAdminAction(w http.ResponseWriter, r *http.Request) {
 		a.serveError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if action == "delete" || action == "approve" {
+	if action != "reverify" {
 		a.cache.purge()
 	}
 	redirectTo := r.FormValue("redir")
@@ -139,3 +145,14 @@ func (a *goBlog) webmentionAdminAction(w http.ResponseWriter, r *http.Request) {
 	}
 	http.Redirect(w, r, redirectTo, http.StatusFound)
 }
+
+func (a *goBlog) webmentionSpamLearn(id int, spam bool) {
+	if !a.spamFilterEnabled() {
+		return
+	}
+	mentions, err := a.db.getWebmentions(&webmentionsRequestConfig{id: id, limit: 1})
+	if err != nil || len(mentions) < 1 {
+		return
+	}
+	a.spamLearn(fmt.Sprintf("webmention:%d", id), webmentionSpamText(mentions[0]), spam)
+}
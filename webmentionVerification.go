@@ -114,6 +114,12 @@ func (a *goBlog) verifyMention(m *mention) error {
 		return a.db.deleteWebmention(m)
 	}
 	newStatus := webmentionStatusVerified
+	if source := defaultIfEmpty(m.NewSource, m.Source); a.isModeratedLocalComment(source) {
+		// Comment was already approved using the moderation
+		newStatus = webmentionStatusApproved
+	} else if _, _, local := a.localCommentID(source); !local && a.isSpam(webmentionSpamText(m), "") {
+		newStatus = webmentionStatusSpam
+	}
 	// Update or insert webmention
 	if a.db.webmentionExists(m) {
 		if a.cfg.Debug {
@@ -135,9 +141,16 @@ func (a *goBlog) verifyMention(m *mention) error {
 		if err != nil {
 			return err
 		}
-		a.sendNotification(fmt.Sprintf("New webmention from %s to %s", defaultIfEmpty(m.NewSource, m.Source), defaultIfEmpty(m.NewTarget, m.Target)))
+		if newStatus != webmentionStatusSpam {
+			a.sendNotification(fmt.Sprintf("New webmention from %s to %s", defaultIfEmpty(m.NewSource, m.Source), defaultIfEmpty(m.NewTarget, m.Target)))
+		}
 	}
-	return err
+	return a.setWebmentionPosts()
+}
+
+// Returns the text of a webmention that is used for the spam filter
+func webmentionSpamText(m *mention) string {
+	return strings.Join([]string{defaultIfEmpty(m.NewSource, m.Source), m.Author, m.Title, m.Content}, " ")
 }
 
 func (a *goBlog) verifyReader(m *mention, body io.Reader) error {